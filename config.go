@@ -23,6 +23,7 @@ import (
 	"github.com/blugelabs/bluge/index"
 	"github.com/blugelabs/bluge/search"
 	"github.com/blugelabs/bluge/search/similarity"
+	segment "github.com/blugelabs/bluge_segment_api"
 )
 
 type Config struct {
@@ -34,8 +35,13 @@ type Config struct {
 	DefaultSimilarity     search.Similarity
 	PerFieldSimilarity    map[string]search.Similarity
 
+	// boosts of the fields, set by WithFieldBoost
+	fieldBoosts map[string]float64
+
 	SearchStartFunc func(size uint64) error
 	SearchEndFunc   func(size uint64)
+
+	parallelSegmentSearch bool
 }
 
 // WithVirtualField allows you to describe a field that
@@ -48,6 +54,147 @@ func (config Config) WithVirtualField(field Field) Config {
 	return config
 }
 
+// WithoutVirtualField removes all the virtual fields with the given name.
+func (config Config) WithoutVirtualField(name string) Config {
+	config.indexConfig = config.indexConfig.WithoutVirtualField(name)
+	return config
+}
+
+// WithVirtualFieldReplace describes a virtual field like WithVirtualField,
+// but replaces any virtual fields previously described with the same name.
+func (config Config) WithVirtualFieldReplace(field Field) Config {
+	_ = field.Analyze(0)
+	config.indexConfig = config.indexConfig.WithVirtualFieldReplace(field)
+	return config
+}
+
+// WithComputedVirtualField computes a field from each document as
+// it is analyzed, the returned field should be named name.  Unlike
+// the fields described with WithVirtualField, the computed field is
+// physically indexed with the document, so it is preserved as-is
+// when segments are merged.  Computed fields are not included in
+// composite fields.  The function may return nil to add no field.
+func (config Config) WithComputedVirtualField(name string, fn func(doc *Document) Field) Config {
+	config.indexConfig = config.indexConfig.WithComputedVirtualField(name,
+		func(doc segment.Document) segment.Field {
+			d, ok := doc.(*Document)
+			if !ok {
+				return nil
+			}
+			field := fn(d)
+			if field == nil {
+				return nil
+			}
+			_ = field.Analyze(0)
+			return field
+		})
+	return config
+}
+
+// SegmentPlugins returns the segment types and versions
+// supported by this config, ordered by type and then version.
+func (config Config) SegmentPlugins() []index.SegmentPluginInfo {
+	return config.indexConfig.SegmentPlugins()
+}
+
+// SupportsSegment reports whether this config is able
+// to read segments of the given type and version.
+func (config Config) SupportsSegment(segType string, version uint32) bool {
+	return config.indexConfig.SupportsSegment(segType, version)
+}
+
+// WithSynchronousAnalysis analyzes documents in the goroutine calling
+// Batch, in the order they were added, instead of using analysis
+// workers.  This is slower, but deterministic, which is useful
+// when testing custom analyzers.
+func (config Config) WithSynchronousAnalysis() Config {
+	config.indexConfig = config.indexConfig.WithSynchronousAnalysis()
+	return config
+}
+
+// NewSharedAnalysisPool starts a pool of analysis workers
+// which may be shared by several indexes, see WithAnalysisPool,
+// when workers is not positive one is started per CPU.
+// The caller owns the pool, and must Close it once every
+// Writer using it has been closed.
+func NewSharedAnalysisPool(workers int) *index.AnalysisPool {
+	return index.NewSharedAnalysisPool(workers)
+}
+
+// WithAnalysisPool shares the analysis workers of the pool with
+// other indexes, instead of starting workers for this index.
+// The pool must outlive every Writer opened with this config.
+func (config Config) WithAnalysisPool(pool *index.AnalysisPool) Config {
+	config.indexConfig = config.indexConfig.WithAnalysisPool(pool)
+	return config
+}
+
+// WithTokenObserver calls observer with the tokens produced by
+// analyzing each field as documents are indexed, which is useful when
+// debugging analysis.  The observer may be called concurrently by the
+// analysis workers, and must not modify the tokens.  Fields computed
+// with WithComputedVirtualField are not observed.
+func (config Config) WithTokenObserver(observer func(field string, tokens analysis.TokenStream)) Config {
+	if observer == nil {
+		config.indexConfig = config.indexConfig.WithAnalyzeFunc(nil)
+		return config
+	}
+	config.indexConfig = config.indexConfig.WithAnalyzeFunc(func(doc segment.Document) {
+		if d, ok := doc.(*Document); ok {
+			d.analyze(observer)
+			return
+		}
+		doc.Analyze()
+	})
+	return config
+}
+
+// WithMaxBatchBytes automatically flushes a batch whose stored
+// and doc values bytes exceed max, so that large batches need not
+// be split by the caller.  Each flush introduces and persists a
+// segment, so a batch larger than max is not applied atomically.
+func (config Config) WithMaxBatchBytes(max int) Config {
+	config.indexConfig = config.indexConfig.WithMaxBatchBytes(max)
+	return config
+}
+
+// WithUnsafeBatches lets batches return once applied, before they are
+// persisted, they are searchable at once, but may be lost should the
+// process exit before the persister catches up with them.
+func (config Config) WithUnsafeBatches() Config {
+	config.indexConfig = config.indexConfig.WithUnsafeBatches()
+	return config
+}
+
+// WithBatchCallback calls f once each batch has been persisted, with
+// the number of documents it indexed, the bytes of the segments built
+// and how long it took, such as to report the progress of a bulk load.
+// It is called from the goroutine persisting the batch, so keep it
+// cheap.  Safe or unsafe, it is called once the batch is persisted,
+// which for unsafe batches is after Batch has returned.
+func (config Config) WithBatchCallback(f func(index.BatchStats)) Config {
+	config.indexConfig = config.indexConfig.WithBatchCallback(f)
+	return config
+}
+
+// WithMemoryPressureFunc lets an external signal, such as the memory
+// usage of a container, tell the persister it is under memory pressure,
+// in place of the count of paused threads.  The function is called
+// each time the persister wakes to persist a snapshot, so keep it cheap.
+func (config Config) WithMemoryPressureFunc(f func() bool) Config {
+	config.indexConfig = config.indexConfig.WithMemoryPressureFunc(f)
+	return config
+}
+
+// WithMergeWindow defers large segment merges while inWindow
+// returns false, such as during peak hours, so they do not
+// compete with searches for resources.  Merges of small
+// segments continue, to keep the number of segments in check.
+func (config Config) WithMergeWindow(inWindow func() bool) Config {
+	config.indexConfig = config.indexConfig.WithMergeWindow(inWindow)
+	return config
+}
+
 func (config Config) WithSegmentType(typ string) Config {
 	config.indexConfig = config.indexConfig.WithSegmentType(typ)
 	return config
@@ -73,11 +220,149 @@ func (config Config) DisableOptimizeDisjunctionUnadorned() Config {
 	return config
 }
 
+// WithDisjunctionUnadornedMinCardinality sets the number of documents
+// the most frequent term of a disjunction which does not need scores
+// must be in, in every segment, for its terms to be combined into a
+// single bitmap, by default 256.  A negative or zero minimum always
+// combines them.
+func (config Config) WithDisjunctionUnadornedMinCardinality(n int) Config {
+	config.indexConfig = config.indexConfig.WithDisjunctionUnadornedMinCardinality(n)
+	return config
+}
+
+// DisableOptimizeDisjunction stops scored disjunctions of more than
+// searcher.DisjunctionHeapTakeover clauses from merging their clauses
+// with a heap, instead checking every clause for every match.  The
+// heap helps when each match satisfies few of the many clauses, such
+// as those of fuzzy, prefix and wildcard queries, but not when most
+// of the clauses match the same documents, where it is about a quarter
+// slower.  It is enabled by default as disjunctions of that many
+// clauses mostly come from those term expanding queries, and large
+// disjunctions always used the heap before it could be disabled.
+func (config Config) DisableOptimizeDisjunction() Config {
+	config.indexConfig = config.indexConfig.DisableOptimizeDisjunction()
+	return config
+}
+
+// WithNormCalc overrides the function used to compute the
+// norm value stored for each indexed field, by default the
+// norm is computed by the Similarity configured for the field.
+func (config Config) WithNormCalc(calc func(field string, numTerms int) float32) Config {
+	config.indexConfig = config.indexConfig.WithNormCalc(calc)
+	return config
+}
+
+// WithFieldNormCalc overrides the function used to compute the
+// norm value stored for the named field, taking precedence over
+// the function configured with WithNormCalc.
+func (config Config) WithFieldNormCalc(field string, calc func(numTerms int) float32) Config {
+	config.indexConfig = config.indexConfig.WithFieldNormCalc(field, calc)
+	return config
+}
+
+// ConstantNorm returns a NormCalc function which stores
+// the same norm value v for every field, regardless of
+// the number of terms it contains.  The value is
+// interpreted by the Similarity used at search time.
+func ConstantNorm(v float32) func(field string, numTerms int) float32 {
+	return func(string, int) float32 {
+		return v
+	}
+}
+
+// DisableNorms returns a NormCalc function which disables
+// length normalization entirely, every field is scored
+// as if it contained exactly one term.
+func DisableNorms() func(field string, numTerms int) float32 {
+	return ConstantNorm(similarity.NewBM25Similarity().ComputeNorm(1))
+}
+
+// WithSimilarity scores fields without a similarity of their own in
+// PerFieldSimilarity with sim, in place of BM25.  The norms stored for
+// fields are computed by sim from then on, replacing any function set
+// by WithNormCalc, so set that afterwards to override them.  As norms
+// are stored when documents are indexed, the similarity of an existing
+// index should only be changed for one which computes norms the same.
+func (config Config) WithSimilarity(sim search.Similarity) Config {
+	config.DefaultSimilarity = sim
+	config.indexConfig = config.indexConfig.WithNormCalc(similarityNormCalc(sim, config.PerFieldSimilarity))
+	return config
+}
+
+// similarityNormCalc returns a NormCalc function computing the norm
+// of each field with its similarity, or else the default similarity
+func similarityNormCalc(defaultSimilarity search.Similarity,
+	perFieldSimilarity map[string]search.Similarity) func(field string, numTerms int) float32 {
+	return func(field string, length int) float32 {
+		if pfs, ok := perFieldSimilarity[field]; ok {
+			return pfs.ComputeNorm(length)
+		}
+		return defaultSimilarity.ComputeNorm(length)
+	}
+}
+
+// WithFieldBoost multiplies the scores of matches of the field by
+// boost, such as to let matches of a title count for more than those
+// of a body, without changing the queries.  It multiplies the boost
+// of each query of the field, so composes with them, a query boosted
+// by 2 of a field boosted by 3 scores as a query boosted by 6.  The
+// boost applies when searching, rather than being stored with the
+// norms when indexing, which hold the length of the field, so it may
+// be changed for an existing index, and is independent of NormCalc.
+func (config Config) WithFieldBoost(field string, boost float64) Config {
+	fieldBoosts := make(map[string]float64, len(config.fieldBoosts)+1)
+	for f, b := range config.fieldBoosts {
+		fieldBoosts[f] = b
+	}
+	fieldBoosts[field] = boost
+	config.fieldBoosts = fieldBoosts
+	return config
+}
+
+// WithBM25Params scores fields without a similarity of their own using
+// BM25 with the parameters k1 and b, in place of the defaults, 1.2 and
+// 0.75.  k1, usually between 1.2 and 2, controls how quickly the score
+// saturates as a term occurs more often in a field, higher values give
+// more weight to repeated terms, 0 scores every match as though the
+// term occurred once.  b, between 0 and 1, controls how much the length
+// of the field counts against it, 0 ignores the length, 1 normalizes
+// it fully.  Values outside these ranges are clamped to them.  The
+// norms stored at index time do not depend on the parameters, so they
+// may be changed for an existing index.
+func (config Config) WithBM25Params(k1, b float64) Config {
+	if k1 < 0 {
+		k1 = 0
+	}
+	if b < 0 {
+		b = 0
+	} else if b > 1 {
+		b = 1
+	}
+	config.DefaultSimilarity = similarity.NewBM25SimilarityBK1(b, k1)
+	return config
+}
+
 func (config Config) WithSearchStartFunc(f func(size uint64) error) Config {
 	config.SearchStartFunc = f
 	return config
 }
 
+// WithParallelSegmentSearch runs the searcher of each segment of
+// the index in its own goroutine.  Only the segment searchers run in
+// parallel, collection stays serial, a single collector consumes the
+// matches in index order, so the results are identical to those of
+// searching the segments in turn.  Each segment may get a thousand
+// matches ahead of the collector, using more memory when explaining
+// scores or including locations.  It can reduce the latency of
+// expensive queries on indexes of several segments when cores are idle,
+// but on a single core it is slower, about a fifth slower for an index
+// of 8 segments in BenchmarkParallelSegmentSearch, and allocates nearly
+// twice as much, so it is not enabled by default.
+func (config Config) WithParallelSegmentSearch() Config {
+	config.parallelSegmentSearch = true
+	return config
+}
+
 func DefaultConfig(path string) Config {
 	indexConfig := index.DefaultConfig(path)
 	return defaultConfig(indexConfig)
@@ -109,12 +394,7 @@ func defaultConfig(indexConfig index.Config) Config {
 	allDocsFields := NewKeywordField("", "")
 	_ = allDocsFields.Analyze(0)
 	indexConfig = indexConfig.WithVirtualField(allDocsFields)
-	indexConfig = indexConfig.WithNormCalc(func(field string, length int) float32 {
-		if pfs, ok := rv.PerFieldSimilarity[field]; ok {
-			return pfs.ComputeNorm(length)
-		}
-		return rv.DefaultSimilarity.ComputeNorm(length)
-	})
+	indexConfig = indexConfig.WithNormCalc(similarityNormCalc(rv.DefaultSimilarity, rv.PerFieldSimilarity))
 	rv.indexConfig = indexConfig
 
 	return rv
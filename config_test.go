@@ -0,0 +1,483 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bluge
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blugelabs/bluge/analysis"
+	segment "github.com/blugelabs/bluge_segment_api"
+)
+
+func scoresByID(t *testing.T, r *Reader, q Query) map[string]float64 {
+	dmi, err := r.Search(context.Background(), NewTopNSearch(100, q))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rv := map[string]float64{}
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		var id string
+		err = next.VisitStoredFields(func(field string, value []byte) bool {
+			if field == _idField {
+				id = string(value)
+			}
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rv[id] = next.Score
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rv
+}
+
+func TestDisableNorms(t *testing.T) {
+	for _, test := range []struct {
+		config    Config
+		sameScore bool
+	}{
+		{
+			config:    InMemoryOnlyConfig(),
+			sameScore: false,
+		},
+		{
+			config:    InMemoryOnlyConfig().WithNormCalc(DisableNorms()),
+			sameScore: true,
+		},
+	} {
+		writer, err := OpenWriter(test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch := NewBatch()
+		for i, id := range []string{"short", "medium", "long"} {
+			doc := NewDocument(id).
+				AddField(NewTextField("desc", "match"+strings.Repeat(" other", i*5)))
+			batch.Update(doc.ID(), doc)
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := writer.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		scores := scoresByID(t, reader, NewTermQuery("match").SetField("desc"))
+		if len(scores) != 3 {
+			t.Fatalf("expected 3 matches, got %d", len(scores))
+		}
+		same := scores["short"] == scores["medium"] && scores["medium"] == scores["long"]
+		if same != test.sameScore {
+			t.Errorf("expected same scores %t, got %v", test.sameScore, scores)
+		}
+
+		err = reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFieldNormCalc(t *testing.T) {
+	disabled := DisableNorms()
+	base := InMemoryOnlyConfig()
+	config := base.
+		WithFieldNormCalc("title", func(numTerms int) float32 {
+			return disabled("title", numTerms)
+		})
+
+	for _, test := range []struct {
+		config    Config
+		field     string
+		sameScore bool
+	}{
+		{
+			config:    config,
+			field:     "body",
+			sameScore: false,
+		},
+		{
+			config:    config,
+			field:     "title",
+			sameScore: true,
+		},
+		// the config derived from is unchanged
+		{
+			config:    base,
+			field:     "title",
+			sameScore: false,
+		},
+	} {
+		writer, err := OpenWriter(test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch := NewBatch()
+		for i, id := range []string{"short", "medium", "long"} {
+			text := "match" + strings.Repeat(" other", i*5)
+			doc := NewDocument(id).
+				AddField(NewTextField("body", text)).
+				AddField(NewTextField("title", text))
+			batch.Update(doc.ID(), doc)
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := writer.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		scores := scoresByID(t, reader, NewTermQuery("match").SetField(test.field))
+		if len(scores) != 3 {
+			t.Fatalf("expected 3 matches, got %d", len(scores))
+		}
+		same := scores["short"] == scores["medium"] && scores["medium"] == scores["long"]
+		if same != test.sameScore {
+			t.Errorf("expected same scores %t for field %s, got %v", test.sameScore, test.field, scores)
+		}
+
+		err = reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVirtualFieldReplace(t *testing.T) {
+	base := InMemoryOnlyConfig().
+		WithVirtualField(NewKeywordField("tenant", "acme"))
+
+	for _, test := range []struct {
+		config Config
+		expect map[string]int
+	}{
+		{
+			config: base,
+			expect: map[string]int{"acme": 2, "globex": 0},
+		},
+		{
+			config: base.WithVirtualFieldReplace(NewKeywordField("tenant", "globex")),
+			expect: map[string]int{"acme": 0, "globex": 2},
+		},
+		{
+			config: base.WithoutVirtualField("tenant"),
+			expect: map[string]int{"acme": 0, "globex": 0},
+		},
+	} {
+		writer, err := OpenWriter(test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch := NewBatch()
+		for _, id := range []string{"a", "b"} {
+			doc := NewDocument(id)
+			batch.Update(doc.ID(), doc)
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := writer.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for tenant, count := range test.expect {
+			scores := scoresByID(t, reader, NewTermQuery(tenant).SetField("tenant"))
+			if len(scores) != count {
+				t.Errorf("expected %d matches for tenant %s, got %d", count, tenant, len(scores))
+			}
+		}
+
+		err = reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestComputedVirtualField(t *testing.T) {
+	config := InMemoryOnlyConfig().
+		WithComputedVirtualField("tenant_shard", func(doc *Document) Field {
+			var shard string
+			doc.EachField(func(field segment.Field) {
+				if field.Name() == "tenant" {
+					shard = "shard-" + string(field.Value()[:1])
+				}
+			})
+			if shard == "" {
+				return nil
+			}
+			return NewKeywordField("tenant_shard", shard)
+		})
+	writer, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := NewBatch()
+	for id, tenant := range map[string]string{"a": "acme", "b": "globex", "c": "acme"} {
+		doc := NewDocument(id).
+			AddField(NewKeywordField("tenant", tenant))
+		batch.Update(doc.ID(), doc)
+	}
+	doc := NewDocument("d")
+	batch.Update(doc.ID(), doc)
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for shard, count := range map[string]int{"shard-a": 2, "shard-g": 1} {
+		scores := scoresByID(t, reader, NewTermQuery(shard).SetField("tenant_shard"))
+		if len(scores) != count {
+			t.Errorf("expected %d matches for %s, got %d", count, shard, len(scores))
+		}
+	}
+
+	err = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedAnalysisPool(t *testing.T) {
+	pool := NewSharedAnalysisPool(2)
+	defer pool.Close()
+
+	var writers []*Writer
+	for i := 0; i < 2; i++ {
+		writer, err := OpenWriter(InMemoryOnlyConfig().WithAnalysisPool(pool))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writers = append(writers, writer)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(writers))
+	for _, writer := range writers {
+		wg.Add(1)
+		go func(writer *Writer) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				batch := NewBatch()
+				for j := 0; j < 5; j++ {
+					doc := NewDocument(strconv.Itoa(i*5 + j)).
+						AddField(NewTextField("desc", "shared analysis"))
+					batch.Update(doc.ID(), doc)
+				}
+				if err := writer.Batch(batch); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(writer)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// closing one writer leaves the pool usable by the other
+	err := writers[0].Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writers[1].Insert(NewDocument("last").AddField(NewTextField("desc", "after close")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := writers[1].Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := reader.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 101 {
+		t.Errorf("expected 101 documents, got %d", count)
+	}
+	err = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writers[1].Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// closing the pool more than once is safe
+	pool.Close()
+}
+
+func TestSharedAnalysisPoolDefaultWorkers(t *testing.T) {
+	for _, workers := range []int{0, -1} {
+		pool := NewSharedAnalysisPool(workers)
+		writer, err := OpenWriter(InMemoryOnlyConfig().WithAnalysisPool(pool))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			done <- writer.Insert(NewDocument("a").AddField(NewTextField("desc", "analyzed")))
+		}()
+		select {
+		case err = <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("expected a pool of %d workers to analyze the document", workers)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.Close()
+	}
+}
+
+// recordingAnalyzer records the order in which values are analyzed
+type recordingAnalyzer struct {
+	analyzed []string
+}
+
+func (r *recordingAnalyzer) Analyze(input []byte) analysis.TokenStream {
+	r.analyzed = append(r.analyzed, string(input))
+	return analysis.TokenStream{
+		&analysis.Token{
+			Term:         input,
+			End:          len(input),
+			PositionIncr: 1,
+		},
+	}
+}
+
+func TestSynchronousAnalysis(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig().WithSynchronousAnalysis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &recordingAnalyzer{}
+	var expect []string
+	batch := NewBatch()
+	for i := 0; i < 50; i++ {
+		value := fmt.Sprintf("value-%d", i)
+		expect = append(expect, value)
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewTextField("desc", value).WithAnalyzer(recorder))
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recorder.analyzed, expect) {
+		t.Errorf("expected documents analyzed in order %v, got %v", expect, recorder.analyzed)
+	}
+
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores := scoresByID(t, reader, NewTermQuery("value-7").SetField("desc"))
+	if _, ok := scores["7"]; !ok || len(scores) != 1 {
+		t.Errorf("expected only document 7 to match, got %v", scores)
+	}
+	err = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenObserver(t *testing.T) {
+	var mu sync.Mutex
+	observed := map[string][]string{}
+	config := InMemoryOnlyConfig().WithTokenObserver(func(field string, tokens analysis.TokenStream) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, token := range tokens {
+			observed[field] = append(observed[field], string(token.Term))
+		}
+	})
+	writer, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := NewDocument("1").
+		AddField(NewTextField("title", "The Quick Brown Fox")).
+		AddField(NewKeywordField("color", "Red"))
+	err = writer.Update(doc.ID(), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string][]string{
+		_idField: {"1"},
+		"title":  {"the", "quick", "brown", "fox"},
+		"color":  {"Red"},
+	}
+	if !reflect.DeepEqual(observed, expect) {
+		t.Errorf("expected observed tokens %v, got %v", expect, observed)
+	}
+}
@@ -0,0 +1,318 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bluge
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/blugelabs/bluge/search"
+	"github.com/blugelabs/bluge/search/searcher"
+	segment "github.com/blugelabs/bluge_segment_api"
+)
+
+// FieldDictionary iterates the terms of the field in sorted order, each
+// with the number of live documents using it, combined across segments.
+// Unlike DictionaryIterator, deleted documents are not counted, and terms
+// only they use are skipped, at the cost of reading the postings of
+// each term.
+func (r *Reader) FieldDictionary(field string) (segment.DictionaryIterator, error) {
+	return r.reader.LiveDictionaryIterator(field, nil, nil, nil)
+}
+
+// FieldDictionaryRange is like FieldDictionary, but only iterates the
+// terms from start, inclusive, to end, exclusive, either may be nil
+// to leave that side of the range unbounded
+func (r *Reader) FieldDictionaryRange(field string, start, end []byte) (segment.DictionaryIterator, error) {
+	return r.reader.LiveDictionaryIterator(field, nil, start, end)
+}
+
+// prefixEnd returns the first term after every term starting
+// with the prefix, or nil if there is no such term
+func prefixEnd(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			rv := make([]byte, i+1)
+			copy(rv, prefix)
+			rv[i]++
+			return rv
+		}
+	}
+	return nil
+}
+
+// FuzzyTerms returns the terms of the field within maxEdits edits of
+// term, in order, for building queries.  An edit inserts, deletes or
+// substitutes a rune, or transposes two adjacent runes.  The terms are
+// found by intersecting a Levenshtein automaton with the dictionary of
+// each segment, so the cost depends on the number of terms close to
+// term, not the size of the dictionary.  maxEdits may be at most
+// searcher.MaxFuzziness, which is 2, and the length of term is not
+// limited.  Terms only used by deleted documents may be included.
+func (r *Reader) FuzzyTerms(field, term string, maxEdits int) ([]string, error) {
+	return searcher.FuzzyTerms(r.reader, term, maxEdits, field)
+}
+
+// Suggestion is a correction of a term, with the number of edits
+// from the term, and the number of live documents using it
+type Suggestion struct {
+	Term  string
+	Edits int
+	Count uint64
+}
+
+// SuggestSpelling suggests corrections of term from the terms of the
+// field within maxEdits edits of it, which must be 1 or 2, at most limit
+// of them, or all of them if limit is 0.  The corrections with the fewest
+// edits come first, then those used by the most live documents, then in
+// term order.  Terms used by fewer live documents than term itself are
+// not suggested, so a misspelling only yields terms at least as common,
+// and a term no document uses yields any term within maxEdits.  The
+// terms are found as they are by FuzzyTerms, but the live documents of
+// each are counted, at the cost of reading its postings.
+func (r *Reader) SuggestSpelling(field, term string, maxEdits, limit int) ([]Suggestion, error) {
+	automaton, edits, err := searcher.FuzzyAutomaton(term, maxEdits)
+	if err != nil {
+		return nil, err
+	}
+	itr, err := r.reader.LiveDictionaryIterator(field, automaton, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = itr.Close()
+	}()
+
+	var termCount uint64
+	var rv []Suggestion
+	entry, err := itr.Next()
+	for err == nil && entry != nil {
+		if entry.Term() == term {
+			termCount = entry.Count()
+		} else {
+			rv = append(rv, Suggestion{
+				Term:  entry.Term(),
+				Edits: edits(entry.Term()),
+				Count: entry.Count(),
+			})
+		}
+		entry, err = itr.Next()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the term is only known once the terms before it are seen
+	n := 0
+	for _, s := range rv {
+		if s.Count >= termCount {
+			rv[n] = s
+			n++
+		}
+	}
+	rv = rv[:n]
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].Edits != rv[j].Edits {
+			return rv[i].Edits < rv[j].Edits
+		}
+		if rv[i].Count != rv[j].Count {
+			return rv[i].Count > rv[j].Count
+		}
+		return rv[i].Term < rv[j].Term
+	})
+	if limit > 0 && len(rv) > limit {
+		rv = rv[:limit]
+	}
+	return rv, nil
+}
+
+// TermCount is a term and the number of live documents using it
+type TermCount struct {
+	Term  string
+	Count uint64
+}
+
+// FieldDictionaryPrefix returns the terms of the field starting with
+// the prefix which are used by the most live documents, at most limit
+// of them, ordered by the number of documents descending, and then by
+// term.  Only limit terms are held while the terms with the prefix are
+// read, which suits autocomplete.  A limit of 0 returns every term.
+func (r *Reader) FieldDictionaryPrefix(field, prefix string, limit int) ([]TermCount, error) {
+	start := []byte(prefix)
+	itr, err := r.reader.LiveDictionaryIterator(field, nil, start, prefixEnd(start))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = itr.Close()
+	}()
+
+	var top termCountHeap
+	entry, err := itr.Next()
+	for err == nil && entry != nil {
+		tc := TermCount{Term: entry.Term(), Count: entry.Count()}
+		if limit <= 0 || len(top) < limit {
+			heap.Push(&top, tc)
+		} else if top.less(top[0], tc) {
+			top[0] = tc
+			heap.Fix(&top, 0)
+		}
+		entry, err = itr.Next()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rv := []TermCount(top)
+	sort.Slice(rv, func(i, j int) bool {
+		return top.less(rv[j], rv[i])
+	})
+	return rv, nil
+}
+
+// WeightedSuggestion is a completion of a prefix, with its weight,
+// and the number of live documents using it
+type WeightedSuggestion struct {
+	Term   string
+	Weight float64
+	Count  uint64
+}
+
+// suggestCandidatesFactor controls how many more completions than
+// requested are weighed by Suggest, the completions used by the most
+// live documents, weighing more reduces the chance of missing a rare
+// but heavy completion, at the cost of reading more postings
+const suggestCandidatesFactor = 8
+
+// Suggest completes the prefix from the terms of the field, ordering the
+// completions by weight, at most limit of them, or all of them if limit
+// is 0.  The weights come from weightField, a numeric field of the same
+// documents indexed with Sortable or Aggregatable, such as the
+// popularity of each document; the weight of a completion is the
+// greatest weight of the live documents using it, and documents without
+// a weight count as 0, so a completion only used by documents with
+// negative weights has a negative weight, unless one has no weight.
+// Completions with the same weight are ordered by the number of live
+// documents using them descending, then by term, so a rare but popular
+// completion comes before a common unpopular one, even the prefix itself.
+// Weighing a completion reads its postings, so only the 8*limit
+// completions used by the most live documents are weighed, a rarer
+// completion is not suggested however heavy.  With a limit of 0 every
+// completion is weighed, so short prefixes of large dictionaries are
+// costly.
+func (r *Reader) Suggest(field, weightField, prefix string, limit int) ([]WeightedSuggestion, error) {
+	terms, err := r.FieldDictionaryPrefix(field, prefix, limit*suggestCandidatesFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]WeightedSuggestion, 0, len(terms))
+	for _, tc := range terms {
+		weight, err := r.termWeight(field, tc.Term, weightField)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, WeightedSuggestion{
+			Term:   tc.Term,
+			Weight: weight,
+			Count:  tc.Count,
+		})
+	}
+
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].Weight != rv[j].Weight {
+			return rv[i].Weight > rv[j].Weight
+		}
+		if rv[i].Count != rv[j].Count {
+			return rv[i].Count > rv[j].Count
+		}
+		return rv[i].Term < rv[j].Term
+	})
+	if limit > 0 && len(rv) > limit {
+		rv = rv[:limit]
+	}
+	return rv, nil
+}
+
+// termWeight returns the greatest value of weightField of the
+// live documents using the term, those without one counting as 0
+func (r *Reader) termWeight(field, term, weightField string) (float64, error) {
+	searcher, err := NewTermQuery(term).SetField(field).
+		Searcher(r.reader, searchOptionsFromConfig(r.config, SearchOptions{
+			Score: "none",
+		}))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = searcher.Close()
+	}()
+	searchContext := search.NewSearchContext(searcher.DocumentMatchPoolSize(), 0)
+	fields := []string{weightField}
+	source := search.Field(weightField)
+
+	var rv float64
+	var found bool
+	next, err := searcher.Next(searchContext)
+	for err == nil && next != nil {
+		err = next.LoadDocumentValues(searchContext, fields)
+		if err != nil {
+			return 0, err
+		}
+		weights := source.Numbers(next)
+		if len(weights) == 0 {
+			weights = []float64{0}
+		}
+		for _, weight := range weights {
+			if !found || weight > rv {
+				rv = weight
+				found = true
+			}
+		}
+		searchContext.DocumentMatchPool.Put(next)
+		next, err = searcher.Next(searchContext)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return rv, nil
+}
+
+// termCountHeap holds the most frequent terms seen, least frequent first
+type termCountHeap []TermCount
+
+// less orders by count, and terms with the same count in reverse,
+// so that earlier terms are preferred when the limit is reached
+func (h termCountHeap) less(a, b TermCount) bool {
+	if a.Count != b.Count {
+		return a.Count < b.Count
+	}
+	return a.Term > b.Term
+}
+
+func (h termCountHeap) Len() int           { return len(h) }
+func (h termCountHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h termCountHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *termCountHeap) Push(x interface{}) {
+	*h = append(*h, x.(TermCount))
+}
+
+func (h *termCountHeap) Pop() interface{} {
+	old := *h
+	rv := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return rv
+}
@@ -15,6 +15,7 @@
 package bluge
 
 import (
+	"github.com/blugelabs/bluge/analysis"
 	segment "github.com/blugelabs/bluge_segment_api"
 )
 
@@ -73,6 +74,12 @@ type FieldConsumer interface {
 }
 
 func (d Document) Analyze() {
+	d.analyze(nil)
+}
+
+// analyze analyzes the document, passing the tokens produced for
+// each TermField to the observer, when one is provided
+func (d Document) analyze(observer func(field string, tokens analysis.TokenStream)) {
 	fieldOffsets := map[string]int{}
 	for _, field := range d.fields {
 		if !field.Index() {
@@ -82,7 +89,12 @@ func (d Document) Analyze() {
 		if fieldOffset > 0 {
 			fieldOffset += field.PositionIncrementGap()
 		}
-		lastPos := field.Analyze(fieldOffset)
+		var lastPos int
+		if termField, ok := field.(*TermField); ok && observer != nil {
+			lastPos = termField.analyze(fieldOffset, observer)
+		} else {
+			lastPos = field.Analyze(fieldOffset)
+		}
 		fieldOffsets[field.Name()] = lastPos
 
 		// see if any of the composite fields need this
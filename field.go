@@ -34,6 +34,8 @@ const (
 	HighlightMatches
 	Sortable
 	Aggregatable
+	TermPositionsOnly
+	TermOffsetsOnly
 )
 
 func (o FieldOptions) Index() bool {
@@ -45,7 +47,19 @@ func (o FieldOptions) Store() bool {
 }
 
 func (o FieldOptions) IncludeLocations() bool {
-	return o&SearchTermPositions != 0 || o&HighlightMatches != 0
+	return o.IncludePositions() || o.IncludeOffsets()
+}
+
+// IncludePositions reports whether term positions are indexed,
+// positions are required to search phrases
+func (o FieldOptions) IncludePositions() bool {
+	return o&(SearchTermPositions|HighlightMatches|TermPositionsOnly) != 0
+}
+
+// IncludeOffsets reports whether term start and end offsets
+// are indexed, offsets are required to highlight matches
+func (o FieldOptions) IncludeOffsets() bool {
+	return o&(SearchTermPositions|HighlightMatches|TermOffsetsOnly) != 0
 }
 
 func (o FieldOptions) IndexDocValues() bool {
@@ -134,6 +148,22 @@ func (b *TermField) HighlightMatches() *TermField {
 	return b
 }
 
+// TermPositionsOnly indexes term positions, but not offsets,
+// supporting phrase search without the cost of highlighting
+func (b *TermField) TermPositionsOnly() *TermField {
+	b.FieldOptions |= TermPositionsOnly
+	return b
+}
+
+// TermOffsetsOnly indexes term offsets, but not positions,
+// supporting highlighting without the cost of phrase search,
+// phrase queries of more than one term on this field fail
+// with searcher.ErrNoTermPositions
+func (b *TermField) TermOffsetsOnly() *TermField {
+	b.FieldOptions |= TermOffsetsOnly
+	return b
+}
+
 func (b *TermField) EachTerm(vt segment.VisitTerm) {
 	for _, v := range b.analyzedTokenFreqs {
 		vt(v)
@@ -162,6 +192,10 @@ func (b *TermField) WithAnalyzer(fieldAnalyzer Analyzer) *TermField {
 }
 
 func (b *TermField) Analyze(startOffset int) (lastPos int) {
+	return b.analyze(startOffset, nil)
+}
+
+func (b *TermField) analyze(startOffset int, observer func(string, analysis.TokenStream)) (lastPos int) {
 	var tokens analysis.TokenStream
 	if b.analyzer != nil {
 		bytesToAnalyze := b.Value()
@@ -175,11 +209,37 @@ func (b *TermField) Analyze(startOffset int) (lastPos int) {
 	} else {
 		tokens = b.baseAnalayze(analysis.AlphaNumeric)
 	}
+	if observer != nil {
+		observer(b.name, tokens)
+	}
 	b.analyzedLength = len(tokens) // number of tokens in this doc field
 	b.analyzedTokenFreqs, lastPos = analysis.TokenFrequency(tokens, b.IncludeLocations(), startOffset)
+	b.omitLocationDetails()
 	return lastPos
 }
 
+// omitLocationDetails zeroes the parts of each term location
+// not requested by the field options.  The segment format records
+// the position, start and end of every location, so they are still
+// written, as zeros, which take the least space a value can.
+func (b *TermField) omitLocationDetails() {
+	positions, offsets := b.IncludePositions(), b.IncludeOffsets()
+	if positions == offsets {
+		return
+	}
+	for _, tf := range b.analyzedTokenFreqs {
+		for _, location := range tf.Locations {
+			if !positions {
+				location.PositionVal = 0
+			}
+			if !offsets {
+				location.StartVal = 0
+				location.EndVal = 0
+			}
+		}
+	}
+}
+
 const defaultTextIndexingOptions = Index
 
 type Analyzer interface {
@@ -234,3 +234,43 @@ func TestGeoPointField(t *testing.T) {
 		t.Errorf("expected 9 token freqs, got %d", len(tokenFreqs))
 	}
 }
+
+func TestTermPositionsAndOffsetsOnly(t *testing.T) {
+	tests := []struct {
+		field       *TermField
+		wantPos     bool
+		wantOffsets bool
+	}{
+		{
+			field:       NewTextField("desc", "quick brown fox").SearchTermPositions(),
+			wantPos:     true,
+			wantOffsets: true,
+		},
+		{
+			field:       NewTextField("desc", "quick brown fox").TermPositionsOnly(),
+			wantPos:     true,
+			wantOffsets: false,
+		},
+		{
+			field:       NewTextField("desc", "quick brown fox").TermOffsetsOnly(),
+			wantPos:     false,
+			wantOffsets: true,
+		},
+	}
+
+	for _, test := range tests {
+		_ = test.field.Analyze(0)
+		for term, tf := range test.field.AnalyzedTokenFrequencies() {
+			if len(tf.Locations) != 1 {
+				t.Fatalf("expected 1 location for %s, got %d", term, len(tf.Locations))
+			}
+			loc := tf.Locations[0]
+			if gotPos := loc.Pos() != 0; gotPos != test.wantPos {
+				t.Errorf("expected positions %t for %s, got position %d", test.wantPos, term, loc.Pos())
+			}
+			if gotOffsets := loc.End() != 0; gotOffsets != test.wantOffsets {
+				t.Errorf("expected offsets %t for %s, got %d-%d", test.wantOffsets, term, loc.Start(), loc.End())
+			}
+		}
+	}
+}
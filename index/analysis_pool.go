@@ -0,0 +1,65 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"runtime"
+	"sync"
+)
+
+// AnalysisPool is a set of analysis workers which can be
+// shared by the Writers of many indexes, instead of each
+// Writer starting its own workers.
+//
+// The pool is owned by the caller which created it, Writers
+// attached to the pool never stop its workers.  Close must be
+// called only after every Writer using the pool has been closed,
+// as a batch submitted to a closed pool will never complete.
+type AnalysisPool struct {
+	analysisChan chan func()
+	closeCh      chan struct{}
+	closeOnce    sync.Once
+	workers      sync.WaitGroup
+}
+
+// NewSharedAnalysisPool starts an AnalysisPool with the
+// requested number of analysis workers, or one per CPU
+// available to Go when workers is not positive
+func NewSharedAnalysisPool(workers int) *AnalysisPool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	rv := &AnalysisPool{
+		analysisChan: make(chan func()),
+		closeCh:      make(chan struct{}),
+	}
+	rv.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer rv.workers.Done()
+			analysisWorker(rv.analysisChan, rv.closeCh)
+		}()
+	}
+	return rv
+}
+
+// Close stops the workers of the pool and waits for them to
+// exit, calling Close more than once has no further effect
+func (p *AnalysisPool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.closeCh)
+	})
+	p.workers.Wait()
+}
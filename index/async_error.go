@@ -0,0 +1,56 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import "fmt"
+
+// AsyncPhase identifies the background work of the Writer which failed
+type AsyncPhase int
+
+// Phases of the background work reported by AsyncError
+const (
+	AsyncPhasePersist AsyncPhase = iota + 1 // persisting a snapshot
+	AsyncPhaseMerge                         // merging persisted segments
+	AsyncPhaseCleanup                       // removing files no longer needed
+)
+
+func (p AsyncPhase) String() string {
+	switch p {
+	case AsyncPhasePersist:
+		return "persist"
+	case AsyncPhaseMerge:
+		return "merge"
+	case AsyncPhaseCleanup:
+		return "cleanup"
+	}
+	return fmt.Sprintf("AsyncPhase(%d)", int(p))
+}
+
+// AsyncError is passed to the Config AsyncError callback when
+// background work of the Writer fails, identifying the phase
+// which failed.  Errors introducing a batch are not reported
+// asynchronously, they are returned by Batch.
+type AsyncError struct {
+	Phase AsyncPhase
+	Err   error
+}
+
+func (e *AsyncError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Phase, e.Err)
+}
+
+func (e *AsyncError) Unwrap() error {
+	return e.Err
+}
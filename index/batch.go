@@ -16,33 +16,101 @@ package index
 
 import segment "github.com/blugelabs/bluge_segment_api"
 
+// Batch records a sequence of inserts, updates and deletes
+// which are applied atomically by the Writer.
+// When several inserts, updates or deletes in the same batch
+// refer to the same id, the last operation recorded wins,
+// inserts are identified by the ID method of the document.
 type Batch struct {
 	documents         []segment.Document
 	ids               []segment.Term
 	persistedCallback func(error)
+
+	// position in documents of the last insert or update for each id
+	updated map[string]int
+	removed int
 }
 
 func NewBatch() *Batch {
 	return &Batch{}
 }
 
+// identifiedDocument is a document which knows its id
+type identifiedDocument interface {
+	ID() segment.Term
+}
+
 func (b *Batch) Insert(doc segment.Document) {
+	if idDoc, ok := doc.(identifiedDocument); ok {
+		if id := idDoc.ID(); id != nil {
+			b.forget(id)
+			b.remember(id)
+		}
+	}
 	b.documents = append(b.documents, doc)
 }
 
 func (b *Batch) Update(id segment.Term, doc segment.Document) {
+	b.forget(id)
+	b.remember(id)
 	b.documents = append(b.documents, doc)
 	b.ids = append(b.ids, id)
 }
 
 func (b *Batch) Delete(id segment.Term) {
+	b.forget(id)
 	b.ids = append(b.ids, id)
 }
 
+// remember records that the next document added is the last for id
+func (b *Batch) remember(id segment.Term) {
+	if b.updated == nil {
+		b.updated = make(map[string]int)
+	}
+	b.updated[batchKey(id)] = len(b.documents)
+}
+
+// forget removes the document from any earlier insert or
+// update of this id, so that it is superseded by the next operation
+func (b *Batch) forget(id segment.Term) {
+	key := batchKey(id)
+	if pos, ok := b.updated[key]; ok {
+		b.documents[pos] = nil
+		b.removed++
+		delete(b.updated, key)
+	}
+}
+
+// compact removes the superseded documents, it must be
+// called before the documents are handed to the segment
+func (b *Batch) compact() {
+	if b.removed == 0 {
+		return
+	}
+	docs := b.documents[:0]
+	for _, doc := range b.documents {
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+	for i := len(docs); i < len(b.documents); i++ {
+		b.documents[i] = nil
+	}
+	b.documents = docs
+	b.updated = nil
+	b.removed = 0
+}
+
+func batchKey(id segment.Term) string {
+	return id.Field() + "\xff" + string(id.Term())
+}
+
 func (b *Batch) Reset() {
 	b.documents = b.documents[:0]
 	b.ids = b.ids[:0]
 	b.persistedCallback = nil
+	b.updated = nil
+	b.removed = 0
 }
 
 func (b *Batch) SetPersistedCallback(f func(error)) {
@@ -52,3 +120,38 @@ func (b *Batch) SetPersistedCallback(f func(error)) {
 func (b *Batch) PersistedCallback() func(error) {
 	return b.persistedCallback
 }
+
+// documentBytes approximates the stored field and
+// document value bytes the document adds to a segment
+func documentBytes(doc segment.Document) int {
+	var rv int
+	doc.EachField(func(field segment.Field) {
+		if field.Store() {
+			rv += len(field.Name()) + len(field.Value())
+		}
+		if field.IndexDocValues() {
+			field.EachTerm(func(term segment.FieldTerm) {
+				rv += len(term.Term())
+			})
+		}
+	})
+	return rv
+}
+
+// splitDocumentsByBytes splits the documents into consecutive chunks,
+// starting a new chunk when adding a document would exceed maxBytes,
+// every chunk holds at least one document, and at least one chunk
+// is returned
+func splitDocumentsByBytes(documents []segment.Document, maxBytes int) [][]segment.Document {
+	var rv [][]segment.Document
+	var start, size int
+	for i, doc := range documents {
+		docSize := documentBytes(doc)
+		if i > start && size+docSize > maxBytes {
+			rv = append(rv, documents[start:i])
+			start, size = i, 0
+		}
+		size += docSize
+	}
+	return append(rv, documents[start:])
+}
@@ -0,0 +1,59 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"sort"
+
+	segment "github.com/blugelabs/bluge_segment_api"
+)
+
+// computedDocument adds the computed fields to the
+// fields of the document being indexed
+type computedDocument struct {
+	segment.Document
+	computed []segment.Field
+}
+
+func (d *computedDocument) EachField(vf segment.VisitField) {
+	d.Document.EachField(vf)
+	for _, field := range d.computed {
+		vf(field)
+	}
+}
+
+// withComputedFields returns the document with the computed fields
+// added, it must be called after the document has been analyzed
+func (config Config) withComputedFields(doc segment.Document) segment.Document {
+	if len(config.computedFields) == 0 {
+		return doc
+	}
+	names := make([]string, 0, len(config.computedFields))
+	for name := range config.computedFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rv := &computedDocument{
+		Document: doc,
+	}
+	for _, name := range names {
+		field := config.computedFields[name](doc)
+		if field != nil {
+			rv.computed = append(rv.computed, field)
+		}
+	}
+	return rv
+}
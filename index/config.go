@@ -40,8 +40,26 @@ type Config struct {
 	DirectoryFunc      func() Directory
 	NormCalc           func(string, int) float32
 
+	// BatchCallback, when set, is called once each batch is persisted,
+	// safe or unsafe, from the goroutine persisting it, so it must not
+	// block.  For unsafe batches this is after Batch has returned.
+	// Batches applied concurrently may be reported in any order.
+	BatchCallback func(BatchStats)
+
+	// AnalyzeFunc, when set, is called to analyze each document
+	// in place of the document's own Analyze method
+	AnalyzeFunc func(doc segment.Document)
+
 	MergeBufferSize int
 
+	// MaxBatchBytes limits the approximate size of the stored field
+	// and document value bytes introduced as a single segment, a
+	// batch exceeding it is split into several segments, each of
+	// which is persisted before the next is introduced.  A batch
+	// which is split is no longer applied atomically.
+	// The default, 0, does not limit the size of a batch.
+	MaxBatchBytes int
+
 	// Time filter
 	FilterTimeMin int64
 	FilterTimeMax int64
@@ -50,6 +68,13 @@ type Config struct {
 	OptimizeConjunction          bool
 	OptimizeConjunctionUnadorned bool
 	OptimizeDisjunctionUnadorned bool
+	OptimizeDisjunction          bool
+
+	// OptimizeDisjunctionUnadornedMinChildCardinality is the number
+	// of documents one of the terms of an unadorned disjunction must
+	// be in, in every segment, for the optimization to be used, below
+	// it the cost of building the combined bitmap outweighs the benefit
+	OptimizeDisjunctionUnadornedMinChildCardinality uint64
 
 	// MinSegmentsForInMemoryMerge represents the number of
 	// in-memory zap segments that persistSnapshotMaybeMerge() needs to
@@ -75,9 +100,27 @@ type Config struct {
 	// be a very high number to always favor the merging of memory segments.
 	MemoryPressurePauseThreshold int
 
+	// MemoryPressureFunc, when set, replaces MemoryPressurePauseThreshold
+	// as the signal of memory pressure, such as the usage of a container's
+	// memory cgroup.  While it returns true the persister does not nap
+	// or wait for the merger, and persists segments directly instead of
+	// merging them in memory first.  It is called by the persister at
+	// most twice each time it wakes to persist a new snapshot, which
+	// may be as often as every batch, so it must be cheap.
+	MemoryPressureFunc func() bool
+
+	// MergeWindowFunc, when set, is consulted by the merger each time
+	// it plans merges, while it returns false only merges of segments
+	// no larger than MergePlanOptions.FloorSegmentSize proceed, the
+	// larger merges are deferred until it returns true again.
+	MergeWindowFunc func() bool
+
 	ValidateSnapshotCRC bool
 
 	virtualFields map[string][]segment.Field
+	fieldNormCalc map[string]func(int) float32
+
+	computedFields map[string]func(segment.Document) segment.Field
 }
 
 func (config Config) WithSegmentType(typ string) Config {
@@ -96,15 +139,139 @@ func (config Config) WithPersisterNapTimeMSec(napTime int) Config {
 }
 
 func (config Config) WithVirtualField(field segment.Field) Config {
+	config.virtualFields = config.cloneVirtualFields()
 	config.virtualFields[field.Name()] = append(config.virtualFields[field.Name()], field)
 	return config
 }
 
+// WithoutVirtualField removes all the virtual fields with the given name
+func (config Config) WithoutVirtualField(name string) Config {
+	config.virtualFields = config.cloneVirtualFields()
+	delete(config.virtualFields, name)
+	return config
+}
+
+// WithVirtualFieldReplace replaces any virtual fields with the
+// same name as the provided field, instead of appending to them
+func (config Config) WithVirtualFieldReplace(field segment.Field) Config {
+	config.virtualFields = config.cloneVirtualFields()
+	config.virtualFields[field.Name()] = []segment.Field{field}
+	return config
+}
+
+// WithComputedVirtualField registers a function computing a field from
+// each document as it is analyzed, replacing any previously registered
+// under the same name.  Unlike virtual fields, the computed field is
+// indexed with the document like any other field, so it survives
+// merges unchanged and is not recomputed.  The function may return
+// nil to add no field to a document.
+func (config Config) WithComputedVirtualField(name string, fn func(doc segment.Document) segment.Field) Config {
+	computedFields := make(map[string]func(segment.Document) segment.Field, len(config.computedFields)+1)
+	for k, v := range config.computedFields {
+		computedFields[k] = v
+	}
+	computedFields[name] = fn
+	config.computedFields = computedFields
+	return config
+}
+
+// cloneVirtualFields copies the virtual fields, so that changes
+// made to a derived Config do not affect the Config it came from
+func (config Config) cloneVirtualFields() map[string][]segment.Field {
+	rv := make(map[string][]segment.Field, len(config.virtualFields)+1)
+	for name, fields := range config.virtualFields {
+		rv[name] = append([]segment.Field(nil), fields...)
+	}
+	return rv
+}
+
 func (config Config) WithNormCalc(calc func(field string, numTerms int) float32) Config {
 	config.NormCalc = calc
 	return config
 }
 
+// WithFieldNormCalc registers a norm calculator used only for the
+// named field, it is consulted before the global NormCalc.
+// Virtual fields are never analyzed, so an override registered
+// for a virtual field has no effect.
+func (config Config) WithFieldNormCalc(field string, calc func(numTerms int) float32) Config {
+	fieldNormCalc := make(map[string]func(int) float32, len(config.fieldNormCalc)+1)
+	for f, c := range config.fieldNormCalc {
+		fieldNormCalc[f] = c
+	}
+	fieldNormCalc[field] = calc
+	config.fieldNormCalc = fieldNormCalc
+	return config
+}
+
+// normCalc returns the function used by the segment writer to compute
+// field norms, applying the per-field overrides before the global NormCalc
+func (config Config) normCalc() func(string, int) float32 {
+	if len(config.fieldNormCalc) == 0 {
+		return config.NormCalc
+	}
+	return func(field string, numTerms int) float32 {
+		if calc, ok := config.fieldNormCalc[field]; ok {
+			return calc(numTerms)
+		}
+		return config.NormCalc(field, numTerms)
+	}
+}
+
+// WithAnalyzeFunc analyzes each document with f,
+// instead of calling the document's Analyze method
+func (config Config) WithAnalyzeFunc(f func(doc segment.Document)) Config {
+	config.AnalyzeFunc = f
+	return config
+}
+
+// analyze analyzes the document with the AnalyzeFunc, if one is set
+func (config Config) analyze(doc segment.Document) {
+	if config.AnalyzeFunc != nil {
+		config.AnalyzeFunc(doc)
+		return
+	}
+	doc.Analyze()
+}
+
+// WithAnalysisPool submits the analysis work of this index to the
+// shared pool, no analysis workers are started for the index itself
+func (config Config) WithAnalysisPool(pool *AnalysisPool) Config {
+	config.AnalysisChan = pool.analysisChan
+	config.NumAnalysisWorkers = 0
+	return config
+}
+
+// WithSynchronousAnalysis analyzes the documents of each batch in the
+// calling goroutine, in the order they were added to the batch, instead
+// of using analysis workers, trading throughput for determinism
+func (config Config) WithSynchronousAnalysis() Config {
+	config.NumAnalysisWorkers = 0
+	config.AnalysisChan = nil
+	return config
+}
+
+// WithMemoryPressureFunc drives the persister's memory
+// pressure handling with f, see MemoryPressureFunc
+func (config Config) WithMemoryPressureFunc(f func() bool) Config {
+	config.MemoryPressureFunc = f
+	return config
+}
+
+// WithMergeWindow restricts large merges to the times
+// when inWindow returns true, see MergeWindowFunc
+func (config Config) WithMergeWindow(inWindow func() bool) Config {
+	config.MergeWindowFunc = inWindow
+	return config
+}
+
+// WithMaxBatchBytes splits batches whose stored field and
+// document value bytes exceed max into several segments
+func (config Config) WithMaxBatchBytes(max int) Config {
+	config.MaxBatchBytes = max
+	return config
+}
+
 func (config Config) WithTimeRange(min, max int64) Config {
 	config.FilterTimeMin = min
 	config.FilterTimeMax = max
@@ -134,6 +301,29 @@ func (config Config) DisableOptimizeDisjunctionUnadorned() Config {
 	return config
 }
 
+// WithDisjunctionUnadornedMinCardinality sets the
+// OptimizeDisjunctionUnadornedMinChildCardinality, a negative
+// or zero minimum always uses the optimization
+func (config Config) WithDisjunctionUnadornedMinCardinality(n int) Config {
+	if n < 0 {
+		n = 0
+	}
+	config.OptimizeDisjunctionUnadornedMinChildCardinality = uint64(n)
+	return config
+}
+
+// DisableOptimizeDisjunction checks every clause of scored disjunctions
+// for every match, rather than merging their clauses with a heap
+func (config Config) DisableOptimizeDisjunction() Config {
+	config.OptimizeDisjunction = false
+	return config
+}
+
+func (config Config) WithBatchCallback(f func(BatchStats)) Config {
+	config.BatchCallback = f
+	return config
+}
+
 func (config Config) WithUnsafeBatches() Config {
 	config.UnsafeBatch = true
 	return config
@@ -176,6 +366,9 @@ func defaultConfig() Config {
 		OptimizeConjunction:          true,
 		OptimizeConjunctionUnadorned: true,
 		OptimizeDisjunctionUnadorned: true,
+		OptimizeDisjunction:          true,
+
+		OptimizeDisjunctionUnadornedMinChildCardinality: 256,
 
 		MinSegmentsForInMemoryMerge: 2,
 
@@ -208,6 +401,7 @@ func defaultConfig() Config {
 		// indexed with these fields, even though nothing is
 		// physically persisted about them in the index.
 		virtualFields: map[string][]segment.Field{},
+		fieldNormCalc: map[string]func(int) float32{},
 
 		NumAnalysisWorkers: 4,
 		AnalysisChan:       make(chan func()),
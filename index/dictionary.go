@@ -17,13 +17,31 @@ package index
 import (
 	"container/heap"
 
+	"github.com/RoaringBitmap/roaring"
 	segment "github.com/blugelabs/bluge_segment_api"
 )
 
 type segmentDictCursor struct {
-	dict segment.Dictionary
-	itr  segment.DictionaryIterator
-	curr segment.DictionaryEntry
+	dict    segment.Dictionary
+	deleted *roaring.Bitmap
+	itr     segment.DictionaryIterator
+	curr    segment.DictionaryEntry
+}
+
+// count returns the count of the current term, of only the live
+// documents if live, otherwise as reported by the segment's iterator
+func (c *segmentDictCursor) count(live bool) (uint64, error) {
+	if !live {
+		return c.curr.Count(), nil
+	}
+	// the postings list is read afresh, rather than relying on the
+	// count of the entry, which some segment types get wrong for a
+	// term following a term used by a single document
+	pl, err := c.dict.PostingsList([]byte(c.curr.Term()), c.deleted, nil)
+	if err != nil {
+		return 0, err
+	}
+	return pl.Count(), nil
 }
 
 type dictionaryEntry struct {
@@ -43,6 +61,7 @@ type dictionary struct {
 	snapshot *Snapshot
 	cursors  []*segmentDictCursor
 	entry    dictionaryEntry
+	live     bool
 }
 
 func (i *dictionary) Len() int { return len(i.cursors) }
@@ -65,29 +84,32 @@ func (i *dictionary) Pop() interface{} {
 }
 
 func (i *dictionary) Next() (segment.DictionaryEntry, error) {
-	if len(i.cursors) == 0 {
-		return nil, nil
+	for len(i.cursors) > 0 {
+		err := i.next()
+		if err != nil {
+			return nil, err
+		}
+		// a term only used by deleted documents is skipped
+		if i.entry.count > 0 || !i.live {
+			return &i.entry, nil
+		}
 	}
+	return nil, nil
+}
+
+// next combines the entries of every cursor at the lowest term
+func (i *dictionary) next() error {
 	i.entry.term = i.cursors[0].curr.Term()
-	i.entry.count = i.cursors[0].curr.Count()
-	next, err := i.cursors[0].itr.Next()
-	if err != nil {
-		return nil, err
-	}
-	if next == nil {
-		// at end of this cursor, remove it
-		heap.Pop(i)
-	} else {
-		// modified heap, fix it
-		i.cursors[0].curr = next
-		heap.Fix(i, 0)
-	}
-	// look for any other entries with the exact same term
-	for len(i.cursors) > 0 && i.cursors[0].curr.Term() == i.entry.Term() {
-		i.entry.count += i.cursors[0].curr.Count()
+	i.entry.count = 0
+	for len(i.cursors) > 0 && i.cursors[0].curr.Term() == i.entry.term {
+		count, err := i.cursors[0].count(i.live)
+		if err != nil {
+			return err
+		}
+		i.entry.count += count
 		next, err := i.cursors[0].itr.Next()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		if next == nil {
 			// at end of this cursor, remove it
@@ -98,8 +120,7 @@ func (i *dictionary) Next() (segment.DictionaryEntry, error) {
 			heap.Fix(i, 0)
 		}
 	}
-
-	return &i.entry, nil
+	return nil
 }
 
 func (i *dictionary) Close() error {
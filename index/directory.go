@@ -16,6 +16,7 @@ package index
 
 import (
 	"io"
+	"time"
 
 	segment "github.com/blugelabs/bluge_segment_api"
 )
@@ -34,6 +35,9 @@ type WriterTo interface {
 
 // Directory abstracts over a collection of items
 // An item has a kind (string) and an id (uint64)
+// Opening a Reader only requires Setup, List and Load,
+// read-only implementations may return ErrReadOnlyDirectory
+// from the remaining methods.
 type Directory interface {
 
 	// Setup is called first, allowing a directory to
@@ -72,3 +76,10 @@ type Directory interface {
 	// Unlock releases the lock held on this directory
 	Unlock() error
 }
+
+// ModTimeDirectory is implemented by directories which know
+// when each item was persisted, such as from the modification
+// time of its file, it is used to describe snapshots.
+type ModTimeDirectory interface {
+	ModTime(kind string, id uint64) (time.Time, error)
+}
@@ -0,0 +1,247 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	segment "github.com/blugelabs/bluge_segment_api"
+)
+
+// ErrReadOnlyDirectory is returned by Directory implementations
+// which do not support modifying their contents
+var ErrReadOnlyDirectory = errors.New("directory is read-only")
+
+type archiveMember struct {
+	size    int64
+	modTime time.Time
+	open    func() (io.Reader, error)
+}
+
+// ArchiveDirectory is a read-only Directory backed by
+// the members of a single tar or zip archive.
+// The archive may contain the index items at the top-level
+// or nested inside a single directory, the location of the
+// snapshot (.snp) items is used to find the index root.
+// Load reads the whole of each item into memory, so opening
+// an index from an archive needs memory for all its segments.
+type ArchiveDirectory struct {
+	members map[string]map[uint64]*archiveMember
+}
+
+// NewTarArchiveDirectory returns an ArchiveDirectory reading the
+// index items from the tar archive of the given size.
+// Each member is read from its offset in the archive, so other
+// members are not read when it is loaded, but Load reads the
+// whole member into memory, as large as the segment it holds.
+func NewTarArchiveDirectory(r io.ReaderAt, size int64) (*ArchiveDirectory, error) {
+	cr := &countingReader{r: io.NewSectionReader(r, 0, size)}
+	tr := tar.NewReader(cr)
+	var names []string
+	members := map[string]*archiveMember{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading tar archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		offset, memberSize := cr.n, hdr.Size
+		names = append(names, hdr.Name)
+		members[hdr.Name] = &archiveMember{
+			size:    memberSize,
+			modTime: hdr.ModTime,
+			open: func() (io.Reader, error) {
+				return io.NewSectionReader(r, offset, memberSize), nil
+			},
+		}
+	}
+	return newArchiveDirectory(names, members)
+}
+
+// NewZipArchiveDirectory returns an ArchiveDirectory reading the
+// index items from the zip archive of the given size.
+func NewZipArchiveDirectory(r io.ReaderAt, size int64) (*ArchiveDirectory, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("error reading zip archive: %w", err)
+	}
+	var names []string
+	members := map[string]*archiveMember{}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		f := f
+		names = append(names, f.Name)
+		members[f.Name] = &archiveMember{
+			size:    int64(f.UncompressedSize64),
+			modTime: f.Modified,
+			open: func() (io.Reader, error) {
+				return f.Open()
+			},
+		}
+	}
+	return newArchiveDirectory(names, members)
+}
+
+func newArchiveDirectory(names []string, members map[string]*archiveMember) (*ArchiveDirectory, error) {
+	root, err := archiveRoot(names)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &ArchiveDirectory{
+		members: map[string]map[uint64]*archiveMember{},
+	}
+	for _, name := range names {
+		dir, base := path.Split(name)
+		if path.Clean(dir) != root {
+			continue
+		}
+		kind := path.Ext(base)
+		if kind != ItemKindSnapshot && kind != ItemKindSegment {
+			continue
+		}
+		id, err := strconv.ParseUint(base[:len(base)-len(kind)], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing identifier '%s': %w", base, err)
+		}
+		if rv.members[kind] == nil {
+			rv.members[kind] = map[uint64]*archiveMember{}
+		}
+		rv.members[kind][id] = members[name]
+	}
+	return rv, nil
+}
+
+// archiveRoot finds the directory within the archive containing
+// the snapshot items, it is an error for more than one to exist
+func archiveRoot(names []string) (string, error) {
+	var root string
+	var found bool
+	for _, name := range names {
+		if path.Ext(name) != ItemKindSnapshot {
+			continue
+		}
+		dir := path.Clean(path.Dir(name))
+		if found && dir != root {
+			return "", fmt.Errorf("archive contains snapshots in multiple directories: '%s' and '%s'", root, dir)
+		}
+		root = dir
+		found = true
+	}
+	if !found {
+		return "", fmt.Errorf("archive does not contain any snapshots")
+	}
+	return root, nil
+}
+
+func (d *ArchiveDirectory) Setup(readOnly bool) error {
+	if !readOnly {
+		return ErrReadOnlyDirectory
+	}
+	return nil
+}
+
+func (d *ArchiveDirectory) List(kind string) ([]uint64, error) {
+	var rv uint64Slice
+	for id := range d.members[kind] {
+		rv = append(rv, id)
+	}
+	sort.Sort(sort.Reverse(rv))
+	return rv, nil
+}
+
+func (d *ArchiveDirectory) Load(kind string, id uint64) (*segment.Data, io.Closer, error) {
+	member, ok := d.members[kind][id]
+	if !ok {
+		return nil, nil, fmt.Errorf("item %d%s not found in archive", id, kind)
+	}
+	r, err := member.open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening item %d%s: %w", id, kind, err)
+	}
+	buf := make([]byte, member.size)
+	_, err = io.ReadFull(r, buf)
+	if rc, ok := r.(io.Closer); ok {
+		_ = rc.Close()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading item %d%s: %w", id, kind, err)
+	}
+	return segment.NewDataBytes(buf), nil, nil
+}
+
+func (d *ArchiveDirectory) ModTime(kind string, id uint64) (time.Time, error) {
+	member, ok := d.members[kind][id]
+	if !ok {
+		return time.Time{}, fmt.Errorf("item %d%s not found in archive", id, kind)
+	}
+	return member.modTime, nil
+}
+
+func (d *ArchiveDirectory) Persist(kind string, id uint64, w WriterTo, closeCh chan struct{}) error {
+	return ErrReadOnlyDirectory
+}
+
+func (d *ArchiveDirectory) Remove(kind string, id uint64) error {
+	return ErrReadOnlyDirectory
+}
+
+func (d *ArchiveDirectory) Stats() (numItems, numBytes uint64) {
+	for _, items := range d.members {
+		for _, member := range items {
+			numItems++
+			numBytes += uint64(member.size)
+		}
+	}
+	return numItems, numBytes
+}
+
+func (d *ArchiveDirectory) Sync() error {
+	return nil
+}
+
+func (d *ArchiveDirectory) Lock() error {
+	return ErrReadOnlyDirectory
+}
+
+func (d *ArchiveDirectory) Unlock() error {
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,174 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func buildTestIndex(t *testing.T, name string) (path string, cleanup func() error) {
+	cfg, cleanup := CreateConfig(name)
+	path = cfg.DirectoryFunc().(*FileSystemDirectory).path
+
+	idx, err := OpenWriter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		doc := &FakeDocument{
+			NewFakeField("_id", id, true, false, false),
+			NewFakeField("name", "test", false, false, true),
+		}
+		b := NewBatch()
+		b.Update(testIdentifier(id), doc)
+		err = idx.Batch(b)
+		if err != nil {
+			t.Fatalf("error updating index: %v", err)
+		}
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, cleanup
+}
+
+func indexFiles(t *testing.T, path string) map[string][]byte {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rv := map[string][]byte{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if ext != ItemKindSnapshot && ext != ItemKindSegment {
+			continue
+		}
+		buf, err := os.ReadFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rv[entry.Name()] = buf
+	}
+	return rv
+}
+
+func checkReadOnlyDirectory(t *testing.T, dir Directory) {
+	cfg := DefaultConfigWithDirectory(func() Directory {
+		return dir
+	})
+	reader, err := OpenReader(cfg)
+	if err != nil {
+		t.Fatalf("error opening reader on archive: %v", err)
+	}
+	count, err := reader.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 documents, got %d", count)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		_, err = findNumberByID(reader, id)
+		if err != nil {
+			t.Errorf("error finding document %s: %v", id, err)
+		}
+	}
+	err = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenWriter(cfg)
+	if err == nil {
+		t.Errorf("expected error opening writer on read-only archive")
+	}
+}
+
+func TestTarArchiveDirectory(t *testing.T) {
+	path, cleanup := buildTestIndex(t, "TestTarArchiveDirectory")
+	defer func() {
+		err := cleanup()
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, data := range indexFiles(t, path) {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     "index/" + name,
+			Mode:     0600,
+			Size:     int64(len(data)),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := NewTarArchiveDirectory(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReadOnlyDirectory(t, dir)
+}
+
+func TestZipArchiveDirectory(t *testing.T) {
+	path, cleanup := buildTestIndex(t, "TestZipArchiveDirectory")
+	defer func() {
+		err := cleanup()
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range indexFiles(t, path) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := NewZipArchiveDirectory(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReadOnlyDirectory(t, dir)
+}
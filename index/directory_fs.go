@@ -21,6 +21,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/blevesearch/mmap-go"
 	"github.com/blugelabs/bluge/index/lock"
@@ -185,6 +186,14 @@ func (d *FileSystemDirectory) Load(kind string, id uint64) (*segment.Data, io.Cl
 	return d.loadMMapFunc(f)
 }
 
+func (d *FileSystemDirectory) ModTime(kind string, id uint64) (time.Time, error) {
+	info, err := os.Stat(filepath.Join(d.path, d.fileName(kind, id)))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
 func (d *FileSystemDirectory) Remove(kind string, id uint64) error {
 	return d.remove(kind, id)
 }
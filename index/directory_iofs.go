@@ -0,0 +1,137 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	segment "github.com/blugelabs/bluge_segment_api"
+)
+
+// FSDirectory is a read-only Directory backed by an fs.FS,
+// allowing indexes to be opened from embedded (go:embed)
+// or virtual filesystems.  The index items are expected
+// at the root of the filesystem, use fs.Sub to open
+// an index stored in a subdirectory.
+//
+// Only Setup, List and Load are required to open a Reader,
+// all methods modifying the directory return ErrReadOnlyDirectory.
+type FSDirectory struct {
+	fsys fs.FS
+}
+
+func NewFSDirectory(fsys fs.FS) *FSDirectory {
+	return &FSDirectory{
+		fsys: fsys,
+	}
+}
+
+func (d *FSDirectory) Setup(readOnly bool) error {
+	if !readOnly {
+		return ErrReadOnlyDirectory
+	}
+	_, err := fs.Stat(d.fsys, ".")
+	if err != nil {
+		return fmt.Errorf("error checking filesystem root: %w", err)
+	}
+	return nil
+}
+
+func (d *FSDirectory) List(kind string) ([]uint64, error) {
+	dirEntries, err := fs.ReadDir(d.fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var rv uint64Slice
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || path.Ext(dirEntry.Name()) != kind {
+			continue
+		}
+		base := dirEntry.Name()
+		base = base[:len(base)-len(kind)]
+		var id uint64
+		id, err = strconv.ParseUint(base, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing identifier '%s': %w", base, err)
+		}
+		rv = append(rv, id)
+	}
+
+	sort.Sort(sort.Reverse(rv))
+
+	return rv, nil
+}
+
+func (d *FSDirectory) Load(kind string, id uint64) (*segment.Data, io.Closer, error) {
+	buf, err := fs.ReadFile(d.fsys, d.fileName(kind, id))
+	if err != nil {
+		return nil, nil, err
+	}
+	return segment.NewDataBytes(buf), nil, nil
+}
+
+func (d *FSDirectory) Persist(kind string, id uint64, w WriterTo, closeCh chan struct{}) error {
+	return ErrReadOnlyDirectory
+}
+
+func (d *FSDirectory) ModTime(kind string, id uint64) (time.Time, error) {
+	info, err := fs.Stat(d.fsys, d.fileName(kind, id))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func (d *FSDirectory) Remove(kind string, id uint64) error {
+	return ErrReadOnlyDirectory
+}
+
+func (d *FSDirectory) Stats() (numItems, numBytes uint64) {
+	dirEntries, err := fs.ReadDir(d.fsys, ".")
+	if err == nil {
+		for _, dirEntry := range dirEntries {
+			if !dirEntry.IsDir() {
+				numItems++
+				if info, err := dirEntry.Info(); err == nil {
+					numBytes += uint64(info.Size())
+				}
+			}
+		}
+	}
+	return numItems, numBytes
+}
+
+func (d *FSDirectory) Sync() error {
+	return nil
+}
+
+func (d *FSDirectory) Lock() error {
+	return ErrReadOnlyDirectory
+}
+
+func (d *FSDirectory) Unlock() error {
+	return nil
+}
+
+func (d *FSDirectory) fileName(kind string, id uint64) string {
+	return fmt.Sprintf("%012x", id) + kind
+}
@@ -0,0 +1,51 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFSDirectory(t *testing.T) {
+	path, cleanup := buildTestIndex(t, "TestFSDirectory")
+	defer func() {
+		err := cleanup()
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	mapFS := fstest.MapFS{}
+	for name, data := range indexFiles(t, path) {
+		mapFS["nested/"+name] = &fstest.MapFile{
+			Data: data,
+			Mode: 0600,
+		}
+	}
+	sub, err := fs.Sub(mapFS, "nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := NewFSDirectory(sub)
+	checkReadOnlyDirectory(t, dir)
+
+	err = dir.Persist(ItemKindSegment, 1, nil, nil)
+	if err != ErrReadOnlyDirectory {
+		t.Errorf("expected ErrReadOnlyDirectory, got %v", err)
+	}
+}
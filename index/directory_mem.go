@@ -20,22 +20,41 @@ import (
 	"io"
 	"sort"
 	"sync"
+	"time"
 
 	segment "github.com/blugelabs/bluge_segment_api"
 )
 
 type InMemoryDirectory struct {
-	segLock  sync.RWMutex
-	segments map[uint64]*bytes.Buffer
+	segLock   sync.RWMutex
+	segments  map[uint64]*bytes.Buffer
+	snapshots map[uint64]*bytes.Buffer
+	// when each item of each kind was persisted
+	modTimes map[string]map[uint64]time.Time
 }
 
 func NewInMemoryDirectory() *InMemoryDirectory {
 	return &InMemoryDirectory{
-		segLock:  sync.RWMutex{},
-		segments: make(map[uint64]*bytes.Buffer),
+		segLock:   sync.RWMutex{},
+		segments:  make(map[uint64]*bytes.Buffer),
+		snapshots: make(map[uint64]*bytes.Buffer),
+		modTimes:  make(map[string]map[uint64]time.Time),
 	}
 }
 
+// items returns the items of the kind, snapshots are kept
+// so that the directory can be opened again, such as
+// when it is the destination of a backup
+func (d *InMemoryDirectory) items(kind string) map[uint64]*bytes.Buffer {
+	switch kind {
+	case ItemKindSegment:
+		return d.segments
+	case ItemKindSnapshot:
+		return d.snapshots
+	}
+	return nil
+}
+
 func (d *InMemoryDirectory) Setup(readOnly bool) error {
 	return nil
 }
@@ -44,10 +63,8 @@ func (d *InMemoryDirectory) List(kind string) ([]uint64, error) {
 	d.segLock.RLock()
 	defer d.segLock.RUnlock()
 	var rv uint64Slice
-	if kind == ItemKindSegment {
-		for id := range d.segments {
-			rv = append(rv, id)
-		}
+	for id := range d.items(kind) {
+		rv = append(rv, id)
 	}
 
 	sort.Sort(sort.Reverse(rv))
@@ -57,36 +74,46 @@ func (d *InMemoryDirectory) List(kind string) ([]uint64, error) {
 func (d *InMemoryDirectory) Load(kind string, id uint64) (*segment.Data, io.Closer, error) {
 	d.segLock.RLock()
 	defer d.segLock.RUnlock()
-	if kind == ItemKindSegment {
-		if buf, ok := d.segments[id]; ok {
-			return segment.NewDataBytes(buf.Bytes()), nil, nil
-		}
-		return nil, nil, fmt.Errorf("segment %d not found", id)
+	if buf, ok := d.items(kind)[id]; ok {
+		return segment.NewDataBytes(buf.Bytes()), nil, nil
 	}
-
-	return nil, nil, nil
+	return nil, nil, fmt.Errorf("%s %d not found", kind, id)
 }
 
 func (d *InMemoryDirectory) Persist(kind string, id uint64, w WriterTo, closeCh chan struct{}) error {
 	d.segLock.Lock()
 	defer d.segLock.Unlock()
-	if kind == ItemKindSegment {
-		var buf bytes.Buffer
-		_, err := w.WriteTo(&buf, closeCh)
-		if err != nil {
-			return err
-		}
-		d.segments[id] = &buf
+	items := d.items(kind)
+	if items == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	_, err := w.WriteTo(&buf, closeCh)
+	if err != nil {
+		return err
+	}
+	items[id] = &buf
+	if d.modTimes[kind] == nil {
+		d.modTimes[kind] = make(map[uint64]time.Time)
 	}
+	d.modTimes[kind][id] = time.Now()
 	return nil
 }
 
+func (d *InMemoryDirectory) ModTime(kind string, id uint64) (time.Time, error) {
+	d.segLock.RLock()
+	defer d.segLock.RUnlock()
+	if modTime, ok := d.modTimes[kind][id]; ok {
+		return modTime, nil
+	}
+	return time.Time{}, fmt.Errorf("%s %d not found", kind, id)
+}
+
 func (d *InMemoryDirectory) Remove(kind string, id uint64) error {
 	d.segLock.Lock()
 	defer d.segLock.Unlock()
-	if kind == ItemKindSegment {
-		delete(d.segments, id)
-	}
+	delete(d.items(kind), id)
+	delete(d.modTimes[kind], id)
 	return nil
 }
 
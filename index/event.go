@@ -21,17 +21,35 @@ type Event struct {
 	Kind     int
 	Chill    *Writer
 	Duration time.Duration
+
+	// Bytes written, for persistence events
+	Bytes uint64
+}
+
+// BatchStats describes a batch, once it has been persisted,
+// as provided in a BatchCallback
+type BatchStats struct {
+	// Documents is the number of documents inserted or updated
+	Documents int
+	// Deletes is the number of ids deleted, or obsoleted by updates
+	Deletes int
+	// Bytes is the size of the segments built for the batch
+	Bytes uint64
+	// Duration is the time from the batch being applied
+	// until it was persisted, including its analysis
+	Duration time.Duration
 }
 
 // Kinds of index events
 const (
-	EventKindCloseStart                 = 1 // when the index has started to close
-	EventKindClose                      = 2 // when the index has been fully closed
-	EventKindMergerProgress             = 3 // when the index has completed a round of merge operations
-	EventKindPersisterProgress          = 4 // when the index has completed a round of persistence operations
-	EventKindBatchIntroductionStart     = 5 // when the index has started to introduce a new batch
-	EventKindBatchIntroduction          = 6 // when index has finished introducing a batch
-	EventKindMergeTaskIntroductionStart = 7 // when the index has started to introduce a merge
-	EventKindMergeTaskIntroduction      = 8 // when the index has finished introdocing a merge
-
+	EventKindCloseStart                 = 1  // when the index has started to close
+	EventKindClose                      = 2  // when the index has been fully closed
+	EventKindMergerProgress             = 3  // when the index has completed a round of merge operations
+	EventKindPersisterProgress          = 4  // when the index has completed a round of persistence operations
+	EventKindBatchIntroductionStart     = 5  // when the index has started to introduce a new batch
+	EventKindBatchIntroduction          = 6  // when index has finished introducing a batch
+	EventKindMergeTaskIntroductionStart = 7  // when the index has started to introduce a merge
+	EventKindMergeTaskIntroduction      = 8  // when the index has finished introdocing a merge
+	EventKindPersistStart               = 9  // when the index has started to persist segments
+	EventKindPersist                    = 10 // when the index has finished persisting segments, with the bytes written
 )
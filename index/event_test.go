@@ -15,7 +15,10 @@
 package index
 
 import (
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestEventBatchIntroductionStart(t *testing.T) {
@@ -62,3 +65,76 @@ func TestEventBatchIntroductionStart(t *testing.T) {
 		t.Fatalf("expected to see 1 batch introduction event event, saw %d", count)
 	}
 }
+
+func TestEventPersist(t *testing.T) {
+	testConfig, cleanup := CreateConfig("TestEventPersist")
+	defer func() {
+		err := cleanup()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// let unsafe batches pile up, to be merged in memory when persisted
+	testConfig.UnsafeBatch = true
+	testConfig.PersisterNapTimeMSec = 50
+
+	var lock sync.Mutex
+	var starts, ends int
+	var written uint64
+	testConfig.EventCallback = func(e Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch e.Kind {
+		case EventKindPersistStart:
+			starts++
+		case EventKindPersist:
+			ends++
+			written += e.Bytes
+			if e.Duration <= 0 {
+				t.Errorf("expected persist duration, got %v", e.Duration)
+			}
+		}
+	}
+
+	idx, err := OpenWriter(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		id := strconv.Itoa(i)
+		b := NewBatch()
+		b.Update(testIdentifier(id), &FakeDocument{
+			NewFakeField("_id", id, true, false, false),
+			NewFakeField("name", "test", true, false, true),
+		})
+		err = idx.Batch(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// wait for everything to be persisted
+	for i := 0; i < 500 && idx.Stats().LastPersistedEpoch < idx.currentEpoch(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := idx.Stats()
+
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.TotMemMergeZapEnd == 0 {
+		t.Errorf("expected segments to be merged in memory")
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if starts == 0 || starts != ends {
+		t.Errorf("expected matching persist start and end events, got %d starts %d ends", starts, ends)
+	}
+	if written == 0 {
+		t.Errorf("expected persist events to report bytes written")
+	}
+}
@@ -0,0 +1,174 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/blugelabs/bluge/numeric"
+	segment "github.com/blugelabs/bluge_segment_api"
+)
+
+// ErrFieldNotFound is returned when no segment contains the field
+var ErrFieldNotFound = errors.New("field not found")
+
+// Field types reported by FieldInfo
+const (
+	FieldTypeText    = "text"
+	FieldTypeNumeric = "numeric" // also used by date and geo point fields
+)
+
+// fieldInfoSampleDocs limits the documents of each segment examined
+// to find the stored fields and doc values of fields not indexed
+const fieldInfoSampleDocs = 1000
+
+// FieldInfo describes how a field was indexed.  Segments do not
+// record the options used to index each field, so the capabilities
+// are inferred by sampling the segment data, a capability is
+// reported when at least one sampled document used it.
+type FieldInfo struct {
+	Name      string
+	Indexed   bool
+	Stored    bool
+	Positions bool
+	Offsets   bool
+	DocValues bool
+
+	// Type is FieldTypeText or FieldTypeNumeric, inferred from
+	// the indexed terms or doc values, empty if neither exist
+	Type string
+}
+
+// FieldInfo inspects the segments of the snapshot to describe
+// how the field was indexed, returning ErrFieldNotFound if
+// no segment contains the field
+func (i *Snapshot) FieldInfo(field string) (FieldInfo, error) {
+	rv := FieldInfo{Name: field}
+	var found bool
+	for _, ss := range i.segment {
+		if !containsField(ss.segment.Fields(), field) {
+			continue
+		}
+		found = true
+		err := inspectSegmentField(ss.segment.Segment, field, &rv)
+		if err != nil {
+			return rv, err
+		}
+	}
+	if !found {
+		return rv, fmt.Errorf("%w: %s", ErrFieldNotFound, field)
+	}
+	return rv, nil
+}
+
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func inspectSegmentField(seg segment.Segment, field string, info *FieldInfo) error {
+	var sampleDocs []uint64
+
+	dict, err := seg.Dictionary(field)
+	if err != nil {
+		return err
+	}
+	itr := dict.Iterator(nil, nil, nil)
+	entry, err := itr.Next()
+	_ = itr.Close()
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		info.Indexed = true
+		info.Type = termType(info.Type, []byte(entry.Term()))
+
+		var postings segment.PostingsList
+		postings, err = dict.PostingsList([]byte(entry.Term()), nil, nil)
+		if err != nil {
+			return err
+		}
+		var postingsItr segment.PostingsIterator
+		postingsItr, err = postings.Iterator(true, false, true, nil)
+		if err != nil {
+			return err
+		}
+		var posting segment.Posting
+		posting, err = postingsItr.Next()
+		if err != nil {
+			return err
+		}
+		if posting != nil {
+			for _, loc := range posting.Locations() {
+				info.Positions = info.Positions || loc.Pos() > 0
+				info.Offsets = info.Offsets || loc.End() > loc.Start()
+			}
+			sampleDocs = append(sampleDocs, posting.Number())
+		}
+		_ = postingsItr.Close()
+	} else {
+		// not indexed, look for the field in the first documents
+		for docNum := uint64(0); docNum < seg.Count() && docNum < fieldInfoSampleDocs; docNum++ {
+			sampleDocs = append(sampleDocs, docNum)
+		}
+	}
+
+	dvReader, err := seg.DocumentValueReader([]string{field})
+	if err != nil {
+		return err
+	}
+	for _, docNum := range sampleDocs {
+		err = seg.VisitStoredFields(docNum, func(name string, _ []byte) bool {
+			if name == field {
+				info.Stored = true
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		err = dvReader.VisitDocumentValues(docNum, func(name string, term []byte) {
+			if name == field {
+				info.DocValues = true
+				info.Type = termType(info.Type, term)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if info.Stored && info.DocValues {
+			break
+		}
+	}
+	return nil
+}
+
+// termType infers the type of field from one of its terms,
+// keeping the type already inferred
+func termType(typ string, term []byte) string {
+	if typ != "" {
+		return typ
+	}
+	if valid, _ := numeric.ValidPrefixCodedTermBytes(term); valid {
+		return FieldTypeNumeric
+	}
+	return FieldTypeText
+}
@@ -15,7 +15,9 @@
 package index
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"sync/atomic"
 	"time"
 
@@ -35,45 +37,79 @@ func (s *Writer) mergerLoop(merges chan *segmentMerge, persisterNotifier watcher
 		return
 	}
 
+	// set while merges are deferred until the merge window opens
+	var retryCh <-chan time.Time
+
+	// set when snapshots went unplanned while merging was paused
+	var replan bool
+
 OUTER:
 	for {
 		atomic.AddUint64(&s.stats.TotFileMergeLoopBeg, 1)
 
+		notified := false
 		select {
 		case <-s.closeCh:
 			break OUTER
 
+		case <-retryCh:
+			// plan the deferred merges again
+
+		case <-s.mergesResumed:
+			// plan the merges skipped while paused
+
+		case req := <-s.forceMerges:
+			// merging here, rather than in the caller, keeps the
+			// planned merges from merging the same segments
+			req.done <- s.forceMerge(merges, req)
+
 		case <-ew.notifyCh:
-			// check to see if there is a new snapshot to persist
-			ourSnapshot := s.currentSnapshot()
-			atomic.StoreUint64(&s.stats.mergeSnapshotSize, uint64(ourSnapshot.Size()))
-			atomic.StoreUint64(&s.stats.mergeEpoch, ourSnapshot.epoch)
-
-			if ourSnapshot.epoch != lastEpochMergePlanned {
-				startTime := time.Now()
-
-				// lets get started
-				err = s.planMergeAtSnapshot(merges, ourSnapshot, s.config.MergePlanOptions)
-				if err != nil {
-					atomic.StoreUint64(&s.stats.mergeEpoch, 0)
-					if err == segment.ErrClosed {
-						// index has been closed
-						_ = ourSnapshot.Close()
-						break OUTER
-					}
-					s.fireAsyncError(fmt.Errorf("merging err: %v", err))
+			notified = true
+		}
+
+		// check to see if there is a new snapshot to persist
+		ourSnapshot := s.currentSnapshot()
+		atomic.StoreUint64(&s.stats.mergeSnapshotSize, uint64(ourSnapshot.Size()))
+		atomic.StoreUint64(&s.stats.mergeEpoch, ourSnapshot.epoch)
+
+		if atomic.LoadUint32(&s.mergesPaused) == 1 {
+			// acknowledge the snapshot all the same, so the persister
+			// does not wait for a merger which will not catch up
+			replan = replan || ourSnapshot.epoch != lastEpochMergePlanned || retryCh != nil
+			lastEpochMergePlanned = ourSnapshot.epoch
+			retryCh = nil
+		} else if ourSnapshot.epoch != lastEpochMergePlanned || retryCh != nil || replan {
+			startTime := time.Now()
+
+			// lets get started
+			deferred, err := s.planMergeAtSnapshot(merges, ourSnapshot, s.config.MergePlanOptions)
+			if err != nil {
+				atomic.StoreUint64(&s.stats.mergeEpoch, 0)
+				if err == segment.ErrClosed {
+					// index has been closed
 					_ = ourSnapshot.Close()
-					atomic.AddUint64(&s.stats.TotFileMergeLoopErr, 1)
-					continue OUTER
+					break OUTER
 				}
-				lastEpochMergePlanned = ourSnapshot.epoch
-
-				atomic.StoreUint64(&s.stats.LastMergedEpoch, ourSnapshot.epoch)
+				s.fireAsyncError(AsyncPhaseMerge, fmt.Errorf("merging err: %w", err))
+				_ = ourSnapshot.Close()
+				atomic.AddUint64(&s.stats.TotFileMergeLoopErr, 1)
+				continue OUTER
+			}
+			lastEpochMergePlanned = ourSnapshot.epoch
 
-				s.fireEvent(EventKindMergerProgress, time.Since(startTime))
+			replan = false
+			retryCh = nil
+			if deferred {
+				retryCh = time.After(MergeWindowCheckInterval)
 			}
-			_ = ourSnapshot.Close()
 
+			atomic.StoreUint64(&s.stats.LastMergedEpoch, ourSnapshot.epoch)
+
+			s.fireEvent(EventKindMergerProgress, time.Since(startTime))
+		}
+		_ = ourSnapshot.Close()
+
+		if notified {
 			// update the persister, that we're now waiting for something
 			// after lastEpochMergePlanned
 			ew, err = persisterNotifier.NotifyUsAfter(lastEpochMergePlanned, s.closeCh)
@@ -86,8 +122,47 @@ OUTER:
 	}
 }
 
+// PauseMerging stops the merger from planning new merges of the
+// persisted segments, merges already planned run to completion.
+// The persister still merges in-memory segments as it persists them,
+// and no longer waits for the merger to reduce the number of files.
+func (s *Writer) PauseMerging() {
+	atomic.StoreUint32(&s.mergesPaused, 1)
+}
+
+// ResumeMerging lets the merger plan merges again, starting
+// with those of the segments introduced while it was paused
+func (s *Writer) ResumeMerging() {
+	if atomic.CompareAndSwapUint32(&s.mergesPaused, 1, 0) {
+		select {
+		case s.mergesResumed <- struct{}{}:
+		default:
+			// the merger has yet to take the last resume
+		}
+	}
+}
+
+// MergeWindowCheckInterval controls how often the merger checks
+// whether the merge window has opened, while merges are deferred
+var MergeWindowCheckInterval = time.Second
+
+// smallMergeTask reports whether the task only merges segments no
+// larger than the floor segment size, these merges are cheap, and
+// proceed even outside the merge window
+func smallMergeTask(task *mergeplan.MergeTask, options *mergeplan.Options) bool {
+	for _, seg := range task.Segments {
+		if seg.LiveSize() > options.FloorSegmentSize {
+			return false
+		}
+	}
+	return true
+}
+
+// planMergeAtSnapshot plans and executes the merges of the persisted
+// segments, reporting whether any merges were deferred because the
+// merge window was closed
 func (s *Writer) planMergeAtSnapshot(merges chan *segmentMerge, ourSnapshot *Snapshot,
-	options mergeplan.Options) error {
+	options mergeplan.Options) (deferred bool, err error) {
 	// build list of persisted segments in this snapshot
 	var onlyPersistedSnapshots []mergeplan.Segment
 	for _, segmentSnapshot := range ourSnapshot.segment {
@@ -102,26 +177,34 @@ func (s *Writer) planMergeAtSnapshot(merges chan *segmentMerge, ourSnapshot *Sna
 	resultMergePlan, err := mergeplan.Plan(onlyPersistedSnapshots, &options)
 	if err != nil {
 		atomic.AddUint64(&s.stats.TotFileMergePlanErr, 1)
-		return fmt.Errorf("merge planning err: %v", err)
+		return false, fmt.Errorf("merge planning err: %v", err)
 	}
 	if resultMergePlan == nil {
 		// nothing to do
 		atomic.AddUint64(&s.stats.TotFileMergePlanNone, 1)
-		return nil
+		return false, nil
 	}
 	atomic.AddUint64(&s.stats.TotFileMergePlanOk, 1)
 
 	atomic.AddUint64(&s.stats.TotFileMergePlanTasks, uint64(len(resultMergePlan.Tasks)))
 
+	// outside the merge window only small merges proceed
+	inWindow := s.config.MergeWindowFunc == nil || s.config.MergeWindowFunc()
+
 	// process tasks in serial for now
 	for _, task := range resultMergePlan.Tasks {
+		if !inWindow && !smallMergeTask(task, &options) {
+			atomic.AddUint64(&s.stats.TotFileMergePlanTasksDeferred, 1)
+			deferred = true
+			continue
+		}
 		err := s.executeMergeTask(merges, task)
 		if err != nil {
-			return err
+			return deferred, err
 		}
 	}
 
-	return nil
+	return deferred, nil
 }
 
 func (s *Writer) executeMergeTask(merges chan *segmentMerge, task *mergeplan.MergeTask) error {
@@ -141,7 +224,7 @@ func (s *Writer) executeMergeTask(merges chan *segmentMerge, task *mergeplan.Mer
 		fileMergeZapStartTime := time.Now()
 
 		atomic.AddUint64(&s.stats.TotFileMergeZapBeg, 1)
-		newDocNums, err := s.merge(segmentsToMerge, docsToDrop, newSegmentID)
+		newDocNums, _, err := s.merge(segmentsToMerge, docsToDrop, newSegmentID)
 		atomic.AddUint64(&s.stats.TotFileMergeZapEnd, 1)
 
 		fileMergeZapTime := uint64(time.Since(fileMergeZapStartTime))
@@ -298,7 +381,9 @@ func (s *Writer) mergeSegmentBases(merges chan *segmentMerge, snapshot *Snapshot
 
 	newSegmentID := atomic.AddUint64(&s.nextSegmentID, 1)
 
-	newDocNums, err := s.merge(sbs, sbsDrops, newSegmentID)
+	s.fireEvent(EventKindPersistStart, 0)
+	newDocNums, written, err := s.merge(sbs, sbsDrops, newSegmentID)
+	s.fireEventBytes(EventKindPersist, time.Since(memMergeZapStartTime), written)
 
 	atomic.AddUint64(&s.stats.TotMemMergeZapEnd, 1)
 
@@ -362,13 +447,101 @@ func (s *Writer) mergeSegmentBases(merges chan *segmentMerge, snapshot *Snapshot
 }
 
 func (s *Writer) merge(segments []segment.Segment, drops []*roaring.Bitmap, id uint64) (
-	[][]uint64, error) {
+	[][]uint64, uint64, error) {
 	merger := s.segPlugin.Merge(segments, drops, s.config.MergeBufferSize)
 
-	err := s.directory.Persist(ItemKindSegment, id, merger, s.closeCh)
+	written := &countingWriterTo{WriterTo: merger}
+	err := s.directory.Persist(ItemKindSegment, id, written, s.closeCh)
 	if err != nil {
-		return nil, err
+		return nil, written.n, err
+	}
+
+	return merger.DocumentNumbers(), written.n, nil
+}
+
+type forceMergeRequest struct {
+	ctx         context.Context
+	maxSegments int
+	done        chan error
+}
+
+// ForceMerge merges the persisted segments until at most maxSegments
+// remain.  The merges are done by the merger goroutine, between those
+// it plans itself, so the two never merge the same segments.  Segments
+// introduced after ForceMerge is called may remain.
+func (s *Writer) ForceMerge(ctx context.Context, maxSegments int) error {
+	if maxSegments < 1 {
+		return fmt.Errorf("force merge must leave at least 1 segment, got %d", maxSegments)
 	}
 
-	return merger.DocumentNumbers(), nil
+	// only persisted segments are merged, so wait
+	// for those introduced so far to be persisted
+	err := s.prepareSegment(nil, nil, nil, nil, true)
+	if err != nil {
+		return err
+	}
+
+	req := &forceMergeRequest{
+		ctx:         ctx,
+		maxSegments: maxSegments,
+		done:        make(chan error, 1),
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.closeCh:
+		return segment.ErrClosed
+	case s.forceMerges <- req:
+	}
+
+	select {
+	case <-s.closeCh:
+		return segment.ErrClosed
+	case err = <-req.done:
+		return err
+	}
+}
+
+func (s *Writer) forceMerge(merges chan *segmentMerge, req *forceMergeRequest) error {
+	for {
+		select {
+		case <-req.ctx.Done():
+			return req.ctx.Err()
+		default:
+		}
+
+		ourSnapshot := s.currentSnapshot()
+		task := forceMergeTask(ourSnapshot, req.maxSegments)
+		if task == nil {
+			_ = ourSnapshot.Close()
+			return nil
+		}
+		err := s.executeMergeTask(merges, task)
+		_ = ourSnapshot.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// forceMergeTask returns a task merging the smallest persisted
+// segments of the snapshot, so that at most maxSegments remain,
+// or nil if there are already few enough
+func forceMergeTask(snapshot *Snapshot, maxSegments int) *mergeplan.MergeTask {
+	var persisted []mergeplan.Segment
+	for _, segmentSnapshot := range snapshot.segment {
+		if segmentSnapshot.segment.Persisted() {
+			persisted = append(persisted, segmentSnapshot)
+		}
+	}
+	if len(persisted) <= maxSegments {
+		return nil
+	}
+
+	sort.SliceStable(persisted, func(i, j int) bool {
+		return persisted[i].LiveSize() < persisted[j].LiveSize()
+	})
+	return &mergeplan.MergeTask{
+		Segments: persisted[:len(persisted)-maxSegments+1],
+	}
 }
@@ -36,6 +36,10 @@ func (i *postingsIterator) Optimize(kind string,
 		return i.optimizeDisjunctionUnadorned(octx)
 	}
 
+	if i.snapshot.parent.config.OptimizeDisjunction && kind == "disjunction" {
+		return i.optimizeDisjunction(octx)
+	}
+
 	return nil, nil
 }
 
@@ -258,6 +262,39 @@ OUTER:
 
 // ----------------------------------------------------------------
 
+// A disjunction that is scored needs the freq-norm's and term-vectors
+// of every clause, so the postings are left unchanged, instead the
+// disjunction searcher merges the clauses with a heap, rather than
+// checking every clause for every match, which pays off once there
+// are many clauses.
+func (i *postingsIterator) optimizeDisjunction(
+	octx segment.OptimizableContext) (segment.OptimizableContext, error) {
+	if octx == nil {
+		octx = &optimizeDisjunction{snapshot: i.snapshot}
+	}
+
+	o, ok := octx.(*optimizeDisjunction)
+	if !ok {
+		return nil, nil
+	}
+
+	if o.snapshot != i.snapshot {
+		return nil, fmt.Errorf("tried to optimize disjunction across different snapshots")
+	}
+
+	return o, nil
+}
+
+type optimizeDisjunction struct {
+	snapshot *Snapshot
+}
+
+func (o *optimizeDisjunction) Finish() (segment.PostingsIterator, error) {
+	return nil, nil
+}
+
+// ----------------------------------------------------------------
+
 // An "unadorned" disjunction optimization is appropriate when
 // additional or subsidiary information like freq-norm's and
 // term-vectors are not required, and instead only the internal-id's
@@ -319,6 +356,13 @@ func (o *optimizeDisjunctionUnadorned) Finish() (rv segment.PostingsIterator, er
 				}
 			}
 		}
+
+		// skip the optimization if all the constituent bitmaps are
+		// too small, where the processing and resource overhead of
+		// creating the OR'ed bitmap outweighs the benefit
+		if cMax < o.snapshot.parent.config.OptimizeDisjunctionUnadornedMinChildCardinality {
+			return nil, nil
+		}
 	}
 
 	// We use an artificial term and field because the optimized
@@ -0,0 +1,110 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"strconv"
+	"testing"
+
+	segment "github.com/blugelabs/bluge_segment_api"
+)
+
+func TestOptimizeDisjunctionUnadornedMinCardinality(t *testing.T) {
+	// "a" is in 3 documents and "b" in 2
+	texts := []string{"a b", "a b", "a", "c"}
+
+	optimized := func(minCardinality int) bool {
+		cfg, cleanup := CreateConfig("TestOptimizeDisjunctionUnadornedMinCardinality")
+		defer func() {
+			err := cleanup()
+			if err != nil {
+				t.Log(err)
+			}
+		}()
+		idx, err := OpenWriter(cfg.WithDisjunctionUnadornedMinCardinality(minCardinality))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = idx.Close()
+		}()
+		b := NewBatch()
+		for i, text := range texts {
+			b.Update(testIdentifier(strconv.Itoa(i)), &FakeDocument{
+				NewFakeField("_id", strconv.Itoa(i), true, false, false),
+				NewFakeField("desc", text, false, false, false),
+			})
+		}
+		err = idx.Batch(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := idx.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+
+		var octx segment.OptimizableContext
+		for _, term := range []string{"a", "b"} {
+			itr, err := reader.PostingsIterator([]byte(term), "desc", false, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			octx, err = itr.(segment.Optimizable).Optimize("disjunction:unadorned", octx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		rv, err := octx.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rv == nil {
+			return false
+		}
+		var count int
+		next, err := rv.Next()
+		for err == nil && next != nil {
+			count++
+			next, err = rv.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 3 {
+			t.Errorf("expected 3 documents in the disjunction, got %d", count)
+		}
+		return true
+	}
+
+	for _, test := range []struct {
+		minCardinality int
+		expected       bool
+	}{
+		{minCardinality: -1, expected: true},
+		{minCardinality: 0, expected: true},
+		{minCardinality: 3, expected: true},
+		{minCardinality: 4, expected: false},
+		{minCardinality: 256, expected: false},
+	} {
+		if got := optimized(test.minCardinality); got != test.expected {
+			t.Errorf("minimum cardinality %d: expected optimized %t, got %t",
+				test.minCardinality, test.expected, got)
+		}
+	}
+}
@@ -16,6 +16,7 @@ package index
 
 import (
 	"fmt"
+	"io"
 	"sync/atomic"
 	"time"
 
@@ -97,7 +98,7 @@ OUTER:
 					// the retry attempt
 					unpersistedCallbacks = append(unpersistedCallbacks, ourPersistedCallbacks...)
 
-					s.fireAsyncError(fmt.Errorf("got err persisting snapshot: %v", err))
+					s.fireAsyncError(AsyncPhasePersist, fmt.Errorf("got err persisting snapshot: %w", err))
 					_ = ourSnapshot.Close()
 					atomic.AddUint64(&s.stats.TotPersistLoopErr, 1)
 					continue OUTER
@@ -141,7 +142,7 @@ OUTER:
 
 			err = s.deletionPolicy.Cleanup(s.directory) // might as well cleanup while waiting
 			if err != nil {
-				s.config.AsyncError(err)
+				s.fireAsyncError(AsyncPhaseCleanup, err)
 			}
 		}
 
@@ -154,6 +155,13 @@ func (s *Writer) pausePersisterForMergerCatchUp(persisterNotifier watcherChan,
 	// First, let the watchers proceed if they lag behind
 	persistWatchers.NotifySatisfiedWatchers(lastPersistedEpoch)
 
+	// Under memory pressure reported by the callback, skip the
+	// pauses, persisting the segments as soon as possible
+	if s.config.MemoryPressureFunc != nil && s.config.MemoryPressureFunc() {
+		atomic.AddUint64(&s.stats.TotPersisterMemoryPressure, 1)
+		return lastMergedEpoch, persistWatchers
+	}
+
 	// Check the merger lag by counting the segment files on disk,
 	numFilesOnDisk, _ := s.directory.Stats()
 
@@ -183,7 +191,7 @@ func (s *Writer) pausePersisterForMergerCatchUp(persisterNotifier watcherChan,
 	if numFilesOnDisk > uint64(s.config.PersisterNapUnderNumFiles) {
 		err := s.deletionPolicy.Cleanup(s.directory)
 		if err != nil {
-			s.config.AsyncError(err)
+			s.fireAsyncError(AsyncPhaseCleanup, err)
 		}
 		numFilesOnDisk, _ = s.directory.Stats()
 	}
@@ -220,7 +228,7 @@ func (s *Writer) persistSnapshot(merges chan *segmentMerge, persists chan *persi
 	// Perform in-memory segment merging only when the memory pressure is
 	// below the configured threshold, else the persister performs the
 	// direct persistence of segments.
-	if s.numEventsBlocking() < s.config.MemoryPressurePauseThreshold {
+	if !s.memoryPressure() {
 		persisted, err := s.persistSnapshotMaybeMerge(merges, persists, snapshot)
 		if err != nil {
 			return err
@@ -233,6 +241,16 @@ func (s *Writer) persistSnapshot(merges chan *segmentMerge, persists chan *persi
 	return s.persistSnapshotDirect(persists, snapshot)
 }
 
+// memoryPressure reports whether the persister should skip in-memory
+// merging, as reported by MemoryPressureFunc, or if not configured,
+// when MemoryPressurePauseThreshold application threads are paused
+func (s *Writer) memoryPressure() bool {
+	if s.config.MemoryPressureFunc != nil {
+		return s.config.MemoryPressureFunc()
+	}
+	return s.numEventsBlocking() >= s.config.MemoryPressurePauseThreshold
+}
+
 // persistSnapshotMaybeMerge examines the snapshot and might merge and
 // persist the in-memory zap segments if there are enough of them
 func (s *Writer) persistSnapshotMaybeMerge(merges chan *segmentMerge, persists chan *persistIntroduction, snapshot *Snapshot) (
@@ -309,13 +327,21 @@ func (s *Writer) persistSnapshotMaybeMerge(merges chan *segmentMerge, persists c
 }
 
 func (s *Writer) persistSnapshotDirect(persists chan *persistIntroduction, snapshot *Snapshot) (err error) {
+	s.fireEvent(EventKindPersistStart, 0)
+	startTime := time.Now()
+	written := &countingWriterTo{}
+	defer func() {
+		s.fireEventBytes(EventKindPersist, time.Since(startTime), written.n)
+	}()
+
 	// first ensure that each segment in this snapshot has been persisted
 	var newSegmentIds []uint64
 	for _, segmentSnapshot := range snapshot.segment {
 		if !segmentSnapshot.segment.Persisted() {
-			err = s.directory.Persist(ItemKindSegment, segmentSnapshot.id, segmentSnapshot.segment.Segment, s.closeCh)
+			written.WriterTo = segmentSnapshot.segment.Segment
+			err = s.directory.Persist(ItemKindSegment, segmentSnapshot.id, written, s.closeCh)
 			if err != nil {
-				return fmt.Errorf("error persisting segment: %v", err)
+				return fmt.Errorf("error persisting segment: %w", err)
 			}
 			newSegmentIds = append(newSegmentIds, segmentSnapshot.id)
 		}
@@ -328,7 +354,8 @@ func (s *Writer) persistSnapshotDirect(persists chan *persistIntroduction, snaps
 		}
 	}
 
-	err = s.directory.Persist(ItemKindSnapshot, snapshot.epoch, snapshot, s.closeCh)
+	written.WriterTo = snapshot
+	err = s.directory.Persist(ItemKindSnapshot, snapshot.epoch, written, s.closeCh)
 	if err != nil {
 		return err
 	}
@@ -338,6 +365,18 @@ func (s *Writer) persistSnapshotDirect(persists chan *persistIntroduction, snaps
 	return nil
 }
 
+// countingWriterTo counts the bytes written by the WriterTo
+type countingWriterTo struct {
+	WriterTo
+	n uint64
+}
+
+func (c *countingWriterTo) WriteTo(w io.Writer, closeCh chan struct{}) (int64, error) {
+	n, err := c.WriterTo.WriteTo(w, closeCh)
+	c.n += uint64(n)
+	return n, err
+}
+
 func (s *Writer) prepareIntroducePersist(persists chan *persistIntroduction, newSegmentIds []uint64) error {
 	// now try to open all the new snapshots
 	newSegments := make(map[uint64]*segmentWrapper)
@@ -369,11 +408,10 @@ func (s *Writer) prepareIntroducePersist(persists chan *persistIntroduction, new
 	case persists <- persist:
 	}
 
-	select {
-	case <-s.closeCh:
-		return segment.ErrClosed
-	case <-persist.applied:
-	}
+	// once received, the introducer always applies the persist, and
+	// removes the segments it uses from newSegments, so wait for it
+	// even when closing, before closing the segments left
+	<-persist.applied
 
 	return nil
 }
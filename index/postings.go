@@ -35,6 +35,9 @@ type postingsIterator struct {
 	currPosting        segment.Posting
 	currID             uint64
 	recycle            bool
+
+	// the count of the snapshot split by SegmentSnapshots, if any
+	docFreq uint64
 }
 
 func (i *postingsIterator) Size() int {
@@ -90,6 +93,11 @@ func (i *postingsIterator) Advance(number uint64) (segment.Posting, error) {
 		_ = i.Close()
 		*i = *(i2.(*postingsIterator))
 	}
+	// the snapshots returned by SegmentSnapshots start at the number
+	// of their segment, advancing before it starts at their first
+	if len(i.snapshot.offsets) > 0 && number < i.snapshot.offsets[0] {
+		number = i.snapshot.offsets[0]
+	}
 	segIndex, ldocNum := i.snapshot.segmentIndexAndLocalDocNumFromGlobal(number)
 	if segIndex >= len(i.snapshot.segment) {
 		return nil, fmt.Errorf("computed segment index %d out of bounds %d",
@@ -116,6 +124,9 @@ func (i *postingsIterator) Advance(number uint64) (segment.Posting, error) {
 }
 
 func (i *postingsIterator) Count() uint64 {
+	if i.docFreq > 0 {
+		return i.docFreq
+	}
 	var rv uint64
 	for _, posting := range i.postings {
 		rv += posting.Count()
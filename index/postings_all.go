@@ -50,6 +50,11 @@ func (i *postingsIteratorAll) Next() (segment.Posting, error) {
 }
 
 func (i *postingsIteratorAll) Advance(number uint64) (segment.Posting, error) {
+	// the snapshots returned by SegmentSnapshots start at the number
+	// of their segment, advancing before it starts at their first
+	if len(i.snapshot.offsets) > 0 && number < i.snapshot.offsets[0] {
+		number = i.snapshot.offsets[0]
+	}
 	segIndex, localDocNum := i.snapshot.segmentIndexAndLocalDocNumFromGlobal(number)
 	if segIndex >= len(i.snapshot.segment) {
 		return nil, fmt.Errorf("computed segment index %d out of bounds %d",
@@ -66,6 +71,10 @@ func (i *postingsIteratorAll) Advance(number uint64) (segment.Posting, error) {
 }
 
 func (i *postingsIteratorAll) Count() uint64 {
+	if i.snapshot.shared != nil {
+		rv, _ := i.snapshot.shared.snapshot.Count()
+		return rv
+	}
 	rv, _ := i.snapshot.Count()
 	return rv
 }
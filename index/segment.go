@@ -15,6 +15,8 @@
 package index
 
 import (
+	"time"
+
 	"github.com/RoaringBitmap/roaring"
 	segment "github.com/blugelabs/bluge_segment_api"
 )
@@ -25,6 +27,25 @@ type SegmentSnapshot interface {
 	DocNum() uint64
 	SegmentSize() uint64
 	Timestamp() (int64, int64)
+
+	// Count returns the number of live documents in the segment
+	Count() uint64
+	// Bytes returns the size of the segment when persisted,
+	// or its size in memory when not yet persisted
+	Bytes() int64
+
+	// FullSize and LiveSize are the sizes of the segment given
+	// to the merge planner, the number of documents including
+	// and excluding those deleted
+	FullSize() int64
+	LiveSize() int64
+	// Persisted reports whether the segment has been persisted,
+	// only persisted segments are merged
+	Persisted() bool
+	// Created returns when the segment was built, or when it was
+	// persisted for segments loaded from a directory implementing
+	// ModTimeDirectory, it is zero for other loaded segments
+	Created() time.Time
 }
 
 type segmentSnapshot struct {
@@ -68,6 +89,14 @@ func (s *segmentSnapshot) Bytes() int64 {
 	return n
 }
 
+func (s *segmentSnapshot) Persisted() bool {
+	return s.segment.Persisted()
+}
+
+func (s *segmentSnapshot) Created() time.Time {
+	return s.segment.created
+}
+
 func (s *segmentSnapshot) Close() error {
 	return s.segment.Close()
 }
@@ -17,7 +17,9 @@ package index
 import (
 	"fmt"
 	"io"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/RoaringBitmap/roaring"
 	segment "github.com/blugelabs/bluge_segment_api"
@@ -31,41 +33,87 @@ type SegmentPlugin struct {
 	Merge   func([]segment.Segment, []*roaring.Bitmap, int) segment.Merger
 }
 
-func supportedSegmentTypes(supportedSegmentPlugins map[string]map[uint32]*SegmentPlugin) (rv []string) {
-	for k := range supportedSegmentPlugins {
-		rv = append(rv, k)
-	}
-	return
+// SegmentPluginInfo identifies a segment type and version
+// which a Config is able to read and write
+type SegmentPluginInfo struct {
+	Type    string
+	Version uint32
 }
 
-func supportedSegmentTypeVersions(supportedSegmentPlugins map[string]map[uint32]*SegmentPlugin, typ string) (
-	rv []uint32) {
-	for k := range supportedSegmentPlugins[typ] {
-		rv = append(rv, k)
+// SegmentPlugins returns the segment types and versions supported
+// by this config, ordered by type and then version
+func (config Config) SegmentPlugins() []SegmentPluginInfo {
+	var rv []SegmentPluginInfo
+	for typ, versions := range config.supportedSegmentPlugins {
+		for version := range versions {
+			rv = append(rv, SegmentPluginInfo{
+				Type:    typ,
+				Version: version,
+			})
+		}
 	}
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].Type != rv[j].Type {
+			return rv[i].Type < rv[j].Type
+		}
+		return rv[i].Version < rv[j].Version
+	})
 	return rv
 }
 
-func loadSegmentPlugin(supportedSegmentPlugins map[string]map[uint32]*SegmentPlugin,
-	forcedSegmentType string, forcedSegmentVersion uint32) (*SegmentPlugin, error) {
-	if versions, ok := supportedSegmentPlugins[forcedSegmentType]; ok {
-		if segPlugin, ok := versions[forcedSegmentVersion]; ok {
-			return segPlugin, nil
+// SupportsSegment reports whether this config has a
+// plugin for the segment type and version
+func (config Config) SupportsSegment(segType string, version uint32) bool {
+	_, ok := config.supportedSegmentPlugins[segType][version]
+	return ok
+}
+
+// ErrUnsupportedSegment is returned when a segment type and version
+// is required for which no segment plugin has been configured, such
+// as opening an index written by a newer version of the segment plugin
+type ErrUnsupportedSegment struct {
+	Type    string
+	Version uint32
+
+	// Supported lists the segment types and versions configured
+	Supported []SegmentPluginInfo
+}
+
+func (e ErrUnsupportedSegment) Error() string {
+	var types []string
+	var versions []uint32
+	for _, info := range e.Supported {
+		if len(types) == 0 || types[len(types)-1] != info.Type {
+			types = append(types, info.Type)
 		}
-		return nil, fmt.Errorf(
-			"unsupported version %d for segment type: %s, supported: %v",
-			forcedSegmentVersion, forcedSegmentType,
-			supportedSegmentTypeVersions(supportedSegmentPlugins, forcedSegmentType))
+		if info.Type == e.Type {
+			versions = append(versions, info.Version)
+		}
+	}
+	if len(versions) > 0 {
+		return fmt.Sprintf("unsupported version %d for segment type: %s, supported: %v",
+			e.Version, e.Type, versions)
+	}
+	return fmt.Sprintf("unsupported segment type: %s, supported: %v", e.Type, types)
+}
+
+func loadSegmentPlugin(config Config, segmentType string, segmentVersion uint32) (*SegmentPlugin, error) {
+	if segPlugin, ok := config.supportedSegmentPlugins[segmentType][segmentVersion]; ok {
+		return segPlugin, nil
+	}
+	return nil, ErrUnsupportedSegment{
+		Type:      segmentType,
+		Version:   segmentVersion,
+		Supported: config.SegmentPlugins(),
 	}
-	return nil, fmt.Errorf("unsupported segment type: %s, supported: %v",
-		forcedSegmentType, supportedSegmentTypes(supportedSegmentPlugins))
 }
 
 func (s *Writer) newSegment(results []segment.Document) (*segmentWrapper, uint64, error) {
-	seg, count, err := s.segPlugin.New(results, s.config.NormCalc)
+	seg, count, err := s.segPlugin.New(results, s.config.normCalc())
 	return &segmentWrapper{
 		Segment:    seg,
 		refCounter: noOpRefCounter{},
+		created:    time.Now(),
 	}, count, err
 }
 
@@ -73,6 +121,9 @@ type segmentWrapper struct {
 	segment.Segment
 	refCounter
 	persisted bool
+	// when the segment was built, or persisted if loaded
+	// from the directory, zero when that is unknown
+	created time.Time
 }
 
 func (s segmentWrapper) Persisted() bool {
@@ -0,0 +1,114 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/blugelabs/ice"
+)
+
+func TestSegmentPlugins(t *testing.T) {
+	config := InMemoryOnlyConfig().
+		WithSegmentPlugin(&SegmentPlugin{
+			Type:    ice.Type,
+			Version: ice.Version + 1,
+		}).
+		WithSegmentPlugin(&SegmentPlugin{
+			Type:    "alt",
+			Version: 1,
+		})
+
+	expect := []SegmentPluginInfo{
+		{Type: "alt", Version: 1},
+		{Type: ice.Type, Version: ice.Version},
+		{Type: ice.Type, Version: ice.Version + 1},
+	}
+	got := config.SegmentPlugins()
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+
+	// mutating the result does not affect the config
+	got[0].Version = 7
+	if config.SupportsSegment("alt", 7) {
+		t.Errorf("expected alt version 7 to be unsupported")
+	}
+
+	for _, test := range []struct {
+		typ     string
+		version uint32
+		expect  bool
+	}{
+		{typ: ice.Type, version: ice.Version, expect: true},
+		{typ: ice.Type, version: ice.Version + 2, expect: false},
+		{typ: "alt", version: 1, expect: true},
+		{typ: "unknown", version: 1, expect: false},
+	} {
+		if got := config.SupportsSegment(test.typ, test.version); got != test.expect {
+			t.Errorf("expected support for %s/%d to be %t", test.typ, test.version, test.expect)
+		}
+	}
+}
+
+func TestOpenUnsupportedSegment(t *testing.T) {
+	path, cleanup := buildTestIndex(t, "TestOpenUnsupportedSegment")
+	defer func() {
+		err := cleanup()
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	// simulate opening the index with an older release,
+	// only supporting a previous version of the segment
+	olderVersion := ice.Version - 1
+	cfg := DefaultConfig(path)
+	cfg.supportedSegmentPlugins = map[string]map[uint32]*SegmentPlugin{}
+	cfg = cfg.WithSegmentPlugin(&SegmentPlugin{
+		Type:    ice.Type,
+		Version: olderVersion,
+		New:     ice.New,
+		Load:    ice.Load,
+		Merge:   ice.Merge,
+	}).WithSegmentVersion(olderVersion)
+
+	for _, open := range []func() error{
+		func() error {
+			_, err := OpenReader(cfg)
+			return err
+		},
+		func() error {
+			_, err := OpenWriter(cfg)
+			return err
+		},
+	} {
+		err := open()
+		var unsupported ErrUnsupportedSegment
+		if !errors.As(err, &unsupported) {
+			t.Fatalf("expected ErrUnsupportedSegment, got %v", err)
+		}
+		if unsupported.Type != ice.Type || unsupported.Version != ice.Version {
+			t.Errorf("expected unsupported %s/%d, got %s/%d", ice.Type, ice.Version,
+				unsupported.Type, unsupported.Version)
+		}
+		expectSupported := []SegmentPluginInfo{{Type: ice.Type, Version: olderVersion}}
+		if !reflect.DeepEqual(unsupported.Supported, expectSupported) {
+			t.Errorf("expected supported %v, got %v", expectSupported, unsupported.Supported)
+		}
+	}
+}
@@ -52,6 +52,9 @@ type Snapshot struct {
 
 	m2        sync.Mutex                     // Protects the fields that follow.
 	fieldTFRs map[string][]*postingsIterator // keyed by field, recycled TFR's
+
+	// set on the snapshots returned by SegmentSnapshots
+	shared *sharedStats
 }
 
 func (i *Snapshot) Segments() []SegmentSnapshot {
@@ -62,6 +65,65 @@ func (i *Snapshot) Segments() []SegmentSnapshot {
 	return rv
 }
 
+// SegmentSnapshots splits the snapshot into one snapshot for each
+// segment.  Documents keep the numbers they have in this snapshot, and
+// the collection statistics and term counts are those of this snapshot,
+// so searchers built against each score documents exactly as they would
+// against this snapshot.  The returned snapshots share the segments of
+// this snapshot, they need not be closed, but must not be used once
+// this snapshot has been closed.
+func (i *Snapshot) SegmentSnapshots() []*Snapshot {
+	shared := &sharedStats{
+		snapshot: i,
+		docFreqs: make(map[string]uint64),
+	}
+	rv := make([]*Snapshot, len(i.segment))
+	for j := range i.segment {
+		rv[j] = &Snapshot{
+			parent:  i.parent,
+			segment: []*segmentSnapshot{i.segment[j]},
+			offsets: []uint64{i.offsets[j]},
+			epoch:   i.epoch,
+			creator: i.creator,
+			shared:  shared,
+		}
+		rv[j].updateSize()
+	}
+	return rv
+}
+
+// sharedStats lets the snapshots returned by SegmentSnapshots
+// report the statistics of the snapshot they were split from
+type sharedStats struct {
+	snapshot *Snapshot
+
+	m        sync.Mutex        // Protects the fields that follow.
+	docFreqs map[string]uint64 // keyed by field and term
+}
+
+func (s *sharedStats) docFreq(field string, term []byte) (uint64, error) {
+	key := field + "\xff" + string(term)
+	s.m.Lock()
+	defer s.m.Unlock()
+	if rv, ok := s.docFreqs[key]; ok {
+		return rv, nil
+	}
+	var rv uint64
+	for _, seg := range s.snapshot.segment {
+		dict, err := seg.segment.Dictionary(field)
+		if err != nil {
+			return 0, err
+		}
+		pl, err := dict.PostingsList(term, seg.deleted, nil)
+		if err != nil {
+			return 0, err
+		}
+		rv += pl.Count()
+	}
+	s.docFreqs[key] = rv
+	return rv, nil
+}
+
 func (i *Snapshot) addRef() {
 	i.m.Lock()
 	i.refs++
@@ -89,6 +151,12 @@ func (i *Snapshot) Close() error {
 	return i.decRef()
 }
 
+// Epoch identifies the snapshot, a snapshot opened from the directory
+// may be opened again at this epoch with OpenReaderAtEpoch
+func (i *Snapshot) Epoch() uint64 {
+	return i.epoch
+}
+
 func (i *Snapshot) Size() int {
 	return int(i.size)
 }
@@ -102,10 +170,10 @@ func (i *Snapshot) updateSize() {
 
 func (i *Snapshot) newDictionary(field string,
 	makeItr func(i segment.Dictionary) segment.DictionaryIterator,
-	randomLookup bool) (*dictionary, error) {
+	randomLookup, live bool) (*dictionary, error) {
 	results := make(chan *asyncSegmentResult)
-	for _, seg := range i.segment {
-		go func(segment *segmentSnapshot) {
+	for index, seg := range i.segment {
+		go func(index int, segment *segmentSnapshot) {
 			dict, err := segment.segment.Dictionary(field)
 			if err != nil {
 				results <- &asyncSegmentResult{err: err}
@@ -113,16 +181,21 @@ func (i *Snapshot) newDictionary(field string,
 				if randomLookup {
 					results <- &asyncSegmentResult{dict: dict}
 				} else {
-					results <- &asyncSegmentResult{dictItr: makeItr(dict)}
+					results <- &asyncSegmentResult{
+						index:   index,
+						dict:    dict,
+						dictItr: makeItr(dict),
+					}
 				}
 			}
-		}(seg)
+		}(index, seg)
 	}
 
 	var err error
 	rv := &dictionary{
 		snapshot: i,
 		cursors:  make([]*segmentDictCursor, 0, len(i.segment)),
+		live:     live,
 	}
 	for count := 0; count < len(i.segment); count++ {
 		asr := <-results
@@ -136,8 +209,10 @@ func (i *Snapshot) newDictionary(field string,
 				}
 				if next != nil {
 					rv.cursors = append(rv.cursors, &segmentDictCursor{
-						itr:  asr.dictItr,
-						curr: next,
+						dict:    asr.dict,
+						deleted: i.segment[asr.index].deleted,
+						itr:     asr.dictItr,
+						curr:    next,
 					})
 				}
 			} else {
@@ -161,14 +236,25 @@ func (i *Snapshot) newDictionary(field string,
 }
 
 func (i *Snapshot) DictionaryLookup(field string) (segment.DictionaryLookup, error) {
-	return i.newDictionary(field, nil, true)
+	return i.newDictionary(field, nil, true, false)
 }
 
 func (i *Snapshot) DictionaryIterator(field string, automaton segment.Automaton, start, end []byte) (
 	segment.DictionaryIterator, error) {
 	return i.newDictionary(field, func(i segment.Dictionary) segment.DictionaryIterator {
 		return i.Iterator(automaton, start, end)
-	}, false)
+	}, false, false)
+}
+
+// LiveDictionaryIterator is like DictionaryIterator, but the count of each
+// term is the number of live documents using it, and terms only used by
+// deleted documents are skipped.  This reads the postings of each term
+// in each segment, so is slower than DictionaryIterator.
+func (i *Snapshot) LiveDictionaryIterator(field string, automaton segment.Automaton, start, end []byte) (
+	segment.DictionaryIterator, error) {
+	return i.newDictionary(field, func(i segment.Dictionary) segment.DictionaryIterator {
+		return i.Iterator(automaton, start, end)
+	}, false, true)
 }
 
 func (i *Snapshot) Fields() ([]string, error) {
@@ -211,6 +297,10 @@ func (c *collectionStats) Merge(other segment.CollectionStats) {
 }
 
 func (i *Snapshot) CollectionStats(field string) (segment.CollectionStats, error) {
+	if i.shared != nil {
+		return i.shared.snapshot.CollectionStats(field)
+	}
+
 	// first handle case where this is a virtual field
 	if vFields, ok := i.parent.config.virtualFields[field]; ok {
 		for _, vField := range vFields {
@@ -291,8 +381,17 @@ func (i *Snapshot) newPostingsIteratorAll(term string, results chan *asyncSegmen
 	return rv, nil
 }
 
+// PostingsIteratorAll returns an iterator over every live
+// document in the snapshot, in index order
+func (i *Snapshot) PostingsIteratorAll() (segment.PostingsIterator, error) {
+	return i.postingsIteratorAll("")
+}
+
 func (i *Snapshot) VisitStoredFields(number uint64, visitor segment.StoredFieldVisitor) error {
 	segmentIndex, localDocNum := i.segmentIndexAndLocalDocNumFromGlobal(number)
+	if segmentIndex < 0 || segmentIndex >= len(i.segment) {
+		return fmt.Errorf("document number %d out of bounds of the snapshot", number)
+	}
 
 	for _, vFields := range i.parent.config.virtualFields {
 		for _, vField := range vFields {
@@ -358,6 +457,14 @@ func (i *Snapshot) PostingsIterator(term []byte, field string, includeFreq,
 	rv.includeTermVectors = includeTermVectors
 	rv.currPosting = nil
 	rv.currID = 0
+	rv.docFreq = 0
+	if i.shared != nil {
+		var err error
+		rv.docFreq, err = i.shared.docFreq(field, term)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if rv.dicts == nil {
 		rv.dicts = make([]segment.Dictionary, len(i.segment))
@@ -779,21 +886,98 @@ func (i *Snapshot) DocumentValueReader(fields []string) (
 	return &documentValueReader{i: i, fields: fields, currSegmentIndex: -1}, nil
 }
 
+// WarmDocumentValues reads the document values of the fields for every
+// live document, through the same readers searches use, so the first
+// searches sorting or aggregating on the fields of an index on disk
+// need not wait for the values to be read.  No memory is held once it
+// returns, the values are only kept in the page cache of the operating
+// system, which takes as much memory as they take on disk, and may
+// evict them again under memory pressure.
+func (i *Snapshot) WarmDocumentValues(fields []string) error {
+	dvReader, err := i.DocumentValueReader(fields)
+	if err != nil {
+		return err
+	}
+	visitor := func(string, []byte) {}
+	for j, seg := range i.segment {
+		itr := seg.DocNumbersLive().Iterator()
+		for itr.HasNext() {
+			err = dvReader.VisitDocumentValues(uint64(itr.Next())+i.offsets[j], visitor)
+			if err != nil {
+				return fmt.Errorf("error warming document values of segment %d: %w", seg.id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Backup copies the segments of the snapshot, and then the snapshot
+// itself, to the remote directory, which may then be opened as an
+// index as of this snapshot.  The snapshot holds its segments open,
+// so writes may continue and segments may be merged away meanwhile.
+// Writing the snapshot last means a backup which is interrupted, or
+// canceled, has no snapshot referring to segments it lacks.  The
+// snapshot is not written atomically, an interrupted write may leave
+// a partial snapshot, which fails its checksum and is ignored when
+// the directory is opened, unless ValidateSnapshotCRC is disabled.
 func (i *Snapshot) Backup(remote Directory, cancel chan struct{}) error {
-	// first copy all the segments
+	err := remote.Setup(false)
+	if err != nil {
+		return fmt.Errorf("error setting up backup directory: %w", err)
+	}
+	_, err = i.backup(remote, nil, cancel)
+	return err
+}
+
+// BackupIncremental updates a backup of this index, made by Backup or
+// BackupIncremental, to this snapshot.  Segments are never modified
+// once written, so only those the remote directory lacks are copied,
+// their ids are returned.  The segments of earlier backups are left in
+// place, as the snapshots of those backups still refer to them.
+func (i *Snapshot) BackupIncremental(remote Directory, cancel chan struct{}) ([]uint64, error) {
+	err := remote.Setup(false)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up backup directory: %w", err)
+	}
+	ids, err := remote.List(ItemKindSegment)
+	if err != nil {
+		return nil, fmt.Errorf("error listing backed up segments: %w", err)
+	}
+	present := make(map[uint64]struct{}, len(ids))
+	for _, id := range ids {
+		present[id] = struct{}{}
+	}
+	return i.backup(remote, present, cancel)
+}
+
+// backup copies the segments of the snapshot not already present
+// and then the snapshot, returning the ids of the segments copied
+func (i *Snapshot) backup(remote Directory, present map[uint64]struct{},
+	cancel chan struct{}) ([]uint64, error) {
+	// first copy the segments
+	var copied []uint64
 	for j := range i.segment {
+		if _, ok := present[i.segment[j].id]; ok {
+			continue
+		}
 		err := remote.Persist(ItemKindSegment, i.segment[j].id, i.segment[j].segment, cancel)
 		if err != nil {
-			return fmt.Errorf("error backing up segment %d: %w", i.segment[j].id, err)
+			return copied, fmt.Errorf("error backing up segment %d: %w", i.segment[j].id, err)
 		}
+		copied = append(copied, i.segment[j].id)
 	}
 	// now persist ourself (snapshot)
 	err := remote.Persist(ItemKindSnapshot, i.epoch, i, cancel)
 	if err != nil {
-		return fmt.Errorf("error backing up snapshot %d: %w", i.epoch, err)
+		return copied, fmt.Errorf("error backing up snapshot %d: %w", i.epoch, err)
 	}
 
-	return nil
+	err = remote.Sync()
+	if err != nil {
+		return copied, fmt.Errorf("error syncing backup directory: %w", err)
+	}
+
+	return copied, nil
 }
 
 type documentValueReader struct {
@@ -807,6 +991,9 @@ type documentValueReader struct {
 func (dvr *documentValueReader) VisitDocumentValues(number uint64,
 	visitor segment.DocumentValueVisitor) (err error) {
 	segmentIndex, localDocNum := dvr.i.segmentIndexAndLocalDocNumFromGlobal(number)
+	if segmentIndex < 0 {
+		return fmt.Errorf("document number %d precedes the segments of the snapshot", number)
+	}
 	if segmentIndex >= len(dvr.i.segment) {
 		return nil
 	}
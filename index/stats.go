@@ -15,6 +15,7 @@
 package index
 
 import (
+	"reflect"
 	"sync/atomic"
 )
 
@@ -22,14 +23,23 @@ func (s *Writer) DirectoryStats() (numFilesOnDisk, numBytesUsedDisk uint64) {
 	return s.directory.Stats()
 }
 
+// Stats returns a copy of the statistics, each read atomically, as the
+// writer's goroutines update them while indexing, so it may be called
+// at any time, but the values need not be consistent with each other
 func (s *Writer) Stats() Stats {
-	// add some computed values
-	numFilesOnDisk, numBytesUsedDisk := s.directory.Stats()
+	var rv Stats
+	src := reflect.ValueOf(&s.stats).Elem()
+	dst := reflect.ValueOf(&rv).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		if field := dst.Field(i); field.CanSet() {
+			field.SetUint(atomic.LoadUint64(src.Field(i).Addr().Interface().(*uint64)))
+		}
+	}
 
-	s.stats.CurOnDiskBytes = numBytesUsedDisk
-	s.stats.CurOnDiskFiles = numFilesOnDisk
+	// add some computed values
+	rv.CurOnDiskFiles, rv.CurOnDiskBytes = s.directory.Stats()
 
-	return s.stats
+	return rv
 }
 
 // Stats tracks statistics about the index, fields that are
@@ -42,6 +52,7 @@ type Stats struct {
 
 	TotBatches        uint64
 	TotBatchesEmpty   uint64
+	TotBatchFlushes   uint64
 	TotBatchIntroTime uint64
 	MaxBatchIntroTime uint64
 
@@ -54,6 +65,14 @@ type Stats struct {
 	TotAnalysisTime uint64
 	TotIndexTime    uint64
 
+	// CurAnalysisQueued counts the documents waiting for an analysis
+	// worker, CurAnalysisBusy those being analyzed, when CurAnalysisQueued
+	// stays high while CurAnalysisBusy equals NumAnalysisWorkers,
+	// indexing is limited by the analysis workers
+	CurAnalysisQueued uint64
+	CurAnalysisBusy   uint64
+	TotAnalyzedDocs   uint64
+
 	TotIndexedPlainTextBytes uint64
 
 	TotTermSearchersStarted  uint64
@@ -89,6 +108,7 @@ type Stats struct {
 
 	TotPersisterNapPauseCompleted uint64
 	TotPersisterMergerNapBreak    uint64
+	TotPersisterMemoryPressure    uint64
 
 	TotFileMergeLoopBeg uint64
 	TotFileMergeLoopErr uint64
@@ -102,6 +122,7 @@ type Stats struct {
 	TotFileMergePlanTasks              uint64
 	TotFileMergePlanTasksDone          uint64
 	TotFileMergePlanTasksErr           uint64
+	TotFileMergePlanTasksDeferred      uint64
 	TotFileMergePlanTasksSegments      uint64
 	TotFileMergePlanTasksSegmentsEmpty uint64
 
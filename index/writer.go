@@ -17,6 +17,7 @@ package index
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -48,6 +49,14 @@ type Writer struct {
 	rootPersisted      []chan error // closed when root is persisted
 	persistedCallbacks []func(error)
 
+	// requests for the merger to force merge the segments
+	forceMerges chan *forceMergeRequest
+
+	// set to 1 while merging is paused, resuming
+	// wakes the merger through mergesResumed
+	mergesPaused  uint32
+	mergesResumed chan struct{}
+
 	// control/track goroutines
 	closeCh    chan struct{}
 	asyncTasks sync.WaitGroup
@@ -61,6 +70,8 @@ func OpenWriter(config Config) (*Writer, error) {
 		deletionPolicy: config.DeletionPolicyFunc(),
 		directory:      config.DirectoryFunc(),
 		closeCh:        make(chan struct{}),
+		forceMerges:    make(chan *forceMergeRequest),
+		mergesResumed:  make(chan struct{}, 1),
 	}
 
 	// start the requested number of analysis workers
@@ -71,9 +82,9 @@ func OpenWriter(config Config) (*Writer, error) {
 	}
 
 	var err error
-	rv.segPlugin, err = loadSegmentPlugin(config.supportedSegmentPlugins, config.SegmentType, config.SegmentVersion)
+	rv.segPlugin, err = loadSegmentPlugin(config, config.SegmentType, config.SegmentVersion)
 	if err != nil {
-		return nil, fmt.Errorf("error loading segment plugin: %v", err)
+		return nil, fmt.Errorf("error loading segment plugin: %w", err)
 	}
 
 	rv.root = &Snapshot{
@@ -172,22 +183,29 @@ func (s *Writer) loadSnapshots() (lastPersistedEpoch, nextSnapshotEpoch uint64,
 		// but we failed to successfully load anything
 		// this results in losing all data and starting from scratch
 		// should require, some more explicit decision, for now error out
-		return 0, 0, fmt.Errorf("existing snapshots found, but none could be loaded, exiting")
+		return 0, 0, fmt.Errorf("existing snapshots found, but none could be loaded, exiting: %w", err)
 	}
 	return lastPersistedEpoch, nextSnapshotEpoch, nil
 }
 
 func (s *Writer) fireEvent(kind int, dur time.Duration) {
+	s.fireEventBytes(kind, dur, 0)
+}
+
+func (s *Writer) fireEventBytes(kind int, dur time.Duration, bytes uint64) {
 	if s.config.EventCallback != nil {
 		atomic.AddUint64(&s.stats.TotEventFired, 1)
-		s.config.EventCallback(Event{Kind: kind, Chill: s, Duration: dur})
+		s.config.EventCallback(Event{Kind: kind, Chill: s, Duration: dur, Bytes: bytes})
 		atomic.AddUint64(&s.stats.TotEventReturned, 1)
 	}
 }
 
-func (s *Writer) fireAsyncError(err error) {
+func (s *Writer) fireAsyncError(phase AsyncPhase, err error) {
 	if s.config.AsyncError != nil {
-		s.config.AsyncError(err)
+		s.config.AsyncError(&AsyncError{
+			Phase: phase,
+			Err:   err,
+		})
 	}
 	atomic.AddUint64(&s.stats.TotOnErrors, 1)
 }
@@ -222,27 +240,58 @@ func (s *Writer) close() (err error) {
 	return nil
 }
 
-// Batch applies a batch of changes to the index atomically
-func (s *Writer) Batch(batch *Batch) (err error) {
+// Batch applies a batch of changes to the index atomically, unless
+// the batch exceeds the configured MaxBatchBytes.
+//
+// Batch analyzes and introduces the batch, it is safe to call from
+// several goroutines at once, each with its own batch.  Their documents
+// are analyzed in parallel, while the introducer applies the batches one
+// at a time, each observing the updates and deletes of those before it.
+func (s *Writer) Batch(batch *Batch) error {
+	return s.batch(batch, s.config.MaxBatchBytes)
+}
+
+// ExecuteBatch applies a batch of changes to the index atomically, as
+// Batch does, but never splits it, whatever the configured MaxBatchBytes.
+func (s *Writer) ExecuteBatch(batch *Batch) error {
+	return s.batch(batch, 0)
+}
+
+// batch applies the batch, splitting it into segments of at most
+// maxBatchBytes, when it is positive
+func (s *Writer) batch(batch *Batch, maxBatchBytes int) (err error) {
 	start := time.Now()
 
 	defer func() {
 		s.fireEvent(EventKindBatchIntroduction, time.Since(start))
 	}()
 
+	batch.compact()
+
 	var numUpdates = len(batch.documents)
 	var numDeletes = len(batch.ids)
 
 	var allDocsAnalyzed sync.WaitGroup
 
-	for _, doc := range batch.documents {
+	for i, doc := range batch.documents {
 		allDocsAnalyzed.Add(1)
-		doc := doc // capture variable
+		i, doc := i, doc // capture variables
 		if doc != nil {
 			aw := func() {
-				doc.Analyze()
+				atomic.AddUint64(&s.stats.CurAnalysisQueued, ^uint64(0))
+				atomic.AddUint64(&s.stats.CurAnalysisBusy, 1)
+				s.config.analyze(doc)
+				batch.documents[i] = s.config.withComputedFields(doc)
+				atomic.AddUint64(&s.stats.CurAnalysisBusy, ^uint64(0))
+				atomic.AddUint64(&s.stats.TotAnalyzedDocs, 1)
 				allDocsAnalyzed.Done()
 			}
+			atomic.AddUint64(&s.stats.CurAnalysisQueued, 1)
+			if s.config.AnalysisChan == nil {
+				// synchronous analysis, in document order
+				aw()
+				continue
+			}
 			// put the work on the queue
 			s.config.AnalysisChan <- aw
 		}
@@ -257,23 +306,32 @@ func (s *Writer) Batch(batch *Batch) (err error) {
 	// notify handlers that we're about to introduce a segment
 	s.fireEvent(EventKindBatchIntroductionStart, 0)
 
-	var newSegment *segmentWrapper
-	var bufBytes uint64
-	if numUpdates > 0 {
-		newSegment, bufBytes, err = s.newSegment(batch.documents)
-		if err != nil {
-			return err
+	documents := batch.documents
+	idTerms := batch.ids
+	var batchBytes uint64
+	if maxBatchBytes > 0 {
+		// flush each chunk but the last as its own persisted
+		// segment, the ids are obsoleted along with the first
+		chunks := splitDocumentsByBytes(documents, maxBatchBytes)
+		for _, chunk := range chunks[:len(chunks)-1] {
+			err = s.introduceDocuments(chunk, idTerms, nil, true, &batchBytes)
+			if err != nil {
+				atomic.AddUint64(&s.stats.TotOnErrors, 1)
+				return err
+			}
+			atomic.AddUint64(&s.stats.TotBatchFlushes, 1)
+			idTerms = nil
 		}
-		atomic.AddUint64(&s.stats.newSegBufBytesAdded, bufBytes)
-	} else {
-		atomic.AddUint64(&s.stats.TotBatchesEmpty, 1)
+		documents = chunks[len(chunks)-1]
 	}
 
-	err = s.prepareSegment(newSegment, batch.ids, nil, batch.PersistedCallback())
+	persistedCallback := batch.PersistedCallback()
+	if s.config.BatchCallback != nil {
+		persistedCallback = s.batchPersistedCallback(persistedCallback, start,
+			numUpdates, numDeletes, &batchBytes)
+	}
+	err = s.introduceDocuments(documents, idTerms, persistedCallback, false, &batchBytes)
 	if err != nil {
-		if newSegment != nil {
-			_ = newSegment.Close()
-		}
 		atomic.AddUint64(&s.stats.TotOnErrors, 1)
 	} else {
 		atomic.AddUint64(&s.stats.TotUpdates, uint64(numUpdates))
@@ -281,14 +339,63 @@ func (s *Writer) Batch(batch *Batch) (err error) {
 		atomic.AddUint64(&s.stats.TotBatches, 1)
 	}
 
-	atomic.AddUint64(&s.stats.newSegBufBytesRemoved, bufBytes)
 	atomic.AddUint64(&s.stats.TotIndexTime, uint64(time.Since(indexStart)))
 
 	return err
 }
 
+// batchPersistedCallback returns the persisted callback of a batch
+// which also reports it to the BatchCallback, the bytes of the segments
+// of the batch are only read once it is persisted, by which time they
+// have all been added
+func (s *Writer) batchPersistedCallback(persistedCallback func(error), start time.Time,
+	numUpdates, numDeletes int, batchBytes *uint64) func(error) {
+	return func(err error) {
+		if persistedCallback != nil {
+			persistedCallback(err)
+		}
+		if err == nil {
+			s.config.BatchCallback(BatchStats{
+				Documents: numUpdates,
+				Deletes:   numDeletes,
+				Bytes:     *batchBytes,
+				Duration:  time.Since(start),
+			})
+		}
+	}
+}
+
+// introduceDocuments builds a segment from the analyzed documents, and
+// introduces it, obsoleting the idTerms, waiting for it to be persisted
+// if the batch is safe or persist is true, the size of the segment
+// is added to batchBytes before it is introduced
+func (s *Writer) introduceDocuments(documents []segment.Document, idTerms []segment.Term,
+	persistedCallback func(error), persist bool, batchBytes *uint64) error {
+	var newSegment *segmentWrapper
+	var bufBytes uint64
+	var err error
+	if len(documents) > 0 {
+		newSegment, bufBytes, err = s.newSegment(documents)
+		if err != nil {
+			return err
+		}
+		*batchBytes += bufBytes
+		atomic.AddUint64(&s.stats.newSegBufBytesAdded, bufBytes)
+	} else {
+		atomic.AddUint64(&s.stats.TotBatchesEmpty, 1)
+	}
+
+	err = s.prepareSegment(newSegment, idTerms, nil, persistedCallback, persist)
+	if err != nil && newSegment != nil {
+		_ = newSegment.Close()
+	}
+
+	atomic.AddUint64(&s.stats.newSegBufBytesRemoved, bufBytes)
+	return err
+}
+
 func (s *Writer) prepareSegment(newSegment *segmentWrapper, idTerms []segment.Term,
-	internalOps map[string][]byte, persistedCallback func(error)) error {
+	internalOps map[string][]byte, persistedCallback func(error), persist bool) error {
 	// new introduction
 	introduction := &segmentIntroduction{
 		id:                atomic.AddUint64(&s.nextSegmentID, 1),
@@ -300,7 +407,7 @@ func (s *Writer) prepareSegment(newSegment *segmentWrapper, idTerms []segment.Te
 		persistedCallback: persistedCallback,
 	}
 
-	if !s.config.UnsafeBatch {
+	if !s.config.UnsafeBatch || persist {
 		introduction.persisted = make(chan error, 1)
 	}
 
@@ -409,47 +516,108 @@ func (s *Writer) currentEpoch() uint64 {
 }
 
 func OpenReader(config Config) (*Snapshot, error) {
+	parent, snapshotEpochs, err := openReaderParent(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// start with most recent
+	var indexSnapshot *Snapshot
+	for _, snapshotEpoch := range snapshotEpochs {
+		indexSnapshot, err = parent.loadSnapshot(snapshotEpoch)
+		if err != nil {
+			log.Printf("error loading snapshot epoch: %d: %v", snapshotEpoch, err)
+			// but keep going and hope there is another newer snapshot that works
+			continue
+		}
+		break
+	}
+	if indexSnapshot == nil {
+		if err != nil {
+			return nil, fmt.Errorf("unable to find a usable snapshot: %w", err)
+		}
+		return nil, fmt.Errorf("unable to find a usable snapshot")
+	}
+
+	return indexSnapshot, nil
+}
+
+// ErrSnapshotNotFound is returned when opening a snapshot
+// which was never persisted, or has since been removed
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// OpenReaderAtEpoch opens the snapshot persisted at the epoch, rather
+// than the latest, it is only found if the deletion policy has kept it
+func OpenReaderAtEpoch(config Config, epoch uint64) (*Snapshot, error) {
+	parent, snapshotEpochs, err := openReaderParent(config)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshotEpoch := range snapshotEpochs {
+		if snapshotEpoch == epoch {
+			indexSnapshot, err := parent.loadSnapshot(epoch)
+			if err != nil {
+				return nil, fmt.Errorf("error loading snapshot epoch %d: %w", epoch, err)
+			}
+			return indexSnapshot, nil
+		}
+	}
+	return nil, fmt.Errorf("epoch %d: %w", epoch, ErrSnapshotNotFound)
+}
+
+// openReaderParent prepares the writer a read-only snapshot
+// refers to, returning the epochs of the persisted snapshots
+func openReaderParent(config Config) (*Writer, []uint64, error) {
 	parent := &Writer{
 		config:    config,
 		directory: config.DirectoryFunc(),
 	}
 
 	var err error
-	parent.segPlugin, err = loadSegmentPlugin(config.supportedSegmentPlugins,
-		config.SegmentType, config.SegmentVersion)
+	parent.segPlugin, err = loadSegmentPlugin(config, config.SegmentType, config.SegmentVersion)
 	if err != nil {
-		return nil, fmt.Errorf("error loadign segment plugin: %v", err)
+		return nil, nil, fmt.Errorf("error loading segment plugin: %w", err)
 	}
 
 	err = parent.directory.Setup(true)
 	if err != nil {
-		return nil, fmt.Errorf("error setting up directory: %w", err)
+		return nil, nil, fmt.Errorf("error setting up directory: %w", err)
 	}
 
 	snapshotEpochs, err := parent.directory.List(ItemKindSnapshot)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parent, snapshotEpochs, nil
+}
+
+func (s *Writer) loadSnapshot(epoch uint64) (*Snapshot, error) {
+	snapshot, err := s.readSnapshot(epoch)
 	if err != nil {
 		return nil, err
 	}
 
-	// start with most recent
-	var indexSnapshot *Snapshot
-	for _, snapshotEpoch := range snapshotEpochs {
-		indexSnapshot, err = parent.loadSnapshot(snapshotEpoch)
+	var running uint64
+	for _, segSnapshot := range snapshot.segment {
+		segPlugin, err := loadSegmentPlugin(s.config, segSnapshot.segmentType, segSnapshot.segmentVersion)
 		if err != nil {
-			log.Printf("error loading snapshot epoch: %d: %v", snapshotEpoch, err)
-			// but keep going and hope there is another newer snapshot that works
-			continue
+			return nil, fmt.Errorf("error loading required segment plugin: %w", err)
 		}
-		break
-	}
-	if indexSnapshot == nil {
-		return nil, fmt.Errorf("unable to find a usable snapshot")
+		segSnapshot.segment, err = s.loadSegment(segSnapshot.id, segPlugin)
+		if err != nil {
+			return nil, fmt.Errorf("error opening segment %d: %w", segSnapshot.id, err)
+		}
+
+		snapshot.offsets = append(snapshot.offsets, running)
+		running += segSnapshot.segment.Count()
 	}
 
-	return indexSnapshot, nil
+	return snapshot, nil
 }
 
-func (s *Writer) loadSnapshot(epoch uint64) (*Snapshot, error) {
+// readSnapshot reads the snapshot persisted at the
+// epoch, without opening the segments it refers to
+func (s *Writer) readSnapshot(epoch uint64) (*Snapshot, error) {
 	snapshot := &Snapshot{
 		parent:  s,
 		epoch:   epoch,
@@ -504,22 +672,57 @@ func (s *Writer) loadSnapshot(epoch uint64) (*Snapshot, error) {
 		}
 	}
 
-	var running uint64
-	for _, segSnapshot := range snapshot.segment {
-		segPlugin, err := loadSegmentPlugin(s.config.supportedSegmentPlugins, segSnapshot.segmentType, segSnapshot.segmentVersion)
+	return snapshot, nil
+}
+
+// SnapshotInfo describes a snapshot persisted in the directory
+type SnapshotInfo struct {
+	Epoch uint64
+	// Created is when the snapshot was persisted, as reported
+	// by the directory, zero when the directory does not
+	// implement ModTimeDirectory
+	Created time.Time
+	// Segments is the number of segments in the snapshot
+	Segments int
+	// Documents is the number of live documents, zero for
+	// snapshots persisted by older versions, which did not
+	// record the number of documents in each segment
+	Documents uint64
+}
+
+// Snapshots describes the snapshots persisted in the directory of
+// the index, newest first, those which the deletion policy has not
+// yet removed, and which may be opened with OpenReaderAtEpoch.
+// Only the snapshots are read, not the segments they refer to.
+func (i *Snapshot) Snapshots() ([]SnapshotInfo, error) {
+	epochs, err := i.parent.directory.List(ItemKindSnapshot)
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]SnapshotInfo, 0, len(epochs))
+	for _, epoch := range epochs {
+		snapshot, err := i.parent.readSnapshot(epoch)
 		if err != nil {
-			return nil, fmt.Errorf("error loading required segment plugin: %v", err)
+			// removed since listed, or unusable, either way
+			// it cannot be opened, so is not described
+			continue
 		}
-		segSnapshot.segment, err = s.loadSegment(segSnapshot.id, segPlugin)
-		if err != nil {
-			return nil, fmt.Errorf("error opening segment %d: %w", segSnapshot.id, err)
+		info := SnapshotInfo{
+			Epoch:    epoch,
+			Segments: len(snapshot.segment),
 		}
-
-		snapshot.offsets = append(snapshot.offsets, running)
-		running += segSnapshot.segment.Count()
+		if mtd, ok := i.parent.directory.(ModTimeDirectory); ok {
+			info.Created, _ = mtd.ModTime(ItemKindSnapshot, epoch)
+		}
+		for _, ss := range snapshot.segment {
+			info.Documents += ss.docNum
+			if ss.deleted != nil && ss.docNum > 0 {
+				info.Documents -= ss.deleted.GetCardinality()
+			}
+		}
+		rv = append(rv, info)
 	}
-
-	return snapshot, nil
+	return rv, nil
 }
 
 func (s *Writer) loadSegment(id uint64, plugin *SegmentPlugin) (*segmentWrapper, error) {
@@ -534,14 +737,18 @@ func (s *Writer) loadSegment(id uint64, plugin *SegmentPlugin) (*segmentWrapper,
 		}
 		return nil, fmt.Errorf("error loading segment: %v", err)
 	}
-	return &segmentWrapper{
+	rv := &segmentWrapper{
 		Segment: seg,
 		refCounter: &closeOnLastRefCounter{
 			closer: closer,
 			refs:   1,
 		},
 		persisted: true,
-	}, nil
+	}
+	if mtd, ok := s.directory.(ModTimeDirectory); ok {
+		rv.created, _ = mtd.ModTime(ItemKindSegment, id)
+	}
+	return rv, nil
 }
 
 func analysisWorker(q chan func(), closeCh chan struct{}) {
@@ -48,9 +48,9 @@ func OpenOfflineWriter(config Config) (writer *WriterOffline, err error) {
 		return nil, fmt.Errorf("error setting up directory: %w", err)
 	}
 
-	writer.segPlugin, err = loadSegmentPlugin(config.supportedSegmentPlugins, config.SegmentType, config.SegmentVersion)
+	writer.segPlugin, err = loadSegmentPlugin(config, config.SegmentType, config.SegmentVersion)
 	if err != nil {
-		return nil, fmt.Errorf("error loading segment plugin: %v", err)
+		return nil, fmt.Errorf("error loading segment plugin: %w", err)
 	}
 
 	return writer, nil
@@ -60,17 +60,19 @@ func (s *WriterOffline) Batch(batch *Batch) (err error) {
 	s.m.Lock()
 	defer s.m.Unlock()
 
+	batch.compact()
 	if len(batch.documents) == 0 {
 		return nil
 	}
 
-	for _, doc := range batch.documents {
+	for i, doc := range batch.documents {
 		if doc != nil {
-			doc.Analyze()
+			s.config.analyze(doc)
+			batch.documents[i] = s.config.withComputedFields(doc)
 		}
 	}
 
-	newSegment, _, err := s.segPlugin.New(batch.documents, s.config.NormCalc)
+	newSegment, _, err := s.segPlugin.New(batch.documents, s.config.normCalc())
 	if err != nil {
 		return err
 	}
@@ -15,14 +15,18 @@
 package index
 
 import (
+	"errors"
 	"io/ioutil"
 	"math"
 	"os"
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	segment "github.com/blugelabs/bluge_segment_api"
 )
@@ -1201,6 +1205,91 @@ func TestConcurrentUpdate(t *testing.T) {
 	}
 }
 
+func TestConcurrentBatches(t *testing.T) {
+	cfg, cleanup := CreateConfig("TestConcurrentBatches")
+	defer func() {
+		err := cleanup()
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+
+	idx, err := OpenWriter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = idx.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// every goroutine updates an overlapping range of ids
+	const numWriters = 16
+	const numBatches = 10
+	const batchSize = 20
+	const numIDs = 200
+	var wg sync.WaitGroup
+	for w := 0; w < numWriters; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for b := 0; b < numBatches; b++ {
+				batch := NewBatch()
+				for d := 0; d < batchSize; d++ {
+					id := strconv.Itoa((w*batchSize + b*7 + d) % numIDs)
+					doc := &FakeDocument{
+						NewFakeField("_id", id, true, false, false),
+						NewFakeField("writer", strconv.Itoa(w), true, false, false),
+					}
+					batch.Update(testIdentifier(id), doc)
+				}
+				err2 := idx.Batch(batch)
+				if err2 != nil {
+					t.Errorf("error executing batch: %v", err2)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	r, err := idx.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	seen := map[string]bool{}
+	for w := 0; w < numWriters; w++ {
+		for b := 0; b < numBatches; b++ {
+			for d := 0; d < batchSize; d++ {
+				seen[strconv.Itoa((w*batchSize+b*7+d)%numIDs)] = true
+			}
+		}
+	}
+	count, err := r.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != uint64(len(seen)) {
+		t.Errorf("expected %d documents, got %d", len(seen), count)
+	}
+	for id := range seen {
+		// fails unless exactly one live document has the id
+		_, err = findNumberByID(r, id)
+		if err != nil {
+			t.Errorf("document %s: %v", id, err)
+		}
+	}
+}
+
 func TestLargeField(t *testing.T) {
 	cfg, cleanup := CreateConfig("TestLargeField")
 	defer func() {
@@ -1632,3 +1721,371 @@ func TestIndexSeekBackwardsStats(t *testing.T) {
 			idx.stats.TotTermSearchersFinished)
 	}
 }
+
+// blockingDocument waits to be released before analysis
+type blockingDocument struct {
+	*FakeDocument
+	release chan struct{}
+}
+
+func (b *blockingDocument) Analyze() {
+	<-b.release
+	b.FakeDocument.Analyze()
+}
+
+func TestAnalysisQueueStats(t *testing.T) {
+	cfg, cleanup := CreateConfig("TestAnalysisQueueStats")
+	defer func() {
+		err := cleanup()
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	cfg.NumAnalysisWorkers = 1
+
+	idx, err := OpenWriter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cerr := idx.Close()
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+	}()
+
+	release := make(chan struct{})
+	b := NewBatch()
+	for _, id := range []string{"1", "2", "3"} {
+		b.Update(testIdentifier(id), &blockingDocument{
+			FakeDocument: &FakeDocument{
+				NewFakeField("_id", id, true, false, false),
+			},
+			release: release,
+		})
+	}
+	batchErr := make(chan error)
+	go func() {
+		batchErr <- idx.Batch(b)
+	}()
+
+	// the single worker is busy, with more documents waiting
+	var busy, queued uint64
+	for i := 0; i < 1000; i++ {
+		busy = atomic.LoadUint64(&idx.stats.CurAnalysisBusy)
+		queued = atomic.LoadUint64(&idx.stats.CurAnalysisQueued)
+		if busy == 1 && queued > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if busy != 1 || queued == 0 {
+		t.Errorf("expected 1 busy worker and queued documents, got %d busy %d queued", busy, queued)
+	}
+
+	close(release)
+	err = <-batchErr
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := idx.Stats()
+	if stats.CurAnalysisBusy != 0 || stats.CurAnalysisQueued != 0 {
+		t.Errorf("expected idle analysis, got %d busy %d queued",
+			stats.CurAnalysisBusy, stats.CurAnalysisQueued)
+	}
+	if stats.TotAnalyzedDocs != 3 {
+		t.Errorf("expected 3 analyzed documents, got %d", stats.TotAnalyzedDocs)
+	}
+}
+
+func TestMaxBatchBytes(t *testing.T) {
+	cfg, cleanup := CreateConfig("TestMaxBatchBytes")
+	defer func() {
+		err := cleanup()
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	cfg = cfg.WithMaxBatchBytes(1000)
+	cfg.UnsafeBatch = true
+
+	idx, err := OpenWriter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cerr := idx.Close()
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+	}()
+
+	body := strings.Repeat("x", 100)
+	b := NewBatch()
+	for i := 0; i < 100; i++ {
+		id := strconv.Itoa(i)
+		b.Update(testIdentifier(id), &FakeDocument{
+			NewFakeField("_id", id, true, false, false),
+			NewFakeField("body", body, true, false, false),
+		})
+	}
+	err = idx.Batch(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := idx.Stats()
+	if stats.TotBatchFlushes == 0 {
+		t.Errorf("expected the batch to be flushed")
+	}
+	if stats.TotPersistedSegments < 2 {
+		t.Errorf("expected multiple persisted segments, got %d", stats.TotPersistedSegments)
+	}
+	if stats.TotBatches != 1 || stats.TotUpdates != 100 {
+		t.Errorf("expected 1 batch of 100 updates, got %d batches %d updates",
+			stats.TotBatches, stats.TotUpdates)
+	}
+
+	reader, err := idx.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cerr := reader.Close()
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+	}()
+	docCount, err := reader.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if docCount != 100 {
+		t.Errorf("expected 100 documents, got %d", docCount)
+	}
+}
+
+func TestMemoryPressureFunc(t *testing.T) {
+	cfg, cleanup := CreateConfig("TestMemoryPressureFunc")
+	defer func() {
+		err := cleanup()
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	var pressure int32
+	cfg = cfg.WithMemoryPressureFunc(func() bool {
+		return atomic.LoadInt32(&pressure) == 1
+	})
+
+	idx, err := OpenWriter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cerr := idx.Close()
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+	}()
+
+	// naps interrupted by the merger count as pauses too
+	pauses := func(stats Stats) uint64 {
+		return stats.TotPersisterNapPauseCompleted + stats.TotPersisterMergerNapBreak
+	}
+
+	var next int
+	indexBatches := func(n int) {
+		for i := 0; i < n; i++ {
+			id := strconv.Itoa(next)
+			next++
+			b := NewBatch()
+			b.Update(testIdentifier(id), &FakeDocument{
+				NewFakeField("_id", id, true, false, false),
+			})
+			err := idx.Batch(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// without pressure the persister naps between snapshots
+	indexBatches(5)
+	stats := idx.Stats()
+	if pauses(stats) == 0 {
+		t.Errorf("expected the persister to nap without memory pressure")
+	}
+	if stats.TotPersisterMemoryPressure != 0 {
+		t.Errorf("expected no memory pressure, got %d", stats.TotPersisterMemoryPressure)
+	}
+
+	// under pressure it persists immediately
+	atomic.StoreInt32(&pressure, 1)
+	// once a batch is persisted under pressure, no earlier nap is in progress
+	indexBatches(1)
+	naps := pauses(idx.Stats())
+	indexBatches(5)
+	stats = idx.Stats()
+	if stats.TotPersisterMemoryPressure == 0 {
+		t.Errorf("expected the persister to observe memory pressure")
+	}
+	if pauses(stats) != naps {
+		t.Errorf("expected no naps under memory pressure, got %d more", pauses(stats)-naps)
+	}
+
+	// and naps again once the pressure is relieved
+	atomic.StoreInt32(&pressure, 0)
+	indexBatches(5)
+	stats = idx.Stats()
+	if pauses(stats) == naps {
+		t.Errorf("expected the persister to nap once pressure is relieved")
+	}
+}
+
+func TestMergeWindow(t *testing.T) {
+	cfg, cleanup := CreateConfig("TestMergeWindow")
+	defer func() {
+		err := cleanup()
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	defer func(interval time.Duration) {
+		MergeWindowCheckInterval = interval
+	}(MergeWindowCheckInterval)
+	MergeWindowCheckInterval = 10 * time.Millisecond
+
+	var open int32
+	cfg = cfg.WithMergeWindow(func() bool {
+		return atomic.LoadInt32(&open) == 1
+	})
+	cfg.MergePlanOptions.FloorSegmentSize = 10
+
+	idx, err := OpenWriter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cerr := idx.Close()
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+	}()
+
+	// each batch persists a segment larger than the floor segment size
+	for i := 0; i < 30; i++ {
+		b := NewBatch()
+		for j := 0; j < 20; j++ {
+			id := strconv.Itoa(i*20 + j)
+			b.Update(testIdentifier(id), &FakeDocument{
+				NewFakeField("_id", id, true, false, false),
+			})
+		}
+		err = idx.Batch(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitForStat := func(stat func(Stats) bool) bool {
+		for i := 0; i < 500; i++ {
+			if stat(idx.Stats()) {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	if !waitForStat(func(stats Stats) bool { return stats.TotFileMergePlanTasksDeferred > 0 }) {
+		t.Fatalf("expected merges to be deferred while the window is closed")
+	}
+	stats := idx.Stats()
+	if stats.TotFileMergeSegments != 0 {
+		t.Errorf("expected no segments merged while the window is closed, got %d", stats.TotFileMergeSegments)
+	}
+
+	atomic.StoreInt32(&open, 1)
+	if !waitForStat(func(stats Stats) bool { return stats.TotFileMergeSegments > 0 }) {
+		t.Errorf("expected deferred merges to proceed once the window opens")
+	}
+}
+
+type failingPersistDirectory struct {
+	Directory
+	fail int32
+}
+
+var errPersistFailed = errors.New("persist failed")
+
+func (d *failingPersistDirectory) Persist(kind string, id uint64, w WriterTo, closeCh chan struct{}) error {
+	if atomic.LoadInt32(&d.fail) == 1 {
+		return errPersistFailed
+	}
+	return d.Directory.Persist(kind, id, w, closeCh)
+}
+
+func TestAsyncErrorPhase(t *testing.T) {
+	dir := &failingPersistDirectory{
+		Directory: NewInMemoryDirectory(),
+	}
+	cfg, cleanup := CreateConfig("TestAsyncErrorPhase")
+	defer func() {
+		err := cleanup()
+		if err != nil {
+			t.Log(err)
+		}
+	}()
+	cfg.DirectoryFunc = func() Directory {
+		return dir
+	}
+	cfg.UnsafeBatch = true
+	asyncErrs := make(chan error, 1)
+	cfg.AsyncError = func(err error) {
+		select {
+		case asyncErrs <- err:
+		default:
+		}
+	}
+
+	idx, err := OpenWriter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&dir.fail, 1)
+	b := NewBatch()
+	b.Update(testIdentifier("1"), &FakeDocument{
+		NewFakeField("_id", "1", true, false, false),
+	})
+	err = idx.Batch(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var asyncErr error
+	select {
+	case asyncErr = <-asyncErrs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an async error")
+	}
+	atomic.StoreInt32(&dir.fail, 0)
+
+	var typed *AsyncError
+	if !errors.As(asyncErr, &typed) {
+		t.Fatalf("expected *AsyncError, got %T", asyncErr)
+	}
+	if typed.Phase != AsyncPhasePersist {
+		t.Errorf("expected phase %s, got %s", AsyncPhasePersist, typed.Phase)
+	}
+	if !errors.Is(asyncErr, errPersistFailed) {
+		t.Errorf("expected error to wrap the persist failure, got %v", asyncErr)
+	}
+
+	err = idx.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
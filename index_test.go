@@ -17,12 +17,14 @@ package bluge
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"math/rand"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -1263,6 +1265,347 @@ func TestBackup(t *testing.T) {
 	}
 }
 
+func TestBackupTo(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	for i := 0; i < 10; i++ {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewTextField("name", "marty").StoreValue())
+		err = writer.Update(doc.ID(), doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// writes after the reader was opened are not backed up
+	doc := NewDocument("late").
+		AddField(NewTextField("name", "marty").StoreValue())
+	err = writer.Update(doc.ID(), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Delete(Identifier("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup := index.NewInMemoryDirectory()
+	err = reader.BackupTo(backup, nil)
+	if err != nil {
+		t.Fatalf("error backing up index: %v", err)
+	}
+	err = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err = OpenReader(DefaultConfigWithDirectory(func() index.Directory {
+		return backup
+	}))
+	if err != nil {
+		t.Fatalf("error opening backup: %v", err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	req := NewTopNSearch(20, NewTermQuery("marty").SetField("name")).WithStandardAggregations()
+	dmi, err := reader.Search(context.Background(), req)
+	if err != nil {
+		t.Fatalf("error searching: %v", err)
+	}
+	if dmi.Aggregations().Count() != 10 {
+		t.Errorf("expected 10 matches, got %d", dmi.Aggregations().Count())
+	}
+	dmi, err = reader.Search(context.Background(), NewTopNSearch(10, NewTermQuery("0").SetField(_idField)))
+	if err != nil {
+		t.Fatalf("error searching: %v", err)
+	}
+	next, err := dmi.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == nil {
+		t.Errorf("expected the document deleted after the backup was taken")
+	}
+}
+
+func TestBackupIncremental(t *testing.T) {
+	tmpBackupPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpBackupPath)
+	backup := index.NewFileSystemDirectory(tmpBackupPath)
+
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	indexDocs := func(from, to int) {
+		batch := NewBatch()
+		for i := from; i < to; i++ {
+			doc := NewDocument(strconv.Itoa(i)).
+				AddField(NewTextField("name", "marty"))
+			batch.Update(doc.ID(), doc)
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// backs up the index, checking the segments copied
+	// are those not in the segments of the last backup
+	backupIncremental := func(last map[uint64]bool) map[uint64]bool {
+		reader, err := writer.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		current := make(map[uint64]bool)
+		var expected []uint64
+		for _, stat := range reader.SegmentStats() {
+			current[stat.ID] = true
+			if !last[stat.ID] {
+				expected = append(expected, stat.ID)
+			}
+		}
+		copied, err := reader.BackupIncremental(backup, nil)
+		if err != nil {
+			t.Fatalf("error backing up: %v", err)
+		}
+		sort.Slice(copied, func(i, j int) bool { return copied[i] < copied[j] })
+		sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+		if len(copied) == 0 || !reflect.DeepEqual(copied, expected) {
+			t.Errorf("expected segments %v to be copied, got %v", expected, copied)
+		}
+		return current
+	}
+	// opens the backup, checking the documents it holds
+	checkBackup := func(expected uint64) {
+		reader, err := OpenReader(DefaultConfig(tmpBackupPath))
+		if err != nil {
+			t.Fatalf("error opening backup: %v", err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		count, err := reader.Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expected {
+			t.Errorf("expected %d documents in the backup, got %d", expected, count)
+		}
+		req := NewTopNSearch(10, NewTermQuery("marty").SetField("name")).WithStandardAggregations()
+		dmi, err := reader.Search(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dmi.Aggregations().Count() != expected {
+			t.Errorf("expected %d matches in the backup, got %d", expected, dmi.Aggregations().Count())
+		}
+	}
+
+	indexDocs(0, 10)
+	indexDocs(10, 20)
+	segments := backupIncremental(nil)
+	checkBackup(20)
+
+	indexDocs(20, 30)
+	err = writer.Delete(Identifier("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backupIncremental(segments)
+	checkBackup(29)
+}
+
+func TestOpenReaderAtEpoch(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	config := DefaultConfig(tmpIndexPath)
+	config.indexConfig.DeletionPolicyFunc = func() index.DeletionPolicy {
+		return index.NewKeepNLatestDeletionPolicy(10)
+	}
+	writer, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexDocs := func(from, to int) {
+		batch := NewBatch()
+		for i := from; i < to; i++ {
+			doc := NewDocument(strconv.Itoa(i)).
+				AddField(NewTextField("name", "marty"))
+			batch.Update(doc.ID(), doc)
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// returns the epoch of the latest persisted snapshot
+	latestEpoch := func() uint64 {
+		reader, err := OpenReader(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		return reader.Epoch()
+	}
+	indexDocs(0, 10)
+	earlier := latestEpoch()
+	indexDocs(10, 20)
+	later := latestEpoch()
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if later <= earlier {
+		t.Fatalf("expected a later epoch than %d, got %d", earlier, later)
+	}
+
+	for epoch, expected := range map[uint64]uint64{earlier: 10, later: 20} {
+		reader, err := OpenReaderAtEpoch(config, epoch)
+		if err != nil {
+			t.Fatalf("error opening epoch %d: %v", epoch, err)
+		}
+		if reader.Epoch() != epoch {
+			t.Errorf("expected epoch %d, got %d", epoch, reader.Epoch())
+		}
+		count, err := reader.Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expected {
+			t.Errorf("expected %d documents at epoch %d, got %d", expected, epoch, count)
+		}
+		err = reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = OpenReaderAtEpoch(config, later+100)
+	if !errors.Is(err, index.ErrSnapshotNotFound) {
+		t.Errorf("expected snapshot not found, got %v", err)
+	}
+
+	// once only the latest snapshot is kept, the earlier is removed
+	config.indexConfig.DeletionPolicyFunc = func() index.DeletionPolicy {
+		return index.NewKeepNLatestDeletionPolicy(1)
+	}
+	writer, err = OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = OpenReaderAtEpoch(config, earlier)
+	if !errors.Is(err, index.ErrSnapshotNotFound) {
+		t.Errorf("expected snapshot not found for the removed epoch, got %v", err)
+	}
+}
+
+func TestReaderSnapshots(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	config := DefaultConfig(tmpIndexPath)
+	config.indexConfig.DeletionPolicyFunc = func() index.DeletionPolicy {
+		return index.NewKeepNLatestDeletionPolicy(10)
+	}
+	writer, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots := func() []index.SnapshotInfo {
+		reader, err := writer.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		rv, err := reader.Snapshots()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i < len(rv); i++ {
+			if rv[i].Epoch >= rv[i-1].Epoch {
+				t.Errorf("expected snapshots newest first, got epoch %d after %d", rv[i].Epoch, rv[i-1].Epoch)
+			}
+			if rv[i].Created.After(rv[i-1].Created) {
+				t.Errorf("expected epoch %d to be created before epoch %d", rv[i].Epoch, rv[i-1].Epoch)
+			}
+		}
+		return rv
+	}
+
+	var last int
+	for b := 0; b < 3; b++ {
+		batch := NewBatch()
+		for i := 0; i < 10; i++ {
+			doc := NewDocument(strconv.Itoa(b*10 + i)).
+				AddField(NewTextField("name", "marty"))
+			batch.Update(doc.ID(), doc)
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos := snapshots()
+		if len(infos) <= last {
+			t.Errorf("expected more than %d snapshots after batch %d, got %d", last, b, len(infos))
+		}
+		last = len(infos)
+		if infos[0].Documents != uint64(b+1)*10 {
+			t.Errorf("expected %d documents in the latest snapshot, got %d", (b+1)*10, infos[0].Documents)
+		}
+		if infos[0].Created.IsZero() || infos[0].Segments == 0 {
+			t.Errorf("expected the latest snapshot to be described, got %+v", infos[0])
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// keeping only the latest snapshot removes the others
+	config.indexConfig.DeletionPolicyFunc = func() index.DeletionPolicy {
+		return index.NewKeepNLatestDeletionPolicy(1)
+	}
+	writer, err = OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	infos := snapshots()
+	if len(infos) != 1 {
+		t.Fatalf("expected 1 snapshot to be kept, got %d", len(infos))
+	}
+	if infos[0].Documents != 30 {
+		t.Errorf("expected 30 documents in the kept snapshot, got %d", infos[0].Documents)
+	}
+}
+
 func TestOptimisedConjunctionSearchHits(t *testing.T) {
 	tmpIndexPath := createTmpIndexPath(t)
 	defer cleanupTmpIndexPath(t, tmpIndexPath)
@@ -1441,96 +1784,364 @@ func TestInMemoryUsage(t *testing.T) {
 	}
 }
 
-func batchAddDocs(docCount int) *index.Batch {
-	batch := NewBatch()
-
-	for i := 0; i < docCount; i++ {
-		doc := randomDoc()
-		batch.Update(doc.ID(), doc)
-	}
-	return batch
-}
-
-var (
-	field1 = randStr()
-	field2 = randStr()
-)
-
-func randomDoc() *Document {
-	return NewDocument(randStr()).
-		AddField(NewTextField(field1, randStr())).
-		AddField(NewTextField(field2, randStr()))
-}
-
-const charset = "01234567890abcdefghijklmnopqrstuvwxyz<>{}[];'"
-const maxRandStrLen = 30
-
-func randStrn(n int) string {
-	var b strings.Builder
-	for i := 0; i < n; i++ {
-		b.WriteByte(charset[rand.Intn(len(charset))])
-	}
-
-	return b.String()
-}
-
-func randStr() string {
-	return randStrn(maxRandStrLen)
-}
-
-func TestBug54(t *testing.T) {
-	tmpIndexPath := createTmpIndexPath(t)
-	defer cleanupTmpIndexPath(t, tmpIndexPath)
-
-	// first index 2 documents
-	config := DefaultConfig(tmpIndexPath)
-	indexWriter, err := OpenWriter(config)
+func TestExecuteBatchLastOpWins(t *testing.T) {
+	// a batch larger than the max is still applied atomically
+	writer, err := OpenWriter(InMemoryOnlyConfig().WithMaxBatchBytes(1))
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer func() {
+		cerr := writer.Close()
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+	}()
 
-	doc := NewDocument("a1")
-	doc.AddField(NewTextField("TestKey1", "TestKey Data1"))
-	if err = indexWriter.Update(doc.ID(), doc); err != nil {
-		t.Fatal(err)
-	}
-
-	doc = NewDocument("a2")
-	doc.AddField(NewTextField("TestKey2", "TestKey Data2"))
-	if err = indexWriter.Update(doc.ID(), doc); err != nil {
-		t.Fatal(err)
+	versionDoc := func(id, version string) *Document {
+		return NewDocument(id).AddField(NewKeywordField("version", version).StoreValue())
 	}
 
-	err = indexWriter.Close()
+	err = writer.Update(Identifier("a"), versionDoc("a", "0"))
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// now delete both documents
-	indexWriter, err = OpenWriter(config)
+	err = writer.Update(Identifier("b"), versionDoc("b", "0"))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if err = indexWriter.Delete(Identifier("a1")); err != nil {
+	batch := NewBatch()
+	// update then delete an existing id
+	batch.Update(Identifier("a"), versionDoc("a", "1"))
+	batch.Delete(Identifier("a"))
+	// several updates of an existing id
+	batch.Update(Identifier("b"), versionDoc("b", "1"))
+	batch.Update(Identifier("b"), versionDoc("b", "2"))
+	// update, delete and update again a new id
+	batch.Update(Identifier("c"), versionDoc("c", "1"))
+	batch.Delete(Identifier("c"))
+	batch.Update(Identifier("c"), versionDoc("c", "2"))
+	// update then delete a new id
+	batch.Update(Identifier("d"), versionDoc("d", "1"))
+	batch.Delete(Identifier("d"))
+	batch.Insert(versionDoc("e", "1"))
+	// insert then delete a new id
+	batch.Insert(versionDoc("f", "1"))
+	batch.Delete(Identifier("f"))
+	// insert then update a new id
+	batch.Insert(versionDoc("g", "1"))
+	batch.Update(Identifier("g"), versionDoc("g", "2"))
+	// update then insert an existing id
+	batch.Update(Identifier("a"), versionDoc("a", "2"))
+	batch.Insert(versionDoc("a", "3"))
+	err = writer.ExecuteBatch(batch)
+	if err != nil {
 		t.Fatal(err)
 	}
-
-	if err = indexWriter.Delete(Identifier("a2")); err != nil {
-		t.Fatal(err)
+	if flushes := writer.Status().TotBatchFlushes; flushes != 0 {
+		t.Errorf("expected the batch not to be split, got %d flushes", flushes)
 	}
 
-	err = indexWriter.Close()
+	reader, err := writer.Reader()
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer func() {
+		cerr := reader.Close()
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+	}()
 
-	// now open index again
-	indexWriter, err = OpenWriter(config)
+	dmi, err := reader.Search(context.Background(), NewAllMatches(NewMatchAllQuery()))
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = indexWriter.Close()
+	got := map[string]string{}
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		var id, version string
+		err = next.VisitStoredFields(func(field string, value []byte) bool {
+			switch field {
+			case _idField:
+				id = string(value)
+			case "version":
+				version = string(value)
+			}
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := got[id]; ok {
+			t.Errorf("duplicate document for id %s", id)
+		}
+		got[id] = version
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]string{
+		"a": "3",
+		"b": "2",
+		"c": "2",
+		"e": "1",
+		"g": "2",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestMatchingIDs(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cerr := writer.Close()
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+	}()
+
+	batch := NewBatch()
+	for i := 0; i < 10; i++ {
+		parity := "even"
+		if i%2 == 1 {
+			parity = "odd"
+		}
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewKeywordField("parity", parity))
+		batch.Update(doc.ID(), doc)
+	}
+	batch.Delete(Identifier("4"))
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cerr := reader.Close()
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+	}()
+
+	q := NewTermQuery("even").SetField("parity")
+	next, err := reader.MatchingIDs(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]struct{}{}
+	id, ok, err := next()
+	for err == nil && ok {
+		got[id] = struct{}{}
+		id, ok, err = next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]struct{}{"0": {}, "2": {}, "6": {}, "8": {}}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected ids %v, got %v", expect, got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	next, err = reader.MatchingIDs(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok, err = next()
+	if err != nil || !ok {
+		t.Fatalf("expected first id, got %t %v", ok, err)
+	}
+	cancel()
+	_, ok, err = next()
+	if ok || err != context.Canceled {
+		t.Errorf("expected context canceled, got %t %v", ok, err)
+	}
+}
+
+func TestAllDocuments(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cerr := writer.Close()
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+	}()
+
+	// several batches, each introducing a segment
+	for b := 0; b < 3; b++ {
+		batch := NewBatch()
+		for i := 0; i < 5; i++ {
+			doc := NewDocument(fmt.Sprintf("%d-%d", b, i))
+			batch.Update(doc.ID(), doc)
+		}
+		// delete from this and the previous segment
+		batch.Delete(Identifier(fmt.Sprintf("%d-%d", b, 4)))
+		if b > 0 {
+			batch.Delete(Identifier(fmt.Sprintf("%d-%d", b-1, 0)))
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cerr := reader.Close()
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+	}()
+
+	itr, err := reader.AllDocuments(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]int{}
+	next, err := itr.Next()
+	for err == nil && next != nil {
+		err = next.VisitStoredFields(func(field string, value []byte) bool {
+			if field == _idField {
+				seen[string(value)]++
+			}
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err = itr.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]int{}
+	for _, id := range []string{"0-1", "0-2", "0-3", "1-1", "1-2", "1-3", "2-0", "2-1", "2-2", "2-3"} {
+		expect[id] = 1
+	}
+	if !reflect.DeepEqual(seen, expect) {
+		t.Errorf("expected %v, got %v", expect, seen)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	itr, err = reader.AllDocuments(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = itr.Next()
+	if err != context.Canceled {
+		t.Errorf("expected context canceled, got %v", err)
+	}
+}
+
+func batchAddDocs(docCount int) *index.Batch {
+	batch := NewBatch()
+
+	for i := 0; i < docCount; i++ {
+		doc := randomDoc()
+		batch.Update(doc.ID(), doc)
+	}
+	return batch
+}
+
+var (
+	field1 = randStr()
+	field2 = randStr()
+)
+
+func randomDoc() *Document {
+	return NewDocument(randStr()).
+		AddField(NewTextField(field1, randStr())).
+		AddField(NewTextField(field2, randStr()))
+}
+
+const charset = "01234567890abcdefghijklmnopqrstuvwxyz<>{}[];'"
+const maxRandStrLen = 30
+
+func randStrn(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteByte(charset[rand.Intn(len(charset))])
+	}
+
+	return b.String()
+}
+
+func randStr() string {
+	return randStrn(maxRandStrLen)
+}
+
+func TestBug54(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	// first index 2 documents
+	config := DefaultConfig(tmpIndexPath)
+	indexWriter, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := NewDocument("a1")
+	doc.AddField(NewTextField("TestKey1", "TestKey Data1"))
+	if err = indexWriter.Update(doc.ID(), doc); err != nil {
+		t.Fatal(err)
+	}
+
+	doc = NewDocument("a2")
+	doc.AddField(NewTextField("TestKey2", "TestKey Data2"))
+	if err = indexWriter.Update(doc.ID(), doc); err != nil {
+		t.Fatal(err)
+	}
+
+	err = indexWriter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// now delete both documents
+	indexWriter, err = OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = indexWriter.Delete(Identifier("a1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = indexWriter.Delete(Identifier("a2")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = indexWriter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// now open index again
+	indexWriter, err = OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = indexWriter.Close()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1816,3 +2427,1444 @@ func TestBug87(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestReaderFieldInfo(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	batch := NewBatch()
+	for i := 0; i < 3; i++ {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewTextField("text", "the quick brown fox")).
+			AddField(NewTextField("highlighted", "jumps over the lazy dog").HighlightMatches().StoreValue()).
+			AddField(NewTextField("positions", "over the hills").TermPositionsOnly()).
+			AddField(NewKeywordField("keyword", "status").StoreValue().Aggregatable()).
+			AddField(NewNumericField("number", float64(i)).Sortable()).
+			AddField(NewStoredOnlyField("stored", []byte("raw")))
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	tests := []index.FieldInfo{
+		{
+			Name:    "text",
+			Indexed: true,
+			Type:    index.FieldTypeText,
+		},
+		{
+			Name:      "highlighted",
+			Indexed:   true,
+			Stored:    true,
+			Positions: true,
+			Offsets:   true,
+			Type:      index.FieldTypeText,
+		},
+		{
+			Name:      "positions",
+			Indexed:   true,
+			Positions: true,
+			Type:      index.FieldTypeText,
+		},
+		{
+			Name:      "keyword",
+			Indexed:   true,
+			Stored:    true,
+			DocValues: true,
+			Type:      index.FieldTypeText,
+		},
+		{
+			Name:      "number",
+			Indexed:   true,
+			DocValues: true,
+			Type:      index.FieldTypeNumeric,
+		},
+		{
+			Name:   "stored",
+			Stored: true,
+		},
+	}
+	for _, expected := range tests {
+		actual, err := reader.FieldInfo(expected.Name)
+		if err != nil {
+			t.Fatalf("field %s: %v", expected.Name, err)
+		}
+		if actual != expected {
+			t.Errorf("expected %+v, got %+v", expected, actual)
+		}
+	}
+
+	_, err = reader.FieldInfo("missing")
+	if !errors.Is(err, index.ErrFieldNotFound) {
+		t.Errorf("expected field not found error, got %v", err)
+	}
+}
+
+func TestReaderScoreHistogram(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	// longer fields score lower, giving a range of scores
+	batch := NewBatch()
+	for i := 0; i < 50; i++ {
+		body := "fox" + strings.Repeat(" dog", i%10)
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewTextField("body", body))
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	histogram, err := reader.ScoreHistogram(context.Background(), NewTermQuery("fox").SetField("body"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histogram) != 4 {
+		t.Fatalf("expected 4 buckets, got %d", len(histogram))
+	}
+	var total uint64
+	for i, bucket := range histogram {
+		total += bucket.Count
+		if bucket.Min >= bucket.Max {
+			t.Errorf("expected bucket %d min %f below max %f", i, bucket.Min, bucket.Max)
+		}
+		if i > 0 && bucket.Min != histogram[i-1].Max {
+			t.Errorf("expected bucket %d to start where bucket %d ends", i, i-1)
+		}
+	}
+	if total != 50 {
+		t.Errorf("expected bucket counts to sum to 50 matches, got %d", total)
+	}
+	// the lowest and highest scores fall in the first and last buckets
+	if histogram[0].Count == 0 || histogram[3].Count == 0 {
+		t.Errorf("expected the first and last buckets to have matches, got %v", histogram)
+	}
+
+	histogram, err = reader.ScoreHistogram(context.Background(), NewTermQuery("cat").SetField("body"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histogram) != 0 {
+		t.Errorf("expected no buckets without matches, got %v", histogram)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = reader.ScoreHistogram(ctx, NewTermQuery("fox").SetField("body"), 4)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled context's error, got %v", err)
+	}
+}
+
+func TestReaderWarmDocValues(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	config := DefaultConfig(tmpIndexPath)
+	writer, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		doc := NewDocument(fmt.Sprintf("%02d", i)).
+			AddField(NewNumericField("rank", float64(50-i)).Sortable())
+		err = writer.Update(doc.ID(), doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the lowest ranked documents are deleted
+	for _, id := range []string{"49", "48"} {
+		err = writer.Delete(Identifier(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := OpenReader(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	err = reader.WarmDocValues([]string{"rank", "missing"})
+	if err != nil {
+		t.Fatalf("error warming doc values: %v", err)
+	}
+
+	dmi, err := reader.Search(context.Background(),
+		NewTopNSearch(3, NewMatchAllQuery()).SortBy([]string{"rank"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		err = next.VisitStoredFields(func(field string, value []byte) bool {
+			if field == _idField {
+				ids = append(ids, string(value))
+			}
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"47", "46", "45"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+}
+
+func TestReaderFieldDictionary(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	docs := map[string][]string{
+		"a": {"apple", "banana"},
+		"b": {"apple", "apricot"},
+		"c": {"banana", "cherry"},
+		"d": {"apple", "lonely"},
+	}
+	// each document in its own batch, so the terms span segments
+	for _, id := range []string{"a", "b", "c", "d"} {
+		doc := NewDocument(id)
+		for _, tag := range docs[id] {
+			doc.AddField(NewKeywordField("tag", tag))
+		}
+		err = writer.Update(doc.ID(), doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = writer.Delete(Identifier("d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	type termCount struct {
+		term  string
+		count uint64
+	}
+	terms := func(itr segment.DictionaryIterator, err error) []termCount {
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rv []termCount
+		entry, err := itr.Next()
+		for err == nil && entry != nil {
+			rv = append(rv, termCount{term: entry.Term(), count: entry.Count()})
+			entry, err = itr.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv
+	}
+
+	// the deleted document is not counted, and its unique term skipped
+	expected := []termCount{
+		{"apple", 2},
+		{"apricot", 1},
+		{"banana", 2},
+		{"cherry", 1},
+	}
+	actual := terms(reader.FieldDictionary("tag"))
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	actual = terms(reader.FieldDictionaryRange("tag", []byte("apricot"), []byte("cherry")))
+	if !reflect.DeepEqual(actual, expected[1:3]) {
+		t.Errorf("expected range %v, got %v", expected[1:3], actual)
+	}
+
+	actual = terms(reader.FieldDictionary("missing"))
+	if len(actual) != 0 {
+		t.Errorf("expected no terms for missing field, got %v", actual)
+	}
+}
+
+func TestReaderFieldDictionaryPrefix(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	counts := map[string]int{
+		"car":      5,
+		"card":     2,
+		"care":     7,
+		"career":   2,
+		"carrot":   1,
+		"cat":      9,
+		"scar":     4,
+		"cargo":    3,
+		"carpet":   1,
+		"carousel": 2,
+	}
+	for term, count := range counts {
+		for i := 0; i < count; i++ {
+			doc := NewDocument(fmt.Sprintf("%s-%d", term, i)).
+				AddField(NewKeywordField("word", term))
+			err = writer.Update(doc.ID(), doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// deleted documents are not counted, so care falls behind car
+	for i := 0; i < 3; i++ {
+		err = writer.Delete(Identifier(fmt.Sprintf("care-%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	actual, err := reader.FieldDictionaryPrefix("word", "car", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ties are broken by term
+	expected := []TermCount{
+		{"car", 5},
+		{"care", 4},
+		{"cargo", 3},
+		{"card", 2},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	actual, err = reader.FieldDictionaryPrefix("word", "care", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []TermCount{
+		{"care", 4},
+		{"career", 2},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	actual, err = reader.FieldDictionaryPrefix("word", "dog", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 0 {
+		t.Errorf("expected no terms, got %v", actual)
+	}
+}
+
+// editDistance is the optimal string alignment distance between a and
+// b in runes, counting the transposition of adjacent runes as one edit
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = d[i-1][j] + 1
+			if d[i][j-1]+1 < d[i][j] {
+				d[i][j] = d[i][j-1] + 1
+			}
+			if d[i-1][j-1]+cost < d[i][j] {
+				d[i][j] = d[i-1][j-1] + cost
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] &&
+				d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func TestReaderFuzzyTerms(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	words := []string{"book", "books", "boot", "bok", "obok", "back", "brook",
+		"look", "cook", "bookkeeper", "bo", "b", "boko", "café", "cafe", "cake"}
+	for i, word := range words {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewKeywordField("word", word))
+		err = writer.Update(doc.ID(), doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	for _, term := range []string{"book", "cafe", "bo", "zzz"} {
+		for maxEdits := 0; maxEdits <= 2; maxEdits++ {
+			var expected []string
+			for _, word := range words {
+				if editDistance(term, word) <= maxEdits {
+					expected = append(expected, word)
+				}
+			}
+			sort.Strings(expected)
+
+			actual, err := reader.FuzzyTerms("word", term, maxEdits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(actual) != len(expected) || (len(expected) > 0 && !reflect.DeepEqual(actual, expected)) {
+				t.Errorf("%s within %d edits: expected %v, got %v", term, maxEdits, expected, actual)
+			}
+		}
+	}
+
+	_, err = reader.FuzzyTerms("word", "book", 3)
+	if err == nil {
+		t.Errorf("expected error for more edits than supported")
+	}
+}
+
+func TestReaderSuggestSpelling(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	batch := NewBatch()
+	var n int
+	for word, count := range map[string]int{
+		"search": 10, "starch": 3, "serach": 1, "peach": 5, "each": 2, "reach": 5,
+	} {
+		for i := 0; i < count; i++ {
+			doc := NewDocument(strconv.Itoa(n)).
+				AddField(NewKeywordField("word", word))
+			batch.Update(doc.ID(), doc)
+			n++
+		}
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	tests := []struct {
+		term     string
+		maxEdits int
+		limit    int
+		expected []Suggestion
+	}{
+		// the common term is suggested for the rare misspelling
+		{term: "serach", maxEdits: 1, expected: []Suggestion{{"search", 1, 10}}},
+		// fewer edits first, then more documents
+		{term: "serach", maxEdits: 2, expected: []Suggestion{
+			{"search", 1, 10}, {"peach", 2, 5}, {"reach", 2, 5}, {"starch", 2, 3}, {"each", 2, 2},
+		}},
+		// ties of edits and documents in term order
+		{term: "beach", maxEdits: 1, expected: []Suggestion{{"peach", 1, 5}, {"reach", 1, 5}, {"each", 1, 2}}},
+		{term: "beach", maxEdits: 1, limit: 2, expected: []Suggestion{{"peach", 1, 5}, {"reach", 1, 5}}},
+		// terms less common than the term are not suggested
+		{term: "search", maxEdits: 2},
+	}
+	for _, test := range tests {
+		actual, err := reader.SuggestSpelling("word", test.term, test.maxEdits, test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual) != len(test.expected) || (len(actual) > 0 && !reflect.DeepEqual(actual, test.expected)) {
+			t.Errorf("%s within %d edits: expected %v, got %v", test.term, test.maxEdits, test.expected, actual)
+		}
+	}
+
+	_, err = reader.SuggestSpelling("word", "search", 0, 0)
+	if err == nil {
+		t.Errorf("expected error for no edits")
+	}
+}
+
+func TestReaderSuggest(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	batch := NewBatch()
+	for i, d := range []struct {
+		title      string
+		popularity float64
+	}{
+		{"apple", 100}, {"app", 5}, {"app", 3}, {"app", 1},
+		{"application", 20}, {"apply", 20}, {"apply", 0}, {"banana", 500},
+	} {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewKeywordField("title", d.title)).
+			AddField(NewNumericField("popularity", d.popularity))
+		batch.Update(doc.ID(), doc)
+	}
+	// documents without a weight
+	for _, id := range []string{"apt", "neg"} {
+		doc := NewDocument(id).AddField(NewKeywordField("title", id))
+		batch.Update(doc.ID(), doc)
+	}
+	for i, d := range []struct {
+		title      string
+		popularity float64
+	}{
+		{"neg", -5}, {"negative", -3},
+		{"z0", 1}, {"z0", 1}, {"z1", 1}, {"z1", 1}, {"z2", 1}, {"z2", 1},
+		{"z3", 1}, {"z3", 1}, {"z4", 1}, {"z4", 1}, {"z5", 1}, {"z5", 1},
+		{"z6", 1}, {"z6", 1}, {"z7", 1}, {"z7", 1}, {"z8", 100},
+	} {
+		doc := NewDocument("w" + strconv.Itoa(i)).
+			AddField(NewKeywordField("title", d.title)).
+			AddField(NewNumericField("popularity", d.popularity))
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	// the popular completion outranks the more frequent exact prefix
+	actual, err := reader.Suggest("title", "popularity", "app", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []WeightedSuggestion{
+		{"apple", 100, 1}, {"apply", 20, 2}, {"application", 20, 1}, {"app", 5, 3},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	actual, err = reader.Suggest("title", "popularity", "ap", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []WeightedSuggestion{{"apple", 100, 1}, {"apply", 20, 2}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	actual, err = reader.Suggest("title", "popularity", "apt", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []WeightedSuggestion{{"apt", 0, 1}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	// a document without a weight outweighs negative weights
+	actual, err = reader.Suggest("title", "popularity", "neg", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []WeightedSuggestion{{"neg", 0, 2}, {"negative", -3, 1}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	// only the most used completions are weighed when limited
+	actual, err = reader.Suggest("title", "popularity", "z", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 9 || actual[0].Term != "z8" {
+		t.Errorf("expected z8 first of 9 completions, got %v", actual)
+	}
+	actual, err = reader.Suggest("title", "popularity", "z", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []WeightedSuggestion{{"z0", 1, 2}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestReaderSize(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	for _, config := range []Config{InMemoryOnlyConfig(), DefaultConfig(tmpIndexPath)} {
+		writer, err := OpenWriter(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch := NewBatch()
+		for i := 0; i < 100; i++ {
+			doc := NewDocument(fmt.Sprintf("%03d", i)).
+				AddField(NewTextField("desc", fmt.Sprintf("document number %d", i)))
+			batch.Update(doc.ID(), doc)
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch = NewBatch()
+		for i := 0; i < 100; i += 10 {
+			batch.Delete(Identifier(fmt.Sprintf("%03d", i)))
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := writer.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err := reader.Size()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size.Documents != 90 {
+			t.Errorf("expected 90 documents, got %d", size.Documents)
+		}
+		if size.Deleted != 10 {
+			t.Errorf("expected 10 deleted documents, got %d", size.Deleted)
+		}
+		if size.Segments != 1 {
+			t.Errorf("expected 1 segment, got %d", size.Segments)
+		}
+		if size.Bytes == 0 {
+			t.Errorf("expected the segments to take some bytes")
+		}
+		count, err := reader.Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != size.Documents {
+			t.Errorf("expected %d documents, as counted by the reader, got %d", count, size.Documents)
+		}
+
+		_ = reader.Close()
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReaderSegmentStats(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	config := DefaultConfig(tmpIndexPath)
+	// keep every batch in a segment of its own
+	config.indexConfig.MinSegmentsForInMemoryMerge = 100
+	config.indexConfig.MergePlanOptions.MaxSegmentsPerTier = 100
+	config.indexConfig.MergePlanOptions.FloorSegmentSize = 1
+	writer, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// file modification times may be truncated to the second
+	start := time.Now().Truncate(time.Second)
+	var next int
+	for _, n := range []int{10, 20, 30} {
+		batch := NewBatch()
+		for i := 0; i < n; i++ {
+			doc := NewDocument(fmt.Sprintf("%03d", next)).
+				AddField(NewTextField("desc", fmt.Sprintf("document number %d", next)))
+			batch.Update(doc.ID(), doc)
+			next++
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// delete 2 documents of the first segment, and 5 of the last
+	batch := NewBatch()
+	for _, id := range []string{"000", "001", "030", "031", "032", "033", "034"} {
+		batch.Delete(Identifier(id))
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := OpenReader(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	stats := reader.SegmentStats()
+	expected := []SegmentStat{
+		{FullSize: 10, LiveSize: 8, Deleted: 2, Persisted: true},
+		{FullSize: 20, LiveSize: 20, Deleted: 0, Persisted: true},
+		{FullSize: 30, LiveSize: 25, Deleted: 5, Persisted: true},
+	}
+	if len(stats) != len(expected) {
+		t.Fatalf("expected %d segments, got %d: %+v", len(expected), len(stats), stats)
+	}
+	for i, stat := range stats {
+		if i > 0 && stat.ID <= stats[i-1].ID {
+			t.Errorf("expected segments from oldest to newest, got ids %d then %d", stats[i-1].ID, stat.ID)
+		}
+		if stat.Bytes <= 0 {
+			t.Errorf("segment %d: expected some bytes, got %d", i, stat.Bytes)
+		}
+		if stat.Created.Before(start) || stat.Created.After(time.Now()) {
+			t.Errorf("segment %d: expected to be created during the test, got %v", i, stat.Created)
+		}
+		stat.ID = 0
+		stat.Bytes = 0
+		stat.Created = time.Time{}
+		if stat != expected[i] {
+			t.Errorf("segment %d: expected %+v, got %+v", i, expected[i], stat)
+		}
+	}
+}
+
+func TestWriterForceMerge(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	config := DefaultConfig(tmpIndexPath)
+	// keep every batch in a segment of its own
+	config.indexConfig.MinSegmentsForInMemoryMerge = 100
+	config.indexConfig.MergePlanOptions.MaxSegmentsPerTier = 100
+	config.indexConfig.MergePlanOptions.FloorSegmentSize = 1
+	writer, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	for s := 0; s < 5; s++ {
+		batch := NewBatch()
+		for i := 0; i < 20; i++ {
+			n := s*20 + i
+			doc := NewDocument(fmt.Sprintf("%03d", n)).
+				AddField(NewTextField("desc", fmt.Sprintf("document %d of segment %d", n, s))).
+				AddField(NewNumericField("n", float64(n)).Sortable())
+			batch.Update(doc.ID(), doc)
+		}
+		if s > 0 {
+			batch.Delete(Identifier(fmt.Sprintf("%03d", s*20-1)))
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(q Query) []string {
+		reader, err := writer.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(100, q).SortBy([]string{"-_score", "n"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					ids = append(ids, string(value))
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+	segments := func() int {
+		reader, err := writer.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		return len(reader.SegmentStats())
+	}
+
+	queries := []Query{
+		NewMatchAllQuery(),
+		NewTermQuery("3").SetField("desc"),
+		NewMatchQuery("document segment 2").SetField("desc"),
+	}
+	var before [][]string
+	for _, q := range queries {
+		before = append(before, search(q))
+	}
+	if n := segments(); n != 5 {
+		t.Fatalf("expected 5 segments before merging, got %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = writer.ForceMerge(ctx, 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled force merge to fail, got %v", err)
+	}
+	err = writer.ForceMerge(context.Background(), 0)
+	if err == nil {
+		t.Errorf("expected an error force merging to no segments")
+	}
+
+	err = writer.ForceMerge(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := segments(); n != 3 {
+		t.Errorf("expected 3 segments, got %d", n)
+	}
+	err = writer.ForceMerge(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := segments(); n != 1 {
+		t.Errorf("expected 1 segment, got %d", n)
+	}
+	for i, q := range queries {
+		after := search(q)
+		if !reflect.DeepEqual(after, before[i]) {
+			t.Errorf("query %d: expected %v after merging, got %v", i, before[i], after)
+		}
+	}
+}
+
+func TestWriterPauseMerging(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	config := DefaultConfig(tmpIndexPath)
+	// persist every batch in a segment of its own
+	config.indexConfig.MinSegmentsForInMemoryMerge = 100
+	writer, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	segments := func() int {
+		reader, err := writer.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		return len(reader.SegmentStats())
+	}
+
+	writer.PauseMerging()
+	for s := 0; s < 30; s++ {
+		batch := NewBatch()
+		for i := 0; i < 10; i++ {
+			doc := NewDocument(fmt.Sprintf("%d-%d", s, i)).
+				AddField(NewTextField("desc", "bulk loaded"))
+			batch.Update(doc.ID(), doc)
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := segments(); n != 30 {
+		t.Fatalf("expected 30 segments while paused, got %d", n)
+	}
+
+	writer.ResumeMerging()
+	deadline := time.Now().Add(10 * time.Second)
+	n := segments()
+	for n >= 30 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		n = segments()
+	}
+	if n >= 30 {
+		t.Errorf("expected the segments to merge once resumed, still %d", n)
+	}
+
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	count, err := reader.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 300 {
+		t.Errorf("expected 300 documents, got %d", count)
+	}
+}
+
+func TestWriterUpdateByQuery(t *testing.T) {
+	defer func(size int) {
+		byQueryBatchSize = size
+	}(byQueryBatchSize)
+	byQueryBatchSize = 10
+
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	batch := NewBatch()
+	for i := 0; i < 50; i++ {
+		status := "published"
+		if i%2 == 0 {
+			status = "draft"
+		}
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewKeywordField("status", status).StoreValue()).
+			AddField(NewKeywordField("title", fmt.Sprintf("title %d", i)).StoreValue())
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// publishes the drafts, but for the first
+	publish := func(match *search.DocumentMatch) (*Document, error) {
+		var id, title string
+		err := match.VisitStoredFields(func(field string, value []byte) bool {
+			switch field {
+			case _idField:
+				id = string(value)
+			case "title":
+				title = string(value)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		if id == "0" {
+			return nil, nil
+		}
+		return NewDocument(id).
+			AddField(NewKeywordField("status", "published").StoreValue()).
+			AddField(NewKeywordField("title", title).StoreValue()), nil
+	}
+	updated, err := writer.UpdateByQuery(context.Background(), NewTermQuery("draft").SetField("status"), publish)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 24 {
+		t.Errorf("expected 24 documents updated, got %d", updated)
+	}
+
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	count, err := reader.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 50 {
+		t.Errorf("expected 50 documents, got %d", count)
+	}
+	titles := make(map[string]string)
+	_, err = reader.SearchFunc(context.Background(), NewAllMatches(NewTermQuery("published").SetField("status")),
+		func(match *search.DocumentMatch) error {
+			var id, title string
+			err := match.VisitStoredFields(func(field string, value []byte) bool {
+				switch field {
+				case _idField:
+					id = string(value)
+				case "title":
+					title = string(value)
+				}
+				return true
+			})
+			titles[id] = title
+			return err
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 49 {
+		t.Errorf("expected 49 published documents, got %d", len(titles))
+	}
+	for id, title := range titles {
+		if title != "title "+id {
+			t.Errorf("expected document %s to keep its title, got %q", id, title)
+		}
+	}
+	if _, ok := titles["0"]; ok {
+		t.Errorf("expected document 0 to be left a draft")
+	}
+
+	// an error from the function stops the updates
+	errStop := errors.New("stop")
+	updated, err = writer.UpdateByQuery(context.Background(), NewTermQuery("published").SetField("status"),
+		func(match *search.DocumentMatch) (*Document, error) {
+			return nil, errStop
+		})
+	if !errors.Is(err, errStop) || updated != 0 {
+		t.Errorf("expected the error of the function and no updates, got %d, %v", updated, err)
+	}
+
+	// an error from the searcher stops the updates too, without
+	// applying those of the matches before it
+	errSearcher := errors.New("searcher failed")
+	updated, err = writer.UpdateByQuery(context.Background(),
+		&failingNextQuery{Query: NewTermQuery("published").SetField("status"), after: 1, err: errSearcher},
+		func(match *search.DocumentMatch) (*Document, error) {
+			return NewDocument("new").AddField(NewKeywordField("status", "new")), nil
+		})
+	if !errors.Is(err, errSearcher) || updated != 0 {
+		t.Errorf("expected the error of the searcher and no updates, got %d, %v", updated, err)
+	}
+}
+
+// failingNextQuery fails once its searcher
+// has returned the given number of matches
+type failingNextQuery struct {
+	Query
+	after int
+	err   error
+}
+
+func (q *failingNextQuery) Searcher(i search.Reader, options search.SearcherOptions) (search.Searcher, error) {
+	searcher, err := q.Query.Searcher(i, options)
+	if err != nil {
+		return nil, err
+	}
+	return &failingNextSearcher{Searcher: searcher, remaining: q.after, err: q.err}, nil
+}
+
+type failingNextSearcher struct {
+	search.Searcher
+	remaining int
+	err       error
+}
+
+func (s *failingNextSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error) {
+	if s.remaining == 0 {
+		return nil, s.err
+	}
+	s.remaining--
+	return s.Searcher.Next(ctx)
+}
+
+func TestWriterDeleteByQuery(t *testing.T) {
+	defer func(size int) {
+		byQueryBatchSize = size
+	}(byQueryBatchSize)
+	byQueryBatchSize = 10
+
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	batch := NewBatch()
+	for i := 0; i < 50; i++ {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewNumericField("n", float64(i)))
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = writer.DeleteByQuery(ctx, NewMatchAllQuery())
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled delete to fail, got %v", err)
+	}
+
+	deleted, err := writer.DeleteByQuery(context.Background(), NewNumericRangeQuery(10, 35).SetField("n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 25 {
+		t.Errorf("expected 25 documents deleted, got %d", deleted)
+	}
+
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	count, err := reader.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 25 {
+		t.Errorf("expected 25 documents left, got %d", count)
+	}
+	ids, err := reader.MatchingIDs(context.Background(), NewMatchAllQuery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, ok, err := ids()
+	for ok {
+		n, _ := strconv.Atoi(id)
+		if n >= 10 && n < 35 {
+			t.Errorf("expected document %s to be deleted", id)
+		}
+		id, ok, err = ids()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriterBatchCallback(t *testing.T) {
+	for _, unsafe := range []bool{false, true} {
+		var m sync.Mutex
+		var callbacks, documents, deletes int
+		var bytes uint64
+		config := InMemoryOnlyConfig().WithBatchCallback(func(stats index.BatchStats) {
+			m.Lock()
+			callbacks++
+			documents += stats.Documents
+			deletes += stats.Deletes
+			bytes += stats.Bytes
+			m.Unlock()
+		})
+		config.indexConfig.UnsafeBatch = unsafe
+		writer, err := OpenWriter(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for b := 0; b < 10; b++ {
+			batch := NewBatch()
+			for i := 0; i < 7; i++ {
+				doc := NewDocument(fmt.Sprintf("%d-%d", b, i)).
+					AddField(NewTextField("desc", "bulk loaded"))
+				batch.Insert(doc)
+			}
+			batch.Delete(Identifier("none"))
+			err = writer.Batch(batch)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// unsafe batches are reported once persisted, after they return
+		deadline := time.Now().Add(10 * time.Second)
+		m.Lock()
+		for callbacks < 10 && time.Now().Before(deadline) {
+			m.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			m.Lock()
+		}
+		if callbacks != 10 {
+			t.Errorf("unsafe %t: expected 10 callbacks, got %d", unsafe, callbacks)
+		}
+		if documents != 70 || deletes != 10 {
+			t.Errorf("unsafe %t: expected 70 documents and 10 deletes, got %d and %d", unsafe, documents, deletes)
+		}
+		if bytes == 0 {
+			t.Errorf("unsafe %t: expected the bytes of the segments", unsafe)
+		}
+		m.Unlock()
+
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriterUpdateIfVersion(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	newDoc := func(status string) *Document {
+		return NewDocument("a").
+			AddField(NewKeywordField("status", status).StoreValue())
+	}
+
+	version, err := writer.UpdateIfVersion(newDoc("new"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("expected version 1, got %d", version)
+	}
+	// only creates the document when expecting version 0
+	_, err = writer.UpdateIfVersion(newDoc("new"), 0)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("expected a version conflict creating the document again, got %v", err)
+	}
+
+	// two writers both read version 1, and race to update it
+	results := make(chan error, 2)
+	for _, status := range []string{"left", "right"} {
+		go func(status string) {
+			_, err := writer.UpdateIfVersion(newDoc(status), 1)
+			results <- err
+		}(status)
+	}
+	var conflicts int
+	for i := 0; i < 2; i++ {
+		err = <-results
+		if errors.Is(err, ErrVersionConflict) {
+			conflicts++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if conflicts != 1 {
+		t.Errorf("expected one update to be rejected, got %d rejected", conflicts)
+	}
+
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	version, err = reader.DocumentVersion("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 {
+		t.Errorf("expected version 2, got %d", version)
+	}
+	count, err := reader.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 document, got %d", count)
+	}
+	version, err = reader.DocumentVersion("missing")
+	if err != nil || version != 0 {
+		t.Errorf("expected version 0 of a missing document, got %d, %v", version, err)
+	}
+}
+
+func TestWriterBatchReader(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	found := func(reader *Reader, id string) bool {
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(1, NewTermQuery(id).SetField(_idField)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := dmi.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return next != nil
+	}
+
+	before, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = before.Close()
+	}()
+
+	batch := NewBatch()
+	doc := NewDocument("new").
+		AddField(NewTextField("desc", "just indexed"))
+	batch.Update(doc.ID(), doc)
+	reader, err := writer.BatchReader(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	if !found(reader, "new") {
+		t.Errorf("expected the refreshed reader to find the new document")
+	}
+	if found(before, "new") {
+		t.Errorf("expected the reader opened before the batch not to find the new document")
+	}
+}
+
+func TestWriterReaderUnpersisted(t *testing.T) {
+	tmpIndexPath := createTmpIndexPath(t)
+	defer cleanupTmpIndexPath(t, tmpIndexPath)
+
+	config := DefaultConfig(tmpIndexPath).WithUnsafeBatches()
+	// keep the persister from persisting the batch for the test
+	config.indexConfig.PersisterNapTimeMSec = 60000
+	writer, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	doc := NewDocument("new").
+		AddField(NewTextField("desc", "not yet persisted"))
+	err = writer.Update(doc.ID(), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	stats := reader.SegmentStats()
+	if len(stats) != 1 || stats[0].Persisted {
+		t.Fatalf("expected a single segment in memory, got %+v", stats)
+	}
+	dmi, err := reader.Search(context.Background(), NewTopNSearch(1, NewMatchQuery("persisted").SetField("desc")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := dmi.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == nil {
+		t.Errorf("expected to find the document not yet persisted")
+	}
+}
@@ -86,7 +86,7 @@ func MultiSearch(ctx context.Context, req SearchRequest, readers ...*Reader) (se
 	}
 
 	msl := NewMultiSearcherList(searchers)
-	dmItr, err := collector.Collect(ctx, req.Aggregations(), msl)
+	dmItr, err := collect(ctx, req, collector, msl)
 	if err != nil {
 		return nil, err
 	}
@@ -16,7 +16,11 @@ package bluge
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"testing"
+
+	"github.com/blugelabs/bluge/search/collector"
 )
 
 func TestMultiSearch(t *testing.T) {
@@ -102,3 +106,98 @@ func TestMultiSearch(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestMultiSearchDedupe(t *testing.T) {
+	openReader := func(source string, docs map[string]string) *Reader {
+		writer, err := OpenWriter(InMemoryOnlyConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = writer.Close()
+		}()
+		batch := NewBatch()
+		for id, body := range docs {
+			doc := NewDocument(id).
+				AddField(NewTextField("body", body)).
+				AddField(NewKeywordField("source", source).StoreValue())
+			batch.Update(doc.ID(), doc)
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := writer.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reader
+	}
+
+	// the indexes overlap, document b is a better match in the second
+	reader1 := openReader("one", map[string]string{
+		"a": "fox",
+		"b": "fox jumped over the lazy dog",
+		"c": "fox",
+	})
+	defer func() {
+		_ = reader1.Close()
+	}()
+	reader2 := openReader("two", map[string]string{
+		"b": "fox",
+		"c": "fox jumped over the lazy dog",
+		"d": "fox",
+	})
+	defer func() {
+		_ = reader2.Close()
+	}()
+
+	q := NewTermQuery("fox").SetField("body")
+	expect := map[string]string{"a": "one", "b": "two", "c": "one", "d": "two"}
+	for _, req := range []*TopNSearch{
+		NewTopNSearch(10, q).WithDedupe(_idField, 0),
+		// the best match is kept even when sorting by a field
+		NewTopNSearch(10, q).SortBy([]string{_idField}).WithDedupe(_idField, 0),
+	} {
+		dmi, err := MultiSearch(context.Background(), req, reader1, reader2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources := map[string]string{}
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			var id, source string
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				switch field {
+				case _idField:
+					id = string(value)
+				case "source":
+					source = string(value)
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := sources[id]; ok {
+				t.Errorf("expected document %s only once", id)
+			}
+			sources[id] = source
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(sources, expect) {
+			t.Errorf("expected documents from %v, got %v", expect, sources)
+		}
+	}
+
+	// hits without a value count towards the limit too
+	for _, field := range []string{_idField, "missing"} {
+		_, err := MultiSearch(context.Background(), NewTopNSearch(10, q).WithDedupe(field, 2), reader1, reader2)
+		if !errors.Is(err, collector.ErrDedupeLimitExceeded) {
+			t.Errorf("expected ErrDedupeLimitExceeded deduplicating %s, got %v", field, err)
+		}
+	}
+}
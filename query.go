@@ -17,6 +17,8 @@ package bluge
 import (
 	"fmt"
 	"math"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -272,6 +274,132 @@ func (q *BooleanQuery) Validate() error {
 	return nil
 }
 
+type BoostingQuery struct {
+	positive      Query
+	negative      Query
+	negativeBoost float64
+}
+
+// NewBoostingQuery creates a compound Query matching
+// the documents which satisfy the positive Query.
+// Those which also satisfy the negative Query are
+// demoted rather than excluded, their score is
+// multiplied by the negativeBoost, between 0 and 1.
+// Only the score changes, so demoted documents rank
+// lower when sorting by score, the default, but the
+// order is unchanged when sorting by other fields,
+// and they are still counted and aggregated.
+func NewBoostingQuery(positive, negative Query, negativeBoost float64) *BoostingQuery {
+	return &BoostingQuery{
+		positive:      positive,
+		negative:      negative,
+		negativeBoost: negativeBoost,
+	}
+}
+
+// Positive returns the query that the documents must match
+func (q *BoostingQuery) Positive() Query {
+	return q.positive
+}
+
+// Negative returns the query demoting the documents it matches
+func (q *BoostingQuery) Negative() Query {
+	return q.negative
+}
+
+// NegativeBoost returns the factor applied to the
+// score of documents matching the negative query
+func (q *BoostingQuery) NegativeBoost() float64 {
+	return q.negativeBoost
+}
+
+func (q *BoostingQuery) Searcher(i search.Reader, options search.SearcherOptions) (search.Searcher, error) {
+	positiveSearcher, err := q.positive.Searcher(i, options)
+	if err != nil {
+		return nil, err
+	}
+	negativeOptions := options
+	negativeOptions.Explain = false
+	negativeOptions.IncludeTermVectors = false
+	negativeSearcher, err := q.negative.Searcher(i, negativeOptions)
+	if err != nil {
+		_ = positiveSearcher.Close()
+		return nil, err
+	}
+	if _, ok := negativeSearcher.(*searcher.MatchNoneSearcher); ok {
+		_ = negativeSearcher.Close()
+		return positiveSearcher, nil
+	}
+	return searcher.NewBoostingSearcher(positiveSearcher, negativeSearcher, q.negativeBoost, options), nil
+}
+
+func (q *BoostingQuery) Validate() error {
+	if q.positive == nil || q.negative == nil {
+		return fmt.Errorf("boosting query must have a positive and a negative query")
+	}
+	if q.negativeBoost < 0 || q.negativeBoost > 1 {
+		return fmt.Errorf("boosting query negative boost must be between 0 and 1, got %g", q.negativeBoost)
+	}
+	for _, cq := range []Query{q.positive, q.negative} {
+		if cq, ok := cq.(validatableQuery); ok {
+			err := cq.Validate()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type ConstantScoreQuery struct {
+	query Query
+	score float64
+}
+
+// NewConstantScoreQuery creates a Query matching the
+// same documents as the provided query, each with the
+// same score.  The wrapped query is searched without
+// scoring, skipping the term frequencies and norms,
+// so it may use the same optimizations as a search
+// which does not need scores.
+func NewConstantScoreQuery(query Query, score float64) *ConstantScoreQuery {
+	return &ConstantScoreQuery{
+		query: query,
+		score: score,
+	}
+}
+
+// Query returns the query being wrapped
+func (q *ConstantScoreQuery) Query() Query {
+	return q.query
+}
+
+// Score returns the score of every match
+func (q *ConstantScoreQuery) Score() float64 {
+	return q.score
+}
+
+func (q *ConstantScoreQuery) Searcher(i search.Reader, options search.SearcherOptions) (search.Searcher, error) {
+	innerOptions := options
+	innerOptions.Score = "none"
+	innerOptions.Explain = false
+	s, err := q.query.Searcher(i, innerOptions)
+	if err != nil {
+		return nil, err
+	}
+	return searcher.NewConstantScoreSearcher(s, q.score, options), nil
+}
+
+func (q *ConstantScoreQuery) Validate() error {
+	if q.query == nil {
+		return fmt.Errorf("constant score query must wrap a query")
+	}
+	if q, ok := q.query.(validatableQuery); ok {
+		return q.Validate()
+	}
+	return nil
+}
+
 type DateRangeQuery struct {
 	start          time.Time
 	end            time.Time
@@ -472,6 +600,60 @@ func (q *FuzzyQuery) Searcher(i search.Reader, options search.SearcherOptions) (
 		q.scorer, similarity.NewCompositeSumScorer(), options)
 }
 
+type FunctionScoreQuery struct {
+	query  Query
+	fn     func(score float64, values map[string][][]byte) float64
+	fields []string
+}
+
+// NewFunctionScoreQuery creates a Query matching the
+// same documents as the provided query, replacing the
+// score of each with that returned by fn, given the
+// score and the document values of the fields.  Only
+// the values of the declared fields are loaded, and
+// they are only valid for the duration of the call.
+// Useful for combining relevance with values such as
+// popularity or recency.
+func NewFunctionScoreQuery(query Query, fn func(score float64, values map[string][][]byte) float64,
+	fields []string) *FunctionScoreQuery {
+	return &FunctionScoreQuery{
+		query:  query,
+		fn:     fn,
+		fields: fields,
+	}
+}
+
+// Query returns the query being wrapped
+func (q *FunctionScoreQuery) Query() Query {
+	return q.query
+}
+
+// Fields returns the fields whose values are passed to the function
+func (q *FunctionScoreQuery) Fields() []string {
+	return q.fields
+}
+
+func (q *FunctionScoreQuery) Searcher(i search.Reader, options search.SearcherOptions) (search.Searcher, error) {
+	s, err := q.query.Searcher(i, options)
+	if err != nil {
+		return nil, err
+	}
+	return searcher.NewFunctionScoreSearcher(s, q.fields, q.fn, options), nil
+}
+
+func (q *FunctionScoreQuery) Validate() error {
+	if q.query == nil {
+		return fmt.Errorf("function score query must wrap a query")
+	}
+	if q.fn == nil {
+		return fmt.Errorf("function score query must have a function")
+	}
+	if q, ok := q.query.(validatableQuery); ok {
+		return q.Validate()
+	}
+	return nil
+}
+
 type GeoBoundingBoxQuery struct {
 	topLeft     []float64
 	bottomRight []float64
@@ -482,7 +664,9 @@ type GeoBoundingBoxQuery struct {
 
 // NewGeoBoundingBoxQuery creates a new Query for performing geo bounding
 // box searches. The arguments describe the position of the box and documents
-// which have an indexed geo point inside the box will be returned.
+// which have an indexed geo point inside the box will be returned, documents
+// without a geo point in the field never match.  A box whose bottom right
+// longitude is less than its top left longitude crosses the antimeridian.
 func NewGeoBoundingBoxQuery(topLeftLon, topLeftLat, bottomRightLon, bottomRightLat float64) *GeoBoundingBoxQuery {
 	return &GeoBoundingBoxQuery{
 		topLeft:     []float64{topLeftLon, topLeftLat},
@@ -577,7 +761,10 @@ type GeoDistanceQuery struct {
 // NewGeoDistanceQuery creates a new Query for performing geo distance
 // searches. The arguments describe a position and a distance. Documents
 // which have an indexed geo point which is less than or equal to the provided
-// distance from the given position will be returned.
+// distance from the given position will be returned, documents without a geo
+// point in the field never match.  The distance is a number followed by a unit,
+// such as "100mi" or "2.5km", a number without a unit is taken as meters.
+// To order the matches by distance, sort by search.NewGeoDistanceSort.
 func NewGeoDistanceQuery(lon, lat float64, distance string) *GeoDistanceQuery {
 	return &GeoDistanceQuery{
 		location: []float64{lon, lat},
@@ -686,6 +873,49 @@ func (q *GeoBoundingPolygonQuery) Validate() error {
 	return nil
 }
 
+type DocIDQuery struct {
+	ids   []string
+	boost *boost
+}
+
+// NewDocIDQuery creates a new Query matching the documents with
+// any of the ids, ids not in the index are ignored.  Each match
+// has a constant score, of the boost if one is set.  Combine it
+// with other queries in a BooleanQuery to rank a set of candidates.
+func NewDocIDQuery(ids []string) *DocIDQuery {
+	return &DocIDQuery{
+		ids: ids,
+	}
+}
+
+func (q *DocIDQuery) SetBoost(b float64) *DocIDQuery {
+	boostVal := boost(b)
+	q.boost = &boostVal
+	return q
+}
+
+func (q *DocIDQuery) Boost() float64 {
+	return q.boost.Value()
+}
+
+// IDs returns the ids being queried
+func (q *DocIDQuery) IDs() []string {
+	return q.ids
+}
+
+func (q *DocIDQuery) Searcher(i search.Reader, options search.SearcherOptions) (search.Searcher, error) {
+	ids := make([]string, 0, len(q.ids))
+	seen := make(map[string]struct{}, len(q.ids))
+	for _, id := range q.ids {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			ids = append(ids, id)
+		}
+	}
+	return searcher.NewMultiTermSearcher(i, ids, _idField, q.boost.Value(),
+		similarity.ConstantScorer(q.boost.Value()), similarity.NewCompositeSumScorer(), options, false)
+}
+
 type MatchAllQuery struct {
 	boost *boost
 }
@@ -740,6 +970,7 @@ type MatchPhraseQuery struct {
 	analyzer    *analysis.Analyzer
 	boost       *boost
 	slop        int
+	termBoosts  map[string]float64
 }
 
 // NewMatchPhraseQuery creates a new Query object
@@ -792,6 +1023,22 @@ func (q *MatchPhraseQuery) SetSlop(dist int) *MatchPhraseQuery {
 	return q
 }
 
+// SetTermBoost weights the contribution of the term to the score of
+// matching phrases, the term is compared with the terms produced by
+// analyzing the phrase, so it should be given in its analyzed form
+func (q *MatchPhraseQuery) SetTermBoost(term string, b float64) *MatchPhraseQuery {
+	if q.termBoosts == nil {
+		q.termBoosts = make(map[string]float64)
+	}
+	q.termBoosts[term] = b
+	return q
+}
+
+// TermBoosts returns the boosts of the terms in the phrase
+func (q *MatchPhraseQuery) TermBoosts() map[string]float64 {
+	return q.termBoosts
+}
+
 func (q *MatchPhraseQuery) SetAnalyzer(a *analysis.Analyzer) *MatchPhraseQuery {
 	q.analyzer = a
 	return q
@@ -822,6 +1069,7 @@ func (q *MatchPhraseQuery) Searcher(i search.Reader, options search.SearcherOpti
 		phraseQuery.SetField(field)
 		phraseQuery.SetBoost(q.boost.Value())
 		phraseQuery.SetSlop(q.slop)
+		phraseQuery.termBoosts = q.termBoosts
 		return phraseQuery.Searcher(i, options)
 	}
 	noneQuery := NewMatchNoneQuery()
@@ -1004,12 +1252,298 @@ func (q *MatchQuery) Searcher(i search.Reader, options search.SearcherOptions) (
 	return noneQuery.Searcher(i, options)
 }
 
+const defaultMoreLikeThisMaxTerms = 25
+
+type MoreLikeThisQuery struct {
+	like        string
+	field       string
+	analyzer    *analysis.Analyzer
+	boost       *boost
+	maxTerms    int
+	minTermFreq int
+	minDocFreq  uint64
+}
+
+// NewMoreLikeThisQuery creates a Query for finding documents
+// similar to the text, such as the stored text of a seed document.
+// The text is analyzed as by MatchQuery, and its terms are weighted
+// by tf-idf, their frequency in the text times their inverse document
+// frequency in the index.  Result documents must contain at least one
+// of the terms with the greatest weights, each of which is boosted by
+// its weight, so distinctive terms repeated in the text count most.
+// By default up to 25 terms are used, terms are used however rarely
+// they occur in the text, and terms no document uses are ignored.
+// A seed document matches itself best, exclude it with a DocIDQuery
+// in a BooleanQuery to find only its neighbors.
+func NewMoreLikeThisQuery(like string) *MoreLikeThisQuery {
+	return &MoreLikeThisQuery{
+		like:        like,
+		maxTerms:    defaultMoreLikeThisMaxTerms,
+		minTermFreq: 1,
+		minDocFreq:  1,
+	}
+}
+
+// Like returns the text similar documents are found for
+func (q *MoreLikeThisQuery) Like() string {
+	return q.like
+}
+
+func (q *MoreLikeThisQuery) SetBoost(b float64) *MoreLikeThisQuery {
+	boostVal := boost(b)
+	q.boost = &boostVal
+	return q
+}
+
+func (q *MoreLikeThisQuery) Boost() float64 {
+	return q.boost.Value()
+}
+
+func (q *MoreLikeThisQuery) SetField(f string) *MoreLikeThisQuery {
+	q.field = f
+	return q
+}
+
+func (q *MoreLikeThisQuery) Field() string {
+	return q.field
+}
+
+func (q *MoreLikeThisQuery) Analyzer() *analysis.Analyzer {
+	return q.analyzer
+}
+
+func (q *MoreLikeThisQuery) SetAnalyzer(a *analysis.Analyzer) *MoreLikeThisQuery {
+	q.analyzer = a
+	return q
+}
+
+// SetMaxTerms sets the number of terms of the text searched for,
+// those with the greatest weights, 0 or less uses every term
+func (q *MoreLikeThisQuery) SetMaxTerms(n int) *MoreLikeThisQuery {
+	q.maxTerms = n
+	return q
+}
+
+func (q *MoreLikeThisQuery) MaxTerms() int {
+	return q.maxTerms
+}
+
+// SetMinTermFreq ignores terms occurring fewer than n times in the text
+func (q *MoreLikeThisQuery) SetMinTermFreq(n int) *MoreLikeThisQuery {
+	q.minTermFreq = n
+	return q
+}
+
+func (q *MoreLikeThisQuery) MinTermFreq() int {
+	return q.minTermFreq
+}
+
+// SetMinDocFreq ignores terms used by fewer than n documents of the
+// index, such as misspellings, those only used by deleted documents
+// are counted until the segments holding them are merged
+func (q *MoreLikeThisQuery) SetMinDocFreq(n uint64) *MoreLikeThisQuery {
+	q.minDocFreq = n
+	return q
+}
+
+func (q *MoreLikeThisQuery) MinDocFreq() uint64 {
+	return q.minDocFreq
+}
+
+type moreLikeThisTerm struct {
+	term   string
+	weight float64
+}
+
+func (q *MoreLikeThisQuery) Searcher(i search.Reader, options search.SearcherOptions) (search.Searcher, error) {
+	field := q.field
+	if q.field == "" {
+		field = options.DefaultSearchField
+	}
+
+	var tokens analysis.TokenStream
+	if q.analyzer != nil {
+		tokens = q.analyzer.Analyze([]byte(q.like))
+	} else if options.DefaultAnalyzer != nil {
+		tokens = options.DefaultAnalyzer.Analyze([]byte(q.like))
+	} else {
+		tokens = tokenizer.MakeTokenStream([]byte(q.like))
+	}
+	termFreqs := make(map[string]int)
+	for _, token := range tokens {
+		termFreqs[string(token.Term)]++
+	}
+
+	terms, err := q.weightTerms(i, field, termFreqs)
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) == 0 {
+		noneQuery := NewMatchNoneQuery()
+		return noneQuery.Searcher(i, options)
+	}
+
+	booleanQuery := NewBooleanQuery()
+	for _, t := range terms {
+		booleanQuery.AddShould(NewTermQuery(t.term).SetField(field).SetBoost(t.weight))
+	}
+	booleanQuery.SetMinShould(1)
+	booleanQuery.SetBoost(q.boost.Value())
+	return booleanQuery.Searcher(i, options)
+}
+
+// weightTerms returns the terms of the text with enough occurrences in
+// it and documents in the index, those with the greatest weight first
+func (q *MoreLikeThisQuery) weightTerms(i search.Reader, field string,
+	termFreqs map[string]int) ([]moreLikeThisTerm, error) {
+	collStats, err := i.CollectionStats(field)
+	if err != nil {
+		return nil, err
+	}
+	docCount := float64(collStats.TotalDocumentCount())
+
+	var rv []moreLikeThisTerm
+	for term, freq := range termFreqs {
+		if freq < q.minTermFreq {
+			continue
+		}
+		postings, err := i.PostingsIterator([]byte(term), field, false, false, false)
+		if err != nil {
+			return nil, err
+		}
+		docFreq := postings.Count()
+		err = postings.Close()
+		if err != nil {
+			return nil, err
+		}
+		if docFreq == 0 || docFreq < q.minDocFreq {
+			continue
+		}
+		idf := math.Log(1 + (docCount-float64(docFreq)+0.5)/(float64(docFreq)+0.5))
+		rv = append(rv, moreLikeThisTerm{
+			term:   term,
+			weight: float64(freq) * idf,
+		})
+	}
+
+	sort.Slice(rv, func(a, b int) bool {
+		if rv[a].weight != rv[b].weight {
+			return rv[a].weight > rv[b].weight
+		}
+		return rv[a].term < rv[b].term
+	})
+	if q.maxTerms > 0 && len(rv) > q.maxTerms {
+		rv = rv[:q.maxTerms]
+	}
+	return rv, nil
+}
+
+type PhraseQuery struct {
+	terms      []string
+	field      string
+	boost      *boost
+	slop       int
+	termBoosts map[string]float64
+}
+
+// NewPhraseQuery creates a new Query for finding
+// exact term phrases in the index.
+// The provided terms must exist in the correct
+// order, at the correct index offsets, in the
+// specified field, unless the slop allows them to
+// be further apart, or out of order. Queried field
+// must have been indexed with IncludeTermVectors
+// set to true.
+func NewPhraseQuery(terms []string) *PhraseQuery {
+	return &PhraseQuery{
+		terms: terms,
+	}
+}
+
+// Terms returns the terms of the phrase being queried
+func (q *PhraseQuery) Terms() []string {
+	return q.terms
+}
+
+func (q *PhraseQuery) SetBoost(b float64) *PhraseQuery {
+	boostVal := boost(b)
+	q.boost = &boostVal
+	return q
+}
+
+func (q *PhraseQuery) Boost() float64 {
+	return q.boost.Value()
+}
+
+func (q *PhraseQuery) SetField(f string) *PhraseQuery {
+	q.field = f
+	return q
+}
+
+func (q *PhraseQuery) Field() string {
+	return q.field
+}
+
+// Slop returns the acceptable distance between terms
+func (q *PhraseQuery) Slop() int {
+	return q.slop
+}
+
+// SetSlop updates the sloppyness of the query, the
+// positions of the terms may differ from those of the
+// phrase by at most "dist" in total, 0 requires the
+// terms to be adjacent. Two adjacent terms in reverse
+// order are 2 away from the phrase.
+func (q *PhraseQuery) SetSlop(dist int) *PhraseQuery {
+	q.slop = dist
+	return q
+}
+
+// SetTermBoost weights the contribution of the term
+// to the score of matching phrases, by default 1.0
+func (q *PhraseQuery) SetTermBoost(term string, b float64) *PhraseQuery {
+	if q.termBoosts == nil {
+		q.termBoosts = make(map[string]float64)
+	}
+	q.termBoosts[term] = b
+	return q
+}
+
+// TermBoosts returns the boosts of the terms in the phrase
+func (q *PhraseQuery) TermBoosts() map[string]float64 {
+	return q.termBoosts
+}
+
+func (q *PhraseQuery) Searcher(i search.Reader, options search.SearcherOptions) (search.Searcher, error) {
+	field := q.field
+	if q.field == "" {
+		field = options.DefaultSearchField
+	}
+
+	terms := make([][]string, len(q.terms))
+	for j, term := range q.terms {
+		terms[j] = []string{term}
+	}
+	return searcher.NewBoostedSloppyMultiPhraseSearcher(i, terms, field, q.slop, q.termBoosts, nil, options)
+}
+
+func (q *PhraseQuery) Validate() error {
+	if len(q.terms) < 1 {
+		return fmt.Errorf("phrase query must contain at least one term")
+	}
+	if q.slop < 0 {
+		return fmt.Errorf("phrase query slop must not be negative, got %d", q.slop)
+	}
+	return nil
+}
+
 type MultiPhraseQuery struct {
-	terms  [][]string
-	field  string
-	boost  *boost
-	scorer search.Scorer
-	slop   int
+	terms      [][]string
+	field      string
+	boost      *boost
+	scorer     search.Scorer
+	slop       int
+	termBoosts map[string]float64
 }
 
 // NewMultiPhraseQuery creates a new Query for finding
@@ -1063,19 +1597,37 @@ func (q *MultiPhraseQuery) SetSlop(dist int) *MultiPhraseQuery {
 	return q
 }
 
+// SetTermBoost weights the contribution of the term
+// to the score of matching phrases, by default 1.0
+func (q *MultiPhraseQuery) SetTermBoost(term string, b float64) *MultiPhraseQuery {
+	if q.termBoosts == nil {
+		q.termBoosts = make(map[string]float64)
+	}
+	q.termBoosts[term] = b
+	return q
+}
+
+// TermBoosts returns the boosts of the terms in the phrase
+func (q *MultiPhraseQuery) TermBoosts() map[string]float64 {
+	return q.termBoosts
+}
+
 func (q *MultiPhraseQuery) Searcher(i search.Reader, options search.SearcherOptions) (search.Searcher, error) {
 	field := q.field
 	if q.field == "" {
 		field = options.DefaultSearchField
 	}
 
-	return searcher.NewSloppyMultiPhraseSearcher(i, q.terms, field, q.slop, q.scorer, options)
+	return searcher.NewBoostedSloppyMultiPhraseSearcher(i, q.terms, field, q.slop, q.termBoosts, q.scorer, options)
 }
 
 func (q *MultiPhraseQuery) Validate() error {
 	if len(q.terms) < 1 {
 		return fmt.Errorf("phrase query must contain at least one term")
 	}
+	if q.slop < 0 {
+		return fmt.Errorf("phrase query slop must not be negative, got %d", q.slop)
+	}
 	return nil
 }
 
@@ -1220,7 +1772,15 @@ type RegexpQuery struct {
 
 // NewRegexpQuery creates a new Query which finds
 // documents containing terms that match the
-// specified regular expression.
+// specified regular expression.  The whole term must
+// match, and the expression is compiled to an automaton
+// which is intersected with the term dictionary of each
+// segment, so only the terms it could match are visited.
+// The syntax is that of Go's regexp package, except that
+// anchors and other zero width assertions such as \b,
+// lazy quantifiers, and byte literals are not supported,
+// though a leading ^ is ignored.  Validate reports
+// whether the expression is supported.
 func NewRegexpQuery(regexp string) *RegexpQuery {
 	return &RegexpQuery{
 		regexp: regexp,
@@ -1257,19 +1817,23 @@ func (q *RegexpQuery) Searcher(i search.Reader, options search.SearcherOptions)
 		field = options.DefaultSearchField
 	}
 
+	return searcher.NewRegexpStringSearcher(i, q.pattern(), field,
+		q.boost.Value(), q.scorer, similarity.NewCompositeSumScorer(), options)
+}
+
+// pattern returns the regexp to compile
+func (q *RegexpQuery) pattern() string {
 	// require that pattern NOT be anchored to start and end of term.
 	// do not attempt to remove trailing $, its presence is not
 	// known to interfere with LiteralPrefix() the way ^ does
 	// and removing $ introduces possible ambiguities with escaped \$, \\$, etc
-	actualRegexp := q.regexp
-	actualRegexp = strings.TrimPrefix(actualRegexp, "^")
-
-	return searcher.NewRegexpStringSearcher(i, actualRegexp, field,
-		q.boost.Value(), q.scorer, similarity.NewCompositeSumScorer(), options)
+	return strings.TrimPrefix(q.regexp, "^")
 }
 
+// Validate returns an error describing why the
+// regexp cannot be searched for, if it cannot be
 func (q *RegexpQuery) Validate() error {
-	return nil // real validation delayed until searcher constructor
+	return searcher.ValidateRegexp(q.pattern())
 }
 
 type TermQuery struct {
@@ -1415,7 +1979,14 @@ type WildcardQuery struct {
 // documents containing terms that match the
 // specified wildcard.  In the wildcard pattern '*'
 // will match any sequence of 0 or more characters,
-// and '?' will match any single character.
+// and '?' will match any single character.  A
+// backslash matches the character following it
+// literally, so '\*', '\?' and '\\' match '*', '?'
+// and '\'.  Only the terms starting with the literal
+// characters before the first wildcard are visited,
+// so a wildcard starting with '*' or '?' visits
+// every term of the field, which is slow for fields
+// with many terms, see LeadingWildcard.
 func NewWildcardQuery(wildcard string) *WildcardQuery {
 	return &WildcardQuery{
 		wildcard: wildcard,
@@ -1446,24 +2017,33 @@ func (q *WildcardQuery) Field() string {
 	return q.field
 }
 
-var wildcardRegexpReplacer = strings.NewReplacer(
-	// characters in the wildcard that must
-	// be escaped in the regexp
-	"+", `\+`,
-	"(", `\(`,
-	")", `\)`,
-	"^", `\^`,
-	"$", `\$`,
-	".", `\.`,
-	"{", `\{`,
-	"}", `\}`,
-	"[", `\[`,
-	"]", `\]`,
-	`|`, `\|`,
-	`\`, `\\`,
-	// wildcard characters
-	"*", ".*",
-	"?", ".")
+// wildcardRegexp translates the wildcard into a regexp matching the same
+// terms, escaping everything but the wildcard characters which are not
+// themselves escaped
+func wildcardRegexp(wildcard string) string {
+	var rv strings.Builder
+	var escaped bool
+	for _, r := range wildcard {
+		switch {
+		case escaped:
+			rv.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			rv.WriteString(".*")
+		case r == '?':
+			rv.WriteString(".")
+		default:
+			rv.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		// a trailing backslash escapes nothing, so is literal
+		rv.WriteString(`\\`)
+	}
+	return rv.String()
+}
 
 func (q *WildcardQuery) Searcher(i search.Reader, options search.SearcherOptions) (search.Searcher, error) {
 	field := q.field
@@ -1471,12 +2051,17 @@ func (q *WildcardQuery) Searcher(i search.Reader, options search.SearcherOptions
 		field = options.DefaultSearchField
 	}
 
-	regexpString := wildcardRegexpReplacer.Replace(q.wildcard)
-
-	return searcher.NewRegexpStringSearcher(i, regexpString, field,
+	return searcher.NewRegexpStringSearcher(i, wildcardRegexp(q.wildcard), field,
 		q.boost.Value(), q.scorer, similarity.NewCompositeSumScorer(), options)
 }
 
+// LeadingWildcard reports whether the wildcard starts with '*' or '?',
+// such queries visit every term of the field, so applications may want
+// to warn about, or refuse, them
+func (q *WildcardQuery) LeadingWildcard() bool {
+	return strings.HasPrefix(q.wildcard, "*") || strings.HasPrefix(q.wildcard, "?")
+}
+
 func (q *WildcardQuery) Validate() error {
-	return nil // real validation delayed until searcher constructor
+	return searcher.ValidateRegexp(wildcardRegexp(q.wildcard))
 }
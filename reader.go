@@ -17,12 +17,14 @@ package bluge
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/blugelabs/bluge/index"
 
 	segment "github.com/blugelabs/bluge_segment_api"
 
 	"github.com/blugelabs/bluge/search"
+	"github.com/blugelabs/bluge/search/collector"
 )
 
 type Reader struct {
@@ -43,14 +45,140 @@ func OpenReader(config Config) (*Reader, error) {
 	return rv, nil
 }
 
+// OpenReaderAtEpoch opens a reader of the index as it was at an epoch
+// reported by Reader.Epoch, for as long as the deletion policy keeps
+// the snapshot of the epoch.  Once it has been removed the error
+// returned wraps index.ErrSnapshotNotFound.
+func OpenReaderAtEpoch(config Config, epoch uint64) (*Reader, error) {
+	rv := &Reader{
+		config: config,
+	}
+	var err error
+	rv.reader, err = index.OpenReaderAtEpoch(config.indexConfig, epoch)
+	if err != nil {
+		return nil, fmt.Errorf("error opening index at epoch %d: %w", epoch, err)
+	}
+
+	return rv, nil
+}
+
+// Epoch identifies the snapshot of the index seen by the reader,
+// readers opened with OpenReader see snapshots which were persisted,
+// and may be opened again with OpenReaderAtEpoch
+func (r *Reader) Epoch() uint64 {
+	return r.reader.Epoch()
+}
+
 func (r *Reader) Count() (count uint64, err error) {
 	return r.reader.Count()
 }
 
+// IndexSize describes the segments of the index seen by a Reader
+type IndexSize struct {
+	// Bytes is the total size of the segments, their size when
+	// persisted, or their size in memory when not yet persisted
+	Bytes uint64
+	// Segments is the number of segments
+	Segments int
+	// Documents is the number of live documents
+	Documents uint64
+	// Deleted is the number of deleted documents the segments still
+	// hold, which take space until the segments are merged
+	Deleted uint64
+}
+
+// Size reports the size of the index, from the segments
+// of the reader, it does not include files no longer in
+// use which have not yet been removed.
+func (r *Reader) Size() (IndexSize, error) {
+	var rv IndexSize
+	for _, s := range r.reader.Segments() {
+		rv.Segments++
+		rv.Bytes += uint64(s.Bytes())
+		rv.Documents += s.Count()
+		if deleted := s.Deleted(); deleted != nil {
+			rv.Deleted += deleted.GetCardinality()
+		}
+	}
+	return rv, nil
+}
+
+// SegmentStat describes a segment of the index
+// as it is seen by the merge planner
+type SegmentStat struct {
+	// ID identifies the segment, segments are given
+	// increasing ids, so older segments have lower ids
+	ID uint64
+	// Bytes is the size of the segment when persisted,
+	// or its size in memory when not yet persisted
+	Bytes int64
+	// FullSize is the number of documents in the segment,
+	// including those deleted
+	FullSize int64
+	// LiveSize is the number of documents not deleted
+	LiveSize int64
+	// Deleted is the number of documents deleted
+	Deleted uint64
+	// Persisted reports whether the segment has been
+	// persisted, only persisted segments are merged
+	Persisted bool
+	// Created is when the segment was built, or when it was
+	// persisted for segments loaded from the directory, the
+	// age of a segment is the time since it was created
+	Created time.Time
+}
+
+// SegmentStats describes the segments of the reader, from oldest
+// to newest, the segments do not change for the life of the reader.
+func (r *Reader) SegmentStats() []SegmentStat {
+	segments := r.reader.Segments()
+	rv := make([]SegmentStat, 0, len(segments))
+	for _, s := range segments {
+		stat := SegmentStat{
+			ID:        s.ID(),
+			Bytes:     s.Bytes(),
+			FullSize:  s.FullSize(),
+			LiveSize:  s.LiveSize(),
+			Persisted: s.Persisted(),
+			Created:   s.Created(),
+		}
+		if deleted := s.Deleted(); deleted != nil {
+			stat.Deleted = deleted.GetCardinality()
+		}
+		rv = append(rv, stat)
+	}
+	return rv
+}
+
+// Snapshots describes the snapshots of the index the deletion policy
+// has kept, newest first, any of which may be opened with
+// OpenReaderAtEpoch.  They include snapshots persisted after this
+// reader was opened.
+func (r *Reader) Snapshots() ([]index.SnapshotInfo, error) {
+	return r.reader.Snapshots()
+}
+
 func (r *Reader) Fields() (fields []string, err error) {
 	return r.reader.Fields()
 }
 
+// FieldInfo describes how the field was indexed, as inferred from
+// the data in the index, returning index.ErrFieldNotFound if no
+// document has the field.
+func (r *Reader) FieldInfo(field string) (index.FieldInfo, error) {
+	return r.reader.FieldInfo(field)
+}
+
+// WarmDocValues reads the document values of the fields across every
+// segment, so that the first searches sorting or aggregating on them
+// after the reader is opened are not slowed by reading them from disk.
+// This takes time proportional to the size of the values, and while it
+// holds no memory itself, the values occupy the operating system's
+// page cache, which takes as much memory as they take on disk.
+func (r *Reader) WarmDocValues(fields []string) error {
+	return r.reader.WarmDocumentValues(fields)
+}
+
 type StoredFieldVisitor func(field string, value []byte) bool
 
 func (r *Reader) VisitStoredFields(number uint64, visitor StoredFieldVisitor) error {
@@ -58,43 +186,239 @@ func (r *Reader) VisitStoredFields(number uint64, visitor StoredFieldVisitor) er
 }
 
 func (r *Reader) Search(ctx context.Context, req SearchRequest) (search.DocumentMatchIterator, error) {
-	collector := req.Collector()
-	searcher, err := req.Searcher(r.reader, r.config)
+	var dmItr search.DocumentMatchIterator
+	err := r.run(req, func(collector search.Collector, searcher sizedCollectible) (err error) {
+		dmItr, err = collect(ctx, req, collector, searcher)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	// FIXME search stats on reader?
+
+	return dmItr, nil
+}
+
+// run builds the collector and searcher for the request, and calls
+// fn with them between the config's search start and end functions
+func (r *Reader) run(req SearchRequest, fn func(search.Collector, sizedCollectible) error) error {
+	collector := req.Collector()
+	searcher, err := r.searcher(req)
+	if err != nil {
+		return err
+	}
+
 	memNeeded := memNeededForSearch(searcher, collector)
 	if r.config.SearchStartFunc != nil {
 		err = r.config.SearchStartFunc(memNeeded)
 	}
 	if err != nil {
-		return nil, err
+		_ = searcher.Close()
+		return err
 	}
 	if r.config.SearchEndFunc != nil {
 		defer r.config.SearchEndFunc(memNeeded)
 	}
 
-	var dmItr search.DocumentMatchIterator
-	dmItr, err = collector.Collect(ctx, req.Aggregations(), searcher)
+	return fn(collector, searcher)
+}
+
+// searcher builds the searcher for the request, one for each
+// segment run in parallel, if the config asks for it
+func (r *Reader) searcher(req SearchRequest) (sizedCollectible, error) {
+	if r.config.parallelSegmentSearch && len(r.reader.Segments()) > 1 {
+		return newParallelSegmentSearcher(r.reader, req, r.config)
+	}
+	return req.Searcher(r.reader, r.config)
+}
+
+// SearchFunc runs the search, calling fn with each of the resulting
+// matches in order, and returns the aggregations once all have been
+// passed to fn.  If fn returns an error, no further matches are passed
+// to it and SearchFunc returns that error.  The match should not be
+// retained once fn returns.
+// When the request's collector is a search.CallbackCollector, such as
+// that of AllMatches, fn is called as each match is collected, and an
+// error from fn stops the search, otherwise fn is called with the
+// results once they have all been collected.
+func (r *Reader) SearchFunc(ctx context.Context, req SearchRequest,
+	fn func(*search.DocumentMatch) error) (*search.Bucket, error) {
+	var bucket *search.Bucket
+	err := r.run(req, func(collector search.Collector, searcher sizedCollectible) error {
+		if cc, ok := collector.(search.CallbackCollector); ok {
+			if cs, ok := searcher.(contextSearcher); ok {
+				cs.withContext(ctx)
+			}
+			var err error
+			bucket, err = cc.CollectFunc(ctx, req.Aggregations(), searcher, fn)
+			return err
+		}
+
+		dmItr, err := collect(ctx, req, collector, searcher)
+		if err != nil {
+			return err
+		}
+		next, err := dmItr.Next()
+		for err == nil && next != nil {
+			err = fn(next)
+			if err != nil {
+				return err
+			}
+			next, err = dmItr.Next()
+		}
+		if err != nil {
+			return err
+		}
+		bucket = dmItr.Aggregations()
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return bucket, nil
+}
 
-	// FIXME search stats on reader?
+// MatchingIDs streams the ids of the documents matching the query,
+// without computing scores or sort values, or loading stored fields.
+// Each call to the returned function yields the next id, false once
+// all the matches have been returned, or an error, which will be the
+// context error if the context is done before the stream is exhausted.
+// The searcher is closed once the function returns false, so a caller
+// stopping early must cancel the context and call the function once
+// more, otherwise the searcher is never closed.
+func (r *Reader) MatchingIDs(ctx context.Context, q Query) (func() (string, bool, error), error) {
+	searcher, err := q.Searcher(r.reader, searchOptionsFromConfig(r.config, SearchOptions{
+		Score: "none",
+	}))
+	if err != nil {
+		return nil, err
+	}
+	dvReader, err := r.reader.DocumentValueReader([]string{_idField})
+	if err != nil {
+		_ = searcher.Close()
+		return nil, err
+	}
+	searchContext := search.NewSearchContext(searcher.DocumentMatchPoolSize(), 0)
 
-	return dmItr, nil
+	var done bool
+	finish := func(err error) (string, bool, error) {
+		if !done {
+			done = true
+			cerr := searcher.Close()
+			if err == nil {
+				err = cerr
+			}
+		}
+		return "", false, err
+	}
+
+	return func() (string, bool, error) {
+		if done {
+			return "", false, nil
+		}
+		select {
+		case <-ctx.Done():
+			return finish(ctx.Err())
+		default:
+		}
+		next, err := searcher.Next(searchContext)
+		if err != nil || next == nil {
+			return finish(err)
+		}
+		var id string
+		var found bool
+		err = dvReader.VisitDocumentValues(next.Number, func(field string, term []byte) {
+			if field == _idField {
+				id = string(term)
+				found = true
+			}
+		})
+		if err != nil {
+			return finish(err)
+		}
+		if !found {
+			return finish(fmt.Errorf("document %d has no %s", next.Number, _idField))
+		}
+		searchContext.DocumentMatchPool.Put(next)
+		return id, true, nil
+	}, nil
+}
+
+// AllDocuments returns an iterator over every live document in the
+// reader, in index order, without running a query.  The returned
+// matches have no score, but their stored fields may be visited.
+func (r *Reader) AllDocuments(ctx context.Context) (*DocumentIterator, error) {
+	postings, err := r.reader.PostingsIteratorAll()
+	if err != nil {
+		return nil, err
+	}
+	return &DocumentIterator{
+		ctx:      ctx,
+		reader:   r.reader,
+		postings: postings,
+	}, nil
+}
+
+// DocumentIterator iterates over the live documents of a Reader
+type DocumentIterator struct {
+	ctx      context.Context
+	reader   search.MatchReader
+	postings segment.PostingsIterator
+	n        int
+}
+
+// Next returns the next document, or nil once all
+// documents have been returned, the context error is
+// returned if the context is done before then
+func (d *DocumentIterator) Next() (*search.DocumentMatch, error) {
+	if d.n%collector.CheckDoneEvery == 0 {
+		select {
+		case <-d.ctx.Done():
+			return nil, d.ctx.Err()
+		default:
+		}
+	}
+	d.n++
+	posting, err := d.postings.Next()
+	if err != nil || posting == nil {
+		return nil, err
+	}
+	rv := &search.DocumentMatch{
+		Number: posting.Number(),
+	}
+	rv.SetReader(d.reader)
+	return rv, nil
 }
 
 func (r *Reader) DictionaryIterator(field string, automaton segment.Automaton, start, end []byte) (segment.DictionaryIterator, error) {
 	return r.reader.DictionaryIterator(field, automaton, start, end)
 }
 
+// Backup copies the index, as seen by this reader, to
+// the directory at path, see BackupTo
 func (r *Reader) Backup(path string, cancel chan struct{}) error {
 	dir := index.NewFileSystemDirectory(path)
+	return r.BackupTo(dir, cancel)
+}
+
+// BackupTo copies the index, as seen by this reader, to the directory,
+// while writes to the index continue.  The directory may then be opened
+// as an index, with a config whose DirectoryFunc returns it.  The copy
+// may be stopped by closing cancel, leaving the directory without an
+// openable index.
+func (r *Reader) BackupTo(dir index.Directory, cancel chan struct{}) error {
 	return r.reader.Backup(dir, cancel)
 }
 
+// BackupIncremental updates a backup of the index in the directory,
+// made by BackupTo or BackupIncremental, to the index as seen by this
+// reader, copying only the segments the backup lacks.  The ids of the
+// segments copied are returned.
+func (r *Reader) BackupIncremental(dir index.Directory, cancel chan struct{}) ([]uint64, error) {
+	return r.reader.BackupIncremental(dir, cancel)
+}
+
 func (r *Reader) Close() error {
 	return r.reader.Close()
 }
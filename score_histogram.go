@@ -0,0 +1,117 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bluge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blugelabs/bluge/search"
+	"github.com/blugelabs/bluge/search/collector"
+)
+
+// ScoreBucket counts the matches scoring at least Min and less
+// than Max, the last bucket also counts those scoring exactly Max
+type ScoreBucket struct {
+	Min   float64
+	Max   float64
+	Count uint64
+}
+
+// ScoreHistogram runs the query, dividing the range of scores of the
+// matches into the number of buckets requested, each of equal width,
+// and counting the matches in each, which helps when choosing a
+// minimum score.  When every match has the same score, a single
+// bucket is returned, and when nothing matches, no buckets are.
+// The query is run twice, first to find the range of the scores, then
+// to count the matches in each bucket, so that only the buckets are
+// held in memory, however many matches there are.
+func (r *Reader) ScoreHistogram(ctx context.Context, q Query, buckets int) ([]ScoreBucket, error) {
+	if buckets < 1 {
+		return nil, fmt.Errorf("score histogram needs at least 1 bucket, got %d", buckets)
+	}
+
+	var count uint64
+	var min, max float64
+	err := r.eachScore(ctx, q, func(score float64) {
+		if count == 0 || score < min {
+			min = score
+		}
+		if count == 0 || score > max {
+			max = score
+		}
+		count++
+	})
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	if min == max {
+		return []ScoreBucket{{Min: min, Max: max, Count: count}}, nil
+	}
+
+	width := (max - min) / float64(buckets)
+	rv := make([]ScoreBucket, buckets)
+	for i := range rv {
+		rv[i].Min = min + float64(i)*width
+		rv[i].Max = min + float64(i+1)*width
+	}
+	rv[buckets-1].Max = max
+	err = r.eachScore(ctx, q, func(score float64) {
+		i := int((score - min) / width)
+		if i >= buckets {
+			i = buckets - 1
+		} else if i < 0 {
+			i = 0
+		}
+		rv[i].Count++
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// eachScore runs the query, calling fn with the score of each match,
+// the context error is returned if the context is done before then
+func (r *Reader) eachScore(ctx context.Context, q Query, fn func(score float64)) error {
+	searcher, err := q.Searcher(r.reader, searchOptionsFromConfig(r.config, SearchOptions{}))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = searcher.Close()
+	}()
+	searchContext := search.NewSearchContext(searcher.DocumentMatchPoolSize(), 0)
+
+	var n int
+	next, err := searcher.Next(searchContext)
+	for err == nil && next != nil {
+		if n%collector.CheckDoneEvery == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+		}
+		n++
+		fn(next.Score)
+		searchContext.DocumentMatchPool.Put(next)
+		next, err = searcher.Next(searchContext)
+	}
+	return err
+}
@@ -15,11 +15,21 @@
 package bluge
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/blugelabs/bluge/search"
 	"github.com/blugelabs/bluge/search/aggregations"
 	"github.com/blugelabs/bluge/search/collector"
+	segment "github.com/blugelabs/bluge_segment_api"
 )
 
+// ErrSearchTimeout is returned when a search takes
+// longer than the timeout set on the request
+var ErrSearchTimeout = errors.New("search timed out")
+
 type SearchRequest interface {
 	Collector() search.Collector
 	Searcher(i search.Reader, config Config) (search.Searcher, error)
@@ -59,11 +69,29 @@ func (b BaseSearch) Searcher(i search.Reader, config Config) (search.Searcher, e
 // It also allows for skipping a specified number of matches which can be used to enable pagination.
 type TopNSearch struct {
 	BaseSearch
-	n        int
-	from     int
-	sort     search.SortOrder
-	after    [][]byte
-	reversed bool
+	n          int
+	from       int
+	sort       search.SortOrder
+	after      [][]byte
+	reversed   bool
+	tieBreaker string
+	sortCache  *search.SortValueCache
+	noScoring  bool
+
+	maxDocsScanned int
+
+	postFilter                search.PostFilter
+	aggregateBeforePostFilter bool
+
+	dedupeField     string
+	dedupeMaxValues int
+
+	stats *search.SearchStats
+
+	spillThreshold int
+	spillDir       string
+
+	timeout time.Duration
 }
 
 // NewTopNSearch creates a search which will find the matches and return the first N when ordered by the
@@ -115,7 +143,10 @@ func (s *TopNSearch) From() int {
 	return s.from
 }
 
-// After can be used to specify a sort key, any match with a sort key less than this will be skipped
+// After can be used to specify a sort key, any match with a sort key less than this will be skipped.
+// The sort key has a value for each level of the sort, text values as they are, and numbers and
+// scores encoded by search.NumericSortValue.  When sorting by score, a cursor from one page may not
+// exactly match the score computed for the next, sort by search.QuantizedDocumentScore to avoid this.
 func (s *TopNSearch) After(after [][]byte) *TopNSearch {
 	s.after = after
 	return s
@@ -144,12 +175,103 @@ func (s *TopNSearch) SortByCustom(order search.SortOrder) *TopNSearch {
 	return s
 }
 
+// WithTieBreaker adds a final ascending sort on the specified field,
+// ordering matches which are otherwise equal.  Using a field with a unique
+// value per document (such as _id) makes After/Before pagination stable.
+// The tie-breaker value is included as the last element of each match's
+// SortValue and must be included when passing it to After or Before.
+func (s *TopNSearch) WithTieBreaker(field string) *TopNSearch {
+	s.tieBreaker = field
+	return s
+}
+
+// WithSortValueCache reuses sort values computed by earlier pages of
+// this search, and remembers those computed now for later pages.
+// Create the cache with search.NewSortValueCache, bounding the number
+// of values held, and pass the same cache with every page requested
+// from the same Reader.
+func (s *TopNSearch) WithSortValueCache(cache *search.SortValueCache) *TopNSearch {
+	s.sortCache = cache
+	return s
+}
+
+// WithMaxDocsScanned fails the search with collector.ErrScanLimitExceeded
+// if more than n documents match, instead of examining them all.
+// The default, 0, does not limit the number of documents examined.
+func (s *TopNSearch) WithMaxDocsScanned(n int) *TopNSearch {
+	s.maxDocsScanned = n
+	return s
+}
+
+// WithTimeout fails the search with ErrSearchTimeout if finding the
+// matches takes longer than timeout, the search stops at the next
+// point it checks for cancellation, see collector.CheckDoneEvery
+func (s *TopNSearch) WithTimeout(timeout time.Duration) *TopNSearch {
+	s.timeout = timeout
+	return s
+}
+
+// Timeout returns the timeout of the search, 0 if there is none
+func (s *TopNSearch) Timeout() time.Duration {
+	return s.timeout
+}
+
+// WithSpill writes the matches held to a temporary file in dir once
+// there are more than threshold of them, bounding the memory needed
+// for a large From, at the cost of a much slower search, see
+// collector.TopNCollector.WithSpill for the details
+func (s *TopNSearch) WithSpill(threshold int, dir string) *TopNSearch {
+	s.spillThreshold = threshold
+	s.spillDir = dir
+	return s
+}
+
+// WithPostFilter only returns the matches accepted by the filter,
+// by default the aggregations only include the accepted matches too
+func (s *TopNSearch) WithPostFilter(filter search.PostFilter) *TopNSearch {
+	s.postFilter = filter
+	return s
+}
+
+// WithAggregationsBeforePostFilter includes every match of the query in
+// the aggregations, even those rejected by the post filter, so that facet
+// counts describe the unfiltered matches while the hits are filtered.
+func (s *TopNSearch) WithAggregationsBeforePostFilter() *TopNSearch {
+	s.aggregateBeforePostFilter = true
+	return s
+}
+
+// WithDedupe only keeps the highest scoring match for each value of the
+// field, such as when searching overlapping indexes with MultiSearch,
+// so the matches are scored whatever they are sorted by.
+// Every match kept is held in memory, the search fails with
+// collector.ErrDedupeLimitExceeded if more than maxValues distinct
+// values are seen, each match without a value counting as one,
+// when maxValues is 0 the memory used is not limited.
+func (s *TopNSearch) WithDedupe(field string, maxValues int) *TopNSearch {
+	s.dedupeField = field
+	s.dedupeMaxValues = maxValues
+	return s
+}
+
+// WithSearchStats counts the work done by the search in stats,
+// such as the number of matches scored, to verify the effect of
+// optimizations.  The counters are added to by each search.
+func (s *TopNSearch) WithSearchStats(stats *search.SearchStats) *TopNSearch {
+	s.stats = stats
+	return s
+}
+
 // SortOrder returns the sort order of the current search
 func (s *TopNSearch) SortOrder() search.SortOrder {
 	return s.sort
 }
 
-// ExplainScores enables the addition of scoring explanation to each match
+// ExplainScores enables the addition of scoring explanation to each match,
+// the explanations are kept by the collector along with the hits, whichever
+// store and offset are used.  An explanation is built for every match scored,
+// not only those returned, so this adds allocations in proportion to the number
+// of matching terms and is best left off except when debugging relevance.
 func (s *TopNSearch) ExplainScores() *TopNSearch {
 	s.options.ExplainScores = true
 	return s
@@ -166,27 +288,124 @@ func (s *TopNSearch) SetScore(mode string) *TopNSearch {
 	return s
 }
 
+// WithoutScoring skips computing the score of the matches when nothing
+// in the search reads it, see UsesScore, such as a search sorted by a
+// field only, every match then has a score of 0.  Searches whose sort
+// order, aggregations, post filter or deduplication use the score are
+// still scored.
+func (s *TopNSearch) WithoutScoring() *TopNSearch {
+	s.noScoring = true
+	return s
+}
+
+// UsesScore reports whether the search reads the score of the matches,
+// in its sort order, aggregations, post filter or deduplication, or has
+// been asked to explain them.
+func (s *TopNSearch) UsesScore() bool {
+	return s.options.ExplainScores || s.dedupeField != "" ||
+		s.sort.UsesScore() || s.aggregations.UsesScore() ||
+		(s.postFilter != nil && search.UsesScore(s.postFilter))
+}
+
+func (s *TopNSearch) Searcher(i search.Reader, config Config) (search.Searcher, error) {
+	options := s.options
+	if options.Score == "" && s.noScoring && !s.UsesScore() {
+		// nothing reads the scores, skip computing them
+		options.Score = "none"
+	}
+	return s.query.Searcher(i, searchOptionsFromConfig(config, options))
+}
+
 func (s *TopNSearch) Collector() search.Collector {
+	rv := s.topNCollector()
+	if s.dedupeField != "" {
+		return collector.NewDedupeCollector(rv, s.dedupeField, s.dedupeMaxValues)
+	}
+	return rv
+}
+
+func (s *TopNSearch) topNCollector() *collector.TopNCollector {
 	if s.after != nil {
-		collectorSort := s.sort
 		if s.reversed {
-			// preserve original sort order in the request
-			collectorSort = s.sort.Copy()
-			collectorSort.Reverse()
+			rv := collector.NewTopNCollectorBefore(s.n, s.sort, s.after)
+			return s.configureCollector(rv)
+		}
+		rv := collector.NewTopNCollectorAfter(s.n, s.sort, s.after, false)
+		return s.configureCollector(rv)
+	}
+	rv := collector.NewTopNCollector(s.n, s.from, s.sort)
+	return s.configureCollector(rv)
+}
+
+func (s *TopNSearch) configureCollector(rv *collector.TopNCollector) *collector.TopNCollector {
+	if s.tieBreaker != "" {
+		rv.WithTieBreaker(s.tieBreaker)
+	}
+	if s.sortCache != nil {
+		rv.WithSortValueCache(s.sortCache)
+	}
+	if s.maxDocsScanned > 0 {
+		rv.WithMaxDocsScanned(s.maxDocsScanned)
+	}
+	if s.stats != nil {
+		rv.WithSearchStats(s.stats)
+	}
+	if s.spillThreshold > 0 {
+		rv.WithSpill(s.spillThreshold, s.spillDir)
+	}
+	if s.postFilter != nil {
+		rv.WithPostFilter(s.postFilter)
+		if s.aggregateBeforePostFilter {
+			rv.WithAggregationsBeforePostFilter()
 		}
-		rv := collector.NewTopNCollectorAfter(s.n, collectorSort, s.after, s.reversed)
-		return rv
 	}
-	return collector.NewTopNCollector(s.n, s.from, s.sort)
+	return rv
+}
+
+// contextSearcher is implemented by searchers which work in the
+// background, so that they stop once the search is canceled
+type contextSearcher interface {
+	withContext(ctx context.Context)
+}
+
+// collect runs the collector, applying the timeout of the
+// request, if it has one, to the context
+func collect(ctx context.Context, req SearchRequest, collector search.Collector,
+	searcher search.Collectible) (search.DocumentMatchIterator, error) {
+	var timeout time.Duration
+	if tr, ok := req.(interface{ Timeout() time.Duration }); ok {
+		timeout = tr.Timeout()
+	}
+	if timeout <= 0 {
+		if cs, ok := searcher.(contextSearcher); ok {
+			cs.withContext(ctx)
+		}
+		return collector.Collect(ctx, req.Aggregations(), searcher)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if cs, ok := searcher.(contextSearcher); ok {
+		cs.withContext(timeoutCtx)
+	}
+	dmItr, err := collector.Collect(timeoutCtx, req.Aggregations(), searcher)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return nil, fmt.Errorf("%w after %v", ErrSearchTimeout, timeout)
+	}
+	return dmItr, err
 }
 
 func searchOptionsFromConfig(config Config, options SearchOptions) search.SearcherOptions {
 	return search.SearcherOptions{
 		SimilarityForField: func(field string) search.Similarity {
+			sim := config.DefaultSimilarity
 			if pfs, ok := config.PerFieldSimilarity[field]; ok {
-				return pfs
+				sim = pfs
 			}
-			return config.DefaultSimilarity
+			if boost, ok := config.fieldBoosts[field]; ok {
+				return fieldBoostSimilarity{Similarity: sim, boost: boost}
+			}
+			return sim
 		},
 		DefaultSearchField: config.DefaultSearchField,
 		DefaultAnalyzer:    config.DefaultSearchAnalyzer,
@@ -196,12 +415,25 @@ func searchOptionsFromConfig(config Config, options SearchOptions) search.Search
 	}
 }
 
+// fieldBoostSimilarity multiplies the boost of the
+// queries of a field by the boost configured for it
+type fieldBoostSimilarity struct {
+	search.Similarity
+	boost float64
+}
+
+func (f fieldBoostSimilarity) Scorer(boost float64, collectionStats segment.CollectionStats,
+	termStats segment.TermStats) search.Scorer {
+	return f.Similarity.Scorer(boost*f.boost, collectionStats, termStats)
+}
+
 func (s *TopNSearch) AddAggregation(name string, aggregation search.Aggregation) {
 	s.aggregations.Add(name, aggregation)
 }
 
 type AllMatches struct {
 	BaseSearch
+	maxDocsScanned int
 }
 
 func NewAllMatches(q Query) *AllMatches {
@@ -234,8 +466,44 @@ func (s *AllMatches) IncludeLocations() *AllMatches {
 	return s
 }
 
+// WithMaxDocsScanned fails the iteration with collector.ErrScanLimitExceeded
+// once more than n documents match, the default, 0, does not limit it.
+func (s *AllMatches) WithMaxDocsScanned(n int) *AllMatches {
+	s.maxDocsScanned = n
+	return s
+}
+
 func (s *AllMatches) Collector() search.Collector {
-	return collector.NewAllCollector()
+	return collector.NewAllCollector().WithMaxDocsScanned(s.maxDocsScanned)
+}
+
+// SampleMatches chooses up to k of the matches of the query uniformly
+// at random, rather than those with the highest scores, such as to
+// monitor the quality of the matches.  The same seed chooses the same
+// sample of the same matches, which is useful in tests.
+type SampleMatches struct {
+	BaseSearch
+	k    int
+	seed int64
+}
+
+func NewSampleMatches(k int, seed int64, q Query) *SampleMatches {
+	return &SampleMatches{
+		BaseSearch: BaseSearch{
+			query:        q,
+			aggregations: make(search.Aggregations),
+		},
+		k:    k,
+		seed: seed,
+	}
+}
+
+func (s *SampleMatches) AddAggregation(name string, aggregation search.Aggregation) {
+	s.aggregations.Add(name, aggregation)
+}
+
+func (s *SampleMatches) Collector() search.Collector {
+	return collector.NewSampleCollector(s.k, s.seed)
 }
 
 func (s *TopNSearch) AllMatches(i search.Reader, config Config) (search.Searcher, error) {
@@ -246,10 +514,15 @@ func (s *TopNSearch) AllMatches(i search.Reader, config Config) (search.Searcher
 	})
 }
 
+type sizedCollectible interface {
+	search.Collectible
+	Size() int
+}
+
 // memNeededForSearch is a helper function that returns an estimate of RAM
 // needed to execute a search request.
 func memNeededForSearch(
-	searcher search.Searcher,
+	searcher sizedCollectible,
 	coll search.Collector) uint64 {
 	numDocMatches := coll.BackingSize() + searcher.DocumentMatchPoolSize()
 
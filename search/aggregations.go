@@ -15,9 +15,17 @@
 package search
 
 import (
+	"errors"
 	"time"
 )
 
+// ErrTooManyBuckets is returned when an aggregation would need
+// to create more buckets than it has been allowed
+var ErrTooManyBuckets = errors.New("too many aggregation buckets")
+
+// Aggregation describes a calculation over the matches, Fields must
+// return the fields needed by the aggregation and by any aggregations
+// nested within its buckets, so that they are loaded for each match
 type Aggregation interface {
 	Fields() []string
 	Calculator() Calculator
@@ -58,6 +66,13 @@ type BucketCalculator interface {
 	Buckets() []*Bucket
 }
 
+// FailingCalculator is a Calculator which is able to fail,
+// such as a BucketCalculator with a limit on its buckets
+type FailingCalculator interface {
+	Calculator
+	Err() error
+}
+
 type Bucket struct {
 	name         string
 	aggregations map[string]Calculator
@@ -100,6 +115,26 @@ func (b *Bucket) Finish() {
 	}
 }
 
+// Err returns the first error reported by the calculators
+// of this bucket, including those of nested buckets
+func (b *Bucket) Err() error {
+	for _, aggCalc := range b.aggregations {
+		switch calc := aggCalc.(type) {
+		case FailingCalculator:
+			if err := calc.Err(); err != nil {
+				return err
+			}
+		case BucketCalculator:
+			for _, bucket := range calc.Buckets() {
+				if err := bucket.Err(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func (b *Bucket) Aggregations() map[string]Calculator {
 	return b.aggregations
 }
@@ -16,7 +16,9 @@ package aggregations
 
 import (
 	"math"
+	"reflect"
 	"testing"
+	"time"
 
 	segment "github.com/blugelabs/bluge_segment_api"
 
@@ -80,6 +82,397 @@ func TestAggregationMerge(t *testing.T) {
 	expect.Assert(t, shard1, "")
 }
 
+func TestRangeAggregationBoundaries(t *testing.T) {
+	byPrice := Ranges(search.Field("price")).
+		AddRange(Range(0, 10)).
+		AddRange(RangeInclusive(0, 10, true, true)).
+		AddRange(RangeInclusive(10, 100, false, false)).
+		AddRange(RangeInclusive(10, 100, true, true)).
+		AddRange(NamedRange("100+", 100, math.Inf(1)))
+	aggs := search.Aggregations{"byPrice": byPrice}
+
+	bucket := search.NewBucket("global", aggs)
+	for i, price := range []float64{0, 10, 50, 100, 150} {
+		doc := newDocumentMatch(uint64(i), 1.0, map[string][]byte{
+			"price": numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(price), 0),
+		})
+		err := doc.LoadDocumentValues(search.NewSearchContext(0, 0), aggs.Fields())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bucket.Consume(doc)
+	}
+	bucket.Finish()
+
+	expectCounts := []struct {
+		name  string
+		count uint64
+	}{
+		{name: "[0.000000,10.000000)", count: 1},
+		{name: "[0.000000,10.000000]", count: 2},
+		{name: "(10.000000,100.000000)", count: 1},
+		{name: "[10.000000,100.000000]", count: 3},
+		{name: "100+", count: 2},
+	}
+	buckets := bucket.Buckets("byPrice")
+	if len(buckets) != len(expectCounts) {
+		t.Fatalf("expected %d buckets, got %d", len(expectCounts), len(buckets))
+	}
+	for i, expect := range expectCounts {
+		if buckets[i].Name() != expect.name {
+			t.Errorf("expected bucket %d named %s, got %s", i, expect.name, buckets[i].Name())
+		}
+		if count := buckets[i].Count(); count != expect.count {
+			t.Errorf("expected %d in bucket %s, got %d", expect.count, expect.name, count)
+		}
+	}
+}
+
+func TestDateHistogramAggregation(t *testing.T) {
+	dates := []time.Time{
+		time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 3, 5, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 5, 12, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name   string
+		agg    *DateHistogramAggregation
+		expect []string
+		counts []uint64
+		err    bool
+	}{
+		{
+			name: "daily",
+			agg:  DateHistogram(search.Field("updated"), 24*time.Hour),
+			expect: []string{
+				"2020-01-01T00:00:00Z",
+				"2020-01-03T00:00:00Z",
+				"2020-01-05T00:00:00Z",
+			},
+			counts: []uint64{2, 1, 1},
+		},
+		{
+			name: "daily filled",
+			agg:  DateHistogram(search.Field("updated"), 24*time.Hour).SetFillEmpty(true),
+			expect: []string{
+				"2020-01-01T00:00:00Z",
+				"2020-01-02T00:00:00Z",
+				"2020-01-03T00:00:00Z",
+				"2020-01-04T00:00:00Z",
+				"2020-01-05T00:00:00Z",
+			},
+			counts: []uint64{2, 0, 1, 0, 1},
+		},
+		{
+			name: "daily offset",
+			agg:  DateHistogram(search.Field("updated"), 24*time.Hour).SetTimeZoneOffset(2 * time.Hour),
+			expect: []string{
+				"2020-01-01T00:00:00+02:00",
+				"2020-01-02T00:00:00+02:00",
+				"2020-01-03T00:00:00+02:00",
+				"2020-01-05T00:00:00+02:00",
+			},
+			counts: []uint64{1, 1, 1, 1},
+		},
+		{
+			name: "daily limited",
+			agg:  DateHistogram(search.Field("updated"), 24*time.Hour).SetMaxBuckets(3),
+			expect: []string{
+				"2020-01-01T00:00:00Z",
+				"2020-01-03T00:00:00Z",
+				"2020-01-05T00:00:00Z",
+			},
+			counts: []uint64{2, 1, 1},
+		},
+		{
+			name: "daily filled limited",
+			agg:  DateHistogram(search.Field("updated"), 24*time.Hour).SetFillEmpty(true).SetMaxBuckets(4),
+			err:  true,
+		},
+		{
+			name: "hourly limited",
+			agg:  DateHistogram(search.Field("updated"), time.Hour).SetMaxBuckets(3),
+			err:  true,
+		},
+		{
+			name: "zero interval",
+			agg:  DateHistogram(search.Field("updated"), 0),
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		aggs := search.Aggregations{"updated": test.agg}
+		bucket := search.NewBucket("global", aggs)
+		for i, date := range dates {
+			doc := newDocumentMatch(uint64(i), 1.0, map[string][]byte{
+				"updated": numeric.MustNewPrefixCodedInt64(date.UnixNano(), 0),
+			})
+			err := doc.LoadDocumentValues(search.NewSearchContext(0, 0), aggs.Fields())
+			if err != nil {
+				t.Fatal(err)
+			}
+			bucket.Consume(doc)
+		}
+		err := bucket.Err()
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		bucket.Finish()
+
+		buckets := bucket.Buckets("updated")
+		if len(buckets) != len(test.expect) {
+			t.Fatalf("%s: expected %d buckets, got %d", test.name, len(test.expect), len(buckets))
+		}
+		for i := range buckets {
+			if buckets[i].Name() != test.expect[i] {
+				t.Errorf("%s: expected bucket %d named %s, got %s", test.name, i, test.expect[i], buckets[i].Name())
+			}
+			if buckets[i].Count() != test.counts[i] {
+				t.Errorf("%s: expected %d in bucket %s, got %d", test.name, test.counts[i], test.expect[i], buckets[i].Count())
+			}
+		}
+	}
+}
+
+func TestStatsAndQuantiles(t *testing.T) {
+	quantiles := Quantiles(search.Field("rank"))
+	err := quantiles.SetCompression(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aggs := search.Aggregations{
+		"stats":     Stats(search.Field("rank")),
+		"quantiles": quantiles,
+	}
+
+	// ranks 1 to 1000, uniformly distributed
+	bucket := search.NewBucket("global", aggs)
+	for i := 1; i <= 1000; i++ {
+		doc := newDocumentMatch(uint64(i), 1.0, map[string][]byte{
+			"rank": numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(float64(i)), 0),
+		})
+		err = doc.LoadDocumentValues(search.NewSearchContext(0, 0), aggs.Fields())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bucket.Consume(doc)
+	}
+	bucket.Finish()
+
+	stats := bucket.Aggregations()["stats"].(*StatsCalculator)
+	if stats.Count() != 1000 {
+		t.Errorf("expected count 1000, got %d", stats.Count())
+	}
+	if stats.Sum() != 500500 {
+		t.Errorf("expected sum 500500, got %f", stats.Sum())
+	}
+	if stats.Min() != 1 || stats.Max() != 1000 {
+		t.Errorf("expected min 1 and max 1000, got %f and %f", stats.Min(), stats.Max())
+	}
+	if stats.Avg() != 500.5 {
+		t.Errorf("expected avg 500.5, got %f", stats.Avg())
+	}
+
+	quantilesCalc := bucket.Aggregations()["quantiles"].(*QuantilesCalculator)
+	for _, percent := range []float64{0.01, 0.25, 0.5, 0.75, 0.99} {
+		got, err := quantilesCalc.Quantile(percent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := percent * 1000
+		if math.Abs(got-expect) > 10 {
+			t.Errorf("expected quantile %f near %f, got %f", percent, expect, got)
+		}
+	}
+}
+
+func TestTermsAggregationOrder(t *testing.T) {
+	buildDocs := func() (rv []*search.DocumentMatch) {
+		for tag, count := range map[string]int{"a": 1, "b": 3, "c": 5, "d": 2, "e": 4} {
+			for i := 0; i < count; i++ {
+				rv = append(rv, newDocumentMatch(uint64(len(rv)), 1, map[string][]byte{
+					"tag": []byte(tag),
+				}))
+			}
+		}
+		return rv
+	}
+
+	tests := []struct {
+		name  string
+		agg   *TermsAggregation
+		names []string
+		other int
+	}{
+		{
+			name:  "count",
+			agg:   NewTermsAggregation(search.Field("tag"), 10),
+			names: []string{"c", "e", "b", "d", "a"},
+		},
+		{
+			name:  "min count",
+			agg:   NewTermsAggregation(search.Field("tag"), 10).SetMinCount(2),
+			names: []string{"c", "e", "b", "d"},
+			other: 1,
+		},
+		{
+			name:  "term",
+			agg:   NewTermsAggregation(search.Field("tag"), 10).OrderByTerm(),
+			names: []string{"a", "b", "c", "d", "e"},
+		},
+		{
+			// the most frequent terms, in term order
+			name:  "term size",
+			agg:   NewTermsAggregation(search.Field("tag"), 10).SetSize(3).OrderByTerm(),
+			names: []string{"b", "c", "e"},
+			other: 3,
+		},
+		{
+			name:  "term then count",
+			agg:   NewTermsAggregation(search.Field("tag"), 2).OrderByTerm().OrderByCount(),
+			names: []string{"c", "e"},
+			other: 6,
+		},
+		{
+			name:  "approximate",
+			agg:   NewTermsAggregation(search.Field("tag"), 10).Approximate(0.01, 0.01).SetMinCount(2).OrderByTerm(),
+			names: []string{"b", "c", "d", "e"},
+			other: 1,
+		},
+	}
+	for _, test := range tests {
+		aggs := search.Aggregations{"tags": test.agg}
+		bucket := search.NewBucket("", aggs)
+		for _, doc := range buildDocs() {
+			err := doc.LoadDocumentValues(search.NewSearchContext(0, 0), aggs.Fields())
+			if err != nil {
+				t.Fatal(err)
+			}
+			bucket.Consume(doc)
+		}
+		bucket.Finish()
+
+		var names []string
+		for _, b := range bucket.Buckets("tags") {
+			names = append(names, b.Name())
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%s: expected buckets %v, got %v", test.name, test.names, names)
+		}
+		var other int
+		switch calc := bucket.Aggregation("tags").(type) {
+		case *TermsCalculator:
+			other = calc.Other()
+		case *ApproximateTermsCalculator:
+			other = calc.Other()
+		}
+		if other != test.other {
+			t.Errorf("%s: expected other %d, got %d", test.name, test.other, other)
+		}
+	}
+}
+
+func TestTermsAggregationOrderByTermTies(t *testing.T) {
+	// every term has one match, so the first terms are kept
+	aggs := search.Aggregations{
+		"tags": NewTermsAggregation(search.Field("tag"), 2).OrderByTerm(),
+	}
+	bucket := search.NewBucket("", aggs)
+	for i, tag := range []string{"e", "d", "c", "b", "a"} {
+		doc := newDocumentMatch(uint64(i), 1, map[string][]byte{
+			"tag": []byte(tag),
+		})
+		err := doc.LoadDocumentValues(search.NewSearchContext(0, 0), aggs.Fields())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bucket.Consume(doc)
+	}
+	bucket.Finish()
+
+	var names []string
+	for _, b := range bucket.Buckets("tags") {
+		names = append(names, b.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("expected buckets [a b], got %v", names)
+	}
+}
+
+func TestNestedAggregations(t *testing.T) {
+	byCategory := NewTermsAggregation(search.Field("category"), 10)
+	byCategory.AddAggregation("avg_price", Avg(search.Field("price")))
+	byStock := Ranges(search.Field("stock")).
+		AddRange(NamedRange("low", 0, 10)).
+		AddRange(NamedRange("high", 10, math.Inf(1))).
+		AddAggregation("byCategory", byCategory)
+	aggs := search.Aggregations{"byStock": byStock}
+
+	// fields of aggregations nested within buckets are needed too
+	assertFieldsSeen(t, []string{"stock", "category", "price"}, aggs.Fields())
+
+	bucket := search.NewBucket("global", aggs)
+	for i, doc := range []struct {
+		category string
+		price    float64
+		stock    float64
+	}{
+		{category: "book", price: 10, stock: 5},
+		{category: "book", price: 20, stock: 5},
+		{category: "book", price: 60, stock: 50},
+		{category: "movie", price: 15, stock: 1},
+		{category: "movie", price: 25, stock: 100},
+		{category: "movie", price: 35, stock: 200},
+	} {
+		match := newDocumentMatch(uint64(i), 1.0, map[string][]byte{
+			"category": []byte(doc.category),
+			"price":    numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(doc.price), 0),
+			"stock":    numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(doc.stock), 0),
+		})
+		err := match.LoadDocumentValues(search.NewSearchContext(0, 0), aggs.Fields())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bucket.Consume(match)
+	}
+	bucket.Finish()
+
+	expect := &bucketExpectation{
+		children: map[string]map[string]*bucketExpectation{
+			"byStock": {
+				"low": &bucketExpectation{
+					metrics: map[string]float64{"count": 3},
+					children: map[string]map[string]*bucketExpectation{
+						"byCategory": {
+							"book":  &bucketExpectation{metrics: map[string]float64{"count": 2, "avg_price": 15}},
+							"movie": &bucketExpectation{metrics: map[string]float64{"count": 1, "avg_price": 15}},
+						},
+					},
+				},
+				"high": &bucketExpectation{
+					metrics: map[string]float64{"count": 3},
+					children: map[string]map[string]*bucketExpectation{
+						"byCategory": {
+							"book":  &bucketExpectation{metrics: map[string]float64{"count": 1, "avg_price": 60}},
+							"movie": &bucketExpectation{metrics: map[string]float64{"count": 2, "avg_price": 30}},
+						},
+					},
+				},
+			},
+		},
+	}
+	expect.Assert(t, bucket, "")
+}
+
 type matchReader struct {
 	docVals map[string][]byte
 }
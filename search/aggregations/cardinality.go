@@ -33,6 +33,10 @@ func (c *CardinalityMetric) Fields() []string {
 	return c.src.Fields()
 }
 
+func (c *CardinalityMetric) UsesScore() bool {
+	return search.UsesScore(c.src)
+}
+
 func (c *CardinalityMetric) Calculator() search.Calculator {
 	rv := &CardinalityCalculator{
 		src:    c.src,
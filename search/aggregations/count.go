@@ -24,6 +24,10 @@ func (*countingSource) Fields() []string {
 	return nil
 }
 
+func (*countingSource) UsesScore() bool {
+	return false
+}
+
 func (*countingSource) Numbers(_ *search.DocumentMatch) []float64 {
 	return staticCount
 }
@@ -30,6 +30,10 @@ func (d *DurationMetric) Fields() []string {
 	return nil
 }
 
+func (d *DurationMetric) UsesScore() bool {
+	return false
+}
+
 func (d *DurationMetric) Calculator() search.Calculator {
 	return &DurationCalculator{
 		origin: time.Now(),
@@ -38,6 +38,10 @@ func (f *FilteringTextSource) Fields() []string {
 	return f.source.Fields()
 }
 
+func (f *FilteringTextSource) UsesScore() bool {
+	return search.UsesScore(f.source)
+}
+
 func (f *FilteringTextSource) Values(match *search.DocumentMatch) [][]byte {
 	var rv [][]byte
 	values := f.source.Values(match)
@@ -65,6 +69,10 @@ func (f *FilteringNumericSource) Fields() []string {
 	return f.source.Fields()
 }
 
+func (f *FilteringNumericSource) UsesScore() bool {
+	return search.UsesScore(f.source)
+}
+
 func (f *FilteringNumericSource) Numbers(match *search.DocumentMatch) []float64 {
 	var rv []float64
 	values := f.source.Numbers(match)
@@ -92,6 +100,10 @@ func (f *FilteringDateSource) Fields() []string {
 	return f.source.Fields()
 }
 
+func (f *FilteringDateSource) UsesScore() bool {
+	return search.UsesScore(f.source)
+}
+
 func (f *FilteringDateSource) Dates(match *search.DocumentMatch) []time.Time {
 	var rv []time.Time
 	values := f.source.Dates(match)
@@ -119,6 +131,10 @@ func (f *FilteringGeoPointSource) Fields() []string {
 	return f.source.Fields()
 }
 
+func (f *FilteringGeoPointSource) UsesScore() bool {
+	return search.UsesScore(f.source)
+}
+
 func (f *FilteringGeoPointSource) GeoPoints(match *search.DocumentMatch) []*geo.Point {
 	var rv []*geo.Point
 	values := f.source.GeoPoints(match)
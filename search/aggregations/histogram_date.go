@@ -0,0 +1,259 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregations
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/blugelabs/bluge/search"
+)
+
+// DateHistogramAggregation groups matches into buckets of a fixed
+// interval of time, named by the start of the interval in RFC3339.
+// Intervals are aligned to the Unix epoch in UTC, shifted by the time
+// zone offset, so daily buckets start at midnight in that zone, but
+// weekly buckets start on a Thursday, as the epoch did.
+// The interval must be positive, otherwise the search fails.
+type DateHistogramAggregation struct {
+	src        search.DateValuesSource
+	interval   time.Duration
+	offset     time.Duration
+	fillEmpty  bool
+	maxBuckets int
+
+	aggregations map[string]search.Aggregation
+}
+
+func DateHistogram(src search.DateValuesSource, interval time.Duration) *DateHistogramAggregation {
+	return &DateHistogramAggregation{
+		src:        src,
+		interval:   interval,
+		maxBuckets: DefaultMaxBuckets,
+		aggregations: map[string]search.Aggregation{
+			"count": CountMatches(),
+		},
+	}
+}
+
+// SetTimeZoneOffset aligns the intervals to a time zone the offset
+// east of UTC, instead of to UTC itself
+func (a *DateHistogramAggregation) SetTimeZoneOffset(offset time.Duration) *DateHistogramAggregation {
+	a.offset = offset
+	return a
+}
+
+// SetFillEmpty adds empty buckets for any intervals without matches
+// between the first and last intervals with matches
+func (a *DateHistogramAggregation) SetFillEmpty(fillEmpty bool) *DateHistogramAggregation {
+	a.fillEmpty = fillEmpty
+	return a
+}
+
+// SetMaxBuckets limits the number of intervals the aggregation will
+// track, including the empty ones added by SetFillEmpty, once exceeded
+// the search fails with ErrTooManyBuckets, 0 means no limit
+func (a *DateHistogramAggregation) SetMaxBuckets(maxBuckets int) *DateHistogramAggregation {
+	a.maxBuckets = maxBuckets
+	return a
+}
+
+func (a *DateHistogramAggregation) Fields() []string {
+	rv := a.src.Fields()
+	for _, agg := range a.aggregations {
+		rv = append(rv, agg.Fields()...)
+	}
+	return rv
+}
+
+func (a *DateHistogramAggregation) UsesScore() bool {
+	return search.UsesScore(a.src) || search.Aggregations(a.aggregations).UsesScore()
+}
+
+func (a *DateHistogramAggregation) AddAggregation(name string, agg search.Aggregation) *DateHistogramAggregation {
+	a.aggregations[name] = agg
+	return a
+}
+
+func (a *DateHistogramAggregation) Calculator() search.Calculator {
+	return &DateHistogramCalculator{
+		src:          a.src,
+		interval:     int64(a.interval),
+		offset:       int64(a.offset),
+		zone:         time.FixedZone("", int(a.offset/time.Second)),
+		fillEmpty:    a.fillEmpty,
+		maxBuckets:   a.maxBuckets,
+		aggregations: a.aggregations,
+		bucketsMap:   make(map[int64]*search.Bucket),
+	}
+}
+
+type DateHistogramCalculator struct {
+	src        search.DateValuesSource
+	interval   int64
+	offset     int64
+	zone       *time.Location
+	fillEmpty  bool
+	maxBuckets int
+	err        error
+
+	aggregations map[string]search.Aggregation
+
+	bucketsMap  map[int64]*search.Bucket
+	bucketsList []*search.Bucket
+}
+
+// start returns the start of the interval containing t, in
+// nanoseconds since the epoch
+func (a *DateHistogramCalculator) start(t time.Time) int64 {
+	local := t.UnixNano() + a.offset
+	n := local / a.interval
+	if local%a.interval < 0 {
+		n--
+	}
+	return n*a.interval - a.offset
+}
+
+func (a *DateHistogramCalculator) bucket(start int64) *search.Bucket {
+	bucket, ok := a.bucketsMap[start]
+	if !ok {
+		name := time.Unix(0, start).In(a.zone).Format(time.RFC3339)
+		bucket = search.NewBucket(name, a.aggregations)
+		a.bucketsMap[start] = bucket
+	}
+	return bucket
+}
+
+// Consume adds the match to the bucket of every interval containing
+// any of its dates, but only once to each
+func (a *DateHistogramCalculator) Consume(d *search.DocumentMatch) {
+	if a.interval <= 0 {
+		return
+	}
+	var seen []int64
+outer:
+	for _, date := range a.src.Dates(d) {
+		start := a.start(date)
+		for _, s := range seen {
+			if s == start {
+				continue outer
+			}
+		}
+		seen = append(seen, start)
+		if _, ok := a.bucketsMap[start]; !ok && a.maxBuckets > 0 && len(a.bucketsMap) >= a.maxBuckets {
+			a.tooManyBuckets()
+			continue
+		}
+		a.bucket(start).Consume(d)
+	}
+}
+
+func (a *DateHistogramCalculator) tooManyBuckets() {
+	if a.err == nil {
+		a.err = fmt.Errorf("date histogram aggregation exceeded %d buckets: %w",
+			a.maxBuckets, search.ErrTooManyBuckets)
+	}
+}
+
+// filledBuckets returns the number of buckets once the empty
+// intervals between the first and last buckets are filled
+func (a *DateHistogramCalculator) filledBuckets() int64 {
+	if len(a.bucketsMap) == 0 {
+		return 0
+	}
+	var first, last int64
+	var seen bool
+	for start := range a.bucketsMap {
+		if !seen || start < first {
+			first = start
+		}
+		if !seen || start > last {
+			last = start
+		}
+		seen = true
+	}
+	return (last-first)/a.interval + 1
+}
+
+// Err reports an interval which is not positive, and returns
+// ErrTooManyBuckets if the limit on the number of buckets was
+// exceeded, by this aggregation or one nested within its buckets
+func (a *DateHistogramCalculator) Err() error {
+	if a.interval <= 0 {
+		return fmt.Errorf("date histogram interval must be positive, got %v",
+			time.Duration(a.interval))
+	}
+	if a.fillEmpty && a.maxBuckets > 0 && a.filledBuckets() > int64(a.maxBuckets) {
+		a.tooManyBuckets()
+	}
+	if a.err != nil {
+		return a.err
+	}
+	for _, bucket := range a.bucketsMap {
+		if err := bucket.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *DateHistogramCalculator) Merge(other search.Calculator) {
+	if other, ok := other.(*DateHistogramCalculator); ok {
+		for start, otherBucket := range other.bucketsMap {
+			if bucket, ok := a.bucketsMap[start]; ok {
+				bucket.Merge(otherBucket)
+			} else {
+				a.bucketsMap[start] = otherBucket
+			}
+		}
+		if a.maxBuckets > 0 && len(a.bucketsMap) > a.maxBuckets {
+			a.tooManyBuckets()
+		}
+		a.Finish()
+	}
+}
+
+func (a *DateHistogramCalculator) Finish() {
+	starts := make([]int64, 0, len(a.bucketsMap))
+	for start := range a.bucketsMap {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i] < starts[j]
+	})
+
+	// filling is skipped when it would exceed the limit, Err reports it
+	fill := a.fillEmpty && (a.maxBuckets <= 0 || a.filledBuckets() <= int64(a.maxBuckets))
+
+	a.bucketsList = a.bucketsList[:0]
+	for i, start := range starts {
+		if fill && i > 0 {
+			for empty := starts[i-1] + a.interval; empty < start; empty += a.interval {
+				bucket := a.bucket(empty)
+				bucket.Finish()
+				a.bucketsList = append(a.bucketsList, bucket)
+			}
+		}
+		bucket := a.bucketsMap[start]
+		bucket.Finish()
+		a.bucketsList = append(a.bucketsList, bucket)
+	}
+}
+
+// Buckets returns a bucket for each interval, in order
+func (a *DateHistogramCalculator) Buckets() []*search.Bucket {
+	return a.bucketsList
+}
@@ -67,6 +67,10 @@ func (s *SingleValueMetric) Fields() []string {
 	return s.src.Fields()
 }
 
+func (s *SingleValueMetric) UsesScore() bool {
+	return search.UsesScore(s.src)
+}
+
 func (s *SingleValueMetric) Calculator() search.Calculator {
 	rv := &SingleValueCalculator{
 		val:     s.init,
@@ -128,6 +132,10 @@ func (a *WeightedAvgMetric) Fields() []string {
 	return rv
 }
 
+func (a *WeightedAvgMetric) UsesScore() bool {
+	return search.UsesScore(a.src) || (a.weight != nil && search.UsesScore(a.weight))
+}
+
 func (a *WeightedAvgMetric) Calculator() search.Calculator {
 	rv := &WeightedAvgCalculator{
 		src:    a.src,
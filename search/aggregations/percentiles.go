@@ -21,6 +21,11 @@ import (
 	"github.com/caio/go-tdigest"
 )
 
+// QuantilesMetric estimates the quantiles of the values of a source
+// using a t-digest, so the memory used is bounded by the compression
+// rather than growing with the number of values.  Estimates are most
+// accurate towards the extremes, such as the 1st and 99th percentiles,
+// and least accurate around the median.
 type QuantilesMetric struct {
 	src         search.NumericValuesSource
 	compression float64
@@ -33,6 +38,10 @@ func Quantiles(src search.NumericValuesSource) *QuantilesMetric {
 	}
 }
 
+// SetCompression trades memory for accuracy, the digest keeps a
+// number of centroids proportional to the compression, so raising
+// it uses more memory in each bucket but reduces the error of the
+// estimates, the default is 100
 func (c *QuantilesMetric) SetCompression(compression float64) error {
 	if compression < 1 {
 		return fmt.Errorf("compression must be > 1")
@@ -45,6 +54,10 @@ func (c *QuantilesMetric) Fields() []string {
 	return c.src.Fields()
 }
 
+func (c *QuantilesMetric) UsesScore() bool {
+	return search.UsesScore(c.src)
+}
+
 func (c *QuantilesMetric) Calculator() search.Calculator {
 	rv := &QuantilesCalculator{
 		src: c.src,
@@ -36,7 +36,11 @@ func Ranges(src search.NumericValuesSource) *RangeAggregation {
 }
 
 func (a *RangeAggregation) Fields() []string {
-	return a.src.Fields()
+	return append(a.src.Fields(), search.Aggregations(a.aggregations).Fields()...)
+}
+
+func (a *RangeAggregation) UsesScore() bool {
+	return search.UsesScore(a.src) || search.Aggregations(a.aggregations).UsesScore()
 }
 
 func (a *RangeAggregation) AddRange(rang *NumericRange) *RangeAggregation {
@@ -58,7 +62,7 @@ func (a *RangeAggregation) Calculator() search.Calculator {
 	for _, rang := range a.ranges {
 		bucketName := rang.name
 		if bucketName == "" {
-			bucketName = fmt.Sprintf("[%f,%f)", rang.low, rang.high)
+			bucketName = rang.String()
 		}
 		newBucket := search.NewBucket(bucketName, a.aggregations)
 		rv.bucketCalculators = append(rv.bucketCalculators, newBucket)
@@ -73,11 +77,16 @@ type RangeCalculator struct {
 	bucketCalculators []*search.Bucket
 }
 
+// Consume adds the match to the bucket of every range containing
+// any of its values, ranges may overlap, but a match with several
+// values in the same range is only counted once for that range
 func (b *RangeCalculator) Consume(d *search.DocumentMatch) {
-	for _, val := range b.src.Numbers(d) {
-		for i, rang := range b.ranges {
-			if val >= rang.low && val < rang.high {
+	vals := b.src.Numbers(d)
+	for i, rang := range b.ranges {
+		for _, val := range vals {
+			if rang.contains(val) {
 				b.bucketCalculators[i].Consume(d)
+				break
 			}
 		}
 	}
@@ -104,22 +113,59 @@ func (b *RangeCalculator) Buckets() []*search.Bucket {
 }
 
 type NumericRange struct {
-	name string
-	low  float64
-	high float64
+	name          string
+	low           float64
+	high          float64
+	lowInclusive  bool
+	highInclusive bool
 }
 
+// Range includes values from low up to, but not including, high,
+// use math.Inf to leave either end of the range open
 func Range(low, high float64) *NumericRange {
+	return RangeInclusive(low, high, true, false)
+}
+
+// RangeInclusive includes values from low to high, with
+// the inclusion of each endpoint controlled separately
+func RangeInclusive(low, high float64, lowInclusive, highInclusive bool) *NumericRange {
 	return &NumericRange{
-		low:  low,
-		high: high,
+		low:           low,
+		high:          high,
+		lowInclusive:  lowInclusive,
+		highInclusive: highInclusive,
 	}
 }
 
 func NamedRange(name string, low, high float64) *NumericRange {
-	return &NumericRange{
-		name: name,
-		low:  low,
-		high: high,
+	return NamedRangeInclusive(name, low, high, true, false)
+}
+
+func NamedRangeInclusive(name string, low, high float64, lowInclusive, highInclusive bool) *NumericRange {
+	rv := RangeInclusive(low, high, lowInclusive, highInclusive)
+	rv.name = name
+	return rv
+}
+
+func (r *NumericRange) contains(val float64) bool {
+	if val < r.low || (val == r.low && !r.lowInclusive) {
+		return false
+	}
+	if val > r.high || (val == r.high && !r.highInclusive) {
+		return false
+	}
+	return true
+}
+
+// String describes the range in interval notation, which
+// is used as the bucket name when the range is not named
+func (r *NumericRange) String() string {
+	open, closing := "(", ")"
+	if r.lowInclusive {
+		open = "["
+	}
+	if r.highInclusive {
+		closing = "]"
 	}
+	return fmt.Sprintf("%s%f,%f%s", open, r.low, r.high, closing)
 }
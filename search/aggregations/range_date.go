@@ -37,7 +37,11 @@ func DateRanges(src search.DateValuesSource) *DateRangeAggregation {
 }
 
 func (a *DateRangeAggregation) Fields() []string {
-	return a.src.Fields()
+	return append(a.src.Fields(), search.Aggregations(a.aggregations).Fields()...)
+}
+
+func (a *DateRangeAggregation) UsesScore() bool {
+	return search.UsesScore(a.src) || search.Aggregations(a.aggregations).UsesScore()
 }
 
 func (a *DateRangeAggregation) AddRange(rang *DateRange) *DateRangeAggregation {
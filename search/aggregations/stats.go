@@ -0,0 +1,114 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregations
+
+import (
+	"math"
+
+	"github.com/blugelabs/bluge/search"
+)
+
+// StatsMetric computes the count, sum, min, max and average
+// of the values of a source in a single pass
+type StatsMetric struct {
+	src search.NumericValuesSource
+}
+
+func Stats(src search.NumericValuesSource) *StatsMetric {
+	return &StatsMetric{
+		src: src,
+	}
+}
+
+func (s *StatsMetric) Fields() []string {
+	return s.src.Fields()
+}
+
+func (s *StatsMetric) UsesScore() bool {
+	return search.UsesScore(s.src)
+}
+
+func (s *StatsMetric) Calculator() search.Calculator {
+	return &StatsCalculator{
+		src: s.src,
+		min: math.Inf(1),
+		max: math.Inf(-1),
+	}
+}
+
+type StatsCalculator struct {
+	src   search.NumericValuesSource
+	count uint64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func (s *StatsCalculator) Consume(d *search.DocumentMatch) {
+	for _, val := range s.src.Numbers(d) {
+		s.add(val)
+	}
+}
+
+func (s *StatsCalculator) add(val float64) {
+	s.count++
+	s.sum += val
+	if val < s.min {
+		s.min = val
+	}
+	if val > s.max {
+		s.max = val
+	}
+}
+
+func (s *StatsCalculator) Merge(other search.Calculator) {
+	if other, ok := other.(*StatsCalculator); ok {
+		s.count += other.count
+		s.sum += other.sum
+		if other.min < s.min {
+			s.min = other.min
+		}
+		if other.max > s.max {
+			s.max = other.max
+		}
+	}
+}
+
+func (s *StatsCalculator) Finish() {}
+
+// Count returns the number of values seen, which may differ from
+// the number of matches when the source has several values
+func (s *StatsCalculator) Count() uint64 {
+	return s.count
+}
+
+func (s *StatsCalculator) Sum() float64 {
+	return s.sum
+}
+
+// Min returns the smallest value seen, or +Inf if there were none
+func (s *StatsCalculator) Min() float64 {
+	return s.min
+}
+
+// Max returns the largest value seen, or -Inf if there were none
+func (s *StatsCalculator) Max() float64 {
+	return s.max
+}
+
+// Avg returns the mean of the values seen, or NaN if there were none
+func (s *StatsCalculator) Avg() float64 {
+	return s.sum / float64(s.count)
+}
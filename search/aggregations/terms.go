@@ -15,30 +15,42 @@
 package aggregations
 
 import (
+	"fmt"
 	"sort"
 
 	"github.com/blugelabs/bluge/search"
 )
 
+// DefaultMaxBuckets limits the number of buckets created by
+// each terms or date histogram aggregation which does not set
+// its own limit, 0 means no limit
+var DefaultMaxBuckets = 0
+
 type TermsAggregation struct {
-	src  search.TextValuesSource
-	size int
+	src        search.TextValuesSource
+	size       int
+	maxBuckets int
+	minCount   int
+	byTerm     bool
 
 	aggregations map[string]search.Aggregation
 
 	lessFunc func(a, b *search.Bucket) bool
 	desc     bool
 	sortFunc func(p sort.Interface)
+
+	approximate bool
+	epsilon     float64
+	delta       float64
 }
 
 func NewTermsAggregation(src search.TextValuesSource, size int) *TermsAggregation {
 	rv := &TermsAggregation{
-		src:  src,
-		size: size,
-		desc: true,
-		lessFunc: func(a, b *search.Bucket) bool {
-			return a.Aggregations()["count"].(search.MetricCalculator).Value() < b.Aggregations()["count"].(search.MetricCalculator).Value()
-		},
+		src:          src,
+		size:         size,
+		maxBuckets:   DefaultMaxBuckets,
+		desc:         true,
+		lessFunc:     lessByCount,
 		aggregations: make(map[string]search.Aggregation),
 		sortFunc:     sort.Sort,
 	}
@@ -46,6 +58,62 @@ func NewTermsAggregation(src search.TextValuesSource, size int) *TermsAggregatio
 	return rv
 }
 
+func lessByCount(a, b *search.Bucket) bool {
+	return bucketCount(a) < bucketCount(b)
+}
+
+func lessByTerm(a, b *search.Bucket) bool {
+	return a.Name() < b.Name()
+}
+
+func bucketCount(b *search.Bucket) float64 {
+	return b.Aggregations()["count"].(search.MetricCalculator).Value()
+}
+
+// SetSize sets the number of buckets returned.  Every distinct term
+// is counted before the buckets are trimmed, for fields with many
+// distinct terms use SetMaxBuckets to bound the memory used, or
+// Approximate to only track a bounded heap of candidate terms.
+func (t *TermsAggregation) SetSize(size int) *TermsAggregation {
+	t.size = size
+	return t
+}
+
+// SetMinCount only returns buckets of terms with at least minCount
+// matches, the matches of the others are included in Other
+func (t *TermsAggregation) SetMinCount(minCount int) *TermsAggregation {
+	t.minCount = minCount
+	return t
+}
+
+// OrderByCount returns the buckets of the terms with
+// the most matches, those with the most first, this is the default
+func (t *TermsAggregation) OrderByCount() *TermsAggregation {
+	t.byTerm = false
+	t.desc = true
+	t.lessFunc = lessByCount
+	return t
+}
+
+// OrderByTerm returns the buckets in term order.  The buckets returned
+// are still those of the terms with the most matches, only their order
+// changes, so the first terms are not returned unless they are
+// among the most frequent.
+func (t *TermsAggregation) OrderByTerm() *TermsAggregation {
+	t.byTerm = true
+	t.desc = false
+	t.lessFunc = lessByTerm
+	return t
+}
+
+// SetMaxBuckets limits the number of distinct terms the aggregation
+// will track, once exceeded the search fails with ErrTooManyBuckets,
+// 0 means no limit
+func (t *TermsAggregation) SetMaxBuckets(maxBuckets int) *TermsAggregation {
+	t.maxBuckets = maxBuckets
+	return t
+}
+
 func (t *TermsAggregation) Fields() []string {
 	rv := t.src.Fields()
 	for _, agg := range t.aggregations {
@@ -54,14 +122,24 @@ func (t *TermsAggregation) Fields() []string {
 	return rv
 }
 
+func (t *TermsAggregation) UsesScore() bool {
+	return search.UsesScore(t.src) || search.Aggregations(t.aggregations).UsesScore()
+}
+
 func (t *TermsAggregation) AddAggregation(name string, aggregation search.Aggregation) {
 	t.aggregations[name] = aggregation
 }
 
 func (t *TermsAggregation) Calculator() search.Calculator {
+	if t.approximate {
+		return t.approximateCalculator()
+	}
 	return &TermsCalculator{
 		src:          t.src,
 		size:         t.size,
+		maxBuckets:   t.maxBuckets,
+		minCount:     t.minCount,
+		byTerm:       t.byTerm,
 		aggregations: t.aggregations,
 		desc:         t.desc,
 		lessFunc:     t.lessFunc,
@@ -71,8 +149,12 @@ func (t *TermsAggregation) Calculator() search.Calculator {
 }
 
 type TermsCalculator struct {
-	src  search.TextValuesSource
-	size int
+	src        search.TextValuesSource
+	size       int
+	maxBuckets int
+	minCount   int
+	byTerm     bool
+	err        error
 
 	aggregations map[string]search.Aggregation
 
@@ -94,6 +176,13 @@ func (a *TermsCalculator) Consume(d *search.DocumentMatch) {
 		if ok {
 			bucket.Consume(d)
 		} else {
+			if a.maxBuckets > 0 && len(a.bucketsList) >= a.maxBuckets {
+				if a.err == nil {
+					a.err = fmt.Errorf("terms aggregation exceeded %d buckets: %w",
+						a.maxBuckets, search.ErrTooManyBuckets)
+				}
+				continue
+			}
 			newBucket := search.NewBucket(termStr, a.aggregations)
 			newBucket.Consume(d)
 			a.bucketsMap[termStr] = newBucket
@@ -127,8 +216,29 @@ func (a *TermsCalculator) Merge(other search.Calculator) {
 }
 
 func (a *TermsCalculator) Finish() {
-	// sort the buckets
-	if a.desc {
+	// drop the buckets with too few matches
+	if a.minCount > 0 {
+		kept := a.bucketsList[:0]
+		for _, bucket := range a.bucketsList {
+			if bucketCount(bucket) >= float64(a.minCount) {
+				kept = append(kept, bucket)
+			}
+		}
+		a.bucketsList = kept
+	}
+
+	// sort the buckets, those kept when ordering by term are still
+	// those with the most matches, and of those with the same number
+	// of matches at the cut, the first terms
+	if a.byTerm {
+		sort.Slice(a.bucketsList, func(i, j int) bool {
+			ci, cj := bucketCount(a.bucketsList[i]), bucketCount(a.bucketsList[j])
+			if ci != cj {
+				return ci > cj
+			}
+			return lessByTerm(a.bucketsList[i], a.bucketsList[j])
+		})
+	} else if a.desc {
 		a.sortFunc(sort.Reverse(a))
 	} else {
 		a.sortFunc(a)
@@ -140,6 +250,10 @@ func (a *TermsCalculator) Finish() {
 	}
 	a.bucketsList = a.bucketsList[:trimTopN]
 
+	if a.byTerm {
+		a.sortFunc(a)
+	}
+
 	var notOther int
 	for _, bucket := range a.bucketsList {
 		notOther += int(bucket.Aggregations()["count"].(search.MetricCalculator).Value())
@@ -147,6 +261,20 @@ func (a *TermsCalculator) Finish() {
 	a.other = a.total - notOther
 }
 
+// Err returns ErrTooManyBuckets if the limit on the number of buckets
+// was exceeded, by this aggregation or one nested within its buckets
+func (a *TermsCalculator) Err() error {
+	if a.err != nil {
+		return a.err
+	}
+	for _, bucket := range a.bucketsList {
+		if err := bucket.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (a *TermsCalculator) Buckets() []*search.Bucket {
 	return a.bucketsList
 }
@@ -0,0 +1,307 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregations
+
+import (
+	"container/heap"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+
+	"github.com/blugelabs/bluge/search"
+)
+
+// approximateCandidatesFactor controls how many more candidate
+// terms than requested are tracked in approximate mode, tracking
+// more candidates reduces the chance of missing a top term which
+// was first seen late in the stream
+const approximateCandidatesFactor = 4
+
+// Approximate switches the aggregation to estimate the top terms
+// using a count-min sketch, using memory bounded by the error
+// parameters rather than the number of distinct terms.
+// Estimated counts are never lower than the true count, and with
+// probability 1-delta exceed it by at most epsilon times the number
+// of values seen.  Both epsilon and delta must be between 0 and 1,
+// exclusive, otherwise the search fails.
+// Sub-aggregations are not computed in this mode, each bucket only
+// reports its estimated count, so the search fails if any were added.
+func (t *TermsAggregation) Approximate(epsilon, delta float64) *TermsAggregation {
+	t.approximate = true
+	t.epsilon = epsilon
+	t.delta = delta
+	return t
+}
+
+func (t *TermsAggregation) approximateCalculator() search.Calculator {
+	rv := &ApproximateTermsCalculator{
+		src:        t.src,
+		size:       t.size,
+		minCount:   uint64(t.minCount),
+		byTerm:     t.byTerm,
+		candidates: make(map[string]*termEstimate),
+		capacity:   t.size * approximateCandidatesFactor,
+	}
+	switch {
+	case !(t.epsilon > 0 && t.epsilon < 1):
+		rv.err = fmt.Errorf("approximate terms epsilon must be between 0 and 1, got %v", t.epsilon)
+	case !(t.delta > 0 && t.delta < 1):
+		rv.err = fmt.Errorf("approximate terms delta must be between 0 and 1, got %v", t.delta)
+	case len(t.aggregations) > 1:
+		rv.err = fmt.Errorf("approximate terms aggregation does not compute sub-aggregations")
+	}
+	if rv.err != nil {
+		return rv
+	}
+
+	width := int(math.Ceil(math.E / t.epsilon))
+	rv.width = uint64(width)
+	rv.sketch = make([][]uint64, int(math.Ceil(math.Log(1/t.delta))))
+	for i := range rv.sketch {
+		rv.sketch[i] = make([]uint64, width)
+	}
+	return rv
+}
+
+// ApproximateTermsCalculator estimates the top terms
+// with a count-min sketch, and a heap of candidate terms
+type ApproximateTermsCalculator struct {
+	src      search.TextValuesSource
+	size     int
+	minCount uint64
+	byTerm   bool
+
+	width  uint64
+	sketch [][]uint64
+	total  uint64
+
+	candidates map[string]*termEstimate
+	heap       termEstimateHeap
+	capacity   int
+
+	bucketsList []*search.Bucket
+	other       int
+	err         error
+}
+
+type termEstimate struct {
+	term  string
+	count uint64
+	index int
+}
+
+func (a *ApproximateTermsCalculator) Consume(d *search.DocumentMatch) {
+	if a.err != nil {
+		return
+	}
+	for _, term := range a.src.Values(d) {
+		a.total++
+		a.offer(string(term), a.add(term, 1))
+	}
+}
+
+// add increments the sketch for the term, returning its new estimate
+func (a *ApproximateTermsCalculator) add(term []byte, n uint64) uint64 {
+	h1, h2 := sketchHashes(term)
+	rv := uint64(math.MaxUint64)
+	for i, row := range a.sketch {
+		cell := &row[(h1+uint64(i)*h2)%a.width]
+		*cell += n
+		if *cell < rv {
+			rv = *cell
+		}
+	}
+	return rv
+}
+
+func (a *ApproximateTermsCalculator) estimate(term []byte) uint64 {
+	h1, h2 := sketchHashes(term)
+	rv := uint64(math.MaxUint64)
+	for i, row := range a.sketch {
+		if cell := row[(h1+uint64(i)*h2)%a.width]; cell < rv {
+			rv = cell
+		}
+	}
+	return rv
+}
+
+// offer updates the candidate terms with the estimate for this term,
+// replacing the lowest candidate if there is no room for another
+func (a *ApproximateTermsCalculator) offer(term string, count uint64) {
+	if candidate, ok := a.candidates[term]; ok {
+		candidate.count = count
+		heap.Fix(&a.heap, candidate.index)
+		return
+	}
+	if len(a.heap) >= a.capacity {
+		if a.capacity == 0 || a.heap[0].count >= count {
+			return
+		}
+		lowest := heap.Pop(&a.heap).(*termEstimate)
+		delete(a.candidates, lowest.term)
+	}
+	candidate := &termEstimate{
+		term:  term,
+		count: count,
+	}
+	a.candidates[term] = candidate
+	heap.Push(&a.heap, candidate)
+}
+
+// sketchHashes derives the hash of each sketch row from two
+// independent hashes of the term, h1 + i*h2
+func sketchHashes(term []byte) (h1, h2 uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write(term)
+	h1 = h.Sum64()
+	h = fnv.New64()
+	_, _ = h.Write(term)
+	h2 = h.Sum64() | 1
+	return h1, h2
+}
+
+func (a *ApproximateTermsCalculator) Merge(other search.Calculator) {
+	if other, ok := other.(*ApproximateTermsCalculator); ok {
+		if len(other.sketch) != len(a.sketch) || other.width != a.width {
+			return
+		}
+		a.total += other.total
+		for i := range a.sketch {
+			for j := range a.sketch[i] {
+				a.sketch[i][j] += other.sketch[i][j]
+			}
+		}
+		// re-estimate all candidates against the merged sketch
+		terms := make([]string, 0, len(a.candidates)+len(other.candidates))
+		for term := range a.candidates {
+			terms = append(terms, term)
+		}
+		for term := range other.candidates {
+			if _, ok := a.candidates[term]; !ok {
+				terms = append(terms, term)
+			}
+		}
+		a.candidates = make(map[string]*termEstimate, len(terms))
+		a.heap = a.heap[:0]
+		for _, term := range terms {
+			a.offer(term, a.estimate([]byte(term)))
+		}
+		a.Finish()
+	}
+}
+
+func (a *ApproximateTermsCalculator) Finish() {
+	estimates := make([]*termEstimate, len(a.heap))
+	copy(estimates, a.heap)
+	sort.Slice(estimates, func(i, j int) bool {
+		if estimates[i].count != estimates[j].count {
+			return estimates[i].count > estimates[j].count
+		}
+		return estimates[i].term < estimates[j].term
+	})
+	if a.minCount > 0 {
+		n := sort.Search(len(estimates), func(i int) bool {
+			return estimates[i].count < a.minCount
+		})
+		estimates = estimates[:n]
+	}
+	if len(estimates) > a.size {
+		estimates = estimates[:a.size]
+	}
+	if a.byTerm {
+		sort.Slice(estimates, func(i, j int) bool {
+			return estimates[i].term < estimates[j].term
+		})
+	}
+
+	a.bucketsList = a.bucketsList[:0]
+	var notOther uint64
+	for _, estimate := range estimates {
+		a.bucketsList = append(a.bucketsList, search.NewBucket(estimate.term,
+			map[string]search.Aggregation{
+				"count": estimatedCount(estimate.count),
+			}))
+		notOther += estimate.count
+	}
+	a.other = 0
+	if a.total > notOther {
+		a.other = int(a.total - notOther)
+	}
+}
+
+func (a *ApproximateTermsCalculator) Buckets() []*search.Bucket {
+	return a.bucketsList
+}
+
+// Err reports error parameters which are out of range, or
+// sub-aggregations, which are not computed in this mode
+func (a *ApproximateTermsCalculator) Err() error {
+	return a.err
+}
+
+// Other returns the estimated number of values
+// not counted in any of the returned buckets
+func (a *ApproximateTermsCalculator) Other() int {
+	return a.other
+}
+
+// estimatedCount is an Aggregation reporting a count
+// which was estimated, rather than counted from matches
+type estimatedCount float64
+
+func (e estimatedCount) Fields() []string {
+	return nil
+}
+
+func (e estimatedCount) UsesScore() bool {
+	return false
+}
+
+func (e estimatedCount) Calculator() search.Calculator {
+	rv := CountMatches().Calculator().(*SingleValueCalculator)
+	rv.val = float64(e)
+	return rv
+}
+
+// termEstimateHeap is a min-heap of the candidate terms
+type termEstimateHeap []*termEstimate
+
+func (h termEstimateHeap) Len() int { return len(h) }
+
+func (h termEstimateHeap) Less(i, j int) bool {
+	return h[i].count < h[j].count
+}
+
+func (h termEstimateHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *termEstimateHeap) Push(x interface{}) {
+	estimate := x.(*termEstimate)
+	estimate.index = len(*h)
+	*h = append(*h, estimate)
+}
+
+func (h *termEstimateHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	rv := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return rv
+}
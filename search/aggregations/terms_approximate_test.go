@@ -0,0 +1,149 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregations
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/blugelabs/bluge/search"
+)
+
+// buildSkewedDocs builds documents where the term "term-i"
+// occurs roughly 1/(i+1) as often as "term-0"
+func buildSkewedDocs(terms, topCount int) (docs []*search.DocumentMatch, counts map[string]uint64) {
+	counts = make(map[string]uint64)
+	var number uint64
+	for i := 0; i < terms; i++ {
+		term := fmt.Sprintf("term-%d", i)
+		for j := 0; j < topCount/(i+1); j++ {
+			docs = append(docs, newDocumentMatch(number, 1, map[string][]byte{
+				"tag": []byte(term),
+			}))
+			counts[term]++
+			number++
+		}
+	}
+	// interleave the terms, so the top terms are not all seen first
+	for i := range docs {
+		j := (i * 7919) % len(docs)
+		docs[i], docs[j] = docs[j], docs[i]
+	}
+	return docs, counts
+}
+
+func TestApproximateTermsAggregation(t *testing.T) {
+	const epsilon = 0.01
+	docs, counts := buildSkewedDocs(500, 2000)
+	maxError := uint64(epsilon * float64(len(docs)))
+
+	aggs := search.Aggregations{
+		"tags": NewTermsAggregation(search.Field("tag"), 5).Approximate(epsilon, 0.01),
+	}
+	assertApproximateTopTerms := func(bucket *search.Bucket) {
+		buckets := bucket.Buckets("tags")
+		if len(buckets) != 5 {
+			t.Fatalf("expected 5 buckets, got %d", len(buckets))
+		}
+		for i, b := range buckets {
+			expectedName := fmt.Sprintf("term-%d", i)
+			if b.Name() != expectedName {
+				t.Errorf("expected bucket %d to be %s, got %s", i, expectedName, b.Name())
+			}
+			actual := counts[b.Name()]
+			if b.Count() < actual || b.Count() > actual+maxError {
+				t.Errorf("expected count for %s within [%d, %d], got %d",
+					b.Name(), actual, actual+maxError, b.Count())
+			}
+		}
+		other := bucket.Aggregation("tags").(*ApproximateTermsCalculator).Other()
+		if other <= 0 || other >= len(docs) {
+			t.Errorf("expected other between 0 and %d, got %d", len(docs), other)
+		}
+	}
+
+	bucket := search.NewBucket("", aggs)
+	for _, doc := range docs {
+		err := doc.LoadDocumentValues(search.NewSearchContext(0, 0), aggs.Fields())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bucket.Consume(doc)
+	}
+	bucket.Finish()
+	assertApproximateTopTerms(bucket)
+
+	// the same estimates should be found when merging shards
+	shard1 := search.NewBucket("", aggs)
+	shard2 := search.NewBucket("", aggs)
+	for i, doc := range docs {
+		if i%2 == 0 {
+			shard1.Consume(doc)
+		} else {
+			shard2.Consume(doc)
+		}
+	}
+	shard1.Finish()
+	shard2.Finish()
+	shard1.Merge(shard2)
+	assertApproximateTopTerms(shard1)
+}
+
+func TestApproximateTermsAggregationInvalid(t *testing.T) {
+	withSubAggregation := NewTermsAggregation(search.Field("tag"), 5).Approximate(0.01, 0.01)
+	withSubAggregation.AddAggregation("max", Max(search.Field("rank")))
+
+	tests := []struct {
+		name string
+		agg  *TermsAggregation
+	}{
+		{
+			name: "zero epsilon",
+			agg:  NewTermsAggregation(search.Field("tag"), 5).Approximate(0, 0.01),
+		},
+		{
+			name: "epsilon of one",
+			agg:  NewTermsAggregation(search.Field("tag"), 5).Approximate(1, 0.01),
+		},
+		{
+			name: "negative delta",
+			agg:  NewTermsAggregation(search.Field("tag"), 5).Approximate(0.01, -0.5),
+		},
+		{
+			name: "delta of one",
+			agg:  NewTermsAggregation(search.Field("tag"), 5).Approximate(0.01, 1),
+		},
+		{
+			name: "sub-aggregation",
+			agg:  withSubAggregation,
+		},
+	}
+
+	docs, _ := buildSkewedDocs(10, 20)
+	for _, test := range tests {
+		aggs := search.Aggregations{"tags": test.agg}
+		bucket := search.NewBucket("", aggs)
+		for _, doc := range docs {
+			err := doc.LoadDocumentValues(search.NewSearchContext(0, 0), aggs.Fields())
+			if err != nil {
+				t.Fatal(err)
+			}
+			bucket.Consume(doc)
+		}
+		if bucket.Err() == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
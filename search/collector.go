@@ -25,6 +25,15 @@ type Collector interface {
 	BackingSize() int
 }
 
+// CallbackCollector is a Collector which can pass each match to a
+// function as it is collected, instead of returning an iterator, an
+// error from the function stops the collection and is returned
+type CallbackCollector interface {
+	Collector
+	CollectFunc(ctx context.Context, aggs Aggregations, searcher Collectible,
+		fn func(*DocumentMatch) error) (*Bucket, error)
+}
+
 type Collectible interface {
 	Next(ctx *Context) (*DocumentMatch, error)
 	DocumentMatchPoolSize() int
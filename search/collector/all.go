@@ -21,23 +21,58 @@ import (
 )
 
 type AllCollector struct {
+	maxDocsScanned int
 }
 
 func NewAllCollector() *AllCollector {
 	return &AllCollector{}
 }
 
+// WithMaxDocsScanned limits the number of matching documents examined,
+// the iterator returns ErrScanLimitExceeded instead of examining more.
+// The default, 0, does not limit the number of documents examined.
+func (a *AllCollector) WithMaxDocsScanned(n int) *AllCollector {
+	a.maxDocsScanned = n
+	return a
+}
+
 func (a *AllCollector) Collect(ctx context.Context, aggs search.Aggregations,
 	searcher search.Collectible) (search.DocumentMatchIterator, error) {
+	return a.iterator(ctx, aggs, searcher), nil
+}
+
+// CollectFunc passes each match to fn as it is collected, the
+// searcher is closed as soon as fn returns an error
+func (a *AllCollector) CollectFunc(ctx context.Context, aggs search.Aggregations,
+	searcher search.Collectible, fn func(*search.DocumentMatch) error) (*search.Bucket, error) {
+	iter := a.iterator(ctx, aggs, searcher)
+	next, err := iter.Next()
+	for err == nil && next != nil {
+		err = fn(next)
+		if err != nil {
+			iter.doneCleanup()
+			return nil, err
+		}
+		next, err = iter.Next()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return iter.Aggregations(), nil
+}
+
+func (a *AllCollector) iterator(ctx context.Context, aggs search.Aggregations,
+	searcher search.Collectible) *AllIterator {
 	iter := &AllIterator{
-		ctx:           ctx,
-		neededFields:  aggs.Fields(),
-		bucket:        search.NewBucket("", aggs),
-		searcher:      searcher,
-		searchContext: search.NewSearchContext(searcher.DocumentMatchPoolSize(), 0),
+		ctx:            ctx,
+		neededFields:   aggs.Fields(),
+		bucket:         search.NewBucket("", aggs),
+		searcher:       searcher,
+		searchContext:  search.NewSearchContext(searcher.DocumentMatchPoolSize(), 0),
+		maxDocsScanned: a.maxDocsScanned,
 	}
 	if len(iter.neededFields) <= 1 {
-		return iter, nil
+		return iter
 	}
 
 	// filter repeat field
@@ -49,7 +84,7 @@ func (a *AllCollector) Collect(ctx context.Context, aggs search.Aggregations,
 	for field := range store {
 		iter.neededFields = append(iter.neededFields, field)
 	}
-	return iter, nil
+	return iter
 }
 
 func (a *AllCollector) Size() int {
@@ -68,6 +103,8 @@ type AllIterator struct {
 	searcher      search.Collectible
 	searchContext *search.Context
 	done          bool
+
+	maxDocsScanned int
 }
 
 func (a *AllIterator) doneCleanup() {
@@ -95,10 +132,18 @@ func (a *AllIterator) Next() (next *search.DocumentMatch, err error) {
 	}
 
 	if next == nil {
-		a.bucket.Finish()
 		a.doneCleanup()
+		err = a.bucket.Err()
+		if err != nil {
+			return nil, err
+		}
+		a.bucket.Finish()
 		return nil, nil
 	}
+	if a.maxDocsScanned > 0 && a.hitNumber >= a.maxDocsScanned {
+		a.doneCleanup()
+		return nil, ErrScanLimitExceeded
+	}
 
 	a.hitNumber++
 	next.HitNumber = a.hitNumber
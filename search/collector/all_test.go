@@ -16,6 +16,7 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/blugelabs/bluge/search"
@@ -58,3 +59,49 @@ func TestAllCollector(t *testing.T) {
 		t.Errorf("expected to see 99 hits, saw: %d", count)
 	}
 }
+
+func TestAllCollectorMaxDocsScanned(t *testing.T) {
+	searcher := &stubSearcher{
+		matches: makeMatches(10000, 11),
+	}
+
+	collector := NewAllCollector().WithMaxDocsScanned(5)
+	dmi, err := collector.Collect(context.Background(), search.Aggregations{}, searcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		count++
+		next, err = dmi.Next()
+	}
+	if !errors.Is(err, ErrScanLimitExceeded) {
+		t.Fatalf("expected ErrScanLimitExceeded, got %v", err)
+	}
+	if count != 5 {
+		t.Errorf("expected to see 5 hits before the limit, saw: %d", count)
+	}
+
+	// a limit equal to the number of matches is not exceeded
+	searcher = &stubSearcher{
+		matches: makeMatches(5, 11),
+	}
+	dmi, err = collector.Collect(context.Background(), search.Aggregations{}, searcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count = 0
+	next, err = dmi.Next()
+	for err == nil && next != nil {
+		count++
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatalf("error iterating matches: %v", err)
+	}
+	if count != 5 {
+		t.Errorf("expected to see 5 hits, saw: %d", count)
+	}
+}
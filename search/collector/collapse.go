@@ -0,0 +1,397 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+
+	"github.com/blugelabs/bluge/search"
+)
+
+// CollapsingCollector collects the top N groups of hits,
+// where hits are grouped by the value of the collapse field.
+// Only the best hit of each group (according to the sort order)
+// is returned, optionally followed by up to K inner hits, the next
+// best members of the same group, available as InnerHits on the
+// returned DocumentMatch.
+// Hits which do not have a value for the collapse field are all
+// placed in the same group.  The number of hits in each group is
+// available as CollapsedCount on the returned DocumentMatch.
+//
+// Only the best size+skip groups seen so far are kept, a group
+// which falls out of these is forgotten, releasing its hits.  Should
+// the group later return to the best groups, its count and inner
+// hits only include the hits seen since.
+type CollapsingCollector struct {
+	size      int
+	skip      int
+	sort      search.SortOrder
+	field     search.FieldSource
+	innerHits int
+
+	maxDocsScanned int
+
+	postFilter                search.PostFilter
+	aggregateBeforePostFilter bool
+
+	// fields needed by the sort and the collapse field
+	neededFields []string
+
+	groups  map[string]*collapseGroup
+	missing *collapseGroup
+	top     collapseGroupHeap
+	dropped bool
+}
+
+// NewCollapsingCollector builds a collector to find the top 'size' groups
+// of hits sharing the same value for 'field', skipping over the first
+// 'skip' groups, ordering the groups by their best hit in the provided
+// sort order
+func NewCollapsingCollector(size, skip int, sort search.SortOrder, field string) *CollapsingCollector {
+	rv := &CollapsingCollector{
+		size:   size,
+		skip:   skip,
+		sort:   sort,
+		field:  search.Field(field),
+		groups: make(map[string]*collapseGroup),
+		top: collapseGroupHeap{
+			compare: sort.Compare,
+		},
+	}
+	rv.neededFields = uniqueFields(sort.Fields(), rv.field.Fields())
+	return rv
+}
+
+// uniqueFields returns the fields of the sets, without repeats
+func uniqueFields(fieldSets ...[]string) []string {
+	var rv []string
+	store := make(map[string]struct{})
+	for _, fields := range fieldSets {
+		for _, field := range fields {
+			if _, ok := store[field]; !ok {
+				store[field] = struct{}{}
+				rv = append(rv, field)
+			}
+		}
+	}
+	return rv
+}
+
+// SetInnerHits sets the number of additional hits
+// returned for each group, defaults to 0
+func (c *CollapsingCollector) SetInnerHits(innerHits int) *CollapsingCollector {
+	c.innerHits = innerHits
+	return c
+}
+
+// WithMaxDocsScanned limits the number of matching documents examined,
+// Collect returns ErrScanLimitExceeded instead of examining more,
+// defaults to 0, which does not limit them
+func (c *CollapsingCollector) WithMaxDocsScanned(n int) *CollapsingCollector {
+	c.maxDocsScanned = n
+	return c
+}
+
+// SetPostFilter only groups the hits accepted by the filter,
+// the aggregations are also only calculated over the accepted hits,
+// unless SetAggregationsBeforePostFilter is used
+func (c *CollapsingCollector) SetPostFilter(filter search.PostFilter) *CollapsingCollector {
+	c.postFilter = filter
+	return c
+}
+
+// SetAggregationsBeforePostFilter calculates the aggregations over
+// every document matching the query, including those rejected
+// by the post filter
+func (c *CollapsingCollector) SetAggregationsBeforePostFilter() *CollapsingCollector {
+	c.aggregateBeforePostFilter = true
+	return c
+}
+
+func (c *CollapsingCollector) Size() int {
+	sizeInBytes := reflectStaticSizeCollapsingCollector + sizeOfPtr
+
+	for _, entry := range c.neededFields {
+		sizeInBytes += len(entry) + sizeOfString
+	}
+
+	return sizeInBytes
+}
+
+func (c *CollapsingCollector) BackingSize() int {
+	backingSize := (c.size+c.skip)*(c.innerHits+1) + 1
+	if backingSize > PreAllocSizeSkipCap {
+		backingSize = PreAllocSizeSkipCap + 1
+	}
+	return backingSize
+}
+
+func (c *CollapsingCollector) Collect(ctx context.Context, aggs search.Aggregations,
+	searcher search.Collectible) (search.DocumentMatchIterator, error) {
+	var err error
+	var next *search.DocumentMatch
+
+	// ensure that we always close the searcher
+	defer func() {
+		_ = searcher.Close()
+	}()
+
+	searchContext := search.NewSearchContext(c.BackingSize()+searcher.DocumentMatchPoolSize(), len(c.sort))
+
+	// add the fields needed by the post filter and aggregations
+	fieldSets := [][]string{c.neededFields, aggs.Fields()}
+	if c.postFilter != nil {
+		fieldSets = append(fieldSets, c.postFilter.Fields())
+	}
+	neededFields := uniqueFields(fieldSets...)
+
+	bucket := search.NewBucket("", aggs)
+
+	var hitNumber int
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		next, err = searcher.Next(searchContext)
+	}
+	for err == nil && next != nil {
+		if hitNumber%CheckDoneEvery == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+		}
+		if c.maxDocsScanned > 0 && hitNumber >= c.maxDocsScanned {
+			return nil, ErrScanLimitExceeded
+		}
+
+		hitNumber++
+		next.HitNumber = hitNumber
+
+		err = c.collectSingle(searchContext, next, neededFields, bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		next, err = searcher.Next(searchContext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = bucket.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	bucket.Finish()
+
+	return &TopNIterator{
+		results:   c.finalizeResults(),
+		bucket:    bucket,
+		index:     0,
+		err:       nil,
+		truncated: c.truncated(),
+	}, nil
+}
+
+// truncated reports whether there were more groups than size+skip,
+// that is whether any group was dropped from, or never made, the best
+func (c *CollapsingCollector) truncated() bool {
+	return c.dropped
+}
+
+func (c *CollapsingCollector) collectSingle(ctx *search.Context, d *search.DocumentMatch,
+	neededFields []string, bucket *search.Bucket) error {
+	err := d.LoadDocumentValues(ctx, neededFields)
+	if err != nil {
+		return err
+	}
+
+	if c.postFilter != nil && !c.postFilter.Accept(d) {
+		if c.aggregateBeforePostFilter {
+			bucket.Consume(d)
+		}
+		ctx.DocumentMatchPool.Put(d)
+		return nil
+	}
+
+	// compute this hits sort value
+	c.sort.Compute(d)
+
+	// calculate aggregations
+	bucket.Consume(d)
+
+	key := c.field.Value(d)
+	group := c.groupFor(key)
+	if group == nil {
+		if !c.makeRoom(ctx, d) {
+			ctx.DocumentMatchPool.Put(d)
+			return nil
+		}
+		group = c.addGroup(key)
+	}
+	group.count++
+
+	removed := group.add(d, c.sort.Compare, c.innerHits+1)
+	ctx.DocumentMatchPool.Put(removed)
+	if group.index < 0 {
+		heap.Push(&c.top, group)
+	} else {
+		heap.Fix(&c.top, group.index)
+	}
+	return nil
+}
+
+// makeRoom reports whether a group not among the best groups can
+// be added to them with the hit, forgetting the worst of the best
+// groups if there are already size+skip of them
+func (c *CollapsingCollector) makeRoom(ctx *search.Context, d *search.DocumentMatch) bool {
+	if len(c.top.groups) < c.size+c.skip {
+		return true
+	}
+	c.dropped = true
+	if len(c.top.groups) == 0 || c.sort.Compare(d, c.top.groups[0].hits[0]) >= 0 {
+		return false
+	}
+	worst := heap.Pop(&c.top).(*collapseGroup)
+	for _, hit := range worst.hits {
+		ctx.DocumentMatchPool.Put(hit)
+	}
+	if worst.missing {
+		c.missing = nil
+	} else {
+		delete(c.groups, worst.key)
+	}
+	return true
+}
+
+// groupFor returns the best group with the key, nil if there is none
+func (c *CollapsingCollector) groupFor(key []byte) *collapseGroup {
+	if key == nil {
+		return c.missing
+	}
+	return c.groups[string(key)]
+}
+
+func (c *CollapsingCollector) addGroup(key []byte) *collapseGroup {
+	if key == nil {
+		c.missing = &collapseGroup{index: -1, missing: true}
+		return c.missing
+	}
+	group := &collapseGroup{index: -1, key: string(key)}
+	c.groups[group.key] = group
+	return group
+}
+
+// finalizeResults orders the groups by their best hit,
+// throws away the groups to be skipped and attaches
+// the inner hits to each remaining group's best hit
+func (c *CollapsingCollector) finalizeResults() search.DocumentMatchCollection {
+	groups := append([]*collapseGroup(nil), c.top.groups...)
+	sort.Slice(groups, func(i, j int) bool {
+		return c.sort.Compare(groups[i].hits[0], groups[j].hits[0]) < 0
+	})
+
+	if c.skip >= len(groups) {
+		return search.DocumentMatchCollection{}
+	}
+	groups = groups[c.skip:]
+	if len(groups) > c.size {
+		groups = groups[:c.size]
+	}
+
+	rv := make(search.DocumentMatchCollection, len(groups))
+	for i, group := range groups {
+		for _, hit := range group.hits {
+			hit.Complete(nil)
+		}
+		rv[i] = group.hits[0]
+		rv[i].CollapsedCount = group.count
+		if len(group.hits) > 1 {
+			rv[i].InnerHits = group.hits[1:]
+		}
+	}
+	return rv
+}
+
+type collapseGroup struct {
+	// value of the collapse field, unless missing
+	key     string
+	missing bool
+	// best hit first
+	hits search.DocumentMatchCollection
+	// number of hits seen in the group
+	count int
+	// position in the heap of the best groups, -1 until pushed
+	index int
+}
+
+// add inserts the hit in sort order, if the group now exceeds
+// the provided size, the worst hit is removed and returned
+func (g *collapseGroup) add(d *search.DocumentMatch, compare collectorCompare, size int) *search.DocumentMatch {
+	i := len(g.hits)
+	for ; i > 0; i-- {
+		if compare(d, g.hits[i-1]) >= 0 {
+			break
+		}
+	}
+	g.hits = append(g.hits, nil)
+	copy(g.hits[i+1:], g.hits[i:])
+	g.hits[i] = d
+	if len(g.hits) > size {
+		var removed *search.DocumentMatch
+		removed, g.hits = g.hits[len(g.hits)-1], g.hits[:len(g.hits)-1]
+		return removed
+	}
+	return nil
+}
+
+// collapseGroupHeap holds the best groups, the worst of them first
+type collapseGroupHeap struct {
+	groups  []*collapseGroup
+	compare collectorCompare
+}
+
+func (h *collapseGroupHeap) Len() int {
+	return len(h.groups)
+}
+
+func (h *collapseGroupHeap) Less(i, j int) bool {
+	return h.compare(h.groups[i].hits[0], h.groups[j].hits[0]) > 0
+}
+
+func (h *collapseGroupHeap) Swap(i, j int) {
+	h.groups[i], h.groups[j] = h.groups[j], h.groups[i]
+	h.groups[i].index = i
+	h.groups[j].index = j
+}
+
+func (h *collapseGroupHeap) Push(x interface{}) {
+	group := x.(*collapseGroup)
+	group.index = len(h.groups)
+	h.groups = append(h.groups, group)
+}
+
+func (h *collapseGroupHeap) Pop() interface{} {
+	n := len(h.groups)
+	group := h.groups[n-1]
+	h.groups[n-1] = nil
+	h.groups = h.groups[:n-1]
+	group.index = -1
+	return group
+}
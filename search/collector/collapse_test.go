@@ -0,0 +1,189 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/blugelabs/bluge/search"
+	"github.com/blugelabs/bluge/search/aggregations"
+)
+
+func collapseTestSearcher(groups map[uint64]string, scores map[uint64]float64) *stubSearcher {
+	reader := &stubReader{docValues: map[uint64]map[string][][]byte{}}
+	var matches []*search.DocumentMatch
+	for i := uint64(1); i <= uint64(len(scores)); i++ {
+		if group, ok := groups[i]; ok {
+			reader.docValues[i] = map[string][][]byte{
+				"group": {[]byte(group)},
+			}
+		}
+		matches = append(matches, &search.DocumentMatch{
+			Number: i,
+			Score:  scores[i],
+		})
+	}
+	return &stubSearcher{
+		matches: matches,
+		reader:  reader,
+	}
+}
+
+func TestCollapsingCollectorInnerHits(t *testing.T) {
+	searcher := collapseTestSearcher(
+		map[uint64]string{1: "a", 2: "b", 3: "a", 4: "a", 5: "c", 6: "b", 7: "a"},
+		map[uint64]float64{1: 5, 2: 9, 3: 7, 4: 1, 5: 3, 6: 8, 7: 6, 8: 2})
+
+	aggs := make(search.Aggregations)
+	aggs.Add("count", aggregations.CountMatches())
+
+	collector := NewCollapsingCollector(10, 0,
+		search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}, "group").
+		SetInnerHits(2)
+	dmi, err := collector.Collect(context.Background(), aggs, searcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(collector.neededFields, []string{"group"}) {
+		t.Errorf("expected the collector's fields left as constructed, got %v", collector.neededFields)
+	}
+
+	got := map[uint64][]uint64{}
+	var order []uint64
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		order = append(order, next.Number)
+		got[next.Number] = []uint64{}
+		for _, inner := range next.InnerHits {
+			got[next.Number] = append(got[next.Number], inner.Number)
+		}
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// groups ordered by best hit: b(2), a(3), c(5), missing(8)
+	expectedOrder := []uint64{2, 3, 5, 8}
+	if !reflect.DeepEqual(order, expectedOrder) {
+		t.Errorf("expected group order %v, got %v", expectedOrder, order)
+	}
+	expectedInner := map[uint64][]uint64{
+		2: {6},
+		3: {7, 1},
+		5: {},
+		8: {},
+	}
+	if !reflect.DeepEqual(got, expectedInner) {
+		t.Errorf("expected inner hits %v, got %v", expectedInner, got)
+	}
+
+	if dmi.Aggregations().Count() != 8 {
+		t.Errorf("expected count 8, got %d", dmi.Aggregations().Count())
+	}
+}
+
+func TestCollapsingCollectorSizeSkip(t *testing.T) {
+	searcher := collapseTestSearcher(
+		map[uint64]string{1: "a", 2: "b", 3: "c", 4: "a", 5: "b", 6: "c"},
+		map[uint64]float64{1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 6: 6})
+
+	collector := NewCollapsingCollector(1, 1,
+		search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}, "group")
+	dmi, err := collector.Collect(context.Background(), search.Aggregations{}, searcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := dmi.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == nil || next.Number != 5 {
+		t.Fatalf("expected second best group represented by 5, got %v", next)
+	}
+	if len(next.InnerHits) != 0 {
+		t.Errorf("expected no inner hits, got %d", len(next.InnerHits))
+	}
+	next, err = dmi.Next()
+	if err != nil || next != nil {
+		t.Errorf("expected only one group, got %v, %v", next, err)
+	}
+}
+
+func TestCollapsingCollectorCollapsedCount(t *testing.T) {
+	// group c has the best hit but arrives last, evicting group a
+	searcher := collapseTestSearcher(
+		map[uint64]string{1: "a", 2: "b", 3: "a", 4: "b", 5: "a", 6: "b", 7: "c", 8: "a"},
+		map[uint64]float64{1: 2, 2: 5, 3: 1, 4: 4, 5: 3, 6: 6, 7: 9, 8: 1})
+
+	collector := NewCollapsingCollector(2, 0,
+		search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}, "group")
+	dmi, err := collector.Collect(context.Background(), search.Aggregations{}, searcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collector.top.groups) > 2 {
+		t.Errorf("expected hits held for at most 2 groups, got %d", len(collector.top.groups))
+	}
+	if len(collector.groups) > 2 {
+		t.Errorf("expected at most 2 groups kept, got %d", len(collector.groups))
+	}
+
+	type group struct {
+		best  uint64
+		count int
+	}
+	var got []group
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		got = append(got, group{best: next.Number, count: next.CollapsedCount})
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []group{{best: 7, count: 1}, {best: 6, count: 3}}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected groups %v, got %v", expect, got)
+	}
+}
+
+func TestCollapsingCollectorCountAfterEviction(t *testing.T) {
+	// group a is evicted by b, then returns with a better hit,
+	// its count only includes the hits seen since it returned
+	searcher := collapseTestSearcher(
+		map[uint64]string{1: "a", 2: "b", 3: "a"},
+		map[uint64]float64{1: 1, 2: 2, 3: 3})
+
+	collector := NewCollapsingCollector(1, 0,
+		search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}, "group")
+	dmi, err := collector.Collect(context.Background(), search.Aggregations{}, searcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := dmi.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == nil || next.Number != 3 || next.CollapsedCount != 1 {
+		t.Errorf("expected group a represented by 3 with 1 hit, got %v", next)
+	}
+	if len(collector.groups) != 1 {
+		t.Errorf("expected evicted groups forgotten, got %d groups", len(collector.groups))
+	}
+}
@@ -0,0 +1,192 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/blugelabs/bluge/search"
+)
+
+// ErrDedupeLimitExceeded is returned when a DedupeCollector sees
+// more distinct values of the dedupe field than it has been allowed
+var ErrDedupeLimitExceeded = errors.New("too many distinct values to deduplicate")
+
+// DedupeCollector removes duplicate hits before passing them to another
+// collector, such as the same document found in several overlapping
+// indexes by MultiSearch.  Hits are duplicates when they have the same
+// value for the dedupe field, of each set of duplicates only the hit
+// with the highest score is kept, ties going to the hit seen first.
+// Hits without a value for the dedupe field are always kept, each
+// counting as a distinct value.
+//
+// Every hit kept is held in memory until all the matches have been
+// seen, so the number of distinct values should be bounded with
+// maxValues, unless the number of matches is known to be small.
+type DedupeCollector struct {
+	collector search.Collector
+	field     string
+	maxValues int
+}
+
+// NewDedupeCollector wraps the collector, only passing it the best hit
+// for each value of field.  Collect returns ErrDedupeLimitExceeded if
+// more than maxValues distinct values are seen, when maxValues is 0
+// the number of values, and so the memory used, is not limited.
+func NewDedupeCollector(collector search.Collector, field string, maxValues int) *DedupeCollector {
+	return &DedupeCollector{
+		collector: collector,
+		field:     field,
+		maxValues: maxValues,
+	}
+}
+
+func (d *DedupeCollector) Size() int {
+	return d.collector.Size() + len(d.field) + sizeOfString
+}
+
+func (d *DedupeCollector) BackingSize() int {
+	return d.collector.BackingSize()
+}
+
+func (d *DedupeCollector) Collect(ctx context.Context, aggs search.Aggregations,
+	searcher search.Collectible) (search.DocumentMatchIterator, error) {
+	hits, err := d.dedupe(ctx, searcher)
+	if err != nil {
+		return nil, err
+	}
+	return d.collector.Collect(ctx, aggs, &sliceCollectible{hits: hits})
+}
+
+// dedupe reads all the matches from the searcher, returning the
+// best hit for each value of the field, in the order they were seen
+func (d *DedupeCollector) dedupe(ctx context.Context, searcher search.Collectible) (search.DocumentMatchCollection, error) {
+	var err error
+	var next *search.DocumentMatch
+
+	// ensure that we always close the searcher
+	defer func() {
+		_ = searcher.Close()
+	}()
+
+	searchContext := search.NewSearchContext(searcher.DocumentMatchPoolSize(), 0)
+	best := make(map[string]*search.DocumentMatch)
+	var hits search.DocumentMatchCollection
+
+	var hitNumber int
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		next, err = searcher.Next(searchContext)
+	}
+	for err == nil && next != nil {
+		if hitNumber%CheckDoneEvery == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+		}
+
+		hitNumber++
+		next.HitNumber = hitNumber
+
+		var key []byte
+		key, err = d.value(searchContext, next)
+		if err != nil {
+			return nil, err
+		}
+		existing, ok := best[string(key)]
+		if key == nil || !ok {
+			// hits without a value are kept too, so count towards the limit
+			if d.maxValues > 0 && len(best)+len(hits) >= d.maxValues {
+				return nil, ErrDedupeLimitExceeded
+			}
+		}
+		if key == nil {
+			hits = append(hits, next)
+		} else if !ok {
+			best[string(key)] = next
+		} else if next.Score > existing.Score {
+			best[string(key)] = next
+			searchContext.DocumentMatchPool.Put(existing)
+		} else {
+			searchContext.DocumentMatchPool.Put(next)
+		}
+
+		next, err = searcher.Next(searchContext)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hit := range best {
+		hits = append(hits, hit)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].HitNumber < hits[j].HitNumber
+	})
+	return hits, nil
+}
+
+// value returns the first value of the dedupe field for the hit,
+// read without adding it to the hit's document values, which are
+// loaded again by the wrapped collector
+func (d *DedupeCollector) value(ctx *search.Context, hit *search.DocumentMatch) ([]byte, error) {
+	dvReader, err := ctx.DocValueReaderForReader(hit.Reader(), []string{d.field})
+	if err != nil {
+		return nil, err
+	}
+	var values [][]byte
+	err = dvReader.VisitDocumentValues(hit.Number, func(field string, term []byte) {
+		if field == d.field {
+			values = append(values, append([]byte(nil), term...))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	values = search.RemoveNumericPaddedTerms(values)
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values[0], nil
+}
+
+// sliceCollectible replays hits which have already been collected
+type sliceCollectible struct {
+	hits  search.DocumentMatchCollection
+	index int
+}
+
+func (s *sliceCollectible) Next(*search.Context) (*search.DocumentMatch, error) {
+	if s.index < len(s.hits) {
+		rv := s.hits[s.index]
+		s.index++
+		return rv, nil
+	}
+	return nil, nil
+}
+
+func (s *sliceCollectible) DocumentMatchPoolSize() int {
+	return 0
+}
+
+func (s *sliceCollectible) Close() error {
+	return nil
+}
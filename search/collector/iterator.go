@@ -18,11 +18,15 @@ import (
 	"github.com/blugelabs/bluge/search"
 )
 
+// TopNIterator returns the hits found by a TopNCollector
+// in order, along with the aggregations over all the matches
 type TopNIterator struct {
 	results search.DocumentMatchCollection
 	bucket  *search.Bucket
 	index   int
 	err     error
+
+	truncated bool
 }
 
 func (i *TopNIterator) Next() (*search.DocumentMatch, error) {
@@ -37,6 +41,28 @@ func (i *TopNIterator) Next() (*search.DocumentMatch, error) {
 	return nil, nil
 }
 
+// Reverse reverses the order of the results not yet returned by Next,
+// so that they may be presented in the opposite of the sort order
+// without searching again.  The aggregations are unaffected.
+func (i *TopNIterator) Reverse() *TopNIterator {
+	remaining := i.results[i.index:]
+	for x, y := 0, len(remaining)-1; x < y; x, y = x+1, y-1 {
+		remaining[x], remaining[y] = remaining[y], remaining[x]
+	}
+	return i
+}
+
+// Truncated reports whether there were more matches sorting after the
+// results, which were left out, rather than the number of results
+// being limited by the number of matches
+func (i *TopNIterator) Truncated() bool {
+	return i.truncated
+}
+
+// Aggregations returns the bucket of aggregations calculated over all
+// the matches, not only the hits returned, it has been finished before
+// the iterator is returned, so the results of each aggregation may be
+// read by name, such as with Metric or Buckets
 func (i *TopNIterator) Aggregations() *search.Bucket {
 	return i.bucket
 }
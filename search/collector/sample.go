@@ -0,0 +1,129 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+
+	"github.com/blugelabs/bluge/search"
+)
+
+// SampleCollector chooses up to k of the matches uniformly at random,
+// using reservoir sampling, so only k matches are held at a time.
+// The same seed chooses the same sample of the same matches.
+type SampleCollector struct {
+	k    int
+	seed int64
+}
+
+// NewSampleCollector returns a collector choosing up to k matches,
+// a negative k chooses none, like 0
+func NewSampleCollector(k int, seed int64) *SampleCollector {
+	if k < 0 {
+		k = 0
+	}
+	return &SampleCollector{
+		k:    k,
+		seed: seed,
+	}
+}
+
+func (s *SampleCollector) Size() int {
+	return reflectStaticSizeSampleCollector + sizeOfPtr
+}
+
+func (s *SampleCollector) BackingSize() int {
+	return s.k
+}
+
+// Collect returns the sample in index order, the
+// aggregations are calculated over every match
+func (s *SampleCollector) Collect(ctx context.Context, aggs search.Aggregations,
+	searcher search.Collectible) (search.DocumentMatchIterator, error) {
+	// ensure that we always close the searcher
+	defer func() {
+		_ = searcher.Close()
+	}()
+
+	searchContext := search.NewSearchContext(s.k+searcher.DocumentMatchPoolSize(), 0)
+	neededFields := aggs.Fields()
+	bucket := search.NewBucket("", aggs)
+	rng := rand.New(rand.NewSource(s.seed))
+	sample := make(search.DocumentMatchCollection, 0, s.k)
+
+	var hitNumber int
+	var next *search.DocumentMatch
+	var err error
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+		next, err = searcher.Next(searchContext)
+	}
+	for err == nil && next != nil {
+		if hitNumber%CheckDoneEvery == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+		}
+		hitNumber++
+		next.HitNumber = hitNumber
+
+		if len(neededFields) > 0 {
+			err = next.LoadDocumentValues(searchContext, neededFields)
+			if err != nil {
+				return nil, err
+			}
+		}
+		bucket.Consume(next)
+
+		// the nth match replaces one of those held with probability k/n
+		if len(sample) < s.k {
+			sample = append(sample, next)
+		} else if i := rng.Intn(hitNumber); i < s.k {
+			searchContext.DocumentMatchPool.Put(sample[i])
+			sample[i] = next
+		} else {
+			searchContext.DocumentMatchPool.Put(next)
+		}
+
+		next, err = searcher.Next(searchContext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = bucket.Err()
+	if err != nil {
+		return nil, err
+	}
+	bucket.Finish()
+
+	sort.Slice(sample, func(i, j int) bool {
+		return sample[i].HitNumber < sample[j].HitNumber
+	})
+	for _, d := range sample {
+		d.Complete(nil)
+	}
+
+	return &TopNIterator{
+		results:   sample,
+		bucket:    bucket,
+		truncated: hitNumber > len(sample),
+	}, nil
+}
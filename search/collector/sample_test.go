@@ -0,0 +1,115 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/blugelabs/bluge/search"
+	"github.com/blugelabs/bluge/search/aggregations"
+)
+
+func collectSample(t *testing.T, k int, seed int64, population int) ([]uint64, *search.Bucket) {
+	searcher := &stubSearcher{
+		matches: makeMatches(population, 1),
+	}
+	aggs := make(search.Aggregations)
+	aggs.Add("count", aggregations.CountMatches())
+
+	dmi, err := NewSampleCollector(k, seed).Collect(context.Background(), aggs, searcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rv []uint64
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		rv = append(rv, next.Number)
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rv, dmi.Aggregations()
+}
+
+func TestSampleCollector(t *testing.T) {
+	sample, bucket := collectSample(t, 10, 42, 100)
+	if len(sample) != 10 {
+		t.Fatalf("expected a sample of 10, got %d", len(sample))
+	}
+	for i := 1; i < len(sample); i++ {
+		if sample[i] <= sample[i-1] {
+			t.Errorf("expected sample in index order without repeats, got %v", sample)
+		}
+	}
+	if bucket.Count() != 100 {
+		t.Errorf("expected aggregations over all 100 matches, got %d", bucket.Count())
+	}
+
+	again, _ := collectSample(t, 10, 42, 100)
+	if !reflect.DeepEqual(sample, again) {
+		t.Errorf("expected the same seed to choose the same sample, got %v and %v", sample, again)
+	}
+
+	// fewer matches than the sample size returns them all
+	small, _ := collectSample(t, 10, 42, 4)
+	if !reflect.DeepEqual(small, []uint64{1, 2, 3, 4}) {
+		t.Errorf("expected every match, got %v", small)
+	}
+
+	// a negative sample size chooses none
+	none, bucket := collectSample(t, -1, 42, 4)
+	if len(none) != 0 {
+		t.Errorf("expected no matches, got %v", none)
+	}
+	if bucket.Count() != 4 {
+		t.Errorf("expected aggregations over all 4 matches, got %d", bucket.Count())
+	}
+}
+
+func TestSampleCollectorUniform(t *testing.T) {
+	const population = 20
+	const k = 5
+	const runs = 4000
+	counts := make([]int, population+1)
+	for seed := int64(0); seed < runs; seed++ {
+		sample, _ := collectSample(t, k, seed, population)
+		for _, number := range sample {
+			counts[number]++
+		}
+	}
+	// each match is expected in a quarter of the samples
+	expected := runs * k / population
+	for number := 1; number <= population; number++ {
+		if counts[number] < expected*8/10 || counts[number] > expected*12/10 {
+			t.Errorf("expected match %d in about %d samples, got %d", number, expected, counts[number])
+		}
+	}
+}
+
+func TestSampleCollectorCancelled(t *testing.T) {
+	searcher := &stubSearcher{
+		matches: makeMatches(100, 1),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewSampleCollector(10, 1).Collect(ctx, make(search.Aggregations), searcher)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled, got %v", err)
+	}
+}
@@ -15,12 +15,15 @@
 package collector
 
 import (
+	segment "github.com/blugelabs/bluge_segment_api"
+
 	"github.com/blugelabs/bluge/search"
 )
 
 type stubSearcher struct {
 	index   int
 	matches []*search.DocumentMatch
+	reader  search.MatchReader
 }
 
 func (ss *stubSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error) {
@@ -28,6 +31,9 @@ func (ss *stubSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error)
 		rv := ctx.DocumentMatchPool.Get()
 		rv.Number = ss.matches[ss.index].Number
 		rv.Score = ss.matches[ss.index].Score
+		if ss.reader != nil {
+			rv.SetReader(ss.reader)
+		}
 		ss.index++
 		return rv, nil
 	}
@@ -41,3 +47,25 @@ func (ss *stubSearcher) DocumentMatchPoolSize() int {
 func (ss *stubSearcher) Close() error {
 	return nil
 }
+
+// stubReader serves document values keyed by document number
+type stubReader struct {
+	docValues map[uint64]map[string][][]byte
+}
+
+func (sr *stubReader) DocumentValueReader(fields []string) (segment.DocumentValueReader, error) {
+	return sr, nil
+}
+
+func (sr *stubReader) VisitDocumentValues(number uint64, visitor segment.DocumentValueVisitor) error {
+	for field, values := range sr.docValues[number] {
+		for _, value := range values {
+			visitor(field, value)
+		}
+	}
+	return nil
+}
+
+func (sr *stubReader) VisitStoredFields(number uint64, visitor segment.StoredFieldVisitor) error {
+	return nil
+}
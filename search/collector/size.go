@@ -25,8 +25,14 @@ func init() {
 	sizeOfString = int(reflect.TypeOf(str).Size())
 	var coll TopNCollector
 	reflectStaticSizeTopNCollector = int(reflect.TypeOf(coll).Size())
+	var collapse CollapsingCollector
+	reflectStaticSizeCollapsingCollector = int(reflect.TypeOf(collapse).Size())
+	var sample SampleCollector
+	reflectStaticSizeSampleCollector = int(reflect.TypeOf(sample).Size())
 }
 
 var sizeOfPtr int
 var sizeOfString int
 var reflectStaticSizeTopNCollector int
+var reflectStaticSizeCollapsingCollector int
+var reflectStaticSizeSampleCollector int
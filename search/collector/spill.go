@@ -0,0 +1,379 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/blugelabs/bluge/search"
+)
+
+// collectStoreSpill holds at most threshold hits in memory.  Once there
+// are more, they are sorted and the best of them are written to a
+// temporary file as a run, and the runs are merged to find the final
+// results.  The file keeps the number, hit number, score, sort value,
+// term locations and reader of each hit.  Other details, such as score
+// explanations, are lost, and document values are loaded again for the
+// final results.
+//
+// The file is an operating system temporary file, not an item of the
+// index Directory, as a Directory persists whole items of an index,
+// while the runs are appended to the file and read back at offsets,
+// and the file is removed once the search is done.
+type collectStoreSpill struct {
+	threshold int
+	dir       string
+	compare   collectorCompare
+
+	// set by the collector before any hits are added
+	pool *search.DocumentMatchPool
+	load collectorFixup
+
+	buffer  search.DocumentMatchCollection
+	size    int
+	file    *os.File
+	writer  *bufio.Writer
+	offset  int64
+	runs    []spillRun
+	readers []search.MatchReader
+	scratch []byte
+	err     error
+}
+
+type spillRun struct {
+	offset int64
+	length int64
+	count  int
+}
+
+func newStoreSpill(threshold int, dir string, compare collectorCompare) *collectStoreSpill {
+	return &collectStoreSpill{
+		threshold: threshold,
+		dir:       dir,
+		compare:   compare,
+	}
+}
+
+func (c *collectStoreSpill) AddNotExceedingSize(doc *search.DocumentMatch, size int) *search.DocumentMatch {
+	c.size = size
+	c.buffer = append(c.buffer, doc)
+	if len(c.buffer) >= c.threshold && c.err == nil {
+		c.err = c.spill()
+	}
+	return nil
+}
+
+// sortBuffer sorts the hits held in memory, and returns to the
+// pool the hits ranked too low to be in the results
+func (c *collectStoreSpill) sortBuffer() {
+	sort.Slice(c.buffer, func(i, j int) bool {
+		return c.compare(c.buffer[i], c.buffer[j]) < 0
+	})
+	if len(c.buffer) > c.size {
+		for _, doc := range c.buffer[c.size:] {
+			c.pool.Put(doc)
+		}
+		c.buffer = c.buffer[:c.size]
+	}
+}
+
+// spill writes the hits held in memory to the file as a sorted run
+func (c *collectStoreSpill) spill() error {
+	c.sortBuffer()
+	if c.file == nil {
+		var err error
+		c.file, err = ioutil.TempFile(c.dir, "bluge-spill-")
+		if err != nil {
+			return fmt.Errorf("error creating spill file: %w", err)
+		}
+		c.writer = bufio.NewWriter(c.file)
+	}
+	run := spillRun{offset: c.offset, count: len(c.buffer)}
+	for _, doc := range c.buffer {
+		n, err := c.writer.Write(c.encode(doc))
+		if err != nil {
+			return fmt.Errorf("error writing spill file: %w", err)
+		}
+		run.length += int64(n)
+		c.pool.Put(doc)
+	}
+	c.offset += run.length
+	c.runs = append(c.runs, run)
+	c.buffer = c.buffer[:0]
+	return nil
+}
+
+func (c *collectStoreSpill) readerIndex(reader search.MatchReader) int {
+	for i := range c.readers {
+		if c.readers[i] == reader {
+			return i
+		}
+	}
+	c.readers = append(c.readers, reader)
+	return len(c.readers) - 1
+}
+
+func (c *collectStoreSpill) encode(doc *search.DocumentMatch) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	buf := c.scratch[:0]
+	putUvarint := func(v uint64) {
+		n := binary.PutUvarint(tmp[:], v)
+		buf = append(buf, tmp[:n]...)
+	}
+	putUvarint(doc.Number)
+	putUvarint(uint64(doc.HitNumber))
+	putUvarint(math.Float64bits(doc.Score))
+	putUvarint(uint64(c.readerIndex(doc.Reader())))
+	putUvarint(uint64(len(doc.SortValue)))
+	for _, val := range doc.SortValue {
+		putUvarint(uint64(len(val)))
+		buf = append(buf, val...)
+	}
+	putUvarint(uint64(len(doc.FieldTermLocations)))
+	for _, ftl := range doc.FieldTermLocations {
+		putUvarint(uint64(len(ftl.Field)))
+		buf = append(buf, ftl.Field...)
+		putUvarint(uint64(len(ftl.Term)))
+		buf = append(buf, ftl.Term...)
+		putUvarint(uint64(ftl.Location.Pos))
+		putUvarint(uint64(ftl.Location.Start))
+		putUvarint(uint64(ftl.Location.End))
+	}
+	c.scratch = buf
+	return buf
+}
+
+func (c *collectStoreSpill) decode(r *bufio.Reader) (*search.DocumentMatch, error) {
+	var vals [5]uint64
+	for i := range vals {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	rv := &search.DocumentMatch{
+		Number:    vals[0],
+		HitNumber: int(vals[1]),
+		Score:     math.Float64frombits(vals[2]),
+		SortValue: make(search.SortValue, vals[4]),
+	}
+	rv.SetReader(c.readers[vals[3]])
+	for i := range rv.SortValue {
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		rv.SortValue[i] = make([]byte, l)
+		_, err = io.ReadFull(r, rv.SortValue[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		rv.FieldTermLocations = make([]search.FieldTermLocation, n)
+	}
+	for i := range rv.FieldTermLocations {
+		ftl, err := decodeFieldTermLocation(r)
+		if err != nil {
+			return nil, err
+		}
+		rv.FieldTermLocations[i] = ftl
+	}
+	return rv, nil
+}
+
+func decodeFieldTermLocation(r *bufio.Reader) (rv search.FieldTermLocation, err error) {
+	readString := func() (string, error) {
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return "", err
+		}
+		b := make([]byte, l)
+		_, err = io.ReadFull(r, b)
+		return string(b), err
+	}
+	rv.Field, err = readString()
+	if err != nil {
+		return rv, err
+	}
+	rv.Term, err = readString()
+	if err != nil {
+		return rv, err
+	}
+	var vals [3]uint64
+	for i := range vals {
+		vals[i], err = binary.ReadUvarint(r)
+		if err != nil {
+			return rv, err
+		}
+	}
+	rv.Location = search.Location{
+		Pos:   int(vals[0]),
+		Start: int(vals[1]),
+		End:   int(vals[2]),
+	}
+	return rv, nil
+}
+
+func (c *collectStoreSpill) Final(skip int, fixup collectorFixup) (search.DocumentMatchCollection, error) {
+	defer c.Close()
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	// nothing was spilled, the results are all in memory
+	if len(c.runs) == 0 {
+		c.sortBuffer()
+		if skip >= len(c.buffer) {
+			return search.DocumentMatchCollection{}, nil
+		}
+		for _, doc := range c.buffer[skip:] {
+			err := fixup(doc)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return c.buffer[skip:], nil
+	}
+
+	if len(c.buffer) > 0 {
+		err := c.spill()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := c.writer.Flush()
+	if err != nil {
+		return nil, fmt.Errorf("error writing spill file: %w", err)
+	}
+
+	merge := &spillMerge{compare: c.compare}
+	for _, run := range c.runs {
+		r := bufio.NewReader(io.NewSectionReader(c.file, run.offset, run.length))
+		err = merge.push(c, r, run.count)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var rv search.DocumentMatchCollection
+	for i := 0; merge.Len() > 0 && i < c.size; i++ {
+		doc, err := merge.pop(c)
+		if err != nil {
+			return nil, err
+		}
+		if i < skip {
+			continue
+		}
+		err = c.load(doc)
+		if err != nil {
+			return nil, err
+		}
+		err = fixup(doc)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, doc)
+	}
+	if rv == nil {
+		rv = search.DocumentMatchCollection{}
+	}
+	return rv, nil
+}
+
+// Close removes the spill file, if one was created
+func (c *collectStoreSpill) Close() {
+	if c.file != nil {
+		_ = c.file.Close()
+		_ = os.Remove(c.file.Name())
+		c.file = nil
+	}
+}
+
+// spillMerge is a heap of the next hit of each run, best first
+type spillMerge struct {
+	compare collectorCompare
+	heads   []*spillHead
+}
+
+type spillHead struct {
+	doc       *search.DocumentMatch
+	reader    *bufio.Reader
+	remaining int
+}
+
+func (m *spillMerge) push(c *collectStoreSpill, r *bufio.Reader, count int) error {
+	if count == 0 {
+		return nil
+	}
+	doc, err := c.decode(r)
+	if err != nil {
+		return fmt.Errorf("error reading spill file: %w", err)
+	}
+	heap.Push(m, &spillHead{doc: doc, reader: r, remaining: count - 1})
+	return nil
+}
+
+func (m *spillMerge) pop(c *collectStoreSpill) (*search.DocumentMatch, error) {
+	head := m.heads[0]
+	rv := head.doc
+	if head.remaining == 0 {
+		heap.Pop(m)
+		return rv, nil
+	}
+	doc, err := c.decode(head.reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading spill file: %w", err)
+	}
+	head.doc = doc
+	head.remaining--
+	heap.Fix(m, 0)
+	return rv, nil
+}
+
+func (m *spillMerge) Len() int {
+	return len(m.heads)
+}
+
+func (m *spillMerge) Less(i, j int) bool {
+	return m.compare(m.heads[i].doc, m.heads[j].doc) < 0
+}
+
+func (m *spillMerge) Swap(i, j int) {
+	m.heads[i], m.heads[j] = m.heads[j], m.heads[i]
+}
+
+func (m *spillMerge) Push(x interface{}) {
+	m.heads = append(m.heads, x.(*spillHead))
+}
+
+func (m *spillMerge) Pop() interface{} {
+	rv := m.heads[len(m.heads)-1]
+	m.heads = m.heads[:len(m.heads)-1]
+	return rv
+}
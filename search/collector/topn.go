@@ -15,7 +15,10 @@
 package collector
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/blugelabs/bluge/search"
 )
@@ -52,11 +55,30 @@ type TopNCollector struct {
 
 	lowestMatchOutsideResults *search.DocumentMatch
 	searchAfter               *search.DocumentMatch
+	stored                    int
+
+	sortCache  *search.SortValueCache
+	cachedSort *search.CachedSortOrder
+	stats      *search.SearchStats
+
+	maxDocsScanned int
+
+	postFilter                search.PostFilter
+	aggregateBeforePostFilter bool
 }
 
 // CheckDoneEvery controls how frequently we check the context deadline
 const CheckDoneEvery = 1024
 
+// ErrScanLimitExceeded is returned when a collector would have to
+// examine more matching documents than it has been allowed
+var ErrScanLimitExceeded = errors.New("maximum documents scanned exceeded")
+
+// ErrAfterKeyLength is returned when the after or before key of a
+// collector does not hold one value for each level of the sort order,
+// including the tie-breaker, if any
+var ErrAfterKeyLength = errors.New("after key length does not match the sort order")
+
 // NewTopNCollector builds a collector to find the top 'size' hits
 // skipping over the first 'skip' hits
 // ordering hits by the provided sort order
@@ -76,6 +98,94 @@ func NewTopNCollectorAfter(size int, sort search.SortOrder, after [][]byte, reve
 	return rv
 }
 
+// NewTopNCollectorBefore builds a collector to find the 'size' hits
+// immediately preceding the 'before' sort key in the provided sort order,
+// the hits are returned in the provided sort order.  Hits tied with each
+// other are ordered as NewTopNCollectorAfter would order them, so that
+// paging back and forth over the same results is consistent.
+func NewTopNCollectorBefore(size int, sort search.SortOrder, before [][]byte) *TopNCollector {
+	return NewTopNCollectorAfter(size, sort.Reversed(), before, true)
+}
+
+// WithTieBreaker adds a final sort level on the provided field, used to
+// order hits which are otherwise equal in the sort order.  When the field
+// holds a unique value for every document (such as _id), pagination with
+// NewTopNCollectorAfter no longer depends on the HitNumber assigned to each
+// hit, which can change between requests.  The tie-breaker value is included
+// as the last element of each hit's SortValue, and so must be included in
+// the after key of subsequent pages.
+func (hc *TopNCollector) WithTieBreaker(field string) *TopNCollector {
+	tieBreaker := search.SortBy(search.Field(field))
+	if hc.reverse {
+		tieBreaker.Desc()
+	}
+	hc.sort = append(hc.sort.Copy(), tieBreaker)
+	hc.neededFields = append(hc.neededFields, tieBreaker.Fields()...)
+	return hc
+}
+
+// WithSortValueCache reuses the sort values held by the cache, and
+// adds the values it computes, so they are not computed again by
+// subsequent pages of the same search against the same reader.
+func (hc *TopNCollector) WithSortValueCache(cache *search.SortValueCache) *TopNCollector {
+	hc.sortCache = cache
+	return hc
+}
+
+// WithMaxDocsScanned limits the number of matching documents examined,
+// Collect returns ErrScanLimitExceeded instead of examining more.
+// The default, 0, does not limit the number of documents examined.
+func (hc *TopNCollector) WithMaxDocsScanned(n int) *TopNCollector {
+	hc.maxDocsScanned = n
+	return hc
+}
+
+// WithPostFilter only returns the hits accepted by the filter,
+// by default the aggregations are also only calculated
+// over the accepted hits, see WithAggregationsBeforePostFilter
+func (hc *TopNCollector) WithPostFilter(filter search.PostFilter) *TopNCollector {
+	hc.postFilter = filter
+	hc.neededFields = append(hc.neededFields, filter.Fields()...)
+	return hc
+}
+
+// WithAggregationsBeforePostFilter calculates the aggregations over
+// every document matching the query, including those rejected by
+// the post filter, such as to count the values of facets which
+// are not selected, while the hits only include the accepted ones
+func (hc *TopNCollector) WithAggregationsBeforePostFilter() *TopNCollector {
+	hc.aggregateBeforePostFilter = true
+	return hc
+}
+
+// WithSearchStats counts the work done by the search in stats,
+// the counters are added to, so reset them to reuse the stats
+func (hc *TopNCollector) WithSearchStats(stats *search.SearchStats) *TopNCollector {
+	hc.stats = stats
+	return hc
+}
+
+// WithSpill bounds the memory used for deep pagination, where size+skip
+// hits would otherwise be held in memory.  Once more than threshold hits
+// are held, they are sorted and written to a temporary file in dir, or
+// the default temporary directory if dir is empty, and the sorted runs
+// are merged once all the hits have been seen.  This is much slower than
+// keeping the hits in memory, so the threshold should be set well above
+// the size+skip of typical searches.  Hits written to the file keep only
+// their number, score, sort value and term locations, the document values
+// needed are loaded again for the results returned, but score
+// explanations are not available.
+func (hc *TopNCollector) WithSpill(threshold int, dir string) *TopNCollector {
+	if threshold < 1 {
+		threshold = 1
+	}
+	hc.store = newStoreSpill(threshold, dir, hc.compare)
+	if hc.backingSize > threshold+1 {
+		hc.backingSize = threshold + 1
+	}
+	return hc
+}
+
 const switchFromSliceToHeap = 10
 
 func newTopNCollector(size, skip int, sort search.SortOrder, reverse bool) *TopNCollector {
@@ -95,13 +205,9 @@ func newTopNCollector(size, skip int, sort search.SortOrder, reverse bool) *TopN
 	}
 
 	if size+skip > switchFromSliceToHeap {
-		hc.store = newStoreHeap(hc.backingSize, func(i, j *search.DocumentMatch) int {
-			return hc.sort.Compare(i, j)
-		})
+		hc.store = newStoreHeap(hc.backingSize, hc.compare)
 	} else {
-		hc.store = newStoreSlice(hc.backingSize, func(i, j *search.DocumentMatch) int {
-			return hc.sort.Compare(i, j)
-		})
+		hc.store = newStoreSlice(hc.backingSize, hc.compare)
 	}
 
 	// these lookups traverse an interface, so do once up-front
@@ -135,7 +241,13 @@ func (hc *TopNCollector) Collect(ctx context.Context, aggs search.Aggregations,
 		_ = searcher.Close()
 	}()
 
+	if hc.searchAfter != nil && len(hc.searchAfter.SortValue) != len(hc.sort) {
+		return nil, fmt.Errorf("%w: %d values for %d sort levels",
+			ErrAfterKeyLength, len(hc.searchAfter.SortValue), len(hc.sort))
+	}
+
 	searchContext := search.NewSearchContext(hc.backingSize+searcher.DocumentMatchPoolSize(), len(hc.sort))
+	searchContext.Stats = hc.stats
 
 	// add fields needed by aggregations
 	hc.neededFields = append(hc.neededFields, aggs.Fields()...)
@@ -153,6 +265,21 @@ func (hc *TopNCollector) Collect(ctx context.Context, aggs search.Aggregations,
 
 	bucket := search.NewBucket("", aggs)
 
+	if hc.sortCache != nil {
+		hc.cachedSort = hc.sortCache.For(hc.sort)
+	}
+
+	if spill, ok := hc.store.(*collectStoreSpill); ok {
+		spill.pool = searchContext.DocumentMatchPool
+		spill.load = func(d *search.DocumentMatch) error {
+			if len(hc.neededFields) == 0 {
+				return nil
+			}
+			return d.LoadDocumentValues(searchContext, hc.neededFields)
+		}
+		defer spill.Close()
+	}
+
 	var hitNumber int
 	select {
 	case <-ctx.Done():
@@ -168,6 +295,9 @@ func (hc *TopNCollector) Collect(ctx context.Context, aggs search.Aggregations,
 			default:
 			}
 		}
+		if hc.maxDocsScanned > 0 && hitNumber >= hc.maxDocsScanned {
+			return nil, ErrScanLimitExceeded
+		}
 
 		hitNumber++
 		next.HitNumber = hitNumber
@@ -182,6 +312,10 @@ func (hc *TopNCollector) Collect(ctx context.Context, aggs search.Aggregations,
 	if err != nil {
 		return nil, err
 	}
+	err = bucket.Err()
+	if err != nil {
+		return nil, err
+	}
 
 	bucket.Finish()
 
@@ -192,14 +326,22 @@ func (hc *TopNCollector) Collect(ctx context.Context, aggs search.Aggregations,
 	}
 
 	rv := &TopNIterator{
-		results: hc.results,
-		bucket:  bucket,
-		index:   0,
-		err:     nil,
+		results:   hc.results,
+		bucket:    bucket,
+		index:     0,
+		err:       nil,
+		truncated: hc.truncated(),
 	}
 	return rv, nil
 }
 
+// truncated reports whether any hits were left out of the results
+// because they sorted after them, once size+skip hits are held, each
+// further hit either displaces one of them or is skipped outright
+func (hc *TopNCollector) truncated() bool {
+	return hc.lowestMatchOutsideResults != nil || hc.stored > hc.size+hc.skip
+}
+
 func (hc *TopNCollector) collectSingle(ctx *search.Context, d *search.DocumentMatch, bucket *search.Bucket) error {
 	var err error
 
@@ -210,10 +352,24 @@ func (hc *TopNCollector) collectSingle(ctx *search.Context, d *search.DocumentMa
 		}
 	}
 
+	if hc.postFilter != nil && !hc.postFilter.Accept(d) {
+		if hc.aggregateBeforePostFilter {
+			bucket.Consume(d)
+		}
+		ctx.DocumentMatchPool.Put(d)
+		return nil
+	}
+
 	// compute this hits sort value
-	hc.sort.Compute(d)
+	if hc.cachedSort != nil {
+		hc.cachedSort.Compute(d)
+	} else {
+		hc.sort.Compute(d)
+	}
 
-	// calculate aggregations
+	// calculate aggregations, this must happen before any of the checks
+	// below which skip hits outside the results, so that aggregations
+	// reflect every match, not only those returned
 	bucket.Consume(d)
 
 	// support search after based pagination,
@@ -223,7 +379,7 @@ func (hc *TopNCollector) collectSingle(ctx *search.Context, d *search.DocumentMa
 		// exact sort order matches use hit number to break tie
 		// but we want to allow for exact match, so we pretend
 		hc.searchAfter.HitNumber = d.HitNumber
-		if hc.sort.Compare(d, hc.searchAfter) <= 0 {
+		if hc.compare(d, hc.searchAfter) <= 0 {
 			return nil
 		}
 	}
@@ -232,7 +388,7 @@ func (hc *TopNCollector) collectSingle(ctx *search.Context, d *search.DocumentMa
 	// with this one comparison, we can avoid all heap operations if
 	// this hit would have been added and then immediately removed
 	if hc.lowestMatchOutsideResults != nil {
-		cmp := hc.sort.Compare(d, hc.lowestMatchOutsideResults)
+		cmp := hc.compare(d, hc.lowestMatchOutsideResults)
 		if cmp >= 0 {
 			// this hit can't possibly be in the result set, so avoid heap ops
 			ctx.DocumentMatchPool.Put(d)
@@ -240,12 +396,16 @@ func (hc *TopNCollector) collectSingle(ctx *search.Context, d *search.DocumentMa
 		}
 	}
 
+	if ctx.Stats != nil {
+		ctx.Stats.HeapOperations++
+	}
+	hc.stored++
 	removed := hc.store.AddNotExceedingSize(d, hc.size+hc.skip)
 	if removed != nil {
 		if hc.lowestMatchOutsideResults == nil {
 			hc.lowestMatchOutsideResults = removed
 		} else {
-			cmp := hc.sort.Compare(removed, hc.lowestMatchOutsideResults)
+			cmp := hc.compare(removed, hc.lowestMatchOutsideResults)
 			if cmp < 0 {
 				tmp := hc.lowestMatchOutsideResults
 				hc.lowestMatchOutsideResults = removed
@@ -256,6 +416,27 @@ func (hc *TopNCollector) collectSingle(ctx *search.Context, d *search.DocumentMa
 	return nil
 }
 
+// compare orders hits by the sort order, a reverse collector also
+// reverses the order of hits with the same sort value, so that once
+// its results are reversed, tied hits are ordered by HitNumber
+// just as they are by a collector which is not reversed
+func (hc *TopNCollector) compare(i, j *search.DocumentMatch) int {
+	c := hc.sort.Compare(i, j)
+	if hc.reverse && sameSortValue(i, j) {
+		return -c
+	}
+	return c
+}
+
+func sameSortValue(i, j *search.DocumentMatch) bool {
+	for x := range i.SortValue {
+		if !bytes.Equal(i.SortValue[x], j.SortValue[x]) {
+			return false
+		}
+	}
+	return true
+}
+
 // finalizeResults starts with the heap containing the final top size+skip
 // it now throws away the results to be skipped
 // and does final doc id lookup (if necessary)
@@ -16,7 +16,12 @@ package collector
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"math"
+	"math/rand"
+	"reflect"
 	"testing"
 
 	"github.com/blugelabs/bluge/search/aggregations"
@@ -103,6 +108,44 @@ func TestTop10Scores(t *testing.T) {
 	}
 }
 
+func TestTopNAggregationsCountSkippedHits(t *testing.T) {
+	// descending scores, so once the results are full every later
+	// hit is skipped by comparing it to the lowest match removed
+	var matches []*search.DocumentMatch
+	for i := 1; i <= 100; i++ {
+		matches = append(matches, &search.DocumentMatch{
+			Number: uint64(i),
+			Score:  float64(1000 - i),
+		})
+	}
+
+	// sizes small and large enough to use each store
+	for _, size := range []int{3, 20} {
+		aggs := make(search.Aggregations)
+		aggs.Add("count", aggregations.CountMatches())
+		collector := NewTopNCollector(size, 0, search.SortOrder{search.SortBy(search.DocumentScore()).Desc()})
+		dmi, err := collector.Collect(context.Background(), aggs, &stubSearcher{matches: matches})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hits int
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			hits++
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hits != size {
+			t.Errorf("size %d: expected %d hits, got %d", size, size, hits)
+		}
+		if dmi.Aggregations().Count() != 100 {
+			t.Errorf("size %d: expected count of 100, got %d", size, dmi.Aggregations().Count())
+		}
+	}
+}
+
 func getTotalHitsMaxScore(bucket *search.Bucket) (total int, topScore float64) {
 	total = int(bucket.Aggregations()["count"].(search.MetricCalculator).Value())
 	topScore = bucket.Aggregations()["max_score"].(search.MetricCalculator).Value()
@@ -293,6 +336,369 @@ func TestPaginationSameScores(t *testing.T) {
 	}
 }
 
+func TestTopNCollectorAfterTieBreaker(t *testing.T) {
+	const numDocs = 50
+	const pageSize = 7
+
+	// all matches have the same score, forming one large tie group
+	reader := &stubReader{docValues: map[uint64]map[string][][]byte{}}
+	var matches []*search.DocumentMatch
+	for i := 1; i <= numDocs; i++ {
+		reader.docValues[uint64(i)] = map[string][][]byte{
+			"_id": {[]byte(fmt.Sprintf("%03d", i))},
+		}
+		matches = append(matches, &search.DocumentMatch{
+			Number: uint64(i),
+			Score:  1,
+		})
+	}
+
+	sort := search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}
+	seen := map[uint64]int{}
+	var after [][]byte
+	for page := 0; ; page++ {
+		// vary the order matches are seen, to simulate HitNumber
+		// being assigned differently for each request
+		pageMatches := make([]*search.DocumentMatch, len(matches))
+		copy(pageMatches, matches)
+		rand.New(rand.NewSource(int64(page))).Shuffle(len(pageMatches), func(i, j int) {
+			pageMatches[i], pageMatches[j] = pageMatches[j], pageMatches[i]
+		})
+		searcher := &stubSearcher{
+			matches: pageMatches,
+			reader:  reader,
+		}
+
+		var collector *TopNCollector
+		if after == nil {
+			collector = NewTopNCollector(pageSize, 0, sort.Copy())
+		} else {
+			collector = NewTopNCollectorAfter(pageSize, sort.Copy(), after, false)
+		}
+		collector.WithTieBreaker("_id")
+		dmi, err := collector.Collect(context.Background(), search.Aggregations{}, searcher)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var count int
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			seen[next.Number]++
+			after = next.SortValue
+			count++
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count == 0 {
+			break
+		}
+	}
+
+	if len(seen) != numDocs {
+		t.Errorf("expected to see %d documents, saw %d", numDocs, len(seen))
+	}
+	for number, times := range seen {
+		if times != 1 {
+			t.Errorf("expected document %d to be seen once, saw %d times", number, times)
+		}
+	}
+}
+
+func TestTopNCollectorAfterKeyLength(t *testing.T) {
+	matches := []*search.DocumentMatch{
+		{Number: 1, Score: 2},
+		{Number: 2, Score: 1},
+	}
+	sort := search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}
+	tests := []struct {
+		name      string
+		collector *TopNCollector
+		expectErr bool
+	}{
+		{
+			name:      "matching",
+			collector: NewTopNCollectorAfter(10, sort, [][]byte{[]byte("x")}, false),
+		},
+		{
+			name:      "empty",
+			collector: NewTopNCollectorAfter(10, sort, [][]byte{}, false),
+			expectErr: true,
+		},
+		{
+			name:      "longer",
+			collector: NewTopNCollectorAfter(10, sort, [][]byte{[]byte("x"), []byte("y")}, false),
+			expectErr: true,
+		},
+		{
+			name:      "missing tie-breaker",
+			collector: NewTopNCollectorBefore(10, sort, [][]byte{[]byte("x")}).WithTieBreaker("_id"),
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		_, err := test.collector.Collect(context.Background(), search.Aggregations{},
+			&stubSearcher{matches: matches})
+		if test.expectErr && !errors.Is(err, ErrAfterKeyLength) {
+			t.Errorf("%s: expected ErrAfterKeyLength, got %v", test.name, err)
+		}
+		if !test.expectErr && err != nil {
+			t.Errorf("%s: expected no error, got %v", test.name, err)
+		}
+	}
+}
+
+func TestTopNCollectorBeforeRoundTrip(t *testing.T) {
+	// pairs of documents share the same score
+	var matches []*search.DocumentMatch
+	for i := 1; i <= 12; i++ {
+		matches = append(matches, &search.DocumentMatch{
+			Number: uint64(i),
+			Score:  float64(10 - (i-1)/2),
+		})
+	}
+	sort := search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}
+
+	collect := func(collector *TopNCollector) (numbers []uint64, sortValues [][][]byte) {
+		dmi, err := collector.Collect(context.Background(), search.Aggregations{}, &stubSearcher{matches: matches})
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			numbers = append(numbers, next.Number)
+			sortValues = append(sortValues, next.SortValue)
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return numbers, sortValues
+	}
+
+	// page forward
+	var pages [][]uint64
+	var firstSortValues [][][]byte
+	numbers, sortValues := collect(NewTopNCollector(4, 0, sort))
+	for len(numbers) > 0 {
+		pages = append(pages, numbers)
+		firstSortValues = append(firstSortValues, sortValues[0])
+		numbers, sortValues = collect(NewTopNCollectorAfter(4, sort, sortValues[len(sortValues)-1], false))
+	}
+	expectedPages := [][]uint64{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}}
+	if !reflect.DeepEqual(pages, expectedPages) {
+		t.Fatalf("expected forward pages %v, got %v", expectedPages, pages)
+	}
+
+	// page back from each page, expecting exactly the previous page
+	for i := len(pages) - 1; i > 0; i-- {
+		numbers, _ = collect(NewTopNCollectorBefore(4, sort, firstSortValues[i]))
+		if !reflect.DeepEqual(numbers, pages[i-1]) {
+			t.Errorf("expected page before %v to be %v, got %v", pages[i], pages[i-1], numbers)
+		}
+	}
+
+	// the sort order provided is not modified
+	numbers, _ = collect(NewTopNCollector(4, 0, sort))
+	if !reflect.DeepEqual(numbers, pages[0]) {
+		t.Errorf("expected sort order to be unchanged, got first page %v", numbers)
+	}
+}
+
+func TestTopNIteratorReverse(t *testing.T) {
+	aggs := make(search.Aggregations)
+	aggs.Add("count", aggregations.CountMatches())
+	sort := search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}
+
+	collect := func(reverse bool) (numbers []uint64, count uint64) {
+		var matches []*search.DocumentMatch
+		for i := 1; i <= 20; i++ {
+			matches = append(matches, &search.DocumentMatch{
+				Number: uint64(i),
+				Score:  float64(i % 7),
+			})
+		}
+		dmi, err := NewTopNCollector(10, 0, sort).
+			Collect(context.Background(), aggs, &stubSearcher{matches: matches})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reverse {
+			dmi.(*TopNIterator).Reverse()
+		}
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			numbers = append(numbers, next.Number)
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return numbers, dmi.Aggregations().Count()
+	}
+
+	forward, forwardCount := collect(false)
+	reversed, reversedCount := collect(true)
+	if len(forward) != 10 {
+		t.Fatalf("expected 10 results, got %d", len(forward))
+	}
+	for i := range forward {
+		if forward[i] != reversed[len(reversed)-1-i] {
+			t.Fatalf("expected reversed results %v to mirror %v", reversed, forward)
+		}
+	}
+	if forwardCount != 20 || reversedCount != 20 {
+		t.Errorf("expected aggregations to count 20 matches, got %d and %d", forwardCount, reversedCount)
+	}
+}
+
+func TestTopNCollectorMaxDocsScanned(t *testing.T) {
+	searcher := &stubSearcher{
+		matches: makeMatches(10000, 11),
+	}
+
+	collector := NewTopNCollector(10, 0, search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}).
+		WithMaxDocsScanned(3)
+	_, err := collector.Collect(context.Background(), search.Aggregations{}, searcher)
+	if !errors.Is(err, ErrScanLimitExceeded) {
+		t.Fatalf("expected ErrScanLimitExceeded, got %v", err)
+	}
+	if searcher.index != 4 {
+		t.Errorf("expected collector to stop after 4 matches, read %d", searcher.index)
+	}
+}
+
+func TestTopNCollectorPostFilter(t *testing.T) {
+	for _, aggregateBefore := range []bool{false, true} {
+		reader := &stubReader{docValues: map[uint64]map[string][][]byte{}}
+		var matches []*search.DocumentMatch
+		for i := 1; i <= 20; i++ {
+			color := "blue"
+			if i%4 == 0 {
+				color = "red"
+			}
+			reader.docValues[uint64(i)] = map[string][][]byte{
+				"color": {[]byte(color)},
+			}
+			matches = append(matches, &search.DocumentMatch{
+				Number: uint64(i),
+				Score:  float64(i),
+			})
+		}
+		searcher := &stubSearcher{
+			matches: matches,
+			reader:  reader,
+		}
+
+		aggs := make(search.Aggregations)
+		aggs.Add("count", aggregations.CountMatches())
+		aggs.Add("colors", aggregations.NewTermsAggregation(search.Field("color"), 10))
+
+		collector := NewTopNCollector(10, 0, search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}).
+			WithPostFilter(search.TextPostFilter(search.Field("color"), func(val []byte) bool {
+				return string(val) == "red"
+			}))
+		if aggregateBefore {
+			collector.WithAggregationsBeforePostFilter()
+		}
+		dmi, err := collector.Collect(context.Background(), aggs, searcher)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var hits []uint64
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			hits = append(hits, next.Number)
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedHits := []uint64{20, 16, 12, 8, 4}
+		if !reflect.DeepEqual(hits, expectedHits) {
+			t.Errorf("aggregate before %t: expected hits %v, got %v", aggregateBefore, expectedHits, hits)
+		}
+
+		counts := map[string]uint64{}
+		for _, bucket := range dmi.Aggregations().Buckets("colors") {
+			counts[bucket.Name()] = bucket.Count()
+		}
+		expectedCount := uint64(5)
+		expectedCounts := map[string]uint64{"red": 5}
+		if aggregateBefore {
+			expectedCount = 20
+			expectedCounts["blue"] = 15
+		}
+		if !reflect.DeepEqual(counts, expectedCounts) {
+			t.Errorf("aggregate before %t: expected counts %v, got %v", aggregateBefore, expectedCounts, counts)
+		}
+		if dmi.Aggregations().Count() != expectedCount {
+			t.Errorf("aggregate before %t: expected count %d, got %d", aggregateBefore, expectedCount, dmi.Aggregations().Count())
+		}
+	}
+}
+
+func TestTopNCollectorFuncPostFilter(t *testing.T) {
+	reader := &stubReader{docValues: map[uint64]map[string][][]byte{}}
+	var matches []*search.DocumentMatch
+	for i := 1; i <= 10; i++ {
+		status := "active"
+		if i == 3 || i == 8 || i == 10 {
+			status = "archived"
+		}
+		reader.docValues[uint64(i)] = map[string][][]byte{
+			"status": {[]byte(status)},
+		}
+		matches = append(matches, &search.DocumentMatch{
+			Number: uint64(i),
+			Score:  float64(i),
+		})
+	}
+	searcher := &stubSearcher{
+		matches: matches,
+		reader:  reader,
+	}
+
+	aggs := make(search.Aggregations)
+	aggs.Add("count", aggregations.CountMatches())
+
+	active := func(d *search.DocumentMatch) bool {
+		for _, val := range search.Field("status").Values(d) {
+			if string(val) != "active" {
+				return false
+			}
+		}
+		return true
+	}
+	collector := NewTopNCollector(4, 0, search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}).
+		WithPostFilter(search.FuncPostFilter([]string{"status"}, active))
+	dmi, err := collector.Collect(context.Background(), aggs, searcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hits []uint64
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		hits = append(hits, next.Number)
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the filtered hits never take a place in the top 4
+	expectedHits := []uint64{9, 7, 6, 5}
+	if !reflect.DeepEqual(hits, expectedHits) {
+		t.Errorf("expected hits %v, got %v", expectedHits, hits)
+	}
+	if dmi.Aggregations().Count() != 7 {
+		t.Errorf("expected count 7, got %d", dmi.Aggregations().Count())
+	}
+}
+
 func BenchmarkTop10of0Scores(b *testing.B) {
 	benchHelper(0, func() search.Collector {
 		return NewTopNCollector(10, 0, search.SortOrder{search.SortBy(search.DocumentScore()).Desc()})
@@ -400,3 +806,146 @@ func BenchmarkTop10000of1000000Scores(b *testing.B) {
 		return NewTopNCollector(10000, 0, search.SortOrder{search.SortBy(search.DocumentScore()).Desc()})
 	}, b)
 }
+
+func TestTopNCollectorSpill(t *testing.T) {
+	var matches []*search.DocumentMatch
+	for i := 1; i <= 1000; i++ {
+		matches = append(matches, &search.DocumentMatch{
+			Number: uint64(i),
+			Score:  float64((i * 37) % 101),
+		})
+	}
+
+	collect := func(collector *TopNCollector) (rv []*search.DocumentMatch) {
+		dmi, err := collector.Collect(context.Background(), search.Aggregations{}, &stubSearcher{matches: matches})
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			rv = append(rv, next)
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv
+	}
+
+	sort := search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}
+	dir := t.TempDir()
+	for _, test := range []struct {
+		size      int
+		skip      int
+		threshold int
+	}{
+		{size: 10, skip: 900, threshold: 50},
+		{size: 10, skip: 900, threshold: 7},
+		{size: 25, skip: 0, threshold: 50},
+		{size: 10, skip: 900, threshold: 5000},
+		{size: 10, skip: 995, threshold: 50},
+		{size: 10, skip: 2000, threshold: 50},
+	} {
+		expect := collect(NewTopNCollector(test.size, test.skip, sort))
+		got := collect(NewTopNCollector(test.size, test.skip, sort).WithSpill(test.threshold, dir))
+		if len(got) != len(expect) {
+			t.Fatalf("size %d skip %d threshold %d: expected %d hits, got %d",
+				test.size, test.skip, test.threshold, len(expect), len(got))
+		}
+		for i := range expect {
+			if got[i].Number != expect[i].Number || got[i].Score != expect[i].Score {
+				t.Errorf("size %d skip %d threshold %d: hit %d expected %d/%f, got %d/%f",
+					test.size, test.skip, test.threshold, i,
+					expect[i].Number, expect[i].Score, got[i].Number, got[i].Score)
+			}
+		}
+	}
+
+	// the spill files are removed
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected spill files to be removed, found %d", len(files))
+	}
+}
+
+func TestTopNIteratorAggregations(t *testing.T) {
+	reader := &stubReader{docValues: map[uint64]map[string][][]byte{}}
+	var matches []*search.DocumentMatch
+	for i := 1; i <= 30; i++ {
+		colors := []string{"blue", "red", "green"}
+		reader.docValues[uint64(i)] = map[string][][]byte{
+			"color": {[]byte(colors[i%3])},
+		}
+		matches = append(matches, &search.DocumentMatch{
+			Number: uint64(i),
+			Score:  float64(i),
+		})
+	}
+	// 14 blue, 10 green, 6 red
+	for i := 1; i <= 4; i++ {
+		reader.docValues[uint64(i*3+1)]["color"] = [][]byte{[]byte("blue")}
+	}
+
+	aggs := make(search.Aggregations)
+	aggs.Add("max_score", aggregations.Max(search.DocumentScore()))
+	aggs.Add("colors", aggregations.NewTermsAggregation(search.Field("color"), 2))
+
+	collector := NewTopNCollector(5, 0, search.SortOrder{search.SortBy(search.DocumentScore()).Desc()})
+	dmi, err := collector.Collect(context.Background(), aggs, &stubSearcher{matches: matches, reader: reader})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket := dmi.(*TopNIterator).Aggregations()
+
+	if bucket.Metric("max_score") != 30 {
+		t.Errorf("expected max score 30, got %f", bucket.Metric("max_score"))
+	}
+	// the terms are counted over all 30 matches, not the 5 hits,
+	// and trimmed to the 2 largest once finished
+	colors := bucket.Buckets("colors")
+	if len(colors) != 2 {
+		t.Fatalf("expected 2 color buckets, got %d", len(colors))
+	}
+	if colors[0].Name() != "blue" || colors[0].Count() != 14 {
+		t.Errorf("expected 14 blue first, got %d %s", colors[0].Count(), colors[0].Name())
+	}
+	if colors[1].Name() != "green" || colors[1].Count() != 10 {
+		t.Errorf("expected 10 green second, got %d %s", colors[1].Count(), colors[1].Name())
+	}
+}
+
+func TestTopNIteratorTruncated(t *testing.T) {
+	sort := search.SortOrder{search.SortBy(search.DocumentScore()).Desc()}
+	for _, test := range []struct {
+		matches   int
+		size      int
+		skip      int
+		truncated bool
+	}{
+		{matches: 5, size: 10, truncated: false},
+		{matches: 10, size: 10, truncated: false},
+		{matches: 11, size: 10, truncated: true},
+		{matches: 100, size: 10, truncated: true},
+		{matches: 15, size: 10, skip: 5, truncated: false},
+		{matches: 16, size: 10, skip: 5, truncated: true},
+		{matches: 100, size: 20, truncated: true},
+	} {
+		// ascending scores, so hits are displaced rather than skipped
+		matches := makeMatches(test.matches, 0)
+		for i, match := range matches {
+			match.Score = float64(i)
+		}
+		collector := NewTopNCollector(test.size, test.skip, sort)
+		dmi, err := collector.Collect(context.Background(), search.Aggregations{}, &stubSearcher{matches: matches})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := dmi.(*TopNIterator).Truncated(); got != test.truncated {
+			t.Errorf("%d matches, size %d, skip %d: expected truncated %t, got %t",
+				test.matches, test.size, test.skip, test.truncated, got)
+		}
+	}
+}
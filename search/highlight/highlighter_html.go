@@ -25,3 +25,13 @@ func NewHTMLHighlighterTags(before, after string) *SimpleHighlighter {
 	formatter := NewHTMLFragmentFormatterTags(before, after)
 	return NewSimpleHighlighter(fragmenter, formatter, DefaultSeparator)
 }
+
+// NewHTMLHighlighterSized highlights the matched terms with the tags in
+// fragments of about fragmentSize runes.  A field without term positions
+// has no locations to highlight, so its fragment is the start of the
+// value, with nothing highlighted.
+func NewHTMLHighlighterSized(fragmentSize int, before, after string) *SimpleHighlighter {
+	fragmenter := NewSimpleFragmenterSized(fragmentSize)
+	formatter := NewHTMLFragmentFormatterTags(before, after)
+	return NewSimpleHighlighter(fragmenter, formatter, DefaultSeparator)
+}
@@ -46,7 +46,7 @@ func (s *SimpleHighlighter) BestFragment(tlm search.TermLocationMap, orig []byte
 }
 
 func (s *SimpleHighlighter) BestFragments(tlm search.TermLocationMap, orig []byte, num int) []string {
-	orderedTermLocations := OrderTermLocations(tlm)
+	orderedTermLocations := OrderTermLocations(tlm).withOffsets()
 	scorer := NewFragmentScorer(tlm)
 
 	// score the fragments and put them into a priority queue ordered by score
@@ -59,6 +59,18 @@ func (t TermLocations) MergeOverlapping() {
 	}
 }
 
+// withOffsets removes the term locations without offsets,
+// as found in fields indexing term positions only
+func (t TermLocations) withOffsets() TermLocations {
+	rv := t[:0]
+	for _, tl := range t {
+		if tl.End > tl.Start {
+			rv = append(rv, tl)
+		}
+	}
+	return rv
+}
+
 func OrderTermLocations(tlm search.TermLocationMap) TermLocations {
 	rv := make(TermLocations, 0)
 	for term, locations := range tlm {
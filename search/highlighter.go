@@ -0,0 +1,56 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+// FragmentHighlighter produces the best fragments of a field value,
+// the highlighters in the highlight package implement it
+type FragmentHighlighter interface {
+	BestFragments(tlm TermLocationMap, orig []byte, num int) []string
+}
+
+// HighlightFunc highlights the stored value of the field,
+// returning at most num fragments
+type HighlightFunc func(h FragmentHighlighter, field string, num int) ([]string, error)
+
+// Highlighter returns a function which highlights the fields of this
+// match on demand, so only the matches displayed pay for loading
+// and highlighting their stored fields.  The term locations of the
+// match are captured now, the search must include locations, and the
+// function remains usable after the match is returned to the pool,
+// for as long as the reader the match came from is open.  Fields
+// indexed without term positions have no locations, so highlighters
+// return the start of their value with nothing highlighted.
+func (dm *DocumentMatch) Highlighter() HighlightFunc {
+	reader := dm.reader
+	number := dm.Number
+	locations := make(FieldTermLocationMap, len(dm.Locations))
+	for field, tlm := range dm.Locations {
+		locations[field] = tlm
+	}
+	return func(h FragmentHighlighter, field string, num int) ([]string, error) {
+		var value []byte
+		err := reader.VisitStoredFields(number, func(name string, val []byte) bool {
+			if name == field {
+				value = append(value[:0], val...)
+				return false
+			}
+			return true
+		})
+		if err != nil || value == nil {
+			return nil, err
+		}
+		return h.BestFragments(locations[field], value, num), nil
+	}
+}
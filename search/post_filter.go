@@ -0,0 +1,102 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+// PostFilter decides which of the documents matching the query are
+// returned as hits, it is applied by the collector once the document
+// values of the fields it needs have been loaded.
+type PostFilter interface {
+	Fields() []string
+	Accept(match *DocumentMatch) bool
+}
+
+type textPostFilter struct {
+	source TextValuesSource
+	filter func([]byte) bool
+}
+
+// TextPostFilter accepts the matches for which
+// any of the values of source pass the filter
+func TextPostFilter(source TextValuesSource, filter func([]byte) bool) PostFilter {
+	return &textPostFilter{
+		source: source,
+		filter: filter,
+	}
+}
+
+func (f *textPostFilter) Fields() []string {
+	return f.source.Fields()
+}
+
+func (f *textPostFilter) Accept(match *DocumentMatch) bool {
+	for _, val := range f.source.Values(match) {
+		if f.filter(val) {
+			return true
+		}
+	}
+	return false
+}
+
+type numericPostFilter struct {
+	source NumericValuesSource
+	filter func(float64) bool
+}
+
+// NumericPostFilter accepts the matches for which
+// any of the values of source pass the filter
+func NumericPostFilter(source NumericValuesSource, filter func(float64) bool) PostFilter {
+	return &numericPostFilter{
+		source: source,
+		filter: filter,
+	}
+}
+
+func (f *numericPostFilter) Fields() []string {
+	return f.source.Fields()
+}
+
+func (f *numericPostFilter) Accept(match *DocumentMatch) bool {
+	for _, val := range f.source.Numbers(match) {
+		if f.filter(val) {
+			return true
+		}
+	}
+	return false
+}
+
+type funcPostFilter struct {
+	fields []string
+	accept func(*DocumentMatch) bool
+}
+
+// FuncPostFilter accepts the matches for which accept returns true,
+// the document values of fields are loaded before it is called, so
+// it may read any of the values sources of those fields, such as to
+// reject the hits whose status is not active.  As accept may read the
+// score, the matches are always scored when it is used.
+func FuncPostFilter(fields []string, accept func(*DocumentMatch) bool) PostFilter {
+	return &funcPostFilter{
+		fields: fields,
+		accept: accept,
+	}
+}
+
+func (f *funcPostFilter) Fields() []string {
+	return f.fields
+}
+
+func (f *funcPostFilter) Accept(match *DocumentMatch) bool {
+	return f.accept(match)
+}
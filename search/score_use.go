@@ -0,0 +1,112 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+// ScoreUser is implemented by value sources, sort orders, aggregations
+// and post filters which know whether they read the score of a match
+type ScoreUser interface {
+	UsesScore() bool
+}
+
+// UsesScore reports whether v reads the score of the matches,
+// values which do not implement ScoreUser are assumed to use it
+func UsesScore(v interface{}) bool {
+	if su, ok := v.(ScoreUser); ok {
+		return su.UsesScore()
+	}
+	return true
+}
+
+func (n *ScoreSource) UsesScore() bool {
+	return true
+}
+
+func (n *QuantizedScoreSource) UsesScore() bool {
+	return true
+}
+
+func (f FieldSource) UsesScore() bool {
+	return false
+}
+
+func (f *MissingTextValueSource) UsesScore() bool {
+	return UsesScore(f.primary) || UsesScore(f.replacement)
+}
+
+func (f *MissingNumericSource) UsesScore() bool {
+	return UsesScore(f.primary) || UsesScore(f.replacement)
+}
+
+func (f *MissingDateSource) UsesScore() bool {
+	return UsesScore(f.primary) || UsesScore(f.replacement)
+}
+
+func (f *MissingGeoPointSource) UsesScore() bool {
+	return UsesScore(f.primary) || UsesScore(f.replacement)
+}
+
+func (f *FilteringTextSource) UsesScore() bool {
+	return UsesScore(f.source)
+}
+
+func (p PointDistanceSource) UsesScore() bool {
+	return UsesScore(p.a) || UsesScore(p.b)
+}
+
+func (s *ScriptSource) UsesScore() bool {
+	return false
+}
+
+func (p *ConstantGeoPointSource) UsesScore() bool {
+	return false
+}
+
+func (c ConstantTextValueSource) UsesScore() bool {
+	return false
+}
+
+func (c *sortFirstLast) UsesScore() bool {
+	return false
+}
+
+func (s *Sort) UsesScore() bool {
+	return UsesScore(s.source)
+}
+
+func (o SortOrder) UsesScore() bool {
+	for _, sort := range o {
+		if sort.UsesScore() {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Aggregations) UsesScore() bool {
+	for _, agg := range a {
+		if UsesScore(agg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *textPostFilter) UsesScore() bool {
+	return UsesScore(f.source)
+}
+
+func (f *numericPostFilter) UsesScore() bool {
+	return UsesScore(f.source)
+}
@@ -91,6 +91,14 @@ type DocumentMatch struct {
 	Locations   FieldTermLocationMap
 	SortValue   [][]byte
 
+	// InnerHits holds the other members of this hit's group,
+	// when results have been collapsed by a field
+	InnerHits DocumentMatchCollection
+	// CollapsedCount is the number of hits in this hit's
+	// group, when results have been collapsed by a field,
+	// see CollapsingCollector for when it undercounts
+	CollapsedCount int
+
 	docValues map[string][][]byte
 
 	// used to maintain natural index order
@@ -107,6 +115,11 @@ func (dm *DocumentMatch) SetReader(r MatchReader) {
 	dm.reader = r
 }
 
+// Reader returns the reader this match was found in
+func (dm *DocumentMatch) Reader() MatchReader {
+	return dm.reader
+}
+
 func (dm *DocumentMatch) addDocValue(name string, value []byte) {
 	if dm.docValues == nil {
 		dm.docValues = make(map[string][][]byte)
@@ -134,6 +147,18 @@ func (dm *DocumentMatch) VisitStoredFields(visitor segment.StoredFieldVisitor) e
 	return dm.reader.VisitStoredFields(dm.Number, visitor)
 }
 
+// SortCursor returns a copy of the sort key of this match, which can be
+// passed to NewTopNCollectorAfter (or Before) to continue the search
+// from this match.  It is a copy, so it remains valid after the match
+// has been reused.
+func (dm *DocumentMatch) SortCursor() [][]byte {
+	rv := make([][]byte, len(dm.SortValue))
+	for i, val := range dm.SortValue {
+		rv[i] = append([]byte(nil), val...)
+	}
+	return rv
+}
+
 // Reset allows an already allocated DocumentMatch to be reused
 func (dm *DocumentMatch) Reset() *DocumentMatch {
 	// remember the [][]byte used for sort
@@ -171,6 +196,10 @@ func (dm *DocumentMatch) Size() int {
 		sizeInBytes += sizeOfSlice + len(entry)
 	}
 
+	for _, entry := range dm.InnerHits {
+		sizeInBytes += entry.Size()
+	}
+
 	return sizeInBytes
 }
 
@@ -274,6 +303,9 @@ type SearcherOptions struct {
 type Context struct {
 	DocumentMatchPool *DocumentMatchPool
 	dvReaders         map[DocumentValueReadable]segment.DocumentValueReader
+
+	// Stats, when not nil, counts the work done by the search
+	Stats *SearchStats
 }
 
 func NewSearchContext(size, sortSize int) *Context {
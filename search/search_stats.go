@@ -0,0 +1,39 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+// SearchStats counts the work done by a search, which is useful to
+// verify the effect of optimizations in tests and benchmarks.  They
+// are only counted when set on the search Context, by the collector.
+type SearchStats struct {
+	// TermsVisited counts the terms whose postings were read
+	TermsVisited uint64
+	// DocsScored counts the term matches which were scored
+	DocsScored uint64
+	// HeapOperations counts the hits offered to the collector's store
+	HeapOperations uint64
+}
+
+// Reset zeroes the counters, so the stats may be reused by another search
+func (s *SearchStats) Reset() {
+	*s = SearchStats{}
+}
+
+// Add adds the counters of other to these
+func (s *SearchStats) Add(other *SearchStats) {
+	s.TermsVisited += other.TermsVisited
+	s.DocsScored += other.DocsScored
+	s.HeapOperations += other.HeapOperations
+}
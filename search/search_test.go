@@ -15,8 +15,13 @@
 package search
 
 import (
+	"math"
 	"reflect"
+	"sort"
 	"testing"
+
+	"github.com/blugelabs/bluge/numeric"
+	"github.com/blugelabs/bluge/numeric/geo"
 )
 
 func TestLocationsDedupe(t *testing.T) {
@@ -45,3 +50,249 @@ func TestLocationsDedupe(t *testing.T) {
 		}
 	}
 }
+
+type countingSource struct {
+	computed int
+}
+
+func (c *countingSource) Fields() []string {
+	return []string{"f"}
+}
+
+func (c *countingSource) Value(d *DocumentMatch) []byte {
+	c.computed++
+	return []byte{byte(d.Number)}
+}
+
+func TestSortValueCacheBound(t *testing.T) {
+	source := &countingSource{}
+	order := SortOrder{SortBy(source)}
+	cache := NewSortValueCache(2)
+	cached := cache.For(order)
+
+	compute := func(number uint64) SortValue {
+		d := &DocumentMatch{Number: number}
+		cached.Compute(d)
+		return d.SortValue
+	}
+
+	for _, number := range []uint64{1, 2, 1, 2} {
+		got := compute(number)
+		if !reflect.DeepEqual(got, SortValue{{byte(number)}}) {
+			t.Errorf("unexpected sort value %v for %d", got, number)
+		}
+	}
+	if source.computed != 2 {
+		t.Errorf("expected 2 computations, got %d", source.computed)
+	}
+
+	// adding a third value evicts the oldest
+	compute(3)
+	if cache.Len() != 2 {
+		t.Errorf("expected cache bounded to 2 values, got %d", cache.Len())
+	}
+	compute(1)
+	if source.computed != 4 {
+		t.Errorf("expected evicted value to be computed again, got %d computations", source.computed)
+	}
+
+	// a different sort order does not reuse the values
+	cache.For(SortOrder{SortBy(source).Desc()}).Compute(&DocumentMatch{Number: 1})
+	if source.computed != 5 {
+		t.Errorf("expected value computed for new sort order, got %d computations", source.computed)
+	}
+
+	// another source of the same field, such as a geo distance from
+	// another origin, does not reuse the values either
+	other := &countingSource{}
+	cache.For(SortOrder{SortBy(other).Desc()}).Compute(&DocumentMatch{Number: 1})
+	if other.computed != 1 {
+		t.Errorf("expected value computed for new source, got %d computations", other.computed)
+	}
+}
+
+func TestSortBuilderMissingValues(t *testing.T) {
+	newMatch := func(number uint64, values ...string) *DocumentMatch {
+		rv := &DocumentMatch{Number: number, HitNumber: int(number)}
+		for _, value := range values {
+			rv.addDocValue("a", []byte(value))
+		}
+		return rv
+	}
+
+	tests := []struct {
+		name   string
+		order  SortOrder
+		expect []uint64
+	}{
+		{
+			name:   "asc missing last",
+			order:  NewSortBuilder().Field("a").Asc().MissingLast().Build(),
+			expect: []uint64{2, 3, 1},
+		},
+		{
+			name:   "asc missing first",
+			order:  NewSortBuilder().Field("a").Asc().MissingFirst().Build(),
+			expect: []uint64{1, 2, 3},
+		},
+		{
+			name:   "desc missing last",
+			order:  NewSortBuilder().Field("a").Desc().MissingLast().Build(),
+			expect: []uint64{3, 2, 1},
+		},
+		{
+			name:   "desc missing first",
+			order:  NewSortBuilder().Field("a").Desc().MissingFirst().Build(),
+			expect: []uint64{1, 3, 2},
+		},
+	}
+
+	for _, test := range tests {
+		matches := []*DocumentMatch{
+			newMatch(1),
+			newMatch(2, "x"),
+			newMatch(3, "y"),
+		}
+		for _, match := range matches {
+			test.order.Compute(match)
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			return test.order.Compare(matches[i], matches[j]) < 0
+		})
+		var got []uint64
+		for _, match := range matches {
+			got = append(got, match.Number)
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("%s: expected order %v, got %v", test.name, test.expect, got)
+		}
+	}
+}
+
+func TestSortBuilderMultipleLevels(t *testing.T) {
+	builder := NewSortBuilder().Field("a").Asc().MissingLast().Field("b").Desc()
+	order := builder.Build()
+	// changes to the builder after building do not affect the order
+	builder.Asc().MissingFirst()
+
+	if len(order) != 2 {
+		t.Fatalf("expected 2 sort levels, got %d", len(order))
+	}
+	if order[0].desc || order[0].missingFirst {
+		t.Errorf("expected first level ascending with missing last")
+	}
+	if !order[1].desc || order[1].missingFirst {
+		t.Errorf("expected second level descending with missing last")
+	}
+	if !reflect.DeepEqual(order.Fields(), []string{"a", "b"}) {
+		t.Errorf("expected fields a and b, got %v", order.Fields())
+	}
+}
+
+func TestScriptSort(t *testing.T) {
+	number := func(val []byte) float64 {
+		i64, err := numeric.PrefixCoded(val).Int64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return numeric.Int64ToFloat64(i64)
+	}
+	script := NewScriptSort(func(values map[string][]byte) float64 {
+		a, ok := values["a"]
+		if !ok {
+			return math.NaN()
+		}
+		return number(a)*2 + number(values["b"])
+	}, []string{"a", "b"})
+	if !reflect.DeepEqual(script.Fields(), []string{"a", "b"}) {
+		t.Errorf("expected script sort to need fields a and b, got %v", script.Fields())
+	}
+
+	newMatch := func(number uint64, a, b float64) *DocumentMatch {
+		rv := &DocumentMatch{Number: number, HitNumber: int(number)}
+		rv.addDocValue("a", numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(a), 0))
+		rv.addDocValue("b", numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(b), 0))
+		return rv
+	}
+	sortMatches := func(order SortOrder) []uint64 {
+		// a*2+b is 7, 4, 9 and missing, unlike the order of a or b alone
+		matches := []*DocumentMatch{
+			newMatch(1, 1, 5),
+			newMatch(2, 2, 0),
+			newMatch(3, 3, 3),
+			{Number: 4, HitNumber: 4},
+		}
+		for _, match := range matches {
+			order.Compute(match)
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			return order.Compare(matches[i], matches[j]) < 0
+		})
+		var rv []uint64
+		for _, match := range matches {
+			rv = append(rv, match.Number)
+		}
+		return rv
+	}
+
+	got := sortMatches(SortOrder{script})
+	if !reflect.DeepEqual(got, []uint64{2, 1, 3, 4}) {
+		t.Errorf("expected script sort order [2 1 3 4], got %v", got)
+	}
+	for _, order := range []SortOrder{
+		{SortBy(Field("a"))},
+		{SortBy(Field("a")).Desc()},
+		{SortBy(Field("b"))},
+		{SortBy(Field("b")).Desc()},
+	} {
+		if reflect.DeepEqual(sortMatches(order), got) {
+			t.Errorf("expected script sort to differ from sorting by %v", order.Fields())
+		}
+	}
+}
+
+func TestGeoDistanceSort(t *testing.T) {
+	newMatch := func(number uint64, name string, lon float64) *DocumentMatch {
+		rv := &DocumentMatch{Number: number, HitNumber: int(number)}
+		rv.addDocValue("name", []byte(name))
+		if !math.IsNaN(lon) {
+			rv.addDocValue("geo", numeric.MustNewPrefixCodedInt64(int64(geo.MortonHash(lon, 0)), 0))
+		}
+		return rv
+	}
+	// points along the equator, about 1113m apart
+	matches := []*DocumentMatch{
+		newMatch(1, "a", 0.03),
+		newMatch(2, "a", 0.01),
+		newMatch(3, "a", math.NaN()),
+		newMatch(4, "b", 0.02),
+		newMatch(5, "a", 0.02),
+	}
+
+	// ties on distance fall through to the name
+	order := SortOrder{NewGeoDistanceSort("geo", 0, 0), SortBy(Field("name"))}
+	if !reflect.DeepEqual(order.Fields(), []string{"geo", "name"}) {
+		t.Errorf("expected fields geo and name, got %v", order.Fields())
+	}
+	for _, match := range matches {
+		order.Compute(match)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return order.Compare(matches[i], matches[j]) < 0
+	})
+	var got []uint64
+	for _, match := range matches {
+		got = append(got, match.Number)
+	}
+	if !reflect.DeepEqual(got, []uint64{2, 5, 4, 1, 3}) {
+		t.Errorf("expected order [2 5 4 1 3], got %v", got)
+	}
+
+	dist := NewGeoPointDistanceSource(Field("geo"), NewConstantGeoPointSource(geo.Point{}), geo.Meter)
+	if meters := dist.Number(matches[0]); math.Abs(meters-1113) > 5 {
+		t.Errorf("expected about 1113m, got %f", meters)
+	}
+	if meters := dist.Numbers(matches[4]); len(meters) != 0 {
+		t.Errorf("expected no distance for match without a point, got %v", meters)
+	}
+}
@@ -0,0 +1,117 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"github.com/blugelabs/bluge/search"
+)
+
+// BoostingSearcher returns the matches of the positive searcher,
+// multiplying the score of those also matched by the negative
+// searcher by the negative boost
+type BoostingSearcher struct {
+	positive      search.Searcher
+	negative      search.Searcher
+	negativeBoost float64
+	currNegative  *search.DocumentMatch
+	negativeDone  bool
+	options       search.SearcherOptions
+}
+
+func NewBoostingSearcher(positive, negative search.Searcher, negativeBoost float64,
+	options search.SearcherOptions) *BoostingSearcher {
+	return &BoostingSearcher{
+		positive:      positive,
+		negative:      negative,
+		negativeBoost: negativeBoost,
+		options:       options,
+	}
+}
+
+func (s *BoostingSearcher) Size() int {
+	sizeInBytes := reflectStaticSizeBoostingSearcher + sizeOfPtr +
+		s.positive.Size() + s.negative.Size()
+	if s.currNegative != nil {
+		sizeInBytes += s.currNegative.Size()
+	}
+	return sizeInBytes
+}
+
+func (s *BoostingSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error) {
+	next, err := s.positive.Next(ctx)
+	if err != nil || next == nil {
+		return nil, err
+	}
+	return s.demote(ctx, next)
+}
+
+func (s *BoostingSearcher) Advance(ctx *search.Context, number uint64) (*search.DocumentMatch, error) {
+	adv, err := s.positive.Advance(ctx, number)
+	if err != nil || adv == nil {
+		return nil, err
+	}
+	return s.demote(ctx, adv)
+}
+
+// demote applies the negative boost to the match if the
+// negative searcher matches it too, the matches of the
+// positive searcher are in order, so the negative searcher
+// is only ever advanced
+func (s *BoostingSearcher) demote(ctx *search.Context, d *search.DocumentMatch) (*search.DocumentMatch, error) {
+	if !s.negativeDone && (s.currNegative == nil || s.currNegative.Number < d.Number) {
+		if s.currNegative != nil {
+			ctx.DocumentMatchPool.Put(s.currNegative)
+		}
+		var err error
+		s.currNegative, err = s.negative.Advance(ctx, d.Number)
+		if err != nil {
+			return nil, err
+		}
+		s.negativeDone = s.currNegative == nil
+	}
+	if s.currNegative == nil || s.currNegative.Number != d.Number {
+		return d, nil
+	}
+
+	d.Score *= s.negativeBoost
+	if s.options.Explain && d.Explanation != nil {
+		d.Explanation = search.NewExplanation(d.Score,
+			"computed as negative boost * score",
+			search.NewExplanation(s.negativeBoost, "negative boost"),
+			d.Explanation)
+	}
+	return d, nil
+}
+
+func (s *BoostingSearcher) Close() error {
+	err := s.positive.Close()
+	err2 := s.negative.Close()
+	if err != nil {
+		return err
+	}
+	return err2
+}
+
+func (s *BoostingSearcher) Count() uint64 {
+	return s.positive.Count()
+}
+
+func (s *BoostingSearcher) Min() int {
+	return s.positive.Min()
+}
+
+func (s *BoostingSearcher) DocumentMatchPoolSize() int {
+	return s.positive.DocumentMatchPoolSize() + s.negative.DocumentMatchPoolSize() + 1
+}
@@ -0,0 +1,81 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"github.com/blugelabs/bluge/search"
+)
+
+// ConstantScoreSearcher wraps any other searcher, giving
+// every match it returns the same score
+type ConstantScoreSearcher struct {
+	child   search.Searcher
+	score   float64
+	options search.SearcherOptions
+}
+
+func NewConstantScoreSearcher(s search.Searcher, score float64,
+	options search.SearcherOptions) *ConstantScoreSearcher {
+	return &ConstantScoreSearcher{
+		child:   s,
+		score:   score,
+		options: options,
+	}
+}
+
+func (s *ConstantScoreSearcher) Size() int {
+	return reflectStaticSizeConstantScoreSearcher + sizeOfPtr +
+		s.child.Size()
+}
+
+func (s *ConstantScoreSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error) {
+	next, err := s.child.Next(ctx)
+	if err != nil || next == nil {
+		return nil, err
+	}
+	return s.scoreMatch(next), nil
+}
+
+func (s *ConstantScoreSearcher) Advance(ctx *search.Context, number uint64) (*search.DocumentMatch, error) {
+	adv, err := s.child.Advance(ctx, number)
+	if err != nil || adv == nil {
+		return nil, err
+	}
+	return s.scoreMatch(adv), nil
+}
+
+func (s *ConstantScoreSearcher) scoreMatch(d *search.DocumentMatch) *search.DocumentMatch {
+	d.Score = s.score
+	if s.options.Explain {
+		d.Explanation = search.NewExplanation(s.score, "constant")
+	}
+	return d
+}
+
+func (s *ConstantScoreSearcher) Close() error {
+	return s.child.Close()
+}
+
+func (s *ConstantScoreSearcher) Count() uint64 {
+	return s.child.Count()
+}
+
+func (s *ConstantScoreSearcher) Min() int {
+	return s.child.Min()
+}
+
+func (s *ConstantScoreSearcher) DocumentMatchPoolSize() int {
+	return s.child.DocumentMatchPoolSize()
+}
@@ -31,7 +31,8 @@ var DisjunctionMaxClauseCount = 0
 
 // DisjunctionHeapTakeover is a compile time setting that applications can
 // adjust to control when the DisjunctionSearcher will switch from a simple
-// slice implementation to a heap implementation.
+// slice implementation to a heap implementation, if the index allows the
+// "disjunction" optimization.
 var DisjunctionHeapTakeover = 10
 
 func NewDisjunctionSearcher(indexReader search.Reader,
@@ -60,7 +61,8 @@ func newDisjunctionSearcher(indexReader search.Reader,
 		}
 	}
 
-	if len(qsearchers) > DisjunctionHeapTakeover {
+	if len(qsearchers) > DisjunctionHeapTakeover &&
+		optimizeDisjunction(qsearchers) {
 		return newDisjunctionHeapSearcher(qsearchers, min, scorer, options,
 			limit)
 	}
@@ -100,6 +102,21 @@ func optimizeCompositeSearcher(optimizationKind string,
 		[]byte(optimizationKind), "*", 1.0, similarity.ConstantScorer(1), options)
 }
 
+// optimizeDisjunction reports whether the index of the searchers
+// allows their disjunction to be merged with a heap, searchers
+// which cannot be optimized leave the choice to the others
+func optimizeDisjunction(qsearchers []search.Searcher) bool {
+	for _, searcher := range qsearchers {
+		o, ok := searcher.(segment.Optimizable)
+		if !ok {
+			continue
+		}
+		octx, err := o.Optimize("disjunction", nil)
+		return err == nil && octx != nil
+	}
+	return true
+}
+
 func tooManyClauses(count int) bool {
 	if DisjunctionMaxClauseCount != 0 && count > DisjunctionMaxClauseCount {
 		return true
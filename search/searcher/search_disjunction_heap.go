@@ -15,8 +15,6 @@
 package searcher
 
 import (
-	"container/heap"
-
 	segment "github.com/blugelabs/bluge_segment_api"
 
 	"github.com/blugelabs/bluge/search"
@@ -95,7 +93,7 @@ func (s *DisjunctionHeapSearcher) initSearchers(ctx *search.Context) error {
 		if curr != nil {
 			block[i].searcher = searcher
 			block[i].curr = curr
-			heap.Push(s, &block[i])
+			s.push(&block[i])
 		}
 	}
 
@@ -113,13 +111,13 @@ func (s *DisjunctionHeapSearcher) updateMatches() error {
 
 	if len(s.heap) > 0 {
 		// top of the heap is our next hit
-		next := heap.Pop(s).(*searcherCurr)
+		next := s.pop()
 		matching = append(matching, next.curr)
 		matchingCurrs = append(matchingCurrs, next)
 
 		// now as long as top of heap matches, keep popping
 		for len(s.heap) > 0 && next.curr.Number == s.heap[0].curr.Number {
-			next = heap.Pop(s).(*searcherCurr)
+			next = s.pop()
 			matching = append(matching, next.curr)
 			matchingCurrs = append(matchingCurrs, next)
 		}
@@ -160,7 +158,7 @@ func (s *DisjunctionHeapSearcher) Next(ctx *search.Context) (
 			}
 			if curr != nil {
 				matchingCurr.curr = curr
-				heap.Push(s, matchingCurr)
+				s.push(matchingCurr)
 			}
 		}
 
@@ -184,7 +182,7 @@ func (s *DisjunctionHeapSearcher) Advance(ctx *search.Context,
 
 	// if there is anything in matching, toss it back onto the heap
 	for _, matchingCurr := range s.matchingCurrs {
-		heap.Push(s, matchingCurr)
+		s.push(matchingCurr)
 	}
 	s.matching = s.matching[:0]
 	s.matchingCurrs = s.matchingCurrs[:0]
@@ -192,7 +190,7 @@ func (s *DisjunctionHeapSearcher) Advance(ctx *search.Context,
 	// find all searchers that actually need to be advanced
 	// advance them, using s.matchingCurrs as temp storage
 	for len(s.heap) > 0 && docNumberCompare(s.heap[0].curr.Number, number) < 0 {
-		searcherCurr := heap.Pop(s).(*searcherCurr)
+		searcherCurr := s.pop()
 		ctx.DocumentMatchPool.Put(searcherCurr.curr)
 		curr, err := searcherCurr.searcher.Advance(ctx, number)
 		if err != nil {
@@ -205,7 +203,7 @@ func (s *DisjunctionHeapSearcher) Advance(ctx *search.Context,
 	}
 	// now all of the searchers that we advanced have to be pushed back
 	for _, matchingCurr := range s.matchingCurrs {
-		heap.Push(s, matchingCurr)
+		s.push(matchingCurr)
 	}
 	// reset our temp space
 	s.matchingCurrs = s.matchingCurrs[:0]
@@ -264,33 +262,60 @@ func (s *DisjunctionHeapSearcher) Optimize(kind string, octx segment.Optimizable
 	return nil, nil
 }
 
-// heap impl
-
-func (s *DisjunctionHeapSearcher) Len() int { return len(s.heap) }
+// heap impl, push and pop are used rather than container/heap,
+// avoiding its interface calls, which dominate the cost of merging
+// disjunctions of many clauses
 
-func (s *DisjunctionHeapSearcher) Less(i, j int) bool {
-	if s.heap[i].curr == nil {
-		return true
-	} else if s.heap[j].curr == nil {
-		return false
-	}
-	return docNumberCompare(s.heap[i].curr.Number, s.heap[j].curr.Number) < 0
+func (s *DisjunctionHeapSearcher) push(sc *searcherCurr) {
+	s.heap = append(s.heap, sc)
+	s.up(len(s.heap) - 1)
 }
 
-func (s *DisjunctionHeapSearcher) Swap(i, j int) {
-	s.heap[i], s.heap[j] = s.heap[j], s.heap[i]
+func (s *DisjunctionHeapSearcher) pop() *searcherCurr {
+	n := len(s.heap) - 1
+	rv := s.heap[0]
+	s.heap[0] = s.heap[n]
+	s.heap[n] = nil
+	s.heap = s.heap[:n]
+	if n > 0 {
+		s.down(0)
+	}
+	return rv
 }
 
-func (s *DisjunctionHeapSearcher) Push(x interface{}) {
-	s.heap = append(s.heap, x.(*searcherCurr))
+func (s *DisjunctionHeapSearcher) up(j int) {
+	h := s.heap
+	sc := h[j]
+	for j > 0 {
+		i := (j - 1) / 2
+		if h[i].curr.Number <= sc.curr.Number {
+			break
+		}
+		h[j] = h[i]
+		j = i
+	}
+	h[j] = sc
 }
 
-func (s *DisjunctionHeapSearcher) Pop() interface{} {
-	old := s.heap
-	n := len(old)
-	x := old[n-1]
-	s.heap = old[0 : n-1]
-	return x
+func (s *DisjunctionHeapSearcher) down(i int) {
+	h := s.heap
+	n := len(h)
+	sc := h[i]
+	for {
+		j := 2*i + 1
+		if j >= n {
+			break
+		}
+		if j+1 < n && h[j+1].curr.Number < h[j].curr.Number {
+			j++
+		}
+		if sc.curr.Number <= h[j].curr.Number {
+			break
+		}
+		h[i] = h[j]
+		i = j
+	}
+	h[i] = sc
 }
 
 func (s *DisjunctionHeapSearcher) buildDocumentMatch(constituents []*search.DocumentMatch) *search.DocumentMatch {
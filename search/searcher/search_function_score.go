@@ -0,0 +1,123 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package searcher
+
+import (
+	"github.com/blugelabs/bluge/search"
+	segment "github.com/blugelabs/bluge_segment_api"
+)
+
+// ScoreFunc computes the new score of a match from its score and
+// the document values of the fields, the values are only valid
+// for the duration of the call
+type ScoreFunc func(score float64, values map[string][][]byte) float64
+
+// FunctionScoreSearcher wraps any other searcher, replacing the
+// score of every match with that computed by the ScoreFunc
+type FunctionScoreSearcher struct {
+	child  search.Searcher
+	fields []string
+	fn     ScoreFunc
+
+	// the document values are read separately from those
+	// of the collector, which may need other fields
+	dvSource search.DocumentValueReadable
+	dvReader segment.DocumentValueReader
+	values   map[string][][]byte
+
+	options search.SearcherOptions
+}
+
+func NewFunctionScoreSearcher(s search.Searcher, fields []string, fn ScoreFunc,
+	options search.SearcherOptions) *FunctionScoreSearcher {
+	return &FunctionScoreSearcher{
+		child:   s,
+		fields:  fields,
+		fn:      fn,
+		values:  make(map[string][][]byte, len(fields)),
+		options: options,
+	}
+}
+
+func (s *FunctionScoreSearcher) Size() int {
+	return reflectStaticSizeFunctionScoreSearcher + sizeOfPtr +
+		s.child.Size()
+}
+
+func (s *FunctionScoreSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error) {
+	next, err := s.child.Next(ctx)
+	if err != nil || next == nil {
+		return nil, err
+	}
+	return s.scoreMatch(next)
+}
+
+func (s *FunctionScoreSearcher) Advance(ctx *search.Context, number uint64) (*search.DocumentMatch, error) {
+	adv, err := s.child.Advance(ctx, number)
+	if err != nil || adv == nil {
+		return nil, err
+	}
+	return s.scoreMatch(adv)
+}
+
+func (s *FunctionScoreSearcher) loadValues(d *search.DocumentMatch) error {
+	for field, vals := range s.values {
+		s.values[field] = vals[:0]
+	}
+	reader := d.Reader()
+	if reader == nil || len(s.fields) == 0 {
+		return nil
+	}
+	if reader != s.dvSource {
+		dvReader, err := reader.DocumentValueReader(s.fields)
+		if err != nil {
+			return err
+		}
+		s.dvSource = reader
+		s.dvReader = dvReader
+	}
+	return s.dvReader.VisitDocumentValues(d.Number, func(field string, term []byte) {
+		s.values[field] = append(s.values[field], term)
+	})
+}
+
+func (s *FunctionScoreSearcher) scoreMatch(d *search.DocumentMatch) (*search.DocumentMatch, error) {
+	err := s.loadValues(d)
+	if err != nil {
+		return nil, err
+	}
+	score := s.fn(d.Score, s.values)
+	if s.options.Explain {
+		d.Explanation = search.NewExplanation(score, "function of:", d.Explanation)
+	}
+	d.Score = score
+	return d, nil
+}
+
+func (s *FunctionScoreSearcher) Close() error {
+	return s.child.Close()
+}
+
+func (s *FunctionScoreSearcher) Count() uint64 {
+	return s.child.Count()
+}
+
+func (s *FunctionScoreSearcher) Min() int {
+	return s.child.Min()
+}
+
+func (s *FunctionScoreSearcher) DocumentMatchPoolSize() int {
+	return s.child.DocumentMatchPoolSize()
+}
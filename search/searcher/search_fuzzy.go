@@ -45,12 +45,9 @@ var MaxFuzziness = 2
 func NewFuzzySearcher(indexReader search.Reader, term string,
 	prefix, fuzziness int, field string, boost float64, scorer search.Scorer,
 	compScorer search.CompositeScorer, options search.SearcherOptions) (search.Searcher, error) {
-	if fuzziness > MaxFuzziness {
-		return nil, fmt.Errorf("fuzziness exceeds max (%d)", MaxFuzziness)
-	}
-
-	if fuzziness < 0 {
-		return nil, fmt.Errorf("invalid fuzziness, negative")
+	err := validateFuzziness(fuzziness)
+	if err != nil {
+		return nil, err
 	}
 
 	// Note: we don't byte slice the term for a prefix because of runes.
@@ -72,8 +69,38 @@ func NewFuzzySearcher(indexReader search.Reader, term string,
 		boost, scorer, compScorer, options, true)
 }
 
+func validateFuzziness(fuzziness int) error {
+	if fuzziness > MaxFuzziness {
+		return fmt.Errorf("fuzziness exceeds max (%d)", MaxFuzziness)
+	}
+	if fuzziness < 0 {
+		return fmt.Errorf("invalid fuzziness, negative")
+	}
+	return nil
+}
+
+// FuzzyTerms returns the terms of the field within fuzziness edits of
+// term, in order, where an edit inserts, deletes or substitutes a rune,
+// or transposes two adjacent runes.  The terms are found by intersecting
+// a Levenshtein automaton with the term dictionary, rather than by
+// comparing term with every term of the field.  The fuzziness may be at
+// most MaxFuzziness, and the length of term is not limited, though the
+// shorter it is the more terms are within the fuzziness of it.
+func FuzzyTerms(indexReader search.Reader, term string, fuzziness int, field string) ([]string, error) {
+	err := validateFuzziness(fuzziness)
+	if err != nil {
+		return nil, err
+	}
+	terms, _, err := findFuzzyCandidateTerms(indexReader, term, fuzziness, field, "")
+	return terms, err
+}
+
 func findFuzzyCandidateTerms(indexReader search.Reader, term string,
 	fuzziness int, field, prefixTerm string) (terms []string, boosts []float64, err error) {
+	if fuzziness == 0 {
+		// without edits, only the term itself can match
+		return findExactCandidateTerm(indexReader, term, field)
+	}
 	automatons, err := getLevAutomatons(term, fuzziness)
 	if err != nil {
 		return nil, nil, err
@@ -114,13 +141,25 @@ func findFuzzyCandidateTerms(indexReader search.Reader, term string,
 	return terms, boosts, err
 }
 
-func boostFromDistance(fuzziness int, automatons []segment.Automaton, dictTerm string, searchTermLen int) float64 {
-	termEditDistance := fuzziness // start assuming it is fuzziness of automaton that found it
-	for i := 1; i < len(automatons); i++ {
-		if vellum.AutomatonContains(automatons[i], []byte(dictTerm)) {
-			termEditDistance--
+func findExactCandidateTerm(indexReader search.Reader, term, field string) (terms []string, boosts []float64, err error) {
+	fieldDict, err := indexReader.DictionaryLookup(field)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if cerr := fieldDict.Close(); cerr != nil && err == nil {
+			err = cerr
 		}
+	}()
+	found, err := fieldDict.Contains([]byte(term))
+	if err != nil || !found {
+		return nil, nil, err
 	}
+	return []string{term}, []float64{1.0}, nil
+}
+
+func boostFromDistance(fuzziness int, automatons []segment.Automaton, dictTerm string, searchTermLen int) float64 {
+	termEditDistance := fuzzyEditDistance(fuzziness, automatons, dictTerm)
 	minTermLen := searchTermLen
 	thisTermLen := utf8.RuneCountInString(dictTerm)
 	if thisTermLen < minTermLen {
@@ -129,6 +168,41 @@ func boostFromDistance(fuzziness int, automatons []segment.Automaton, dictTerm s
 	return 1.0 - (float64(termEditDistance) / float64(minTermLen))
 }
 
+// fuzzyEditDistance returns the number of edits of a term accepted by the
+// first of the automatons, which accept terms within fuzziness down
+// to 1 edits, without counting the edits between them
+func fuzzyEditDistance(fuzziness int, automatons []segment.Automaton, dictTerm string) int {
+	termEditDistance := fuzziness // start assuming it is fuzziness of automaton that found it
+	for i := 1; i < len(automatons); i++ {
+		if vellum.AutomatonContains(automatons[i], []byte(dictTerm)) {
+			termEditDistance--
+		}
+	}
+	return termEditDistance
+}
+
+// FuzzyAutomaton returns an automaton accepting the terms within
+// fuzziness edits of term, for iterating a dictionary, and a function
+// returning the number of edits of a term other than term it accepts.
+// The fuzziness must be between 1 and MaxFuzziness.
+func FuzzyAutomaton(term string, fuzziness int) (segment.Automaton, func(string) int, error) {
+	err := validateFuzziness(fuzziness)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fuzziness == 0 {
+		return nil, nil, fmt.Errorf("invalid fuzziness, zero")
+	}
+	automatons, err := getLevAutomatons(term, fuzziness)
+	if err != nil {
+		return nil, nil, err
+	}
+	edits := func(dictTerm string) int {
+		return fuzzyEditDistance(fuzziness, automatons, dictTerm)
+	}
+	return automatons[0], edits, nil
+}
+
 func getLevAutomaton(term string, fuzziness int) (segment.Automaton, error) {
 	if levAutomatonBuilder, ok := levAutomatonBuilders[fuzziness]; ok {
 		return levAutomatonBuilder.BuildDfa(term, uint8(fuzziness))
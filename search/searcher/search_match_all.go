@@ -104,7 +104,7 @@ func (s *MatchAllSearcher) buildDocumentMatch(ctx *search.Context, termMatch seg
 	if s.options.Explain {
 		rv.Explanation = s.scorer.Explain(termMatch.Frequency(), termMatch.Norm())
 		rv.Score = rv.Explanation.Value
-	} else {
+	} else if s.options.Score != optionScoringNone {
 		rv.Score = s.scorer.Score(termMatch.Frequency(), termMatch.Norm())
 	}
 
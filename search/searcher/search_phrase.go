@@ -15,6 +15,7 @@
 package searcher
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/blugelabs/bluge/search/similarity"
@@ -63,12 +64,26 @@ func NewMultiPhraseSearcher(indexReader search.Reader, terms [][]string, field s
 // the value of the slop parameter restricts the distance between the terms
 func NewSloppyMultiPhraseSearcher(indexReader search.Reader, terms [][]string, field string, slop int,
 	scorer search.Scorer, options search.SearcherOptions) (*PhraseSearcher, error) {
+	return NewBoostedSloppyMultiPhraseSearcher(indexReader, terms, field, slop, nil, scorer, options)
+}
+
+// NewBoostedSloppyMultiPhraseSearcher creates a sloppy multi-phrase searcher
+// where each term contributes to the score of a match according to its boost
+// in termBoosts, terms without a boost have a boost of 1.0
+func NewBoostedSloppyMultiPhraseSearcher(indexReader search.Reader, terms [][]string, field string, slop int,
+	termBoosts map[string]float64, scorer search.Scorer, options search.SearcherOptions) (*PhraseSearcher, error) {
+	termBoost := func(term string) float64 {
+		if b, ok := termBoosts[term]; ok {
+			return b
+		}
+		return 1.0
+	}
 	options.IncludeTermVectors = true
 	var termPositionSearchers []search.Searcher
 	for _, termPos := range terms {
 		if len(termPos) == 1 && termPos[0] != "" {
 			// single term
-			ts, err := NewTermSearcher(indexReader, termPos[0], field, 1.0, scorer, options)
+			ts, err := NewTermSearcher(indexReader, termPos[0], field, termBoost(termPos[0]), scorer, options)
 			if err != nil {
 				// close any searchers already opened
 				for _, ts := range termPositionSearchers {
@@ -84,7 +99,7 @@ func NewSloppyMultiPhraseSearcher(indexReader search.Reader, terms [][]string, f
 				if term == "" {
 					continue
 				}
-				ts, err := NewTermSearcher(indexReader, term, field, 1.0, scorer, options)
+				ts, err := NewTermSearcher(indexReader, term, field, termBoost(term), scorer, options)
 				if err != nil {
 					// close any searchers already opened
 					for _, ts := range termPositionSearchers {
@@ -138,6 +153,11 @@ func (s *PhraseSearcher) initSearchers(ctx *search.Context) error {
 	return nil
 }
 
+// ErrNoTermPositions is returned when a phrase is searched for in a
+// field indexed without term positions, such as with TermOffsetsOnly,
+// whose terms cannot be checked for adjacency
+var ErrNoTermPositions = errors.New("field indexed without term positions")
+
 func (s *PhraseSearcher) advanceNextMust(ctx *search.Context) error {
 	var err error
 
@@ -164,10 +184,13 @@ func (s *PhraseSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error
 
 	for s.currMust != nil {
 		// check this match against phrase constraints
-		rv := s.checkCurrMustMatch()
+		rv, err := s.checkCurrMustMatch()
+		if err != nil {
+			return nil, err
+		}
 
 		// prepare for next iteration (either loop or subsequent call to Next())
-		err := s.advanceNextMust(ctx)
+		err = s.advanceNextMust(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -185,7 +208,7 @@ func (s *PhraseSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error
 // pointed to by s.currMust (which satisifies the pre-condition searcher)
 // also satisfies the phase constraints.  if so, it returns a DocumentMatch
 // for this document, otherwise nil
-func (s *PhraseSearcher) checkCurrMustMatch() *search.DocumentMatch {
+func (s *PhraseSearcher) checkCurrMustMatch() (*search.DocumentMatch, error) {
 	s.locations = s.currMust.Complete(s.locations)
 
 	locations := s.currMust.Locations
@@ -198,6 +221,9 @@ func (s *PhraseSearcher) checkCurrMustMatch() *search.DocumentMatch {
 	// but, we note that phrase constraints can only be satisfied within
 	// a single field, so we can check them each independently
 	for field, tlm := range locations {
+		if len(s.terms) > 1 && !hasPositions(tlm) {
+			return nil, fmt.Errorf("phrase search of field %s: %w", field, ErrNoTermPositions)
+		}
 		ftls = s.checkCurrMustMatchField(field, tlm, ftls)
 	}
 
@@ -206,10 +232,23 @@ func (s *PhraseSearcher) checkCurrMustMatch() *search.DocumentMatch {
 		rv := s.currMust
 		s.currMust = nil
 		rv.FieldTermLocations = ftls
-		return rv
+		return rv, nil
 	}
 
-	return nil
+	return nil, nil
+}
+
+// hasPositions reports whether the locations record term positions,
+// positions start at 1, so a location at 0 was indexed without them
+func hasPositions(tlm search.TermLocationMap) bool {
+	for _, locations := range tlm {
+		for _, location := range locations {
+			if location.Pos == 0 {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 // checkCurrMustMatchField is solely concerned with determining if one
@@ -15,6 +15,7 @@
 package searcher
 
 import (
+	"fmt"
 	"regexp/syntax"
 
 	"github.com/blevesearch/vellum/regexp"
@@ -28,7 +29,7 @@ func NewRegexpStringSearcher(indexReader search.Reader, pattern, field string,
 	options search.SearcherOptions) (search.Searcher, error) {
 	a, prefixBeg, prefixEnd, err := parseRegexp(pattern)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid regexp %q: %w", pattern, err)
 	}
 
 	fieldDict, err := indexReader.DictionaryIterator(field, a, prefixBeg, prefixEnd)
@@ -56,6 +57,16 @@ func NewRegexpStringSearcher(indexReader search.Reader, pattern, field string,
 		compScorer, options, true)
 }
 
+// ValidateRegexp returns the error which searching for the pattern would,
+// if it cannot be compiled to an automaton to match terms against
+func ValidateRegexp(pattern string) error {
+	_, _, _, err := parseRegexp(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid regexp %q: %w", pattern, err)
+	}
+	return nil
+}
+
 func parseRegexp(pattern string) (a *regexp.Regexp, prefixBeg, prefixEnd []byte, err error) {
 	// TODO: potential optimization where syntax.Regexp supports a Simplify() API?
 
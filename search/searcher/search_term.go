@@ -25,6 +25,7 @@ type TermSearcher struct {
 	options     search.SearcherOptions
 	scorer      search.Scorer
 	queryTerm   string
+	visited     bool
 }
 
 func NewTermSearcher(indexReader search.Reader, term, field string, boost float64, scorer search.Scorer,
@@ -34,7 +35,7 @@ func NewTermSearcher(indexReader search.Reader, term, field string, boost float6
 
 func NewTermSearcherBytes(indexReader search.Reader, term []byte, field string, boost float64, scorer search.Scorer,
 	options search.SearcherOptions) (*TermSearcher, error) {
-	needFreqNorm := options.Score != "none"
+	needFreqNorm := options.Score != optionScoringNone
 	reader, err := indexReader.PostingsIterator(term, field, needFreqNorm, needFreqNorm, options.IncludeTermVectors)
 	if err != nil {
 		return nil, err
@@ -77,6 +78,7 @@ func (s *TermSearcher) Count() uint64 {
 }
 
 func (s *TermSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error) {
+	s.countVisit(ctx)
 	termMatch, err := s.reader.Next()
 	if err != nil {
 		return nil, err
@@ -94,6 +96,7 @@ func (s *TermSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error)
 }
 
 func (s *TermSearcher) Advance(ctx *search.Context, number uint64) (*search.DocumentMatch, error) {
+	s.countVisit(ctx)
 	termMatch, err := s.reader.Advance(number)
 	if err != nil {
 		return nil, err
@@ -110,6 +113,14 @@ func (s *TermSearcher) Advance(ctx *search.Context, number uint64) (*search.Docu
 	return docMatch, nil
 }
 
+// countVisit counts the term as visited the first time its postings are read
+func (s *TermSearcher) countVisit(ctx *search.Context) {
+	if ctx.Stats != nil && !s.visited {
+		s.visited = true
+		ctx.Stats.TermsVisited++
+	}
+}
+
 func (s *TermSearcher) Close() error {
 	return s.reader.Close()
 }
@@ -140,9 +151,12 @@ func (s *TermSearcher) buildDocumentMatch(ctx *search.Context, termMatch segment
 	if s.options.Explain {
 		rv.Explanation = s.scorer.Explain(termMatch.Frequency(), termMatch.Norm())
 		rv.Score = rv.Explanation.Value
-	} else {
+	} else if s.options.Score != optionScoringNone {
 		rv.Score = s.scorer.Score(termMatch.Frequency(), termMatch.Norm())
 	}
+	if ctx.Stats != nil && (s.options.Explain || s.options.Score != optionScoringNone) {
+		ctx.Stats.DocsScored++
+	}
 
 	if len(termMatch.Locations()) > 0 {
 		if cap(rv.FieldTermLocations) < len(termMatch.Locations()) {
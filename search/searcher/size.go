@@ -30,8 +30,12 @@ func init() {
 
 	var bs BooleanSearcher
 	reflectStaticSizeBooleanSearcher = int(reflect.TypeOf(bs).Size())
+	var bos BoostingSearcher
+	reflectStaticSizeBoostingSearcher = int(reflect.TypeOf(bos).Size())
 	var cs ConjunctionSearcher
 	reflectStaticSizeConjunctionSearcher = int(reflect.TypeOf(cs).Size())
+	var css ConstantScoreSearcher
+	reflectStaticSizeConstantScoreSearcher = int(reflect.TypeOf(css).Size())
 	var dhs DisjunctionHeapSearcher
 	reflectStaticSizeDisjunctionHeapSearcher = int(reflect.TypeOf(dhs).Size())
 	var sc searcherCurr
@@ -40,6 +44,8 @@ func init() {
 	reflectStaticSizeDisjunctionSliceSearcher = int(reflect.TypeOf(ds).Size())
 	var fs FilteringSearcher
 	reflectStaticSizeFilteringSearcher = int(reflect.TypeOf(fs).Size())
+	var fss FunctionScoreSearcher
+	reflectStaticSizeFunctionScoreSearcher = int(reflect.TypeOf(fss).Size())
 	var mas MatchAllSearcher
 	reflectStaticSizeMatchAllSearcher = int(reflect.TypeOf(mas).Size())
 	var mns MatchNoneSearcher
@@ -56,11 +62,14 @@ var sizeOfSlice int
 var sizeOfString int
 
 var reflectStaticSizeBooleanSearcher int
+var reflectStaticSizeBoostingSearcher int
 var reflectStaticSizeConjunctionSearcher int
+var reflectStaticSizeConstantScoreSearcher int
 var reflectStaticSizeDisjunctionHeapSearcher int
 var reflectStaticSizeSearcherCurr int
 var reflectStaticSizeDisjunctionSliceSearcher int
 var reflectStaticSizeFilteringSearcher int
+var reflectStaticSizeFunctionScoreSearcher int
 var reflectStaticSizeMatchAllSearcher int
 var reflectStaticSizeMatchNoneSearcher int
 var reflectStaticSizePhraseSearcher int
@@ -14,7 +14,29 @@
 
 package similarity
 
-import "github.com/blugelabs/bluge/search"
+import (
+	"math"
+
+	segment "github.com/blugelabs/bluge_segment_api"
+
+	"github.com/blugelabs/bluge/search"
+)
+
+// ConstantSimilarity scores every match of a term the same, times
+// the boost of the query, regardless of how often the term occurs, in
+// how many documents, or the length of the field, such as for fields
+// which are only filtered on
+type ConstantSimilarity float64
+
+// ComputeNorm records the length of the field, as BM25 does, though
+// it is not used, so the similarity may be changed later
+func (c ConstantSimilarity) ComputeNorm(numTerms int) float32 {
+	return math.Float32frombits(uint32(numTerms))
+}
+
+func (c ConstantSimilarity) Scorer(boost float64, _ segment.CollectionStats, _ segment.TermStats) search.Scorer {
+	return ConstantScorer(boost * float64(c))
+}
 
 type ConstantScorer float64
 
@@ -17,6 +17,9 @@ package search
 import (
 	"bytes"
 	"strings"
+
+	"github.com/blugelabs/bluge/numeric"
+	"github.com/blugelabs/bluge/numeric/geo"
 )
 
 type SortOrder []*Sort
@@ -41,6 +44,19 @@ func (o SortOrder) Reverse() {
 	}
 }
 
+// Reversed returns a copy of the sort order, with the direction of each
+// sort, and the placement of missing values, reversed.  Unlike Reverse,
+// the original sort order is left unchanged.
+func (o SortOrder) Reversed() SortOrder {
+	rv := make(SortOrder, len(o))
+	for i, oi := range o {
+		rv[i] = SortBy(oi.by)
+		rv[i].desc = !oi.desc
+		rv[i].missingFirst = !oi.missingFirst
+	}
+	return rv
+}
+
 func (o SortOrder) Compute(match *DocumentMatch) {
 	for _, sort := range o {
 		sortVal := sort.Value(match)
@@ -75,16 +91,40 @@ func (o SortOrder) Compare(i, j *DocumentMatch) int {
 	return -1
 }
 
+// SortValue holds the values a match is sorted by, one for each level
+// of the sort order.  The values are compared as bytes, so a field with
+// numbers for some documents and text for others sorts the numbers,
+// whose encoding starts with a space, before most text.
 type SortValue [][]byte
 
+// NumericSortValue encodes the number as it is sorted by numeric fields
+// and scores, for building a sort cursor to pass to After or Before, the
+// other levels of a cursor are the text values of the fields sorted on
+func NumericSortValue(val float64) []byte {
+	return numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(val), 0)
+}
+
+// SortValueNumber decodes a sort value of a numeric field or score,
+// as returned in the SortValue or SortCursor of a DocumentMatch
+func SortValueNumber(val []byte) (float64, error) {
+	i64, err := numeric.PrefixCoded(val).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return numeric.Int64ToFloat64(i64), nil
+}
+
 type Sort struct {
+	by           TextValueSource
 	source       TextValueSource
 	desc         bool
 	missingFirst bool
 }
 
 func SortBy(source TextValueSource) *Sort {
-	rv := &Sort{}
+	rv := &Sort{
+		by: source,
+	}
 
 	rv.source = MissingTextValue(source, &sortFirstLast{
 		desc:  &rv.desc,
@@ -94,6 +134,21 @@ func SortBy(source TextValueSource) *Sort {
 	return rv
 }
 
+// NewScriptSort sorts by the number fn computes from the values
+// of the fields, see NewScriptSource
+func NewScriptSort(fn func(values map[string][]byte) float64, fields []string) *Sort {
+	return SortBy(NewScriptSource(fn, fields))
+}
+
+// NewGeoDistanceSort sorts by the distance in meters of the geo point
+// field from the point lon, lat, nearest first, matches without a point
+// are sorted last.  Use NewGeoPointDistanceSource with SortBy to have
+// the sort values in another unit.
+func NewGeoDistanceSort(field string, lon, lat float64) *Sort {
+	return SortBy(NewGeoPointDistanceSource(Field(field),
+		NewConstantGeoPointSource(geo.Point{Lon: lon, Lat: lat}), geo.Meter))
+}
+
 func (s *Sort) Desc() *Sort {
 	s.desc = true
 	return s
@@ -104,6 +159,13 @@ func (s *Sort) MissingFirst() *Sort {
 	return s
 }
 
+// MissingLast places matches without a value after all others,
+// whatever the direction of the sort, which is the default
+func (s *Sort) MissingLast() *Sort {
+	s.missingFirst = false
+	return s
+}
+
 func (s *Sort) Fields() []string {
 	return s.source.Fields()
 }
@@ -138,6 +200,76 @@ func ParseSortOrderStrings(in []string) SortOrder {
 	return rv
 }
 
+// SortBuilder builds a SortOrder of several levels fluently, the
+// direction and missing value methods apply to the most recently
+// added level, for example:
+//
+//	NewSortBuilder().Field("a").MissingFirst().Field("b").Desc().Build()
+//
+// sorts by a ascending, with matches missing a first, then by b
+// descending, with matches missing b last.
+type SortBuilder struct {
+	order SortOrder
+}
+
+func NewSortBuilder() *SortBuilder {
+	return &SortBuilder{}
+}
+
+// By adds a level sorting by the source, ascending with missing values last
+func (b *SortBuilder) By(source TextValueSource) *SortBuilder {
+	b.order = append(b.order, SortBy(source))
+	return b
+}
+
+// Field adds a level sorting by the field, ascending with missing values last
+func (b *SortBuilder) Field(field string) *SortBuilder {
+	return b.By(Field(field))
+}
+
+// Score adds a level sorting by score, descending
+func (b *SortBuilder) Score() *SortBuilder {
+	return b.By(DocumentScore()).Desc()
+}
+
+func (b *SortBuilder) last() *Sort {
+	if len(b.order) == 0 {
+		return &Sort{}
+	}
+	return b.order[len(b.order)-1]
+}
+
+func (b *SortBuilder) Asc() *SortBuilder {
+	b.last().desc = false
+	return b
+}
+
+func (b *SortBuilder) Desc() *SortBuilder {
+	b.last().Desc()
+	return b
+}
+
+func (b *SortBuilder) MissingFirst() *SortBuilder {
+	b.last().MissingFirst()
+	return b
+}
+
+func (b *SortBuilder) MissingLast() *SortBuilder {
+	b.last().MissingLast()
+	return b
+}
+
+// Build returns the sort order, later calls to the builder do not change it
+func (b *SortBuilder) Build() SortOrder {
+	rv := make(SortOrder, len(b.order))
+	for i, oi := range b.order {
+		rv[i] = SortBy(oi.by)
+		rv[i].desc = oi.desc
+		rv[i].missingFirst = oi.missingFirst
+	}
+	return rv
+}
+
 var highTerm = bytes.Repeat([]byte{0xff}, 10)
 var lowTerm = []byte{0x00}
 
@@ -0,0 +1,146 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package search
+
+import (
+	"reflect"
+	"sync"
+)
+
+// SortValueCache remembers the sort values computed for each
+// document, so that successive pages of a paginated search can
+// reuse them instead of computing them again, which is useful
+// for expensive sorts such as geo distance.
+//
+// Values are keyed by document number, document numbers are only
+// meaningful within a single reader, so a cache must only be shared
+// by the pages of the same search, against the same reader.
+// The cache holds the values of a single sort order, a search
+// sorting in another way, or by other sources, discards them.
+// When the cache holds size values, the oldest is evicted.
+type SortValueCache struct {
+	m          sync.Mutex
+	size       int
+	sort       SortOrder
+	generation int
+	values     map[uint64]SortValue
+	order      []uint64
+}
+
+// NewSortValueCache returns a cache holding at most size sort values
+func NewSortValueCache(size int) *SortValueCache {
+	return &SortValueCache{
+		size:   size,
+		values: make(map[uint64]SortValue),
+	}
+}
+
+// CachedSortOrder computes the sort values of a sort order
+// using a SortValueCache, see SortValueCache.For
+type CachedSortOrder struct {
+	cache      *SortValueCache
+	sort       SortOrder
+	generation int
+}
+
+// For returns the sort order computing its values with the cache,
+// a search calls it once, before computing any sort values.
+// If the cache holds the values of another sort order, they are
+// discarded.
+func (c *SortValueCache) For(o SortOrder) *CachedSortOrder {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.generation == 0 || !o.sameSources(c.sort) {
+		c.sort = o
+		c.generation++
+		c.values = make(map[uint64]SortValue)
+		c.order = nil
+	}
+	return &CachedSortOrder{
+		cache:      c,
+		sort:       o,
+		generation: c.generation,
+	}
+}
+
+// Compute sets the sort value of the match, like SortOrder.Compute,
+// using the cached value if the match has been seen before
+func (s *CachedSortOrder) Compute(match *DocumentMatch) {
+	c := s.cache
+	var values SortValue
+	var ok bool
+	c.m.Lock()
+	if c.generation == s.generation {
+		values, ok = c.values[match.Number]
+	}
+	c.m.Unlock()
+	if ok {
+		match.SortValue = append(match.SortValue, values...)
+		return
+	}
+
+	start := len(match.SortValue)
+	s.sort.Compute(match)
+	if c.size <= 0 {
+		return
+	}
+	values = make(SortValue, len(match.SortValue)-start)
+	copy(values, match.SortValue[start:])
+
+	c.m.Lock()
+	if c.generation == s.generation {
+		if _, ok := c.values[match.Number]; !ok {
+			if len(c.order) >= c.size {
+				delete(c.values, c.order[0])
+				c.order = c.order[1:]
+			}
+			c.values[match.Number] = values
+			c.order = append(c.order, match.Number)
+		}
+	}
+	c.m.Unlock()
+}
+
+// Len returns the number of sort values in the cache
+func (c *SortValueCache) Len() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return len(c.values)
+}
+
+// sameSources reports whether the orders sort by the same sources,
+// with the same direction and missing placement, sources such as
+// FieldSource are compared by value, others by identity
+func (o SortOrder) sameSources(other SortOrder) bool {
+	if len(o) != len(other) {
+		return false
+	}
+	for i := range o {
+		if o[i].desc != other[i].desc ||
+			o[i].missingFirst != other[i].missingFirst ||
+			!sameSource(o[i].by, other[i].by) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameSource(a, b TextValueSource) bool {
+	t := reflect.TypeOf(a)
+	if t == nil || t != reflect.TypeOf(b) || !t.Comparable() {
+		return false
+	}
+	return a == b
+}
@@ -168,6 +168,46 @@ func (n *ScoreSource) Numbers(d *DocumentMatch) []float64 {
 	return []float64{d.Score}
 }
 
+// QuantizedScoreSource rounds the score to a multiple of step, so scores
+// differing by much less than this, such as through floating point error
+// in sums computed in a different order, mostly have the same sort value.
+// This reduces, but does not rule out, a sort cursor built from one page
+// misplacing its position in the next, as two such scores either side of
+// a rounding boundary still differ.  Ties are broken by the later sort
+// levels.
+type QuantizedScoreSource struct {
+	step float64
+}
+
+func QuantizedDocumentScore(step float64) *QuantizedScoreSource {
+	return &QuantizedScoreSource{
+		step: step,
+	}
+}
+
+func (n *QuantizedScoreSource) Fields() []string {
+	return []string{}
+}
+
+func (n *QuantizedScoreSource) Value(d *DocumentMatch) []byte {
+	return NumericSortValue(n.Number(d))
+}
+
+func (n *QuantizedScoreSource) Values(d *DocumentMatch) [][]byte {
+	return [][]byte{n.Value(d)}
+}
+
+func (n *QuantizedScoreSource) Number(d *DocumentMatch) float64 {
+	if n.step <= 0 {
+		return d.Score
+	}
+	return math.Round(d.Score/n.step) * n.step
+}
+
+func (n *QuantizedScoreSource) Numbers(d *DocumentMatch) []float64 {
+	return []float64{n.Number(d)}
+}
+
 type MissingTextValueSource struct {
 	primary, replacement TextValueSource
 }
@@ -365,24 +405,93 @@ func (p PointDistanceSource) Fields() []string {
 }
 
 func (p PointDistanceSource) Value(match *DocumentMatch) []byte {
-	distInt64 := numeric.Float64ToInt64(p.Number(match))
-	return numeric.MustNewPrefixCodedInt64(distInt64, 0)
+	dist := p.Number(match)
+	if math.IsNaN(dist) {
+		return nil
+	}
+	return numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(dist), 0)
 }
 
 func (p PointDistanceSource) Values(match *DocumentMatch) [][]byte {
-	return [][]byte{p.Value(match)}
+	if val := p.Value(match); val != nil {
+		return [][]byte{val}
+	}
+	return nil
 }
 
+// Number returns the distance between the points, or
+// NaN if the match is missing either of them
 func (p PointDistanceSource) Number(match *DocumentMatch) float64 {
 	pointA := p.a.GeoPoint(match)
 	pointB := p.b.GeoPoint(match)
+	if pointA == nil || pointB == nil {
+		return math.NaN()
+	}
 	dist := geo.Haversin(pointA.Lon, pointA.Lat, pointB.Lon, pointB.Lat)
 	// dist is returned in km, convert to desired unit
 	return geo.Convert(dist, geo.Kilometer, p.unit)
 }
 
 func (p PointDistanceSource) Numbers(match *DocumentMatch) []float64 {
-	return []float64{p.Number(match)}
+	if dist := p.Number(match); !math.IsNaN(dist) {
+		return []float64{dist}
+	}
+	return nil
+}
+
+// ScriptSource computes a number from the first value of each of
+// the fields, such as a weighted sum of several numeric fields
+type ScriptSource struct {
+	fn     func(values map[string][]byte) float64
+	fields []string
+}
+
+// NewScriptSource calls fn with the first value of each of the fields
+// for the match, missing fields are absent from the map.  Numeric
+// values are prefix coded, and can be decoded with numeric.PrefixCoded.
+// The fn may return NaN for matches it cannot compute a value for,
+// these are treated as missing a value.
+func NewScriptSource(fn func(values map[string][]byte) float64, fields []string) *ScriptSource {
+	return &ScriptSource{
+		fn:     fn,
+		fields: fields,
+	}
+}
+
+func (s *ScriptSource) Fields() []string {
+	return append([]string(nil), s.fields...)
+}
+
+func (s *ScriptSource) Value(match *DocumentMatch) []byte {
+	val := s.Number(match)
+	if math.IsNaN(val) {
+		return nil
+	}
+	return numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(val), 0)
+}
+
+func (s *ScriptSource) Values(match *DocumentMatch) [][]byte {
+	if val := s.Value(match); val != nil {
+		return [][]byte{val}
+	}
+	return nil
+}
+
+func (s *ScriptSource) Number(match *DocumentMatch) float64 {
+	values := make(map[string][]byte, len(s.fields))
+	for _, field := range s.fields {
+		if val := Field(field).Value(match); val != nil {
+			values[field] = val
+		}
+	}
+	return s.fn(values)
+}
+
+func (s *ScriptSource) Numbers(match *DocumentMatch) []float64 {
+	if val := s.Number(match); !math.IsNaN(val) {
+		return []float64{val}
+	}
+	return nil
 }
 
 type ConstantGeoPointSource geo.Point
@@ -0,0 +1,245 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bluge
+
+import (
+	"context"
+	"sync"
+
+	"github.com/blugelabs/bluge/index"
+	"github.com/blugelabs/bluge/search"
+)
+
+// segmentChunkSize is the number of matches the searcher
+// of a segment passes to the collector at a time
+const segmentChunkSize = 256
+
+// segmentChunkBuffer is the number of chunks the searcher of a segment
+// may get ahead of the collector by, bounding the matches held
+const segmentChunkBuffer = 4
+
+type segmentHit struct {
+	number uint64
+	score  float64
+	// the match itself, only kept when it holds more
+	// than the number and score, such as an explanation
+	match *search.DocumentMatch
+}
+
+type segmentChunk struct {
+	hits []segmentHit
+	err  error
+}
+
+type segmentSearch struct {
+	searcher search.Searcher
+	chunks   chan segmentChunk
+	stats    *search.SearchStats
+}
+
+// parallelSegmentSearcher runs a searcher for each segment in its own
+// goroutine, returning their matches in turn, in the same order and
+// with the same scores as a single searcher of the whole snapshot
+type parallelSegmentSearcher struct {
+	reader   search.MatchReader
+	segments []*segmentSearch
+	ctx      context.Context
+
+	started bool
+	closed  bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	index int
+	hits  []segmentHit
+	err   error
+}
+
+func newParallelSegmentSearcher(reader *index.Snapshot, req SearchRequest,
+	config Config) (*parallelSegmentSearcher, error) {
+	rv := &parallelSegmentSearcher{
+		reader: reader,
+		ctx:    context.Background(),
+		done:   make(chan struct{}),
+	}
+	for _, snapshot := range reader.SegmentSnapshots() {
+		searcher, err := req.Searcher(snapshot, config)
+		if err != nil {
+			_ = rv.Close()
+			return nil, err
+		}
+		rv.segments = append(rv.segments, &segmentSearch{
+			searcher: searcher,
+			chunks:   make(chan segmentChunk, segmentChunkBuffer),
+		})
+	}
+	return rv, nil
+}
+
+// withContext stops the searchers when the context is done, it
+// is set by the collector before the first call to Next
+func (p *parallelSegmentSearcher) withContext(ctx context.Context) {
+	p.ctx = ctx
+}
+
+func (p *parallelSegmentSearcher) start(ctx *search.Context) {
+	p.started = true
+	for _, s := range p.segments {
+		if ctx.Stats != nil {
+			s.stats = &search.SearchStats{}
+		}
+		p.wg.Add(1)
+		go p.run(s)
+	}
+}
+
+func (p *parallelSegmentSearcher) run(s *segmentSearch) {
+	defer p.wg.Done()
+	defer close(s.chunks)
+
+	searchContext := search.NewSearchContext(s.searcher.DocumentMatchPoolSize(), 0)
+	searchContext.Stats = s.stats
+
+	hits := make([]segmentHit, 0, segmentChunkSize)
+	next, err := s.searcher.Next(searchContext)
+	for err == nil && next != nil {
+		// stop between matches, as sparse or slow queries
+		// may take a long time to fill a chunk
+		select {
+		case <-p.done:
+			return
+		case <-p.ctx.Done():
+			p.send(s, segmentChunk{err: p.ctx.Err()})
+			return
+		default:
+		}
+		hit := segmentHit{
+			number: next.Number,
+			score:  next.Score,
+		}
+		if next.Explanation != nil || len(next.FieldTermLocations) > 0 {
+			hit.match = next
+		} else {
+			searchContext.DocumentMatchPool.Put(next)
+		}
+		hits = append(hits, hit)
+		if len(hits) == segmentChunkSize {
+			if !p.send(s, segmentChunk{hits: hits}) {
+				return
+			}
+			hits = make([]segmentHit, 0, segmentChunkSize)
+		}
+		next, err = s.searcher.Next(searchContext)
+	}
+	p.send(s, segmentChunk{hits: hits, err: err})
+}
+
+// send passes the chunk to the collector, returning
+// false if the searcher was closed before it could
+func (p *parallelSegmentSearcher) send(s *segmentSearch, chunk segmentChunk) bool {
+	select {
+	case s.chunks <- chunk:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+func (p *parallelSegmentSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if !p.started {
+		p.start(ctx)
+	}
+	for p.index < len(p.segments) {
+		if len(p.hits) > 0 {
+			hit := p.hits[0]
+			p.hits = p.hits[1:]
+			return p.match(ctx, hit), nil
+		}
+		s := p.segments[p.index]
+		var chunk segmentChunk
+		var ok bool
+		select {
+		case chunk, ok = <-s.chunks:
+		case <-p.ctx.Done():
+			p.err = p.ctx.Err()
+			return nil, p.err
+		}
+		if !ok {
+			if ctx.Stats != nil && s.stats != nil {
+				ctx.Stats.Add(s.stats)
+			}
+			p.index++
+			continue
+		}
+		if chunk.err != nil {
+			p.err = chunk.err
+			return nil, p.err
+		}
+		p.hits = chunk.hits
+	}
+	return nil, nil
+}
+
+func (p *parallelSegmentSearcher) match(ctx *search.Context, hit segmentHit) *search.DocumentMatch {
+	rv := hit.match
+	if rv == nil {
+		rv = ctx.DocumentMatchPool.Get()
+		rv.Number = hit.number
+		rv.Score = hit.score
+	}
+	// the numbers are those of the whole snapshot, so read values from
+	// it, as they would have been had it been searched as a whole
+	rv.SetReader(p.reader)
+	return rv
+}
+
+func (p *parallelSegmentSearcher) DocumentMatchPoolSize() int {
+	// matches are returned one at a time, as from a single searcher
+	var rv int
+	for _, s := range p.segments {
+		ps := s.searcher.DocumentMatchPoolSize()
+		if ps > rv {
+			rv = ps
+		}
+	}
+	return rv
+}
+
+func (p *parallelSegmentSearcher) Size() int {
+	var rv int
+	for _, s := range p.segments {
+		rv += s.searcher.Size()
+	}
+	return rv
+}
+
+func (p *parallelSegmentSearcher) Close() (err error) {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	p.wg.Wait()
+	for _, s := range p.segments {
+		cerr := s.searcher.Close()
+		if err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
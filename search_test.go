@@ -16,16 +16,25 @@ package bluge
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/blugelabs/bluge/search/aggregations"
 	"github.com/blugelabs/bluge/search/highlight"
+	"github.com/blugelabs/bluge/search/searcher"
+	"github.com/blugelabs/bluge/search/similarity"
 
 	"github.com/blugelabs/bluge/analysis/char"
 
+	"github.com/blugelabs/bluge/numeric"
 	"github.com/blugelabs/bluge/numeric/geo"
 
 	"github.com/blugelabs/bluge/search"
@@ -1183,6 +1192,84 @@ func TestGeoDistanceIssue1301(t *testing.T) {
 	}
 }
 
+func TestGeoDistanceQueryRadius(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	// a degree of latitude is about 111.2km, so points
+	// due north of the center lie just inside or just
+	// outside a radius of 10km
+	lon, lat := -73.985, 40.758
+	batch := NewBatch()
+	for id, latOffset := range map[string]float64{
+		"center":      0,
+		"inside":      0.089, // 9.9km
+		"outside":     0.091, // 10.1km
+		"far":         1,
+		"southInside": -0.089,
+	} {
+		doc := NewDocument(id).
+			AddField(NewGeoPointField("location", lon, lat+latOffset))
+		batch.Update(doc.ID(), doc)
+	}
+	// documents without a point never match
+	missing := NewDocument("missing").AddField(NewKeywordField("name", "nowhere"))
+	batch.Update(missing.ID(), missing)
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	for _, test := range []struct {
+		distance string
+		expect   []string
+	}{
+		{distance: "10km", expect: []string{"center", "inside", "southInside"}},
+		{distance: "10000", expect: []string{"center", "inside", "southInside"}},
+		{distance: "10.2km", expect: []string{"center", "inside", "outside", "southInside"}},
+		{distance: "9.8km", expect: []string{"center"}},
+	} {
+		q := NewGeoDistanceQuery(lon, lat, test.distance).SetField("location")
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q).SortBy([]string{_idField}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					got = append(got, string(value))
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("within %s expected %v, got %v", test.distance, test.expect, got)
+		}
+	}
+}
+
 func TestSearchHighlightingWithRegexpReplacement(t *testing.T) {
 	r := regexp.MustCompile(`([a-z])\s+(\d)`)
 	regexpReplace := char.NewRegexpCharFilter(r, []byte("ooooo$1-$2"))
@@ -1263,6 +1350,327 @@ func TestSearchHighlightingWithRegexpReplacement(t *testing.T) {
 	}
 }
 
+func TestTermPositionsOnlyPhraseAndHighlight(t *testing.T) {
+	config := InMemoryOnlyConfig()
+	indexWriter, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := NewDocument("doc").
+		AddField(NewTextField("positions", "twenty thousand leagues").
+			StoreValue().
+			TermPositionsOnly()).
+		AddField(NewTextField("offsets", "twenty thousand leagues").
+			StoreValue().
+			TermOffsetsOnly())
+
+	batch := NewBatch()
+	batch.Update(doc.ID(), doc)
+
+	if err = indexWriter.Batch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	indexReader, err := indexWriter.Reader()
+	if err != nil {
+		t.Fatalf("error getting index reader: %v", err)
+	}
+
+	tests := []struct {
+		phrase      string
+		expectMatch bool
+	}{
+		{
+			phrase:      "thousand leagues",
+			expectMatch: true,
+		},
+		{
+			phrase:      "leagues thousand",
+			expectMatch: false,
+		},
+	}
+
+	htmlHighlighter := highlight.NewHTMLHighlighter()
+	for _, test := range tests {
+		query := NewMatchPhraseQuery(test.phrase).SetField("positions")
+		sreq := NewTopNSearch(10, query).IncludeLocations()
+		dmi, err := indexReader.Search(context.Background(), sreq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := dmi.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (next != nil) != test.expectMatch {
+			t.Fatalf("expected match %t for phrase '%s'", test.expectMatch, test.phrase)
+		}
+		if next == nil {
+			continue
+		}
+		for _, locations := range next.Locations["positions"] {
+			for _, location := range locations {
+				if location.Start != 0 || location.End != 0 {
+					t.Errorf("expected no offsets, got %d-%d", location.Start, location.End)
+				}
+			}
+		}
+		// highlighting without offsets falls back to the plain text
+		err = next.VisitStoredFields(func(field string, value []byte) bool {
+			if field == "positions" {
+				got := htmlHighlighter.BestFragment(next.Locations["positions"], value)
+				if got != "twenty thousand leagues" {
+					t.Errorf("expected unhighlighted fragment, got '%s'", got)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			t.Fatalf("error visiting stored fields: %v", err)
+		}
+	}
+
+	// highlighting works with offsets only
+	query := NewMatchQuery("leagues").SetField("offsets")
+	dmi, err := indexReader.Search(context.Background(), NewTopNSearch(10, query).IncludeLocations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := dmi.Next()
+	if err != nil || next == nil {
+		t.Fatalf("expected match, got %v", err)
+	}
+	err = next.VisitStoredFields(func(field string, value []byte) bool {
+		if field == "offsets" {
+			got := htmlHighlighter.BestFragment(next.Locations["offsets"], value)
+			expect := "twenty thousand <mark>leagues</mark>"
+			if got != expect {
+				t.Errorf("expected highlight '%s', got '%s'", expect, got)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("error visiting stored fields: %v", err)
+	}
+
+	// phrases cannot be checked without positions, in either order
+	for _, phrase := range []string{"thousand leagues", "leagues thousand"} {
+		query := NewMatchPhraseQuery(phrase).SetField("offsets")
+		dmi, err = indexReader.Search(context.Background(), NewTopNSearch(10, query))
+		if err == nil {
+			_, err = dmi.Next()
+		}
+		if !errors.Is(err, searcher.ErrNoTermPositions) {
+			t.Errorf("expected phrase '%s' rejected without positions, got %v", phrase, err)
+		}
+	}
+
+	err = indexReader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = indexWriter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// geoDistanceSource sorts by the distance of a geo point field
+// from a fixed location, counting how often it is computed
+type geoDistanceSource struct {
+	field    string
+	lon, lat float64
+	computed map[uint64]int
+}
+
+func (g *geoDistanceSource) Fields() []string {
+	return []string{g.field}
+}
+
+func (g *geoDistanceSource) Value(d *search.DocumentMatch) []byte {
+	g.computed[d.Number]++
+	values := d.DocValues(g.field)
+	if len(values) == 0 {
+		return nil
+	}
+	lon, lat, err := DecodeGeoLonLat(values[0])
+	if err != nil {
+		return nil
+	}
+	dist := geo.Haversin(g.lon, g.lat, lon, lat)
+	return numeric.MustNewPrefixCodedInt64(numeric.Float64ToInt64(dist), 0)
+}
+
+func TestSortValueCachePagination(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := NewBatch()
+	for i := 0; i < 30; i++ {
+		doc := NewDocument(fmt.Sprintf("%02d", i)).
+			AddField(NewGeoPointField("loc", float64(i)*0.1, 0))
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &geoDistanceSource{
+		field:    "loc",
+		computed: map[uint64]int{},
+	}
+	order := search.SortOrder{search.SortBy(source)}
+	cache := search.NewSortValueCache(100)
+
+	var ids []string
+	var after [][]byte
+	for {
+		req := NewTopNSearch(7, NewMatchAllQuery()).
+			SortByCustom(order).
+			WithSortValueCache(cache)
+		if after != nil {
+			req.After(after)
+		}
+		dmi, err := reader.Search(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page int
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			page++
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					ids = append(ids, string(value))
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			after = next.SortValue
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page == 0 {
+			break
+		}
+	}
+
+	if len(ids) != 30 {
+		t.Fatalf("expected 30 hits across pages, got %d", len(ids))
+	}
+	for i, id := range ids {
+		if id != fmt.Sprintf("%02d", i) {
+			t.Errorf("expected hit %d to be %02d, got %s", i, i, id)
+		}
+	}
+	if len(source.computed) != 30 {
+		t.Errorf("expected sort values for 30 documents, got %d", len(source.computed))
+	}
+	for number, count := range source.computed {
+		if count != 1 {
+			t.Errorf("expected sort value of %d computed once, got %d", number, count)
+		}
+	}
+
+	err = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTermsAggregationMaxBuckets(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := NewBatch()
+	for i := 0; i < 100; i++ {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewKeywordField("user", fmt.Sprintf("user-%d", i)).Aggregatable())
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+		_ = writer.Close()
+	}()
+
+	tests := []struct {
+		maxBuckets    int
+		defaultMax    int
+		expectTooMany bool
+	}{
+		{maxBuckets: 0, expectTooMany: false},
+		{maxBuckets: 100, expectTooMany: false},
+		{maxBuckets: 10, expectTooMany: true},
+		{defaultMax: 10, expectTooMany: true},
+		{maxBuckets: 200, defaultMax: 10, expectTooMany: false},
+	}
+
+	defer func(orig int) {
+		aggregations.DefaultMaxBuckets = orig
+	}(aggregations.DefaultMaxBuckets)
+
+	for _, test := range tests {
+		aggregations.DefaultMaxBuckets = test.defaultMax
+		agg := aggregations.NewTermsAggregation(search.Field("user"), 5)
+		if test.maxBuckets > 0 {
+			agg.SetMaxBuckets(test.maxBuckets)
+		}
+		for _, req := range []SearchRequest{
+			NewTopNSearch(10, NewMatchAllQuery()),
+			NewAllMatches(NewMatchAllQuery()),
+		} {
+			req.AddAggregation("users", agg)
+			dmi, err := reader.Search(context.Background(), req)
+			if err == nil {
+				var next *search.DocumentMatch
+				next, err = dmi.Next()
+				for err == nil && next != nil {
+					next, err = dmi.Next()
+				}
+			}
+			if test.expectTooMany {
+				if !errors.Is(err, search.ErrTooManyBuckets) {
+					t.Errorf("expected ErrTooManyBuckets for %+v, got %v", test, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %+v: %v", test, err)
+			}
+			if len(dmi.Aggregations().Buckets("users")) != 5 {
+				t.Errorf("expected 5 buckets for %+v, got %d", test,
+					len(dmi.Aggregations().Buckets("users")))
+			}
+		}
+	}
+}
+
 func TestAllMatchesWithAggregationIssue31(t *testing.T) {
 	query := NewMatchQuery("bluge").SetField("name")
 	request := NewAllMatches(query)
@@ -1380,3 +1788,2401 @@ func TestBooleanSearchBoost(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func buildFieldSortIndex(tb testing.TB, n int) *Reader {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	batch := NewBatch()
+	for i := 0; i < n; i++ {
+		body := "common"
+		if i%3 == 0 {
+			body += " common three"
+		}
+		doc := NewDocument(fmt.Sprintf("%04d", i)).
+			AddField(NewTextField("body", body)).
+			AddField(NewNumericField("rank", float64((i*7)%n)).Sortable())
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return reader
+}
+
+func TestPhraseQueryTermBoosts(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	// quick is common, fox is rare
+	batch := NewBatch()
+	for i := 0; i < 20; i++ {
+		body := "quick brown dog"
+		if i < 2 {
+			body = "quick fox jumped"
+		}
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewTextField("body", body).SearchTermPositions())
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	scores := func(q Query) map[string]float64 {
+		rv := map[string]float64{}
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					rv[string(value)] = next.Score
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv
+	}
+
+	unboosted := scores(NewMatchPhraseQuery("quick fox").SetField("body"))
+	boosted := scores(NewMatchPhraseQuery("quick fox").SetField("body").SetTermBoost("fox", 5))
+	multiBoosted := scores(NewMultiPhraseQuery([][]string{{"quick"}, {"fox"}}).SetField("body").SetTermBoost("fox", 5))
+	phraseBoosted := scores(NewPhraseQuery([]string{"quick", "fox"}).SetField("body").SetTermBoost("fox", 5))
+	if len(unboosted) != 2 || len(boosted) != 2 {
+		t.Fatalf("expected the phrase to match 2 documents, got %v and %v", unboosted, boosted)
+	}
+	for id, score := range unboosted {
+		if boosted[id] <= score {
+			t.Errorf("expected boosting fox to raise the score of %s, got %f, unboosted %f", id, boosted[id], score)
+		}
+		if multiBoosted[id] != boosted[id] {
+			t.Errorf("expected multi-phrase score %f to equal phrase score %f", multiBoosted[id], boosted[id])
+		}
+		if phraseBoosted[id] != boosted[id] {
+			t.Errorf("expected phrase query score %f to equal match phrase score %f", phraseBoosted[id], boosted[id])
+		}
+	}
+}
+
+func TestWithoutScoring(t *testing.T) {
+	reader := buildFieldSortIndex(t, 100)
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	q := NewBooleanQuery().
+		AddShould(NewTermQuery("common").SetField("body")).
+		AddShould(NewTermQuery("three").SetField("body"))
+
+	collect := func(req *TopNSearch) (ids []string, scores []float64) {
+		dmi, err := reader.Search(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					ids = append(ids, string(value))
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			scores = append(scores, next.Score)
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids, scores
+	}
+
+	unscoredIDs, unscored := collect(NewTopNSearch(20, q).SortBy([]string{"-rank"}).WithoutScoring())
+	scoredIDs, scored := collect(NewTopNSearch(20, q).SortBy([]string{"-rank"}))
+	if !reflect.DeepEqual(unscoredIDs, scoredIDs) {
+		t.Errorf("expected the same matches in the same order, got %v and %v", unscoredIDs, scoredIDs)
+	}
+	if len(unscoredIDs) != 20 {
+		t.Fatalf("expected 20 matches, got %d", len(unscoredIDs))
+	}
+	for i := range unscored {
+		if unscored[i] != 0 {
+			t.Errorf("expected match %s not to be scored, got %f", unscoredIDs[i], unscored[i])
+		}
+		if scored[i] <= 0 {
+			t.Errorf("expected match %s to be scored, got %f", scoredIDs[i], scored[i])
+		}
+	}
+
+	// the max_score aggregation needs scores, even when sorting by field
+	_, withAggs := collect(NewTopNSearch(20, q).SortBy([]string{"-rank"}).WithoutScoring().
+		WithStandardAggregations())
+	for i := range withAggs {
+		if withAggs[i] != scored[i] {
+			t.Errorf("expected score %f for match %d, got %f", scored[i], i, withAggs[i])
+		}
+	}
+
+	// match all is only skipped when the sort doesn't use the score
+	_, matchAllUnscored := collect(NewTopNSearch(20, NewMatchAllQuery()).SortBy([]string{"rank"}).WithoutScoring())
+	_, matchAllScored := collect(NewTopNSearch(20, NewMatchAllQuery()).WithoutScoring())
+	_, matchAllDefault := collect(NewTopNSearch(20, NewMatchAllQuery()).SortBy([]string{"rank"}))
+	for i := range matchAllUnscored {
+		if matchAllUnscored[i] != 0 {
+			t.Errorf("expected match all not to be scored when sorting by field, got %f", matchAllUnscored[i])
+		}
+		if matchAllScored[i] != 1 {
+			t.Errorf("expected match all scored 1 when sorting by score, got %f", matchAllScored[i])
+		}
+		if matchAllDefault[i] != 1 {
+			t.Errorf("expected match all scored 1 by default, got %f", matchAllDefault[i])
+		}
+	}
+
+	// post filters reading the score need it too
+	positive := func(score float64) bool { return score > 0 }
+	for _, filter := range []search.PostFilter{
+		search.NumericPostFilter(search.DocumentScore(), positive),
+		search.FuncPostFilter(nil, func(match *search.DocumentMatch) bool {
+			return positive(match.Score)
+		}),
+	} {
+		ids, filtered := collect(NewTopNSearch(20, q).SortBy([]string{"-rank"}).WithoutScoring().
+			WithPostFilter(filter))
+		if !reflect.DeepEqual(ids, scoredIDs) || !reflect.DeepEqual(filtered, scored) {
+			t.Errorf("expected post filtered matches %v scored %v, got %v scored %v", scoredIDs, scored, ids, filtered)
+		}
+	}
+	// but not those reading fields only
+	_, filtered := collect(NewTopNSearch(20, q).SortBy([]string{"-rank"}).WithoutScoring().
+		WithPostFilter(search.NumericPostFilter(search.Field("rank"), positive)))
+	for i := range filtered {
+		if filtered[i] != 0 {
+			t.Errorf("expected match %d not to be scored, got %f", i, filtered[i])
+		}
+	}
+}
+
+func TestSortFieldMixedTypes(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	batch := NewBatch()
+	for i := 0; i < 10; i++ {
+		doc := NewDocument(fmt.Sprintf("%d", i))
+		switch i % 3 {
+		case 0:
+			doc.AddField(NewNumericField("price", float64(i)).Sortable())
+		case 1:
+			doc.AddField(NewKeywordField("price", "cheap").Sortable())
+		}
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	dmi, err := reader.Search(context.Background(), NewTopNSearch(10, NewMatchAllQuery()).SortBy([]string{"price"}))
+	if err != nil {
+		t.Fatalf("expected numeric and text values to sort, got %v", err)
+	}
+	var ids []string
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		err = next.VisitStoredFields(func(field string, value []byte) bool {
+			if field == _idField {
+				ids = append(ids, string(value))
+			}
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// numbers sort before text, and documents without a value sort last
+	want := []string{"0", "3", "6", "9", "1", "4", "7", "2", "5", "8"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected %v, got %v", want, ids)
+	}
+}
+
+func TestSearchStats(t *testing.T) {
+	reader := buildFieldSortIndex(t, 100)
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	q := NewBooleanQuery().
+		AddShould(NewTermQuery("common").SetField("body")).
+		AddShould(NewTermQuery("three").SetField("body"))
+
+	run := func(req *TopNSearch) {
+		dmi, err := reader.Search(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every document matches common, every third also matches three
+	var stats search.SearchStats
+	run(NewTopNSearch(10, q).WithSearchStats(&stats))
+	if stats.TermsVisited != 2 {
+		t.Errorf("expected 2 terms visited, got %d", stats.TermsVisited)
+	}
+	if stats.DocsScored != 134 {
+		t.Errorf("expected 134 term matches scored, got %d", stats.DocsScored)
+	}
+	if stats.HeapOperations == 0 || stats.HeapOperations > 100 {
+		t.Errorf("expected between 1 and 100 heap operations, got %d", stats.HeapOperations)
+	}
+
+	// sorting by a field without scoring skips scoring entirely
+	stats.Reset()
+	run(NewTopNSearch(10, q).SortBy([]string{"rank"}).WithoutScoring().WithSearchStats(&stats))
+	if stats.DocsScored != 0 {
+		t.Errorf("expected no matches scored when sorting by field, got %d", stats.DocsScored)
+	}
+}
+
+func TestExplainScoresRetained(t *testing.T) {
+	reader := buildFieldSortIndex(t, 100)
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	q := NewBooleanQuery().
+		AddShould(NewTermQuery("common").SetField("body")).
+		AddShould(NewTermQuery("three").SetField("body"))
+
+	run := func(req *TopNSearch) []*search.DocumentMatch {
+		dmi, err := reader.Search(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rv []*search.DocumentMatch
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			rv = append(rv, next)
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv
+	}
+
+	// small requests use the slice store, larger ones the heap
+	for _, test := range []struct {
+		size int
+		from int
+	}{
+		{size: 5, from: 3},
+		{size: 20, from: 5},
+	} {
+		plain := run(NewTopNSearch(test.size, q).SetFrom(test.from))
+		explained := run(NewTopNSearch(test.size, q).SetFrom(test.from).ExplainScores())
+		if len(plain) != test.size || len(explained) != test.size {
+			t.Fatalf("size %d from %d: expected %d hits, got %d and %d",
+				test.size, test.from, test.size, len(plain), len(explained))
+		}
+		for i := range plain {
+			if plain[i].Number != explained[i].Number || plain[i].Score != explained[i].Score {
+				t.Errorf("size %d from %d: hit %d differs, %d/%f vs %d/%f", test.size, test.from, i,
+					plain[i].Number, plain[i].Score, explained[i].Number, explained[i].Score)
+			}
+			if plain[i].Explanation != nil {
+				t.Errorf("size %d from %d: hit %d unexpectedly explained", test.size, test.from, i)
+			}
+			if explained[i].Explanation == nil {
+				t.Errorf("size %d from %d: hit %d missing explanation", test.size, test.from, i)
+			} else if explained[i].Explanation.Value != explained[i].Score {
+				t.Errorf("size %d from %d: hit %d explains score %f, expected %f", test.size, test.from, i,
+					explained[i].Explanation.Value, explained[i].Score)
+			}
+		}
+	}
+}
+
+func BenchmarkTopNSearchSortByField(b *testing.B) {
+	reader := buildFieldSortIndex(b, 10000)
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	q := NewBooleanQuery().
+		AddShould(NewTermQuery("common").SetField("body")).
+		AddShould(NewTermQuery("three").SetField("body"))
+
+	for _, scored := range []bool{false, true} {
+		b.Run(fmt.Sprintf("scored=%t", scored), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req := NewTopNSearch(10, q).SortBy([]string{"rank"})
+				if !scored {
+					req.WithoutScoring()
+				}
+				dmi, err := reader.Search(context.Background(), req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				next, err := dmi.Next()
+				for err == nil && next != nil {
+					next, err = dmi.Next()
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMatchAllSortByField(b *testing.B) {
+	reader := buildFieldSortIndex(b, 10000)
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	for _, scored := range []bool{false, true} {
+		b.Run(fmt.Sprintf("scored=%t", scored), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req := NewTopNSearch(10, NewMatchAllQuery()).SortBy([]string{"rank"})
+				if !scored {
+					req.WithoutScoring()
+				}
+				dmi, err := reader.Search(context.Background(), req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				next, err := dmi.Next()
+				for err == nil && next != nil {
+					next, err = dmi.Next()
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSortCursorPagination(t *testing.T) {
+	const numDocs = 100
+	reader := buildFieldSortIndex(t, numDocs)
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	for _, sort := range []string{"rank", "-rank", "body"} {
+		seen := map[string]int{}
+		var order []string
+		var cursor [][]byte
+		for {
+			req := NewTopNSearch(7, NewMatchAllQuery()).
+				SortBy([]string{sort}).
+				WithTieBreaker(_idField)
+			if cursor != nil {
+				req.After(cursor)
+			}
+			dmi, err := reader.Search(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var count int
+			next, err := dmi.Next()
+			for err == nil && next != nil {
+				err = next.VisitStoredFields(func(field string, value []byte) bool {
+					if field == _idField {
+						seen[string(value)]++
+						order = append(order, string(value))
+					}
+					return true
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				cursor = next.SortCursor()
+				count++
+				next, err = dmi.Next()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count == 0 {
+				break
+			}
+		}
+
+		if len(seen) != numDocs {
+			t.Errorf("sort %s: expected to see %d documents, saw %d", sort, numDocs, len(seen))
+		}
+		for id, times := range seen {
+			if times != 1 {
+				t.Errorf("sort %s: expected document %s once, saw it %d times", sort, id, times)
+			}
+		}
+		if sort == "rank" {
+			// ranks are a permutation, so the first page starts with rank 0
+			if order[0] != "0000" {
+				t.Errorf("expected first document by rank to be 0000, got %s", order[0])
+			}
+		}
+	}
+}
+
+func TestQuantizedScorePagination(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	// several batches, so the matches span segments
+	const numDocs = 100
+	for b := 0; b < 4; b++ {
+		batch := NewBatch()
+		for i := b * numDocs / 4; i < (b+1)*numDocs/4; i++ {
+			body := strings.Repeat("common ", i%5+1)
+			doc := NewDocument(fmt.Sprintf("%04d", i)).
+				AddField(NewTextField("body", body))
+			batch.Update(doc.ID(), doc)
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	order := search.SortOrder{
+		search.SortBy(search.QuantizedDocumentScore(0.0001)).Desc(),
+		search.SortBy(search.Field(_idField)),
+	}
+	seen := map[string]int{}
+	lastScore := math.Inf(1)
+	var cursor [][]byte
+	for {
+		req := NewTopNSearch(7, NewTermQuery("common").SetField("body")).
+			SortByCustom(order)
+		if cursor != nil {
+			req.After(cursor)
+		}
+		dmi, err := reader.Search(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			var id string
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					id = string(value)
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen[id]++
+
+			// build the cursor from the decoded values
+			score, err := search.SortValueNumber(next.SortValue[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if score > lastScore {
+				t.Errorf("expected scores in descending order, got %f after %f", score, lastScore)
+			}
+			lastScore = score
+			cursor = [][]byte{search.NumericSortValue(score), []byte(id)}
+			count++
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count == 0 {
+			break
+		}
+	}
+
+	if len(seen) != numDocs {
+		t.Errorf("expected to see %d documents, saw %d", numDocs, len(seen))
+	}
+	for id, times := range seen {
+		if times != 1 {
+			t.Errorf("expected document %s once, saw it %d times", id, times)
+		}
+	}
+}
+
+func TestDocIDQuery(t *testing.T) {
+	reader := buildFieldSortIndex(t, 10)
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	// ranks are (i*7)%10, so 0001 is 7, 0003 is 1, 0007 is 9
+	q := NewDocIDQuery([]string{"0007", "0001", "missing", "0003", "0001"}).SetBoost(2)
+	req := NewTopNSearch(10, q).SortBy([]string{"rank"})
+	dmi, err := reader.Search(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		err = next.VisitStoredFields(func(field string, value []byte) bool {
+			if field == _idField {
+				got = append(got, string(value))
+			}
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"0003", "0001", "0007"}) {
+		t.Errorf("expected [0003 0001 0007], got %v", got)
+	}
+
+	// scored, every match has the boost
+	dmi, err = reader.Search(context.Background(), NewTopNSearch(10, q))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	next, err = dmi.Next()
+	for err == nil && next != nil {
+		if next.Score != 2 {
+			t.Errorf("expected score 2, got %f", next.Score)
+		}
+		count++
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 matches, got %d", count)
+	}
+}
+
+func TestReaderSearchFunc(t *testing.T) {
+	reader := buildFieldSortIndex(t, 100)
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	req := NewTopNSearch(20, NewTermQuery("common").SetField("body")).
+		SortBy([]string{"-rank"}).
+		WithStandardAggregations()
+
+	var expect []uint64
+	dmi, err := reader.Search(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		expect = append(expect, next.Number)
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []uint64
+	aggs, err := reader.SearchFunc(context.Background(), req, func(match *search.DocumentMatch) error {
+		got = append(got, match.Number)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected matches %v, got %v", expect, got)
+	}
+	if aggs.Count() != dmi.Aggregations().Count() {
+		t.Errorf("expected count %d, got %d", dmi.Aggregations().Count(), aggs.Count())
+	}
+
+	// an error from the callback stops the search
+	errStop := errors.New("stop")
+	var calls int
+	_, err = reader.SearchFunc(context.Background(), req, func(match *search.DocumentMatch) error {
+		calls++
+		if calls == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("expected the callback error, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls before stopping, got %d", calls)
+	}
+
+	// matches of every match search are passed to the callback as they
+	// are collected, and stopping closes the searcher
+	q := &closeCountingQuery{Query: NewTermQuery("common").SetField("body")}
+	calls = 0
+	_, err = reader.SearchFunc(context.Background(), NewAllMatches(q), func(match *search.DocumentMatch) error {
+		calls++
+		if calls == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("expected the callback error, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls before stopping, got %d", calls)
+	}
+	if q.closed != 1 {
+		t.Errorf("expected the searcher closed once, got %d", q.closed)
+	}
+}
+
+type closeCountingQuery struct {
+	Query
+	closed int
+}
+
+func (q *closeCountingQuery) Searcher(i search.Reader, options search.SearcherOptions) (search.Searcher, error) {
+	searcher, err := q.Query.Searcher(i, options)
+	if err != nil {
+		return nil, err
+	}
+	return &closeCountingSearcher{Searcher: searcher, query: q}, nil
+}
+
+type closeCountingSearcher struct {
+	search.Searcher
+	query *closeCountingQuery
+}
+
+func (s *closeCountingSearcher) Close() error {
+	s.query.closed++
+	return s.Searcher.Close()
+}
+
+func TestTopNSearchSpill(t *testing.T) {
+	reader := buildFieldSortIndex(t, 100)
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	ids := func(req *TopNSearch) (rv []string) {
+		_, err := reader.SearchFunc(context.Background(), req, func(match *search.DocumentMatch) error {
+			return match.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					rv = append(rv, string(value))
+				}
+				return true
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv
+	}
+
+	for _, sort := range []string{"rank", "-_score"} {
+		expect := ids(NewTopNSearch(10, NewTermQuery("common").SetField("body")).
+			SortBy([]string{sort}).SetFrom(60))
+		got := ids(NewTopNSearch(10, NewTermQuery("common").SetField("body")).
+			SortBy([]string{sort}).SetFrom(60).WithSpill(8, t.TempDir()))
+		if len(expect) != 10 {
+			t.Fatalf("sort %s: expected 10 matches, got %d", sort, len(expect))
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("sort %s: expected %v, got %v", sort, expect, got)
+		}
+	}
+}
+
+func TestTopNSearchLocations(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	batch := NewBatch()
+	for i := 0; i < 20; i++ {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewTextField("body", "the quick brown fox").SearchTermPositions())
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	expected := search.FieldTermLocationMap{
+		"body": search.TermLocationMap{
+			"quick": search.Locations{{Pos: 2, Start: 4, End: 9}},
+			"brown": search.Locations{{Pos: 3, Start: 10, End: 15}},
+		},
+	}
+	query := NewMatchPhraseQuery("quick brown").SetField("body")
+	for _, req := range []*TopNSearch{
+		NewTopNSearch(5, query).IncludeLocations(),
+		// the locations of spilled matches are kept
+		NewTopNSearch(5, query).SetFrom(10).IncludeLocations().WithSpill(2, t.TempDir()),
+	} {
+		dmi, err := reader.Search(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			count++
+			if !reflect.DeepEqual(next.Locations, expected) {
+				t.Errorf("expected locations %v, got %v", expected, next.Locations)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 5 {
+			t.Errorf("expected 5 matches, got %d", count)
+		}
+	}
+}
+
+func TestMoreLikeThisQuery(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	bodies := map[string]string{
+		"seed":    "quantum physics explains entanglement and quantum tunneling",
+		"similar": "quantum computers use entanglement of qubits",
+		"related": "the physics of cooking pasta",
+		"other":   "cooking pasta with tomato sauce",
+	}
+	batch := NewBatch()
+	for id, body := range bodies {
+		doc := NewDocument(id).AddField(NewTextField("body", body))
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	ids := func(q Query) (rv []string) {
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					rv = append(rv, string(value))
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv
+	}
+
+	// the seed matches itself best, then its nearest neighbor
+	mlt := NewMoreLikeThisQuery(bodies["seed"]).SetField("body")
+	expected := []string{"seed", "similar", "related"}
+	if got := ids(mlt); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	neighbors := NewBooleanQuery().
+		AddMust(mlt).
+		AddMustNot(NewDocIDQuery([]string{"seed"}))
+	expected = []string{"similar", "related"}
+	if got := ids(neighbors); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// only quantum occurs twice in the seed
+	expected = []string{"seed", "similar"}
+	if got := ids(NewMoreLikeThisQuery(bodies["seed"]).SetField("body").SetMinTermFreq(2)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	// the most characteristic term is quantum
+	expected = []string{"seed", "similar"}
+	if got := ids(NewMoreLikeThisQuery(bodies["seed"]).SetField("body").SetMaxTerms(1)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	// no term of the seed is used by three documents
+	if got := ids(NewMoreLikeThisQuery(bodies["seed"]).SetField("body").SetMinDocFreq(3)); len(got) != 0 {
+		t.Errorf("expected no matches, got %v", got)
+	}
+	if got := ids(NewMoreLikeThisQuery("unknown words").SetField("body")); len(got) != 0 {
+		t.Errorf("expected no matches, got %v", got)
+	}
+}
+
+// slowNextQuery delays each match, unlike slowQuery which
+// only delays building the searcher
+type slowNextQuery struct {
+	Query
+	delay time.Duration
+}
+
+func (q *slowNextQuery) Searcher(i search.Reader, options search.SearcherOptions) (search.Searcher, error) {
+	searcher, err := q.Query.Searcher(i, options)
+	if err != nil {
+		return nil, err
+	}
+	return &slowSearcher{Searcher: searcher, delay: q.delay}, nil
+}
+
+type slowSearcher struct {
+	search.Searcher
+	delay time.Duration
+}
+
+func (s *slowSearcher) Next(ctx *search.Context) (*search.DocumentMatch, error) {
+	time.Sleep(s.delay)
+	return s.Searcher.Next(ctx)
+}
+
+func TestTopNSearchTimeout(t *testing.T) {
+	reader := buildFieldSortIndex(t, 10)
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	q := &slowNextQuery{Query: NewMatchAllQuery(), delay: 10 * time.Millisecond}
+	_, err := reader.Search(context.Background(), NewTopNSearch(10, q).WithTimeout(time.Millisecond))
+	if !errors.Is(err, ErrSearchTimeout) {
+		t.Errorf("expected ErrSearchTimeout, got %v", err)
+	}
+	_, err = MultiSearch(context.Background(), NewTopNSearch(10, q).WithTimeout(time.Millisecond), reader)
+	if !errors.Is(err, ErrSearchTimeout) {
+		t.Errorf("expected ErrSearchTimeout from multi search, got %v", err)
+	}
+
+	// a search finishing in time is unaffected
+	dmi, err := reader.Search(context.Background(), NewTopNSearch(10, NewMatchAllQuery()).WithTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		count++
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 10 {
+		t.Errorf("expected 10 matches, got %d", count)
+	}
+
+	// cancellation by the caller is not reported as a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = reader.Search(ctx, NewTopNSearch(10, q).WithTimeout(time.Minute))
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrSearchTimeout) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestLazyHighlighter(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	bodies := []string{
+		"the quick brown fox jumps over the lazy dog",
+		"a fox is quick, a dog is lazy, and the fox is brown",
+		"nothing to see here but a fox",
+	}
+	batch := NewBatch()
+	for i, body := range bodies {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewTextField("body", body).StoreValue().SearchTermPositions())
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	highlighter := highlight.NewHTMLHighlighter()
+	query := NewMatchQuery("fox lazy").SetField("body")
+	dmi, err := reader.Search(context.Background(), NewTopNSearch(10, query).IncludeLocations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var eager [][]string
+	var lazy []search.HighlightFunc
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		var fragments []string
+		err = next.VisitStoredFields(func(field string, value []byte) bool {
+			if field == "body" {
+				fragments = highlighter.BestFragments(next.Locations["body"], value, 2)
+			}
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		eager = append(eager, fragments)
+		lazy = append(lazy, next.Highlighter())
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lazy) != len(bodies) {
+		t.Fatalf("expected %d matches, got %d", len(bodies), len(lazy))
+	}
+
+	// only highlight some of the matches, after collection has finished
+	for _, i := range []int{2, 0} {
+		got, err := lazy[i](highlighter, "body", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) == 0 || !reflect.DeepEqual(got, eager[i]) {
+			t.Errorf("expected lazy highlight %v to match eager %v", got, eager[i])
+		}
+	}
+
+	got, err := lazy[1](highlighter, "missing", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("expected no fragments for a field which is not stored, got %v", got)
+	}
+}
+
+func TestHighlighterSized(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	doc := NewDocument("a").
+		AddField(NewTextField("body", "the quick brown fox jumps over the lazy dog").
+			StoreValue().SearchTermPositions()).
+		AddField(NewTextField("title", "a lazy fox story").StoreValue())
+	err = writer.Update(doc.ID(), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	query := NewBooleanQuery().
+		AddShould(NewMatchQuery("fox").SetField("body")).
+		AddShould(NewMatchQuery("fox").SetField("title"))
+	dmi, err := reader.Search(context.Background(), NewTopNSearch(10, query).IncludeLocations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := dmi.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == nil {
+		t.Fatal("expected a match")
+	}
+	highlightFunc := next.Highlighter()
+
+	highlighter := highlight.NewHTMLHighlighterSized(12, "<em>", "</em>")
+	got, err := highlightFunc(highlighter, "body", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"…own <em>fox</em> jump…"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// without positions the start of the value is not highlighted
+	got, err = highlightFunc(highlighter, "title", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"a lazy fox s…"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+// buildSegmentedIndex builds an index of the number of segments
+// requested, each of perSegment documents, with terms repeated at
+// different rates so that scores vary between documents and segments
+func buildSegmentedIndex(tb testing.TB, segments, perSegment int) *Reader {
+	config := InMemoryOnlyConfig()
+	// allow enough segments per tier that they are not merged
+	config.indexConfig.MergePlanOptions.MaxSegmentsPerTier = 2 * segments
+	writer, err := OpenWriter(config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	// even when slow batches race the merger
+	writer.PauseMerging()
+	words := []string{"alpha", "beta", "gamma", "delta", "epsilon"}
+	colors := []string{"red", "green", "blue"}
+	for s := 0; s < segments; s++ {
+		batch := NewBatch()
+		for j := 0; j < perSegment; j++ {
+			i := s*perSegment + j
+			var body []string
+			for k, word := range words {
+				for r := 0; r < (i+s)%(k+2); r++ {
+					body = append(body, word)
+				}
+			}
+			body = append(body, "common")
+			doc := NewDocument(fmt.Sprintf("%05d", i)).
+				AddField(NewTextField("body", strings.Join(body, " "))).
+				AddField(NewKeywordField("color", colors[i%len(colors)]).Aggregatable()).
+				AddField(NewNumericField("rank", float64((i*7)%(segments*perSegment))).Sortable())
+			batch.Update(doc.ID(), doc)
+		}
+		err = writer.Batch(batch)
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return reader
+}
+
+func TestParallelSegmentSearch(t *testing.T) {
+	serial := buildSegmentedIndex(t, 4, 50)
+	defer func() {
+		_ = serial.Close()
+	}()
+	if len(serial.reader.Segments()) < 2 {
+		t.Fatalf("expected several segments, got %d", len(serial.reader.Segments()))
+	}
+	parallel := &Reader{
+		config: serial.config.WithParallelSegmentSearch(),
+		reader: serial.reader,
+	}
+
+	tests := []struct {
+		name string
+		req  func() *TopNSearch
+	}{
+		{
+			name: "match",
+			req: func() *TopNSearch {
+				return NewTopNSearch(20, NewMatchQuery("alpha gamma epsilon").SetField("body"))
+			},
+		},
+		{
+			name: "from",
+			req: func() *TopNSearch {
+				return NewTopNSearch(20, NewMatchQuery("beta delta").SetField("body")).SetFrom(30)
+			},
+		},
+		{
+			name: "conjunction",
+			req: func() *TopNSearch {
+				return NewTopNSearch(20, NewBooleanQuery().
+					AddMust(NewTermQuery("alpha").SetField("body")).
+					AddMust(NewTermQuery("delta").SetField("body")).
+					AddMustNot(NewTermQuery("red").SetField("color")))
+			},
+		},
+		{
+			name: "fuzzy",
+			req: func() *TopNSearch {
+				return NewTopNSearch(20, NewFuzzyQuery("gamm").SetField("body"))
+			},
+		},
+		{
+			name: "sort by field",
+			req: func() *TopNSearch {
+				return NewTopNSearch(20, NewTermQuery("common").SetField("body")).
+					SortBy([]string{"-rank"})
+			},
+		},
+		{
+			name: "match all",
+			req: func() *TopNSearch {
+				return NewTopNSearch(500, NewMatchAllQuery())
+			},
+		},
+		{
+			name: "explain",
+			req: func() *TopNSearch {
+				return NewTopNSearch(20, NewMatchQuery("alpha beta").SetField("body")).
+					ExplainScores()
+			},
+		},
+		{
+			name: "locations",
+			req: func() *TopNSearch {
+				return NewTopNSearch(20, NewMatchQuery("gamma delta").SetField("body")).
+					IncludeLocations()
+			},
+		},
+	}
+
+	search := func(reader *Reader, req *TopNSearch) (search.DocumentMatchCollection, *search.Bucket) {
+		req.WithStandardAggregations()
+		req.AddAggregation("stats", aggregations.Stats(search.Field("rank")))
+		req.AddAggregation("colors", aggregations.NewTermsAggregation(search.Field("color"), 2))
+		dmi, err := reader.Search(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rv search.DocumentMatchCollection
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			rv = append(rv, next)
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv, dmi.Aggregations()
+	}
+
+	for _, test := range tests {
+		expected, expectedAggs := search(serial, test.req())
+		actual, actualAggs := search(parallel, test.req())
+		if len(expected) == 0 {
+			t.Fatalf("%s: expected some matches", test.name)
+		}
+		if len(actual) != len(expected) {
+			t.Fatalf("%s: expected %d matches, got %d", test.name, len(expected), len(actual))
+		}
+		for i := range expected {
+			if actual[i].Number != expected[i].Number ||
+				actual[i].Score != expected[i].Score ||
+				actual[i].HitNumber != expected[i].HitNumber ||
+				!reflect.DeepEqual(actual[i].SortValue, expected[i].SortValue) ||
+				!reflect.DeepEqual(actual[i].Explanation, expected[i].Explanation) ||
+				!reflect.DeepEqual(actual[i].Locations, expected[i].Locations) {
+				t.Errorf("%s: hit %d differs, expected %+v, got %+v", test.name, i, expected[i], actual[i])
+			}
+		}
+		if actualAggs.Count() != expectedAggs.Count() {
+			t.Errorf("%s: expected count %d, got %d", test.name, expectedAggs.Count(), actualAggs.Count())
+		}
+		if actualAggs.Metric("max_score") != expectedAggs.Metric("max_score") {
+			t.Errorf("%s: expected max score %f, got %f", test.name,
+				expectedAggs.Metric("max_score"), actualAggs.Metric("max_score"))
+		}
+		expectedStats := expectedAggs.Aggregation("stats").(*aggregations.StatsCalculator)
+		actualStats := actualAggs.Aggregation("stats").(*aggregations.StatsCalculator)
+		if actualStats.Sum() != expectedStats.Sum() || actualStats.Count() != expectedStats.Count() {
+			t.Errorf("%s: expected stats %+v, got %+v", test.name, expectedStats, actualStats)
+		}
+		for i, bucket := range expectedAggs.Buckets("colors") {
+			actualBucket := actualAggs.Buckets("colors")[i]
+			if actualBucket.Name() != bucket.Name() || actualBucket.Count() != bucket.Count() {
+				t.Errorf("%s: expected color %s %d, got %s %d", test.name,
+					bucket.Name(), bucket.Count(), actualBucket.Name(), actualBucket.Count())
+			}
+		}
+	}
+}
+
+func TestParallelSegmentSearchTimeout(t *testing.T) {
+	serial := buildSegmentedIndex(t, 4, 50)
+	defer func() {
+		_ = serial.Close()
+	}()
+	parallel := &Reader{
+		config: serial.config.WithParallelSegmentSearch(),
+		reader: serial.reader,
+	}
+
+	// each segment takes a quarter of a second to search, but fills
+	// no chunk, the search stops without waiting for any of them
+	q := &slowNextQuery{Query: NewMatchAllQuery(), delay: 5 * time.Millisecond}
+	start := time.Now()
+	_, err := parallel.Search(context.Background(), NewTopNSearch(10, q).WithTimeout(20*time.Millisecond))
+	if !errors.Is(err, ErrSearchTimeout) {
+		t.Errorf("expected ErrSearchTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("expected the search to stop at the timeout, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start = time.Now()
+	_, err = parallel.Search(ctx, NewTopNSearch(10, q))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("expected the search to stop once canceled, took %v", elapsed)
+	}
+}
+
+func BenchmarkParallelSegmentSearch(b *testing.B) {
+	serial := buildSegmentedIndex(b, 8, 5000)
+	defer func() {
+		_ = serial.Close()
+	}()
+	parallel := &Reader{
+		config: serial.config.WithParallelSegmentSearch(),
+		reader: serial.reader,
+	}
+
+	q := NewMatchQuery("alpha beta gamma delta epsilon").SetField("body")
+	for _, test := range []struct {
+		name   string
+		reader *Reader
+	}{
+		{name: "serial", reader: serial},
+		{name: "parallel", reader: parallel},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				dmi, err := test.reader.Search(context.Background(), NewTopNSearch(10, q))
+				if err != nil {
+					b.Fatal(err)
+				}
+				next, err := dmi.Next()
+				for err == nil && next != nil {
+					next, err = dmi.Next()
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRegexpQuery(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	terms := []string{"foobar", "foobazbar", "foo", "bar", "fooba", "xfoobar", "baz", "foo-bar"}
+	for _, term := range terms {
+		doc := NewDocument(term).
+			AddField(NewKeywordField("tag", term))
+		err = writer.Update(doc.ID(), doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	tests := []struct {
+		pattern string
+		ids     []string
+	}{
+		{pattern: "foo.*bar", ids: []string{"foo-bar", "foobar", "foobazbar"}},
+		{pattern: "ba[rz]", ids: []string{"bar", "baz"}},
+		{pattern: "^foo", ids: []string{"foo"}},
+		{pattern: "x?foobar", ids: []string{"foobar", "xfoobar"}},
+		{pattern: "qux.*", ids: nil},
+	}
+	for _, test := range tests {
+		q := NewRegexpQuery(test.pattern).SetField("tag")
+		err = q.Validate()
+		if err != nil {
+			t.Fatalf("%s: unexpected validation error: %v", test.pattern, err)
+		}
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q).SortBy([]string{"_id"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					ids = append(ids, string(value))
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("%s: expected %v, got %v", test.pattern, test.ids, ids)
+		}
+	}
+
+	for _, pattern := range []string{"foo(", `\bfoo`, "fo+?", "foo$bar"} {
+		q := NewRegexpQuery(pattern).SetField("tag")
+		err = q.Validate()
+		if err == nil || !strings.Contains(err.Error(), pattern) {
+			t.Errorf("%s: expected validation error naming the pattern, got %v", pattern, err)
+		}
+		_, err = reader.Search(context.Background(), NewTopNSearch(10, q))
+		if err == nil {
+			t.Errorf("%s: expected search error", pattern)
+		}
+	}
+}
+
+func TestWildcardQuery(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	terms := []string{"market", "marker", "mark", "remark", "mar*", "mar?", "marx", `a\b`, "a.b"}
+	for i, term := range terms {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewKeywordField("tag", term).StoreValue().Sortable())
+		err = writer.Update(doc.ID(), doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	tests := []struct {
+		wildcard string
+		leading  bool
+		terms    []string
+	}{
+		{wildcard: "mar*", terms: []string{"mar*", "mar?", "mark", "marker", "market", "marx"}},
+		{wildcard: "mar?", terms: []string{"mar*", "mar?", "mark", "marx"}},
+		{wildcard: "mark?t", terms: []string{"market"}},
+		{wildcard: "*mark", leading: true, terms: []string{"mark", "remark"}},
+		{wildcard: "?ark*", leading: true, terms: []string{"mark", "marker", "market"}},
+		{wildcard: `mar\*`, terms: []string{"mar*"}},
+		{wildcard: `mar\?`, terms: []string{"mar?"}},
+		{wildcard: `a\\b`, terms: []string{`a\b`}},
+		{wildcard: "a.b", terms: []string{"a.b"}},
+		{wildcard: `mar\`, terms: nil},
+	}
+	for _, test := range tests {
+		q := NewWildcardQuery(test.wildcard).SetField("tag")
+		if q.LeadingWildcard() != test.leading {
+			t.Errorf("%s: expected leading wildcard %t", test.wildcard, test.leading)
+		}
+		err = q.Validate()
+		if err != nil {
+			t.Fatalf("%s: unexpected validation error: %v", test.wildcard, err)
+		}
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q).SortBy([]string{"tag"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var matched []string
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == "tag" {
+					matched = append(matched, string(value))
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(matched, test.terms) {
+			t.Errorf("%s: expected %v, got %v", test.wildcard, test.terms, matched)
+		}
+	}
+}
+
+func TestPhraseQuery(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	texts := []string{
+		"the quick fox jumped",
+		"the quick brown fox jumped",
+		"the quick brown lazy fox jumped",
+		"the fox was quick",
+		"a fox quick as ever",
+	}
+	for i, text := range texts {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewTextField("desc", text).SearchTermPositions())
+		err = writer.Update(doc.ID(), doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	tests := []struct {
+		terms []string
+		slop  int
+		ids   []string
+	}{
+		// exact phrase
+		{terms: []string{"quick", "fox"}, ids: []string{"0"}},
+		{terms: []string{"quick", "brown", "fox"}, ids: []string{"1"}},
+		{terms: []string{"fox", "jumped"}, ids: []string{"0", "1", "2"}},
+		// terms further apart
+		{terms: []string{"quick", "fox"}, slop: 1, ids: []string{"0", "1"}},
+		{terms: []string{"quick", "fox"}, slop: 2, ids: []string{"0", "1", "2", "4"}},
+		// out of order, reversed adjacent terms are 2 away
+		{terms: []string{"fox", "quick"}, ids: []string{"4"}},
+		{terms: []string{"fox", "quick"}, slop: 1, ids: []string{"3", "4"}},
+		{terms: []string{"fox", "quick"}, slop: 2, ids: []string{"0", "3", "4"}},
+		{terms: []string{"fox", "quick"}, slop: 3, ids: []string{"0", "1", "3", "4"}},
+		{terms: []string{"quick", "dog"}, slop: 10, ids: nil},
+	}
+	for _, test := range tests {
+		q := NewPhraseQuery(test.terms).SetField("desc").SetSlop(test.slop)
+		err = q.Validate()
+		if err != nil {
+			t.Fatalf("%v~%d: unexpected validation error: %v", test.terms, test.slop, err)
+		}
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q).SortBy([]string{"_id"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					ids = append(ids, string(value))
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("%v~%d: expected %v, got %v", test.terms, test.slop, test.ids, ids)
+		}
+	}
+
+	for _, q := range []*PhraseQuery{
+		NewPhraseQuery(nil).SetField("desc"),
+		NewPhraseQuery([]string{"quick", "fox"}).SetField("desc").SetSlop(-1),
+	} {
+		if q.Validate() == nil {
+			t.Errorf("%v~%d: expected validation error", q.Terms(), q.Slop())
+		}
+	}
+}
+
+func TestMultiPhraseQuery(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	texts := []string{
+		"the quick fox ran",
+		"the quick wolf ran",
+		"the quick dog ran",
+		"the quick grey wolf ran",
+		"a fox was quick",
+	}
+	for i, text := range texts {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewTextField("desc", text).SearchTermPositions())
+		err = writer.Update(doc.ID(), doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	tests := []struct {
+		terms [][]string
+		slop  int
+		ids   []string
+	}{
+		// either alternative matches at the second position
+		{terms: [][]string{{"quick"}, {"fox", "wolf"}}, ids: []string{"0", "1"}},
+		{terms: [][]string{{"quick"}, {"fox", "wolf"}, {"ran"}}, ids: []string{"0", "1"}},
+		{terms: [][]string{{"quick", "slow"}, {"wolf"}}, ids: []string{"1"}},
+		{terms: [][]string{{"quick"}, {"fox", "wolf"}}, slop: 1, ids: []string{"0", "1", "3"}},
+		{terms: [][]string{{"quick"}, {"cat", "bird"}}, ids: nil},
+	}
+	for _, test := range tests {
+		q := NewMultiPhraseQuery(test.terms).SetField("desc").SetSlop(test.slop)
+		err = q.Validate()
+		if err != nil {
+			t.Fatalf("%v~%d: unexpected validation error: %v", test.terms, test.slop, err)
+		}
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q).SortBy([]string{"_id"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					ids = append(ids, string(value))
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("%v~%d: expected %v, got %v", test.terms, test.slop, test.ids, ids)
+		}
+	}
+
+	q := NewMultiPhraseQuery([][]string{{"quick"}, {"fox"}}).SetSlop(-1)
+	if q.Validate() == nil {
+		t.Errorf("expected validation error for negative slop")
+	}
+}
+
+func TestBoostingQuery(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	texts := []string{
+		"apple apple pie",
+		"apple juice",
+		"apple tart",
+		"pear pie",
+	}
+	for i, text := range texts {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewTextField("desc", text))
+		err = writer.Update(doc.ID(), doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	runSearch := func(q Query) (ids []string, scores map[string]float64) {
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q).ExplainScores())
+		if err != nil {
+			t.Fatal(err)
+		}
+		scores = make(map[string]float64)
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					ids = append(ids, string(value))
+					scores[string(value)] = next.Score
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next.Explanation == nil || next.Explanation.Value != next.Score {
+				t.Errorf("expected explanation of score %f, got %v", next.Score, next.Explanation)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids, scores
+	}
+
+	positive := NewTermQuery("apple").SetField("desc")
+	ids, scores := runSearch(positive)
+	if len(ids) != 3 || ids[0] != "0" {
+		t.Fatalf("expected doc 0 to rank first of 3, got %v", ids)
+	}
+
+	q := NewBoostingQuery(positive, NewTermQuery("pie").SetField("desc"), 0.1)
+	err = q.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	boostedIDs, boostedScores := runSearch(q)
+	if len(boostedIDs) != 3 || boostedIDs[2] != "0" {
+		t.Fatalf("expected doc 0 to be present and rank last of 3, got %v", boostedIDs)
+	}
+	for id, score := range scores {
+		expected := score
+		if id == "0" {
+			expected *= 0.1
+		}
+		if math.Abs(boostedScores[id]-expected) > 1e-9 {
+			t.Errorf("doc %s: expected score %f, got %f", id, expected, boostedScores[id])
+		}
+	}
+
+	// a negative query matching nothing changes nothing
+	_, unchanged := runSearch(NewBoostingQuery(positive, NewTermQuery("plum").SetField("desc"), 0.1))
+	if !reflect.DeepEqual(unchanged, scores) {
+		t.Errorf("expected scores %v, got %v", scores, unchanged)
+	}
+
+	for _, negativeBoost := range []float64{-0.5, 1.5} {
+		if NewBoostingQuery(positive, positive, negativeBoost).Validate() == nil {
+			t.Errorf("expected validation error for negative boost %g", negativeBoost)
+		}
+	}
+}
+
+func TestConstantScoreQuery(t *testing.T) {
+	texts := []string{
+		"apple apple apple pie",
+		"apple juice",
+		"pear pie",
+		"plum tart with a long description of apple",
+		"grape",
+	}
+	for _, config := range []Config{
+		InMemoryOnlyConfig(),
+		InMemoryOnlyConfig().DisableOptimizeConjunction().
+			DisableOptimizeConjunctionUnadorned().DisableOptimizeDisjunctionUnadorned(),
+	} {
+		writer, err := OpenWriter(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, text := range texts {
+			doc := NewDocument(strconv.Itoa(i)).
+				AddField(NewTextField("desc", text))
+			err = writer.Update(doc.ID(), doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		reader, err := writer.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		scores := func(q Query) map[string]float64 {
+			dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q).ExplainScores())
+			if err != nil {
+				t.Fatal(err)
+			}
+			rv := make(map[string]float64)
+			next, err := dmi.Next()
+			for err == nil && next != nil {
+				err = next.VisitStoredFields(func(field string, value []byte) bool {
+					if field == _idField {
+						rv[string(value)] = next.Score
+					}
+					return true
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if next.Explanation == nil || math.Abs(next.Explanation.Value-next.Score) > 1e-9 {
+					t.Errorf("expected explanation of score %f, got %v", next.Score, next.Explanation)
+				}
+				next, err = dmi.Next()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			return rv
+		}
+
+		inner := NewBooleanQuery().
+			AddShould(NewTermQuery("apple").SetField("desc")).
+			AddShould(NewTermQuery("pie").SetField("desc"))
+		got := scores(NewConstantScoreQuery(inner, 2.5))
+		expected := map[string]float64{"0": 2.5, "1": 2.5, "2": 2.5, "3": 2.5}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected scores %v, got %v", expected, got)
+		}
+
+		// the constant adds a flat amount to the other clauses
+		tart := NewTermQuery("tart").SetField("desc")
+		tartScores := scores(tart)
+		got = scores(NewBooleanQuery().
+			AddMust(NewConstantScoreQuery(NewTermQuery("apple").SetField("desc"), 1)).
+			AddShould(tart))
+		if len(got) != 3 {
+			t.Errorf("expected 3 matches, got %v", got)
+		}
+		for id, score := range got {
+			if math.Abs(score-(1+tartScores[id])) > 1e-9 {
+				t.Errorf("doc %s: expected score %f, got %f", id, 1+tartScores[id], score)
+			}
+		}
+
+		_ = reader.Close()
+		_ = writer.Close()
+	}
+
+	if NewConstantScoreQuery(nil, 1).Validate() == nil {
+		t.Errorf("expected validation error without a query")
+	}
+}
+
+func TestFunctionScoreQuery(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	docs := []struct {
+		text string
+		age  float64
+	}{
+		{text: "apple apple apple", age: 30},
+		{text: "apple apple", age: 10},
+		{text: "apple", age: 0},
+	}
+	for i, d := range docs {
+		doc := NewDocument(strconv.Itoa(i)).
+			AddField(NewTextField("desc", d.text)).
+			AddField(NewNumericField("age", d.age).Sortable())
+		err = writer.Update(doc.ID(), doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	ranking := func(q Query) []string {
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q).ExplainScores())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					ids = append(ids, string(value))
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next.Explanation == nil || next.Explanation.Value != next.Score {
+				t.Errorf("expected explanation of score %f, got %v", next.Score, next.Explanation)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+
+	apple := NewTermQuery("apple").SetField("desc")
+	got := ranking(apple)
+	if !reflect.DeepEqual(got, []string{"0", "1", "2"}) {
+		t.Fatalf("expected ranking by term frequency, got %v", got)
+	}
+
+	// halve the score for every 5 days of age
+	recency := func(score float64, values map[string][][]byte) float64 {
+		for _, val := range values["age"] {
+			prefixCoded := numeric.PrefixCoded(val)
+			if shift, err := prefixCoded.Shift(); err == nil && shift == 0 {
+				i64, _ := prefixCoded.Int64()
+				return score * math.Pow(0.5, numeric.Int64ToFloat64(i64)/5)
+			}
+		}
+		return score
+	}
+	q := NewFunctionScoreQuery(apple, recency, []string{"age"})
+	err = q.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = ranking(q)
+	if !reflect.DeepEqual(got, []string{"2", "1", "0"}) {
+		t.Errorf("expected ranking by recency, got %v", got)
+	}
+
+	// the values are loaded separately from those used to sort
+	dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q).SortBy([]string{"-age"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	next, err := dmi.Next()
+	for err == nil && next != nil {
+		err = next.VisitStoredFields(func(field string, value []byte) bool {
+			if field == _idField {
+				ids = append(ids, string(value))
+			}
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		next, err = dmi.Next()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []string{"0", "1", "2"}) {
+		t.Errorf("expected ranking by age, got %v", ids)
+	}
+
+	if NewFunctionScoreQuery(apple, nil, nil).Validate() == nil {
+		t.Errorf("expected validation error without a function")
+	}
+}
+
+func buildDisjunctionIndex(tb testing.TB, config Config, docs, words int) *Reader {
+	writer, err := OpenWriter(config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	batch := NewBatch()
+	for i := 0; i < docs; i++ {
+		var body []string
+		for k := 0; k < 5; k++ {
+			body = append(body, fmt.Sprintf("w%02d", (i*(k+3)+k)%words))
+		}
+		doc := NewDocument(fmt.Sprintf("%05d", i)).
+			AddField(NewTextField("body", strings.Join(body, " ")))
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return reader
+}
+
+func disjunctionQuery(words int) Query {
+	q := NewBooleanQuery()
+	for k := 0; k < words; k++ {
+		q.AddShould(NewTermQuery(fmt.Sprintf("w%02d", k)).SetField("body"))
+	}
+	return q
+}
+
+func TestOptimizeDisjunction(t *testing.T) {
+	results := func(config Config) map[string]float64 {
+		reader := buildDisjunctionIndex(t, config, 500, 50)
+		defer func() {
+			_ = reader.Close()
+		}()
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(500, disjunctionQuery(50)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rv := make(map[string]float64)
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					rv[string(value)] = next.Score
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv
+	}
+
+	on := results(InMemoryOnlyConfig())
+	off := results(InMemoryOnlyConfig().DisableOptimizeDisjunction())
+	if len(on) != 500 || len(off) != 500 {
+		t.Fatalf("expected 500 matches, got %d and %d", len(on), len(off))
+	}
+	for id, score := range on {
+		if math.Abs(off[id]-score) > 1e-9 {
+			t.Errorf("doc %s: expected score %f without the optimization, got %f", id, score, off[id])
+		}
+	}
+}
+
+func BenchmarkOptimizeDisjunction(b *testing.B) {
+	// 50 clauses of vocabularies of 50 and 500 words,
+	// each document having 5 words, so matching about
+	// 5 clauses or 1 clause of the disjunction
+	q := disjunctionQuery(50)
+	for _, words := range []int{50, 500} {
+		for _, test := range []struct {
+			name   string
+			config Config
+		}{
+			{name: "on", config: InMemoryOnlyConfig()},
+			{name: "off", config: InMemoryOnlyConfig().DisableOptimizeDisjunction()},
+		} {
+			reader := buildDisjunctionIndex(b, test.config, 20000, words)
+			b.Run(fmt.Sprintf("words=%d/%s", words, test.name), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q))
+					if err != nil {
+						b.Fatal(err)
+					}
+					next, err := dmi.Next()
+					for err == nil && next != nil {
+						next, err = dmi.Next()
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			_ = reader.Close()
+		}
+	}
+}
+
+func TestBM25Params(t *testing.T) {
+	writer, err := OpenWriter(InMemoryOnlyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	batch := NewBatch()
+	for id, desc := range map[string]string{
+		"once":   "fox jumps over dogs",
+		"thrice": "fox fox fox dogs",
+		"long":   "fox jumps over lazy dogs in the field at dawn",
+		"other":  "cat",
+	} {
+		doc := NewDocument(id).AddField(NewTextField("desc", desc))
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	// the parameters only apply when searching,
+	// so the same reader is searched with each
+	scores := func(config Config) map[string]float64 {
+		reader.config = config
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(10, NewTermQuery("fox").SetField("desc")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rv := make(map[string]float64)
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					rv[string(value)] = next.Score
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv
+	}
+
+	defaults := scores(InMemoryOnlyConfig())
+	if !reflect.DeepEqual(scores(InMemoryOnlyConfig().WithBM25Params(1.2, 0.75)), defaults) {
+		t.Errorf("expected the default parameters to score as before")
+	}
+
+	// a higher k1 gives more weight to the repeated term
+	low := scores(InMemoryOnlyConfig().WithBM25Params(0.5, 0.75))
+	high := scores(InMemoryOnlyConfig().WithBM25Params(3, 0.75))
+	if high["thrice"]/high["once"] <= low["thrice"]/low["once"] {
+		t.Errorf("expected a higher k1 to favor repeated terms, got %v and %v", low, high)
+	}
+
+	// b of 0 ignores the length of the field, 1 penalizes it fully
+	none := scores(InMemoryOnlyConfig().WithBM25Params(1.2, 0))
+	if none["long"] != none["once"] {
+		t.Errorf("expected b of 0 to ignore the length of the field, got %v", none)
+	}
+	full := scores(InMemoryOnlyConfig().WithBM25Params(1.2, 1))
+	if full["long"]/full["once"] >= defaults["long"]/defaults["once"] {
+		t.Errorf("expected b of 1 to penalize the longer field more, got %v and %v", defaults, full)
+	}
+
+	// out of range parameters are clamped
+	if !reflect.DeepEqual(scores(InMemoryOnlyConfig().WithBM25Params(1.2, 2)), full) {
+		t.Errorf("expected b above 1 to be clamped to 1")
+	}
+}
+
+// countingSimilarity counts the norms it computes
+type countingSimilarity struct {
+	similarity.ConstantSimilarity
+	norms *int64
+}
+
+func (c countingSimilarity) ComputeNorm(numTerms int) float32 {
+	atomic.AddInt64(c.norms, 1)
+	return c.ConstantSimilarity.ComputeNorm(numTerms)
+}
+
+func TestWithSimilarity(t *testing.T) {
+	var norms int64
+	config := InMemoryOnlyConfig().WithSimilarity(countingSimilarity{
+		ConstantSimilarity: similarity.ConstantSimilarity(2),
+		norms:              &norms,
+	})
+	writer, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	batch := NewBatch()
+	for id, desc := range map[string]string{
+		"once":   "fox jumps over dogs",
+		"thrice": "fox fox fox dogs",
+		"long":   "fox jumps over lazy dogs in the field at dawn",
+	} {
+		doc := NewDocument(id).AddField(NewTextField("desc", desc))
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&norms) == 0 {
+		t.Errorf("expected the norms to be computed by the similarity")
+	}
+
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	for _, q := range []Query{
+		NewTermQuery("fox").SetField("desc"),
+		NewTermQuery("fox").SetField("desc").SetBoost(3),
+	} {
+		expected := 2 * q.(*TermQuery).Boost()
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var matches int
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			matches++
+			if next.Score != expected {
+				t.Errorf("expected a uniform score of %f, got %f", expected, next.Score)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if matches != 3 {
+			t.Errorf("expected 3 matches, got %d", matches)
+		}
+	}
+}
+
+func TestWithFieldBoost(t *testing.T) {
+	config := InMemoryOnlyConfig().WithFieldBoost("title", 3)
+	writer, err := OpenWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+	batch := NewBatch()
+	for id, field := range map[string]string{"in-title": "title", "in-body": "body"} {
+		doc := NewDocument(id).
+			AddField(NewTextField(field, "gopher conference")).
+			AddField(NewCompositeFieldExcluding("_all", nil))
+		batch.Update(doc.ID(), doc)
+	}
+	err = writer.Batch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := writer.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	scores := func(q Query) map[string]float64 {
+		dmi, err := reader.Search(context.Background(), NewTopNSearch(10, q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rv := make(map[string]float64)
+		next, err := dmi.Next()
+		for err == nil && next != nil {
+			err = next.VisitStoredFields(func(field string, value []byte) bool {
+				if field == _idField {
+					rv[string(value)] = next.Score
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err = dmi.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rv
+	}
+
+	// the same term, in fields of the same length and frequency,
+	// scores three times as high in the boosted field
+	got := scores(NewBooleanQuery().
+		AddShould(NewTermQuery("gopher").SetField("title")).
+		AddShould(NewTermQuery("gopher").SetField("body")))
+	if got["in-title"] <= got["in-body"] {
+		t.Errorf("expected the match in the boosted field to rank higher, got %v", got)
+	}
+	if math.Abs(got["in-title"]-3*got["in-body"]) > 1e-9 {
+		t.Errorf("expected the boosted field to score 3 times as high, got %v", got)
+	}
+
+	// query boosts compose with the field boost
+	boosted := scores(NewTermQuery("gopher").SetField("title").SetBoost(2))
+	if math.Abs(boosted["in-title"]-2*got["in-title"]) > 1e-9 {
+		t.Errorf("expected the query boost to multiply the field boost, got %v and %v", boosted, got)
+	}
+
+	// other fields are unaffected
+	all := scores(NewTermQuery("gopher"))
+	if all["in-title"] != all["in-body"] {
+		t.Errorf("expected matches of the composite field to score the same, got %v", all)
+	}
+}
@@ -85,6 +85,29 @@ func geoLoad(writer *bluge.Writer) error {
 		return err
 	}
 
+	err = writer.Insert(bluge.NewDocument("fiji_bitter_brewery").
+		AddField(bluge.NewKeywordField("name", "Fiji Bitter Brewery")).
+		AddField(bluge.NewGeoPointField("geo", 178.4419, -18.1416)).
+		AddField(bluge.NewCompositeFieldExcluding("_all", []string{"_id"})))
+	if err != nil {
+		return err
+	}
+
+	err = writer.Insert(bluge.NewDocument("samoa_breweries").
+		AddField(bluge.NewKeywordField("name", "Samoa Breweries")).
+		AddField(bluge.NewGeoPointField("geo", -171.7514, -13.8333)).
+		AddField(bluge.NewCompositeFieldExcluding("_all", []string{"_id"})))
+	if err != nil {
+		return err
+	}
+
+	err = writer.Insert(bluge.NewDocument("unknown_location_brewery").
+		AddField(bluge.NewKeywordField("name", "Unknown Location Brewery")).
+		AddField(bluge.NewCompositeFieldExcluding("_all", []string{"_id"})))
+	if err != nil {
+		return err
+	}
+
 	err = writer.Insert(bluge.NewDocument("sweet_water_tavern_and_brewery").
 		AddField(bluge.NewKeywordField("name", "Sweet Water Tavern and Brewery")).
 		AddField(bluge.NewGeoPointField("geo", -77.4097, 39.0324)).
@@ -226,6 +249,43 @@ func geoTests() []*RequestVerify {
 				},
 			},
 		},
+		{
+			Comment: "bounding box crossing the antimeridian",
+			Request: bluge.NewTopNSearch(10,
+				bluge.NewGeoBoundingBoxQuery(170, -10, -170, -20).
+					SetField("geo")).
+				SortBy([]string{"_id"}),
+			Aggregations: standardAggs,
+			ExpectTotal:  2,
+			ExpectMatches: []*match{
+				{
+					Fields: map[string][][]byte{
+						"_id": {[]byte("fiji_bitter_brewery")},
+					},
+				},
+				{
+					Fields: map[string][][]byte{
+						"_id": {[]byte("samoa_breweries")},
+					},
+				},
+			},
+		},
+		{
+			Comment: "bounding box east of the antimeridian only",
+			Request: bluge.NewTopNSearch(10,
+				bluge.NewGeoBoundingBoxQuery(170, -10, 180, -20).
+					SetField("geo")).
+				SortBy([]string{"_id"}),
+			Aggregations: standardAggs,
+			ExpectTotal:  1,
+			ExpectMatches: []*match{
+				{
+					Fields: map[string][][]byte{
+						"_id": {[]byte("fiji_bitter_brewery")},
+					},
+				},
+			},
+		},
 		{
 			Comment: "breweries near the couchbase office, ordered by distance from office",
 			Request: bluge.NewTopNSearch(10,
@@ -0,0 +1,114 @@
+//  Copyright (c) 2020 The Bluge Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 		http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bluge
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/blugelabs/bluge/search"
+)
+
+// ErrVersionConflict is returned by UpdateIfVersion when
+// the document does not have the version expected
+var ErrVersionConflict = errors.New("version conflict")
+
+// _versionField stores the version of a document
+// updated with UpdateIfVersion
+const _versionField = "_version"
+
+// UpdateIfVersion replaces the document with the same id, only if its
+// version is expected, returning the new version of the document,
+// which is always expected+1.  Otherwise the document is left as it
+// was, and the error returned wraps ErrVersionConflict.  Documents
+// which do not exist, or were not written by UpdateIfVersion, have
+// version 0, so an expected version of 0 creates the document, but
+// also replaces one which exists without a version.
+//
+// The version is kept in a stored field added to doc, replacing any
+// from an earlier call, so doc is modified, and a document reused with
+// Update carries the version with it.
+//
+// Versioned updates are applied one at a time, so of several updates
+// racing to replace the same version only one succeeds.  Documents
+// changed by other means, such as Update or Batch, are not checked,
+// Update of a versioned document resets its version to 0.
+func (w *Writer) UpdateIfVersion(doc *Document, expected uint64) (uint64, error) {
+	w.versionLock.Lock()
+	defer w.versionLock.Unlock()
+
+	id := string(doc.ID().Term())
+	reader, err := w.Reader()
+	if err != nil {
+		return 0, err
+	}
+	current, err := reader.DocumentVersion(id)
+	_ = reader.Close()
+	if err != nil {
+		return 0, err
+	}
+	if current != expected {
+		return current, fmt.Errorf("document %s has version %d, expected %d: %w",
+			id, current, expected, ErrVersionConflict)
+	}
+
+	version := expected + 1
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], version)
+	fields := doc.fields[:0]
+	for _, field := range doc.fields {
+		if field.Name() != _versionField {
+			fields = append(fields, field)
+		}
+	}
+	doc.fields = append(fields, NewStoredOnlyField(_versionField, buf[:]))
+
+	err = w.Update(doc.ID(), doc)
+	if err != nil {
+		return current, err
+	}
+	return version, nil
+}
+
+// DocumentVersion returns the version of the document with the id, as
+// set by UpdateIfVersion, or 0 if it does not exist, or has no version
+func (r *Reader) DocumentVersion(id string) (uint64, error) {
+	searcher, err := NewTermQuery(id).SetField(_idField).
+		Searcher(r.reader, searchOptionsFromConfig(r.config, SearchOptions{
+			Score: "none",
+		}))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = searcher.Close()
+	}()
+	searchContext := search.NewSearchContext(searcher.DocumentMatchPoolSize(), 0)
+	match, err := searcher.Next(searchContext)
+	if err != nil || match == nil {
+		return 0, err
+	}
+
+	var version uint64
+	err = r.VisitStoredFields(match.Number, func(field string, value []byte) bool {
+		if field == _versionField && len(value) == 8 {
+			version = binary.BigEndian.Uint64(value)
+			return false
+		}
+		return true
+	})
+	return version, err
+}
@@ -15,16 +15,22 @@
 package bluge
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	segment "github.com/blugelabs/bluge_segment_api"
 
 	"github.com/blugelabs/bluge/index"
+	"github.com/blugelabs/bluge/search"
 )
 
 type Writer struct {
 	config Config
 	chill  *index.Writer
+
+	// serializes the check and update of UpdateIfVersion
+	versionLock sync.Mutex
 }
 
 func OpenWriter(config Config) (*Writer, error) {
@@ -59,10 +65,222 @@ func (w *Writer) Delete(id segment.Term) error {
 	return w.Batch(b)
 }
 
+// Batch applies the batch, it may be called concurrently
+// from several goroutines, as long as each has its own batch.
 func (w *Writer) Batch(batch *index.Batch) error {
 	return w.chill.Batch(batch)
 }
 
+// ExecuteBatch applies all the inserts, updates and deletes
+// recorded in the batch atomically, introducing them in a
+// single snapshot, even when the batch exceeds the size set
+// by WithMaxBatchBytes.  When the batch contains several
+// operations for the same id, the last one recorded wins.
+func (w *Writer) ExecuteBatch(batch *index.Batch) error {
+	return w.chill.ExecuteBatch(batch)
+}
+
+// BatchReader applies the batch, as Batch does, and returns a reader
+// which sees it, so a document just indexed can be searched for at
+// once.  The reader may also see batches applied concurrently.  Each
+// batch is introduced as a segment of its own until merged, so
+// searching after many small batches visits many segments.
+func (w *Writer) BatchReader(batch *index.Batch) (*Reader, error) {
+	err := w.Batch(batch)
+	if err != nil {
+		return nil, err
+	}
+	return w.Reader()
+}
+
+// ForceMerge merges the segments of the index until there are at
+// most maxSegments, so that searches of a read-heavy index need visit
+// fewer segments.  It is expensive, rewriting the documents of the
+// segments merged, which takes time and as much disk space again as
+// those segments.  Cancelling the context stops further merges, but
+// not one already started.
+func (w *Writer) ForceMerge(ctx context.Context, maxSegments int) error {
+	return w.chill.ForceMerge(ctx, maxSegments)
+}
+
+// PauseMerging stops the background merging of segments, such as
+// for the duration of a bulk load, so that indexing need not compete
+// with it.  The segments left unmerged may slow searches, and use
+// more file handles, until ResumeMerging is called.
+func (w *Writer) PauseMerging() {
+	w.chill.PauseMerging()
+}
+
+// ResumeMerging restarts the background merging of segments, which
+// then merges those introduced while it was paused
+func (w *Writer) ResumeMerging() {
+	w.chill.ResumeMerging()
+}
+
+// byQueryBatchSize is the number of changes UpdateByQuery
+// and DeleteByQuery apply in each batch
+var byQueryBatchSize = 1000
+
+// UpdateByQuery passes each document matching the query to fn, and
+// replaces it with the document fn returns, leaving it unchanged if
+// fn returns nil.  The stored fields of the match may be visited to
+// build the new document.  The updates are applied in batches, and
+// the number of documents updated is returned, which on error is the
+// number updated before the error.
+//
+// The documents matched are those of a reader opened when it is called,
+// so documents updated by it are not matched again.  It is best-effort
+// in the face of concurrent writes, a document updated or deleted by
+// another writer after the reader was opened is replaced all the same,
+// by a document built from its stale fields.
+func (w *Writer) UpdateByQuery(ctx context.Context, q Query,
+	fn func(match *search.DocumentMatch) (*Document, error)) (int, error) {
+	reader, err := w.Reader()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	searcher, err := q.Searcher(reader.reader, searchOptionsFromConfig(w.config, SearchOptions{
+		Score: "none",
+	}))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = searcher.Close()
+	}()
+	dvReader, err := reader.reader.DocumentValueReader([]string{_idField})
+	if err != nil {
+		return 0, err
+	}
+	searchContext := search.NewSearchContext(searcher.DocumentMatchPoolSize(), 0)
+
+	var updated int
+	batch := NewBatch()
+	var batched int
+	apply := func() error {
+		err := w.Batch(batch)
+		if err != nil {
+			return err
+		}
+		updated += batched
+		batch.Reset()
+		batched = 0
+		return nil
+	}
+	next, err := searcher.Next(searchContext)
+	for err == nil && next != nil {
+		select {
+		case <-ctx.Done():
+			return updated, ctx.Err()
+		default:
+		}
+		var id []byte
+		err = dvReader.VisitDocumentValues(next.Number, func(field string, term []byte) {
+			if field == _idField {
+				id = append(id[:0], term...)
+			}
+		})
+		if err != nil {
+			return updated, err
+		}
+		if id == nil {
+			return updated, fmt.Errorf("document %d has no %s", next.Number, _idField)
+		}
+		next.SetReader(reader.reader)
+		var doc *Document
+		doc, err = fn(next)
+		if err != nil {
+			return updated, err
+		}
+		if doc != nil {
+			batch.Update(Identifier(id), doc)
+			batched++
+			if batched == byQueryBatchSize {
+				err = apply()
+				if err != nil {
+					return updated, err
+				}
+			}
+		}
+		searchContext.DocumentMatchPool.Put(next)
+		next, err = searcher.Next(searchContext)
+	}
+	if err != nil {
+		return updated, err
+	}
+	if batched > 0 {
+		err = apply()
+		if err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
+
+// DeleteByQuery deletes the documents matching the query, returning
+// the number deleted, which on error is the number deleted before the
+// error.  The matches are streamed from a reader opened when it is
+// called, and deleted in batches, each batch becoming visible to new
+// readers once applied, so a reader opened before it returns may see
+// only some of the documents deleted.
+func (w *Writer) DeleteByQuery(ctx context.Context, q Query) (int, error) {
+	reader, err := w.Reader()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	// canceled to stop the stream, closing its searcher, on error
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ids, err := reader.MatchingIDs(streamCtx, q)
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int
+	batch := NewBatch()
+	var batched int
+	apply := func() error {
+		err := w.Batch(batch)
+		if err != nil {
+			return err
+		}
+		deleted += batched
+		batch.Reset()
+		batched = 0
+		return nil
+	}
+	id, ok, err := ids()
+	for ok {
+		batch.Delete(Identifier(id))
+		batched++
+		if batched == byQueryBatchSize {
+			err = apply()
+			if err != nil {
+				cancel()
+				_, _, _ = ids()
+				return deleted, err
+			}
+		}
+		id, ok, err = ids()
+	}
+	if err != nil {
+		return deleted, err
+	}
+	if batched > 0 {
+		err = apply()
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
 func (w *Writer) Close() error {
 	return w.chill.Close()
 }
@@ -75,6 +293,19 @@ func (w *Writer) DirectoryStats() (numFilesOnDisk, numBytesUsedDisk uint64) {
 	return w.chill.DirectoryStats()
 }
 
+// Reader returns a reader of the index as of the latest batch applied,
+// including batches not yet persisted, so it sees every batch which
+// returned before it was called.  A reader is a view of a snapshot,
+// it never changes, so call Reader again to see later batches.
+// Opening a reader is cheap, it only holds a reference on the current
+// snapshot, but the segments of the snapshot are kept until every
+// reader of it is closed.
+//
+// With unsafe batches, which return before they are persisted, the
+// reader searches the segments still in memory, so documents are
+// searchable as soon as the batch returns, but may be lost should the
+// process exit before they are persisted.  Those segments are held in
+// memory, even once persisted, for as long as a reader refers to them.
 func (w *Writer) Reader() (*Reader, error) {
 	r, err := w.chill.Reader()
 	if err != nil {